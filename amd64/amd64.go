@@ -0,0 +1,655 @@
+package amd64
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"yal/ir"
+)
+
+// Registers of the System V calling convention holding the first int and
+// float args of a call
+var (
+	intArgs   = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+	floatArgs = []string{"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7"}
+)
+
+type genError struct {
+	error
+}
+
+type generator struct {
+	m       *ir.Module
+	w       *strings.Builder
+	strs    map[string]string
+	strList []string
+
+	// State of the fn being generated
+	f      *ir.Func
+	locs   map[ir.Value]location
+	slots  map[*ir.Instr]int
+	saved  map[string]int
+	frame  int
+	next   *ir.Block
+	left   bool
+	stubs  strings.Builder
+	params []string
+}
+
+// Writes the GNU assembler text of a valid module to w, along with the
+// runtime and a _start symbol exiting with what main returns, or 0 when it
+// returns nothing. Values are held in 64 bit registers, floats as their
+// bits, and fns of the module are called following the System V calling
+// convention.
+func Generate(w io.Writer, m *ir.Module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(genError)
+			if !ok {
+				panic(r)
+			}
+			err = e.error
+		}
+	}()
+
+	main := m.Func("main")
+	if main == nil {
+		return fmt.Errorf("no main fn")
+	}
+	if len(main.Params) > 0 {
+		return fmt.Errorf("main takes no params")
+	}
+
+	g := &generator{m: m, w: &strings.Builder{}, strs: map[string]string{}}
+	g.emit("\t.text")
+	for _, f := range m.Funcs {
+		g.genFunc(f)
+	}
+
+	g.emit("\n\t.globl _start\n_start:")
+	g.emit("\tcall %s", symbol("main"))
+	if main.Ret == ir.Void {
+		g.emit("\txorl %%eax, %%eax")
+	}
+	g.emit("\tmovq %%rax, %%rdi\n\tmovl $60, %%eax\n\tsyscall")
+
+	if len(g.strList) > 0 {
+		g.emit("\n\t.section .rodata")
+	}
+	for _, s := range g.strList {
+		g.emit("\t.balign 8\n%s:\n\t.quad %d\n\t.ascii %s", g.strs[s], len(s), quote(s))
+	}
+
+	g.emit("")
+	_, err = io.WriteString(w, g.w.String()+runtime)
+	return err
+}
+
+// Assembles and links the text written by Generate into a static executable
+func Link(ctx context.Context, asm []byte, out string) error {
+	dir, err := os.MkdirTemp("", "yal")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	src, obj := filepath.Join(dir, "main.s"), filepath.Join(dir, "main.o")
+	if err := os.WriteFile(src, asm, 0o644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"as", "--64", "-o", obj, src},
+		{"ld", "-static", "-o", out, obj},
+	} {
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v\n%s", args[0], err, output)
+		}
+	}
+	return nil
+}
+
+func symbol(fn string) string {
+	return "yal." + fn
+}
+
+func (g *generator) emit(format string, args ...any) {
+	fmt.Fprintf(g.w, format+"\n", args...)
+}
+
+// Stops the program when the pointer in rax is null, passing the line and
+// column of i to the runtime in rax and rcx
+func (g *generator) nullCheck(i *ir.Instr) {
+	g.emit("\ttestq %%rax, %%rax\n\tjnz 1f")
+	g.emit("\tmovl $%d, %%eax\n\tmovl $%d, %%ecx\n\tjmp yal_rt_nullderef\n1:", i.Loc.Line, i.Loc.Column)
+}
+
+func (g *generator) label(b *ir.Block) string {
+	return fmt.Sprintf(".L%s.%s", symbol(g.f.Name), b)
+}
+
+func (g *generator) slot() int {
+	g.frame += 8
+	return -g.frame
+}
+
+func (g *generator) genFunc(f *ir.Func) {
+	if f.HasDefers() {
+		panic(genError{fmt.Errorf("fn %s: defer is not supported on amd64", f.Name)})
+	}
+	if f.HasInterfaces() {
+		panic(genError{fmt.Errorf("fn %s: interfaces are not supported on amd64", f.Name)})
+	}
+	if f.HasResults() {
+		panic(genError{fmt.Errorf("fn %s: results and recover are not supported on amd64", f.Name)})
+	}
+	if f.HasClosures() {
+		panic(genError{fmt.Errorf("fn %s: closures are not supported on amd64", f.Name)})
+	}
+	if f.HasTasks() {
+		panic(genError{fmt.Errorf("fn %s: tasks and channels are not supported on amd64", f.Name)})
+	}
+	g.f, g.frame = f, 0
+	g.slots, g.saved = map[*ir.Instr]int{}, map[string]int{}
+	g.locs = linearScan(intervals(f, number(g.m, f)), g.slot)
+
+	for _, r := range calleeSaved {
+		for _, loc := range g.locs {
+			if loc.reg == r {
+				g.saved[r] = g.slot()
+				break
+			}
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == ir.OpAlloca {
+				g.slots[i] = g.slot()
+			}
+		}
+	}
+
+	// Params passed in registers are first stored to the frame since they
+	// may be allocated to the registers of one another
+	g.params = make([]string, len(f.Params))
+	ints, floats, stack := 0, 0, 0
+	homes := []string{}
+	for j, p := range f.Params {
+		switch {
+		case p.Typ == ir.Float && floats < len(floatArgs):
+			g.params[j] = fmt.Sprintf("%d(%%rbp)", g.slot())
+			homes = append(homes, fmt.Sprintf("\tmovq %%%s, %s", floatArgs[floats], g.params[j]))
+			floats++
+		case p.Typ != ir.Float && ints < len(intArgs):
+			g.params[j] = fmt.Sprintf("%d(%%rbp)", g.slot())
+			homes = append(homes, fmt.Sprintf("\tmovq %%%s, %s", intArgs[ints], g.params[j]))
+			ints++
+		default:
+			g.params[j] = fmt.Sprintf("%d(%%rbp)", 16+8*stack)
+			stack++
+		}
+	}
+	if g.frame%16 != 0 {
+		g.frame += 8
+	}
+
+	g.emit("\n\t.globl %s\n%s:", symbol(f.Name), symbol(f.Name))
+	g.emit("\tpushq %%rbp\n\tmovq %%rsp, %%rbp")
+	if g.frame > 0 {
+		g.emit("\tsubq $%d, %%rsp", g.frame)
+	}
+	for _, r := range calleeSaved {
+		if off, ok := g.saved[r]; ok {
+			g.emit("\tmovq %%%s, %d(%%rbp)", r, off)
+		}
+	}
+	for _, home := range homes {
+		g.emit("%s", home)
+	}
+	for j, p := range f.Params {
+		if loc, ok := g.locs[p]; ok {
+			g.emit("\tmovq %s, %%rax", g.params[j])
+			g.emit("\tmovq %%rax, %s", loc)
+		}
+	}
+
+	g.stubs.Reset()
+	for k, b := range f.Blocks {
+		g.next = nil
+		if k+1 < len(f.Blocks) {
+			g.next = f.Blocks[k+1]
+		}
+		g.emit("%s:", g.label(b))
+		// The ret following a tail call is never reached once the frame
+		// has been left
+		g.left = false
+		for _, i := range b.Instrs {
+			if i.Op != ir.OpPhi && !g.left {
+				g.genInstr(i)
+			}
+		}
+	}
+	g.w.WriteString(g.stubs.String())
+}
+
+func (l location) String() string {
+	if l.reg != "" {
+		return "%" + l.reg
+	}
+	return fmt.Sprintf("%d(%%rbp)", l.offset)
+}
+
+// Puts v in reg
+func (g *generator) load(v ir.Value, reg string) {
+	switch v := v.(type) {
+	case *ir.Const:
+		g.loadConst(v, reg)
+	case *ir.Instr:
+		if v.Op == ir.OpAlloca {
+			g.emit("\tleaq %d(%%rbp), %%%s", g.slots[v], reg)
+			return
+		}
+	}
+	if loc, ok := g.locs[v]; ok && loc.reg != reg {
+		g.emit("\tmovq %s, %%%s", loc, reg)
+	}
+}
+
+func (g *generator) loadConst(c *ir.Const, reg string) {
+	switch n := constBits(c); {
+	case c.Typ == ir.String:
+		g.emit("\tleaq %s(%%rip), %%%s", g.str(c.Str), reg)
+	case n == 0:
+		g.emit("\txorl %%%s, %%%s", reg32(reg), reg32(reg))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		g.emit("\tmovq $%d, %%%s", n, reg)
+	default:
+		g.emit("\tmovabsq $%d, %%%s", n, reg)
+	}
+}
+
+// Returns the bits of a constant that isn't a string
+func constBits(c *ir.Const) int64 {
+	if c.Typ == ir.Float {
+		return int64(math.Float64bits(c.Float))
+	}
+	return c.Int
+}
+
+// Returns the name of the low 32 bits of a scratch register
+func reg32(reg string) string {
+	return "e" + reg[1:]
+}
+
+// Stores rax to the location of v
+func (g *generator) store(v ir.Value) {
+	if loc, ok := g.locs[v]; ok {
+		g.emit("\tmovq %%rax, %s", loc)
+	}
+}
+
+// Returns the label of the string constant s
+func (g *generator) str(s string) string {
+	l, ok := g.strs[s]
+	if !ok {
+		l = fmt.Sprintf(".Lstr%d", len(g.strList))
+		g.strs[s] = l
+		g.strList = append(g.strList, s)
+	}
+	return l
+}
+
+func (g *generator) push(v ir.Value) {
+	switch v := v.(type) {
+	case *ir.Const:
+		if n := constBits(v); v.Typ != ir.String && n >= math.MinInt32 && n <= math.MaxInt32 {
+			g.emit("\tpushq $%d", n)
+			return
+		}
+	case *ir.Param:
+		g.emit("\tpushq %s", g.locs[v])
+		return
+	case *ir.Instr:
+		if v.Op != ir.OpAlloca {
+			g.emit("\tpushq %s", g.locs[v])
+			return
+		}
+	}
+	g.load(v, "rax")
+	g.emit("\tpushq %%rax")
+}
+
+// Copies the values of the phis of b coming from pred at once, returning
+// whether there was any to copy
+func (g *generator) copyPhis(pred *ir.Block, b *ir.Block) bool {
+	at := b.PredIndex(pred)
+	phis := []*ir.Instr{}
+	for _, phi := range b.Phis() {
+		if loc, ok := g.locs[phi.Args[at]]; !ok || loc != g.locs[phi] {
+			phis = append(phis, phi)
+		}
+	}
+
+	// Pushing all of them before popping them to the phis keeps the values
+	// of the phis that are args of other ones
+	for _, phi := range phis {
+		g.push(phi.Args[at])
+	}
+	for j := len(phis) - 1; j >= 0; j-- {
+		g.emit("\tpopq %s", g.locs[phis[j]])
+	}
+	return len(phis) > 0
+}
+
+// Jumps from b to its successor s, unless s is the next block
+func (g *generator) jump(b *ir.Block, s *ir.Block) {
+	g.copyPhis(b, s)
+	if s != g.next {
+		g.emit("\tjmp %s", g.label(s))
+	}
+}
+
+// Returns the label to branch to from b to s: the one of s, or the one of a
+// stub copying the values of the phis of s when there are any
+func (g *generator) edge(b *ir.Block, s *ir.Block) string {
+	w := g.w
+	g.w = &strings.Builder{}
+	copied := g.copyPhis(b, s)
+	moves := g.w.String()
+	g.w = w
+	if !copied {
+		return g.label(s)
+	}
+
+	stub := fmt.Sprintf("%s.to.%s", g.label(b), s)
+	fmt.Fprintf(&g.stubs, "%s:\n%s\tjmp %s\n", stub, moves, g.label(s))
+	return stub
+}
+
+// Restores the callee saved registers and the frame of the caller
+func (g *generator) leave() {
+	for _, r := range calleeSaved {
+		if off, ok := g.saved[r]; ok {
+			g.emit("\tmovq %d(%%rbp), %%%s", off, r)
+		}
+	}
+	g.emit("\tleave")
+}
+
+var (
+	intOps = map[ir.Op]string{
+		ir.OpAdd: "addq", ir.OpSub: "subq", ir.OpMul: "imulq",
+		ir.OpAnd: "andq", ir.OpOr: "orq", ir.OpXor: "xorq",
+	}
+	floatOps = map[ir.Op]string{
+		ir.OpAdd: "addsd", ir.OpSub: "subsd", ir.OpMul: "mulsd", ir.OpDiv: "divsd",
+	}
+	signedConds   = map[ir.Op]string{ir.OpEq: "e", ir.OpNe: "ne", ir.OpLt: "l", ir.OpLe: "le", ir.OpGt: "g", ir.OpGe: "ge"}
+	unsignedConds = map[ir.Op]string{ir.OpEq: "e", ir.OpNe: "ne", ir.OpLt: "b", ir.OpLe: "be", ir.OpGt: "a", ir.OpGe: "ae"}
+)
+
+func (g *generator) genInstr(i *ir.Instr) {
+	switch {
+	case i.Op.IsBinary():
+		g.load(i.Args[0], "rax")
+		g.load(i.Args[1], "rcx")
+		g.genBinary(i)
+		if i.Typ == ir.Char {
+			g.emit("\tmovzbl %%al, %%eax")
+		}
+		g.store(i)
+	case i.Op == ir.OpNot:
+		g.load(i.Args[0], "rax")
+		g.emit("\txorq $1, %%rax")
+		g.store(i)
+	case i.Op == ir.OpNeg:
+		g.load(i.Args[0], "rax")
+		switch i.Typ {
+		case ir.Float:
+			g.emit("\tbtcq $63, %%rax")
+		case ir.Char:
+			g.emit("\tnegq %%rax\n\tmovzbl %%al, %%eax")
+		default:
+			g.emit("\tnegq %%rax")
+		}
+		g.store(i)
+	case i.Op.IsCompare():
+		g.load(i.Args[0], "rax")
+		g.load(i.Args[1], "rcx")
+		g.genCompare(i)
+		g.store(i)
+	case i.Op == ir.OpAlloca:
+	case i.Op == ir.OpLoad:
+		g.load(i.Args[0], "rax")
+		g.nullCheck(i)
+		g.emit("\tmovq (%%rax), %%rax")
+		g.store(i)
+	case i.Op == ir.OpStore:
+		g.load(i.Args[0], "rax")
+		g.load(i.Args[1], "rcx")
+		g.nullCheck(i)
+		g.emit("\tmovq %%rcx, (%%rax)")
+	case i.Op == ir.OpCall:
+		g.genCall(i)
+	case i.Op == ir.OpJump:
+		g.jump(i.Block, i.Block.Succs[0])
+	case i.Op == ir.OpBranch:
+		then, els := i.Block.Succs[0], i.Block.Succs[1]
+		g.load(i.Args[0], "rax")
+		g.emit("\ttestq %%rax, %%rax")
+		g.emit("\tjnz %s", g.edge(i.Block, then))
+		if target := g.edge(i.Block, els); target != g.label(els) || els != g.next {
+			g.emit("\tjmp %s", target)
+		}
+	case i.Op == ir.OpRet:
+		if len(i.Args) > 0 {
+			g.load(i.Args[0], "rax")
+			if i.Args[0].Type() == ir.Float {
+				g.emit("\tmovq %%rax, %%xmm0")
+			}
+		}
+		g.leave()
+		g.emit("\tret")
+	case i.Op == ir.OpUnreachable:
+		g.emit("\tjmp yal_rt_unreachable")
+	}
+}
+
+// Computes binary i of rax and rcx in rax
+func (g *generator) genBinary(i *ir.Instr) {
+	if i.Typ == ir.Float {
+		g.emit("\tmovq %%rax, %%xmm0\n\tmovq %%rcx, %%xmm1")
+		g.emit("\t%s %%xmm1, %%xmm0", floatOps[i.Op])
+		g.emit("\tmovq %%xmm0, %%rax")
+		return
+	}
+
+	switch i.Op {
+	case ir.OpDiv, ir.OpRem:
+		g.emit("\ttestq %%rcx, %%rcx\n\tjz yal_rt_divzero")
+		if !i.Typ.IsSigned() {
+			g.emit("\txorl %%edx, %%edx\n\tdivq %%rcx")
+		} else {
+			// idiv faults when the quotient overflows, dividing by -1 is
+			// done by negating instead
+			g.emit("\tcmpq $-1, %%rcx\n\tjne 1f")
+			if i.Op == ir.OpDiv {
+				g.emit("\tnegq %%rax")
+			} else {
+				g.emit("\txorl %%edx, %%edx")
+			}
+			g.emit("\tjmp 2f\n1:\n\tcqto\n\tidivq %%rcx\n2:")
+		}
+		if i.Op == ir.OpRem {
+			g.emit("\tmovq %%rdx, %%rax")
+		}
+	case ir.OpShl, ir.OpShr:
+		// Shifts only use the low 6 bits of their count, shifting by 64
+		// or more gives what shifting by 63 twice would
+		switch {
+		case i.Op == ir.OpShl:
+			g.emit("\txorl %%edx, %%edx\n\tshlq %%cl, %%rax")
+		case i.Typ.IsSigned():
+			g.emit("\tmovq %%rax, %%rdx\n\tsarq $63, %%rdx\n\tsarq %%cl, %%rax")
+		default:
+			g.emit("\txorl %%edx, %%edx\n\tshrq %%cl, %%rax")
+		}
+		g.emit("\tcmpq $63, %%rcx\n\tcmova %%rdx, %%rax")
+	default:
+		g.emit("\t%s %%rcx, %%rax", intOps[i.Op])
+	}
+}
+
+// Computes comparison i of rax and rcx in rax
+func (g *generator) genCompare(i *ir.Instr) {
+	t := i.Args[0].Type()
+	switch {
+	case t == ir.String:
+		g.emit("\tcall yal_rt_streq")
+		if i.Op == ir.OpNe {
+			g.emit("\txorq $1, %%rax")
+		}
+		return
+	case t == ir.Float:
+		// Comparisons with NaN are unordered, setting the parity flag
+		g.emit("\tmovq %%rax, %%xmm0\n\tmovq %%rcx, %%xmm1")
+		switch i.Op {
+		case ir.OpEq:
+			g.emit("\tucomisd %%xmm1, %%xmm0\n\tsete %%al\n\tsetnp %%cl\n\tandb %%cl, %%al")
+		case ir.OpNe:
+			g.emit("\tucomisd %%xmm1, %%xmm0\n\tsetne %%al\n\tsetp %%cl\n\torb %%cl, %%al")
+		case ir.OpLt:
+			g.emit("\tucomisd %%xmm0, %%xmm1\n\tseta %%al")
+		case ir.OpLe:
+			g.emit("\tucomisd %%xmm0, %%xmm1\n\tsetae %%al")
+		case ir.OpGt:
+			g.emit("\tucomisd %%xmm1, %%xmm0\n\tseta %%al")
+		default:
+			g.emit("\tucomisd %%xmm1, %%xmm0\n\tsetae %%al")
+		}
+	case t.IsSigned():
+		g.emit("\tcmpq %%rcx, %%rax\n\tset%s %%al", signedConds[i.Op])
+	default:
+		g.emit("\tcmpq %%rcx, %%rax\n\tset%s %%al", unsignedConds[i.Op])
+	}
+	g.emit("\tmovzbl %%al, %%eax")
+}
+
+func (g *generator) genCall(i *ir.Instr) {
+	callee := g.m.Func(i.Callee)
+	if callee == nil {
+		g.genBuiltin(i)
+		return
+	}
+
+	type arg struct {
+		v   ir.Value
+		reg string
+	}
+	regs, stack := []arg{}, []ir.Value{}
+	ints, floats := 0, 0
+	for _, v := range i.Args {
+		switch {
+		case v.Type() == ir.Float && floats < len(floatArgs):
+			regs = append(regs, arg{v, floatArgs[floats]})
+			floats++
+		case v.Type() != ir.Float && ints < len(intArgs):
+			regs = append(regs, arg{v, intArgs[ints]})
+			ints++
+		default:
+			stack = append(stack, v)
+		}
+	}
+
+	// The frame of the caller can only be replaced when the callee takes
+	// all of its args in registers
+	tail := i.Tail && len(stack) == 0
+	pad := len(stack) % 2
+	if pad > 0 {
+		g.emit("\tsubq $8, %%rsp")
+	}
+	for j := len(stack) - 1; j >= 0; j-- {
+		g.push(stack[j])
+	}
+	for j := len(regs) - 1; j >= 0; j-- {
+		g.push(regs[j].v)
+	}
+	for _, a := range regs {
+		if strings.HasPrefix(a.reg, "xmm") {
+			g.emit("\tpopq %%rax\n\tmovq %%rax, %%%s", a.reg)
+		} else {
+			g.emit("\tpopq %%%s", a.reg)
+		}
+	}
+
+	if tail {
+		g.leave()
+		g.emit("\tjmp %s", symbol(callee.Name))
+		g.left = true
+		return
+	}
+	g.emit("\tcall %s", symbol(callee.Name))
+	if n := len(stack) + pad; n > 0 {
+		g.emit("\taddq $%d, %%rsp", 8*n)
+	}
+	if i.Typ == ir.Float {
+		g.emit("\tmovq %%xmm0, %%rax")
+	}
+	g.store(i)
+}
+
+// Prints the args of a call to print or panic with the routines of the
+// runtime
+func (g *generator) genBuiltin(i *ir.Instr) {
+	if i.Callee == "panic" {
+		g.emit("\tcall yal_rt_panic")
+	}
+	for j, arg := range i.Args {
+		if j > 0 {
+			g.emit("\tcall yal_rt_print_space")
+		}
+		g.load(arg, "rax")
+
+		t := arg.Type()
+		switch {
+		case t == ir.Float:
+			panic(genError{fmt.Errorf("fn %s: printing floats is not supported on amd64", g.f.Name)})
+		case t.IsPointer():
+			g.emit("\tcall yal_rt_print_ptr")
+		case t == ir.Uint || t == ir.Char || t == ir.Bool || t == ir.String:
+			g.emit("\tcall yal_rt_print_%s", t)
+		default:
+			g.emit("\tcall yal_rt_print_int")
+		}
+	}
+	if i.Callee == "panic" {
+		g.emit("\tjmp yal_rt_die")
+	} else {
+		g.emit("\tcall yal_rt_print_newline")
+	}
+}
+
+// Quotes s for the .ascii directive, which reads octal escapes as C does,
+// up to three digits
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
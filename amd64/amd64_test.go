@@ -0,0 +1,198 @@
+package amd64_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yal/amd64"
+	"yal/internal/backendtest"
+	"yal/ir"
+)
+
+// Builds src optimized at level and runs it, returning what it writes to
+// stdout and stderr and its exit code
+func run(t *testing.T, src string, level int) (string, string, int) {
+	return runModule(t, backendtest.Lower(t, src, level))
+}
+
+func runModule(t *testing.T, m *ir.Module) (string, string, int) {
+	for _, tool := range []string{"as", "ld"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to link programs", tool)
+		}
+	}
+
+	var asm strings.Builder
+	if err := amd64.Generate(&asm, m); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "main")
+	if err := amd64.Link(context.Background(), []byte(asm.String()), out); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr strings.Builder
+	cmd := exec.Command(out)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestRun(t *testing.T) {
+	backendtest.RunPrograms(t, 2, run)
+
+	t.Run("Test many args", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, `fn mix(a: int, x: float, b: int, c: int, d: int, e: int, f: int, g: int, h: int, y: float) : float {
+  if (x * y > 0.5) { return x * y; }
+  return 0.0;
+}
+
+fn sum(a: int, b: int, c: int, d: int, e: int, f: int, g: int, h: int) : int {
+  return a - b + c - d + e - f + g * h;
+}
+
+fn main() : int {
+  print(mix(1, 2.0, 3, 4, 5, 6, 7, 8, 9, 0.5) == 1.0, sum(1, 2, 3, 4, 5, 6, 7, 8));
+  return sum(8, 7, 6, 5, 4, 3, 2, 1);
+}`, 2, run)
+	})
+
+	t.Run("Test register pressure", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, `fn id(n: int) : int { return n; }
+
+fn main() : int {
+  let a = id(1); let b = id(2); let c = id(3); let d = id(4);
+  let e = id(5); let f = id(6); let g = id(7); let h = id(8);
+  let i = id(9); let j = id(10); let k = id(11); let l = id(12);
+  let s = 0;
+  for (let n = 0; n < 3; ++n) {
+    s = s + a * b - c + d * e - f + g * h - i + j * k - l;
+    let t = a; a = b; b = c; c = d; d = e; e = f; f = g; g = h; h = i; i = j; j = k; k = l; l = t;
+  }
+  print(s, a, l);
+  return s % 256;
+}`, 2, run)
+	})
+}
+
+// Tail calls deeper than the stack could hold calls
+func TestTailCalls(t *testing.T) {
+	src := `fn even(n: int) : bool {
+  if (n == 0) { return true; }
+  return odd(n - 1);
+}
+
+fn odd(n: int) : bool {
+  if (n == 0) { return false; }
+  return even(n - 1);
+}
+
+fn main() : void {
+  print(even(10000001));
+}`
+
+	for level := 1; level <= 2; level++ {
+		out, _, code := run(t, src, level)
+		if out != "false\n" || code != 0 {
+			t.Errorf("expected %q and exit code 0 at -O%d, got %q and %d\n", "false\n", level, out, code)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":            `fn main() : void { print(1); panic("oops", 2); }`,
+		"Test division by zero": `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test null pointer":     `fn get(p: *int) : int { *p } fn main() : int { let p: *int = NULL; get(p) }`,
+	}
+	msgs := map[string]string{
+		"Test panic":            "panic: oops 2\n",
+		"Test division by zero": "division by zero\n",
+		"Test null pointer":     "line 1 column 25: null pointer dereference\n",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			for level := 0; level <= 2; level++ {
+				_, stderr, code := run(t, src, level)
+				if stderr != msgs[name] || code != 1 {
+					t.Errorf("expected %q and exit code 1 at -O%d, got %q and %d\n", msgs[name], level, stderr, code)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Test printing floats", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, `fn main() : void { print(1.5); }`, 0))
+		if err == nil || err.Error() != "fn main: printing floats is not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test closures", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, `fn main() : int { let n = 1; let f = () : int => n; f() }`, 0))
+		if err == nil || err.Error() != "fn main: closures are not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test interfaces", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, backendtest.Interfaces, 0))
+		if err == nil || err.Error() != "fn total: interfaces are not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test results", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, backendtest.Results, 0))
+		if err == nil || err.Error() != "fn checked: results and recover are not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test defer", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, `fn main() : void { defer print(1); }`, 0))
+		if err == nil || err.Error() != "fn main: defer is not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test channels", func(t *testing.T) {
+		err := amd64.Generate(&strings.Builder{}, backendtest.Lower(t, `fn main() : int { let ch = chan<int>(1); ch <- 1; <- ch }`, 0))
+		if err == nil || err.Error() != "fn main: tasks and channels are not supported on amd64" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test swapping phis", func(t *testing.T) {
+		m, err := ir.Parse(`fn main(): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [1, b0], [%1, b1]
+  %1 = phi int [2, b0], [%0, b1]
+  %2 = phi int [1, b0], [%3, b1]
+  %3 = add int %2, 1
+  %4 = lt int %3, 5
+  br %4, b1, b2
+b2:
+  %5 = sub int %0, %1
+  ret int %5
+}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, code := runModule(t, m); code != 1 {
+			t.Errorf("expected exit code 1, got %d\n", code)
+		}
+	})
+}
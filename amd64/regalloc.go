@@ -0,0 +1,263 @@
+package amd64
+
+import (
+	"sort"
+	"yal/ir"
+)
+
+// Registers values are allocated to. rax, rcx, rdx and r11 are left as
+// scratch registers for the code of each instruction, rsp and rbp hold the
+// frame.
+var (
+	callerSaved = []string{"rsi", "rdi", "r8", "r9", "r10"}
+	calleeSaved = []string{"rbx", "r12", "r13", "r14", "r15"}
+)
+
+// Where a value lives for its whole lifetime: a register, or a stack slot
+// at an offset from rbp when it is spilled
+type location struct {
+	reg    string
+	offset int
+}
+
+type interval struct {
+	value ir.Value
+	start int
+	end   int
+	// Whether a call happens while the value is live, in which case it
+	// must be kept in a callee saved register
+	crossesCall bool
+}
+
+// Numbering of the instructions of a fn, blocks in the order they are
+// emitted. Instructions are two positions apart, the phis of a block
+// sharing the position of its start. calls holds the positions of the calls
+// to fns of the module, the runtime keeping every allocated register.
+type numbering struct {
+	pos   map[*ir.Instr]int
+	start map[*ir.Block]int
+	end   map[*ir.Block]int
+	calls []int
+}
+
+func number(m *ir.Module, f *ir.Func) *numbering {
+	n := &numbering{
+		pos:   map[*ir.Instr]int{},
+		start: map[*ir.Block]int{},
+		end:   map[*ir.Block]int{},
+	}
+	p := 0
+	for _, b := range f.Blocks {
+		n.start[b] = p
+		for _, i := range b.Instrs {
+			if i.Op != ir.OpPhi {
+				p += 2
+			}
+			n.pos[i] = p
+			if i.Op == ir.OpCall && m.Func(i.Callee) != nil {
+				n.calls = append(n.calls, p)
+			}
+		}
+		n.end[b] = p
+		p += 2
+	}
+	return n
+}
+
+// Returns the values live at the start of each block
+func liveness(f *ir.Func) map[*ir.Block]map[ir.Value]bool {
+	liveIn := map[*ir.Block]map[ir.Value]bool{}
+	for _, b := range f.Blocks {
+		liveIn[b] = map[ir.Value]bool{}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for k := len(f.Blocks) - 1; k >= 0; k-- {
+			b := f.Blocks[k]
+			live := liveOut(b, liveIn)
+			for j := len(b.Instrs) - 1; j >= 0; j-- {
+				i := b.Instrs[j]
+				delete(live, i)
+				if i.Op == ir.OpPhi {
+					continue
+				}
+				for _, arg := range i.Args {
+					if isVar(arg) {
+						live[arg] = true
+					}
+				}
+			}
+			for v := range live {
+				if !liveIn[b][v] {
+					liveIn[b][v] = true
+					changed = true
+				}
+			}
+		}
+	}
+	return liveIn
+}
+
+// Returns the values live at the end of b: the ones live at the start of
+// its successors but defined by their phis, and the phi args coming from b
+func liveOut(b *ir.Block, liveIn map[*ir.Block]map[ir.Value]bool) map[ir.Value]bool {
+	live := map[ir.Value]bool{}
+	for _, s := range b.Succs {
+		for v := range liveIn[s] {
+			if i, ok := v.(*ir.Instr); !ok || i.Op != ir.OpPhi || i.Block != s {
+				live[v] = true
+			}
+		}
+		at := s.PredIndex(b)
+		for _, phi := range s.Phis() {
+			if isVar(phi.Args[at]) {
+				live[phi.Args[at]] = true
+			}
+		}
+	}
+	return live
+}
+
+// Returns whether v needs a location: params and the instructions with a
+// value, apart from stack slots whose address is known from the frame
+func isVar(v ir.Value) bool {
+	switch v := v.(type) {
+	case *ir.Param:
+		return true
+	case *ir.Instr:
+		return v.Typ != ir.Void && v.Op != ir.OpAlloca
+	}
+	return false
+}
+
+// Returns an interval for each value of f, spanning from its first to its
+// last live position, sorted by start
+func intervals(f *ir.Func, n *numbering) []*interval {
+	byValue := map[ir.Value]*interval{}
+	order := []*interval{}
+	extend := func(v ir.Value, p int) {
+		if !isVar(v) {
+			return
+		}
+		iv := byValue[v]
+		if iv == nil {
+			iv = &interval{value: v, start: p, end: p}
+			byValue[v] = iv
+			order = append(order, iv)
+		}
+		if p < iv.start {
+			iv.start = p
+		}
+		if p > iv.end {
+			iv.end = p
+		}
+	}
+
+	for _, p := range f.Params {
+		extend(p, 0)
+	}
+	liveIn := liveness(f)
+	for _, b := range f.Blocks {
+		for v := range liveIn[b] {
+			extend(v, n.start[b])
+		}
+		for v := range liveOut(b, liveIn) {
+			extend(v, n.end[b])
+		}
+		for _, i := range b.Instrs {
+			extend(i, n.pos[i])
+			if i.Op == ir.OpPhi {
+				continue
+			}
+			for _, arg := range i.Args {
+				extend(arg, n.pos[i])
+			}
+		}
+	}
+
+	for _, iv := range order {
+		for _, c := range n.calls {
+			if iv.start < c && c < iv.end {
+				iv.crossesCall = true
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].start < order[j].start
+	})
+	return order
+}
+
+// Allocates registers to the intervals by linear scan, spilling the
+// interval ending last when none is free. spill returns the stack slot of a
+// spilled value.
+func linearScan(ivs []*interval, spill func() int) map[ir.Value]location {
+	locs := map[ir.Value]location{}
+	free := map[string]bool{}
+	for _, r := range append(append([]string{}, callerSaved...), calleeSaved...) {
+		free[r] = true
+	}
+	active := []*interval{}
+
+	for _, iv := range ivs {
+		kept := active[:0]
+		for _, a := range active {
+			if a.end < iv.start {
+				free[locs[a.value].reg] = true
+			} else {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		allowed := calleeSaved
+		if !iv.crossesCall {
+			allowed = append(append([]string{}, callerSaved...), calleeSaved...)
+		}
+		reg := ""
+		for _, r := range allowed {
+			if free[r] {
+				reg = r
+				break
+			}
+		}
+
+		if reg == "" {
+			// Takes the register of the active interval ending last if it
+			// ends after this one
+			var victim *interval
+			for _, a := range active {
+				if contains(allowed, locs[a.value].reg) && (victim == nil || a.end > victim.end) {
+					victim = a
+				}
+			}
+			if victim == nil || victim.end <= iv.end {
+				locs[iv.value] = location{offset: spill()}
+				continue
+			}
+			reg = locs[victim.value].reg
+			locs[victim.value] = location{offset: spill()}
+			for k, a := range active {
+				if a == victim {
+					active = append(active[:k], active[k+1:]...)
+					break
+				}
+			}
+		}
+
+		free[reg] = false
+		locs[iv.value] = location{reg: reg}
+		active = append(active, iv)
+	}
+	return locs
+}
+
+func contains(regs []string, reg string) bool {
+	for _, r := range regs {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
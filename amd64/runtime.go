@@ -0,0 +1,209 @@
+package amd64
+
+// Runtime linked into every program, written against the Linux syscalls so
+// that no libc is needed. Its routines take their operands in rax and rcx
+// and only clobber rax, rcx, rdx and r11, the registers no value is
+// allocated to, so that calling them doesn't spill anything.
+const runtime = `	.data
+	.balign 8
+# File descriptor the print routines write to, stderr once panicking
+yal_rt_fd:
+	.quad 1
+
+	.section .rodata
+	.balign 8
+yal_rt_true:
+	.quad 4
+	.ascii "true"
+	.balign 8
+yal_rt_false:
+	.quad 5
+	.ascii "false"
+	.balign 8
+yal_rt_null:
+	.quad 4
+	.ascii "null"
+	.balign 8
+yal_rt_ptr:
+	.quad 3
+	.ascii "ptr"
+	.balign 8
+yal_rt_panic_msg:
+	.quad 7
+	.ascii "panic: "
+	.balign 8
+yal_rt_divzero_msg:
+	.quad 16
+	.ascii "division by zero"
+	.balign 8
+yal_rt_line_msg:
+	.quad 5
+	.ascii "line "
+	.balign 8
+yal_rt_column_msg:
+	.quad 8
+	.ascii " column "
+	.balign 8
+yal_rt_position_end:
+	.quad 2
+	.ascii ": "
+	.balign 8
+yal_rt_nullderef_msg:
+	.quad 24
+	.ascii "null pointer dereference"
+	.balign 8
+yal_rt_unreachable_msg:
+	.quad 24
+	.ascii "unreachable code reached"
+
+	.text
+# Writes the rdx bytes at rax
+yal_rt_write:
+	pushq %rdi
+	pushq %rsi
+	movq %rax, %rsi
+	movq yal_rt_fd(%rip), %rdi
+	movl $1, %eax
+	syscall
+	popq %rsi
+	popq %rdi
+	ret
+
+# Strings point to their length followed by their bytes
+yal_rt_print_string:
+	movq (%rax), %rdx
+	addq $8, %rax
+	jmp yal_rt_write
+
+yal_rt_print_char:
+	pushq %rax
+	movq %rsp, %rax
+	movl $1, %edx
+	call yal_rt_write
+	popq %rax
+	ret
+
+yal_rt_print_space:
+	movl $32, %eax
+	jmp yal_rt_print_char
+
+yal_rt_print_newline:
+	movl $10, %eax
+	jmp yal_rt_print_char
+
+yal_rt_print_uint:
+	pushq %rsi
+	subq $32, %rsp
+	leaq 32(%rsp), %rsi
+	movl $10, %ecx
+1:
+	xorl %edx, %edx
+	divq %rcx
+	addl $48, %edx
+	decq %rsi
+	movb %dl, (%rsi)
+	testq %rax, %rax
+	jnz 1b
+	movq %rsi, %rax
+	leaq 32(%rsp), %rdx
+	subq %rsi, %rdx
+	call yal_rt_write
+	addq $32, %rsp
+	popq %rsi
+	ret
+
+yal_rt_print_int:
+	testq %rax, %rax
+	jns yal_rt_print_uint
+	pushq %rax
+	movl $45, %eax
+	call yal_rt_print_char
+	popq %rax
+	negq %rax
+	jmp yal_rt_print_uint
+
+yal_rt_print_bool:
+	testq %rax, %rax
+	leaq yal_rt_true(%rip), %rax
+	jnz yal_rt_print_string
+	leaq yal_rt_false(%rip), %rax
+	jmp yal_rt_print_string
+
+yal_rt_print_ptr:
+	testq %rax, %rax
+	leaq yal_rt_ptr(%rip), %rax
+	jnz yal_rt_print_string
+	leaq yal_rt_null(%rip), %rax
+	jmp yal_rt_print_string
+
+# Sets rax to whether the strings in rax and rcx are equal
+yal_rt_streq:
+	movq (%rax), %rdx
+	cmpq (%rcx), %rdx
+	jne 1f
+	pushq %rsi
+	pushq %rdi
+	leaq 8(%rax), %rsi
+	leaq 8(%rcx), %rdi
+	movq %rdx, %rcx
+	repe cmpsb
+	popq %rdi
+	popq %rsi
+	sete %al
+	movzbl %al, %eax
+	ret
+1:
+	xorl %eax, %eax
+	ret
+
+# Starts the message of a panic, its args being printed next
+yal_rt_panic:
+	movq $2, yal_rt_fd(%rip)
+	leaq yal_rt_panic_msg(%rip), %rax
+	jmp yal_rt_print_string
+
+# Ends the message of a panic and exits with status 1
+yal_rt_die:
+	call yal_rt_print_newline
+	movl $60, %eax
+	movl $1, %edi
+	syscall
+
+# Exits with the message in rax
+yal_rt_fail:
+	movq $2, yal_rt_fd(%rip)
+	call yal_rt_print_string
+	jmp yal_rt_die
+
+yal_rt_divzero:
+	leaq yal_rt_divzero_msg(%rip), %rax
+	jmp yal_rt_fail
+
+# Exits with the message of a null pointer dereference at line rax and
+# column rcx, which are 0 for an operation without a position
+yal_rt_nullderef:
+	movq $2, yal_rt_fd(%rip)
+	testq %rax, %rax
+	jz 1f
+	pushq %rcx
+	pushq %rax
+	leaq yal_rt_line_msg(%rip), %rax
+	call yal_rt_print_string
+	popq %rax
+	call yal_rt_print_int
+	leaq yal_rt_column_msg(%rip), %rax
+	call yal_rt_print_string
+	popq %rax
+	call yal_rt_print_int
+	leaq yal_rt_position_end(%rip), %rax
+	call yal_rt_print_string
+1:
+	leaq yal_rt_nullderef_msg(%rip), %rax
+	jmp yal_rt_fail
+
+yal_rt_unreachable:
+	leaq yal_rt_unreachable_msg(%rip), %rax
+	jmp yal_rt_fail
+
+	.section .note.GNU-stack,"",@progbits
+`
@@ -0,0 +1,159 @@
+// Package astutil holds the helpers the backends generating source from the
+// AST share: walking nodes, finding out what evaluating an expression may
+// do, working out the type of its value and writing the source of fns,
+// down to the lvalues of assignments.
+package astutil
+
+import (
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Calls f with node and the nodes it is made of
+func Visit(node any, f func(any)) {
+	if node == nil {
+		return
+	}
+	f(node)
+	switch n := node.(type) {
+	case *parser.Block:
+		for _, s := range n.Statements {
+			Visit(s, f)
+		}
+	case *parser.VarDeclExpression:
+		Visit(n.Initializer, f)
+	case *parser.StatementExpression:
+		Visit(n.Expr, f)
+	case *parser.FnReturn:
+		Visit(n.Value, f)
+	case *parser.IfExpr:
+		Visit(n.Condition, f)
+		Visit(n.ThenBranch, f)
+		Visit(n.ElseBranch, f)
+	case *parser.WhileLoop:
+		Visit(n.Condition, f)
+		Visit(n.Body, f)
+	case *parser.ForLoop:
+		Visit(n.Initializer, f)
+		Visit(n.Condition, f)
+		Visit(n.Apply, f)
+		Visit(n.Body, f)
+	case *parser.SwitchStmt:
+		Visit(n.Subject, f)
+		for _, sc := range n.Cases {
+			Visit(sc.Body, f)
+		}
+		Visit(n.Default, f)
+	case *parser.Grouping:
+		Visit(n.Grouped, f)
+	case *parser.Binary:
+		Visit(n.Left, f)
+		Visit(n.Right, f)
+	case *parser.Logical:
+		Visit(n.Left, f)
+		Visit(n.Right, f)
+	case *parser.UnaryRight:
+		Visit(n.Right, f)
+	case *parser.Assign:
+		Visit(n.Target, f)
+		Visit(n.Expr, f)
+	case *parser.PrefixIncDec:
+		Visit(n.Target, f)
+	case *parser.PostfixIncDec:
+		Visit(n.Target, f)
+	case *parser.AddressOf:
+		Visit(n.Operand, f)
+	case *parser.Deref:
+		Visit(n.Operand, f)
+	case *parser.Index:
+		Visit(n.Object, f)
+		Visit(n.Index, f)
+	case *parser.FnCall:
+		Visit(n.Callee, f)
+		for _, arg := range n.Args {
+			Visit(arg, f)
+		}
+	case *parser.Field:
+		Visit(n.Object, f)
+	case *parser.NamedArg:
+		Visit(n.Value, f)
+	case *parser.DeferStmt:
+		Visit(n.Expr, f)
+	case *parser.Try:
+		Visit(n.Operand, f)
+	case *parser.MatchExpr:
+		Visit(n.Subject, f)
+		for _, arm := range n.Arms {
+			Visit(arm.Body, f)
+		}
+	}
+}
+
+// Reports whether evaluating an expression may change variables or print,
+// which ifs and matches are assumed to do
+func Effects(expr parser.IExpression) bool {
+	found := false
+	Visit(expr, func(node any) {
+		switch node.(type) {
+		case *parser.FnCall, *parser.Assign, *parser.PrefixIncDec,
+			*parser.PostfixIncDec, *parser.IfExpr, *parser.MatchExpr:
+			found = true
+		}
+	})
+	return found
+}
+
+// Reports whether evaluating an expression may assign to variables other
+// than through pointers
+func Assigns(expr parser.IExpression) bool {
+	found := false
+	Visit(expr, func(node any) {
+		switch node.(type) {
+		case *parser.Assign, *parser.PrefixIncDec, *parser.PostfixIncDec,
+			*parser.IfExpr, *parser.MatchExpr:
+			found = true
+		}
+	})
+	return found
+}
+
+// Reports whether evaluating an expression may stop the program, or return
+// from its fn as ? does
+func Fails(expr parser.IExpression) bool {
+	found := false
+	Visit(expr, func(node any) {
+		switch n := node.(type) {
+		case *parser.Deref, *parser.Index, *parser.Try:
+			found = true
+		case *parser.Binary:
+			op := n.Operator.TokenType
+			found = found || op == lexer.Slash || op == lexer.Rem
+		}
+	})
+	return found
+}
+
+func IsNumber(tk *lexer.Token) bool {
+	switch tk.TokenType {
+	case lexer.Number2, lexer.Number8, lexer.Number10, lexer.Number16:
+		return true
+	}
+	return false
+}
+
+func IsCompare(op lexer.TokenType) bool {
+	switch op {
+	case lexer.EqualEqual, lexer.BangEqual, lexer.Lesser, lexer.LesserEqual,
+		lexer.Greater, lexer.GreaterEqual:
+		return true
+	}
+	return false
+}
+
+func IsLogical(op lexer.TokenType) bool {
+	return op == lexer.DoubleAmpersand || op == lexer.DoublePipe
+}
+
+func IsShift(op lexer.TokenType) bool {
+	return op == lexer.Shl || op == lexer.Shr
+}
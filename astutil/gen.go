@@ -0,0 +1,144 @@
+package astutil
+
+import (
+	"fmt"
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Error reported when a construct can't be generated
+type Error struct {
+	error
+}
+
+// Stops generating on node, reporting where it is written
+func Fail(node any, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if tk, ok := node.(*lexer.Token); ok {
+		msg = fmt.Sprintf("line %d column %d: %s", tk.Line, tk.Column, msg)
+	} else if n, ok := node.(interface{ Pos() parser.Loc }); ok && n.Pos().Line > 0 {
+		msg = fmt.Sprintf("line %d column %d: %s", n.Pos().Line, n.Pos().Column, msg)
+	}
+	panic(Error{fmt.Errorf("%s", msg)})
+}
+
+// Sets err to the error generating stopped on. It must be deferred by the
+// fn generating.
+func Catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e.error
+	}
+}
+
+// Writer writes the source of a fn, each line indented by Depth
+type Writer struct {
+	W     *strings.Builder
+	Depth int
+}
+
+func (w *Writer) Line(format string, args ...any) {
+	if format != "" {
+		w.W.WriteString(strings.Repeat("\t", w.Depth))
+	}
+	fmt.Fprintf(w.W, format+"\n", args...)
+}
+
+// Generates an expression with the statements it needs written apart,
+// indented at depth, and returns both
+func (w *Writer) Split(depth int, gen func() string) (string, string) {
+	out, d := w.W, w.Depth
+	var pre strings.Builder
+	w.W, w.Depth = &pre, depth
+	s := gen()
+	w.W, w.Depth = out, d
+	return s, pre.String()
+}
+
+// Removes the parentheses around a whole expression
+func Unparen(s string) string {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return s
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			for i++; s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(s)-1 {
+				return s
+			}
+		}
+	}
+	return s[1 : len(s)-1]
+}
+
+// Gen generates the parts of the assignment targets of a backend
+type Gen interface {
+	Env
+	// Returns the variable name refers to
+	Variable(name *lexer.Token) string
+	// Return the value a pointer dereference or an array index refers to,
+	// hoisting the pointer or the index when hoist is set
+	Deref(n *parser.Deref, hoist bool) string
+	Index(n *parser.Index, hoist bool) string
+}
+
+// Returns the lvalue an assignment stores to and its type. Hoisting stores
+// the operands of pointer dereferences and array indexes in temporaries.
+func Lvalue(g Gen, name *lexer.Token, target parser.IExpression, hoist bool) (string, string) {
+	switch n := target.(type) {
+	case nil, *parser.Variable:
+		if v, ok := n.(*parser.Variable); ok {
+			name = v.Name
+		}
+		t := g.VarType(name)
+		if _, ok := g.Const(name); ok {
+			Fail(name, "cannot assign to constant %s", name.Lexeme)
+		}
+		return g.Variable(name), t
+	case *parser.Deref:
+		return g.Deref(n, hoist), ExprType(g, n)
+	case *parser.Index:
+		return g.Index(n, hoist), ExprType(g, n)
+	}
+	g.Unsupported(target, strings.TrimPrefix(fmt.Sprintf("%T", target), "*parser."))
+	return "", ""
+}
+
+func ParamDecls(args *parser.FnArgs) []*parser.VarDeclExpression {
+	decls := []*parser.VarDeclExpression{}
+	if args == nil {
+		return decls
+	}
+	for _, arg := range *args {
+		if decl, ok := arg.(*parser.VarDeclExpression); ok {
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+// Adds the names of the variables whose address is taken within node to
+// names
+func Addressed(node any, names map[string]bool) {
+	Visit(node, func(node any) {
+		if n, ok := node.(*parser.AddressOf); ok {
+			if v, ok := n.Operand.(*parser.Variable); ok {
+				names[v.Name.Lexeme] = true
+			}
+		}
+	})
+}
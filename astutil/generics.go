@@ -0,0 +1,107 @@
+package astutil
+
+import (
+	"strings"
+	"unicode"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Returns the type arguments of a call to a generic fn, resolved in env: the
+// ones the checker recorded, or the ones given and inferred from the args
+// when it didn't run
+func TypeArgs(env Env, n *parser.FnCall, fn *parser.FnDeclStmt) []string {
+	params := fn.TypeParams
+	types := make([]string, len(params))
+	if len(n.Instance) == len(params) {
+		for i, t := range n.Instance {
+			types[i] = TypeOf(env, Annotation(n.Loc, t))
+		}
+		return types
+	}
+
+	isParam := map[string]bool{}
+	bindings := map[string]string{}
+	for i, param := range params {
+		isParam[param.Name.Lexeme] = true
+		if i < len(n.TypeArgs) {
+			bindings[param.Name.Lexeme] = TypeOf(env, n.TypeArgs[i])
+		}
+	}
+
+	decls := ParamDecls(fn.Args)
+	for i, arg := range n.Args {
+		if named, ok := arg.(*parser.NamedArg); ok {
+			for j, p := range decls {
+				if p.Name.Lexeme == named.Name.Lexeme {
+					i = j
+				}
+			}
+			arg = named.Value
+		}
+		if i < len(decls) {
+			bind(decls[i].Type, ExprType(env, arg), isParam, bindings)
+		}
+	}
+
+	for i, param := range params {
+		t, ok := bindings[param.Name.Lexeme]
+		switch {
+		case !ok:
+			Fail(n, "cannot infer type parameter %s of %s", param.Name.Lexeme, fn.Name.Lexeme)
+		case t == "":
+			// Only integer constants were passed for it
+			t = "int"
+		}
+		types[i] = t
+	}
+	return types
+}
+
+// Binds the type parameters found in the annotation of a param by matching
+// it against the type of the arg passed for it, integer constants binding
+// them to an empty type that any other arg overrides
+func bind(ann parser.IExpression, t string, isParam map[string]bool, bindings map[string]string) {
+	switch a := ann.(type) {
+	case *parser.TypeName:
+		if a.Module == nil && isParam[a.Name.Lexeme] && bindings[a.Name.Lexeme] == "" {
+			bindings[a.Name.Lexeme] = t
+		}
+	case *parser.PointerType:
+		if strings.HasPrefix(t, "*") {
+			bind(a.Elem, t[1:], isParam, bindings)
+		}
+	}
+}
+
+// Returns the annotation of a type the checker spelled out, qualified by a
+// module when it has a dot
+func Annotation(loc parser.Loc, t string) parser.IExpression {
+	if strings.HasPrefix(t, "*") {
+		return &parser.PointerType{Loc: loc, Elem: Annotation(loc, t[1:])}
+	}
+
+	name := &parser.TypeName{Loc: loc, Name: &lexer.Token{Lexeme: t, Line: loc.Line, Column: loc.Column}}
+	if i := strings.Index(t, "."); i >= 0 {
+		name.Module = &lexer.Token{Lexeme: t[:i], Line: loc.Line, Column: loc.Column}
+		name.Name.Lexeme = t[i+1:]
+	}
+	return name
+}
+
+// Returns the name in the program of the instance of the generic fn name
+// with type arguments types, such as max__int or max__p_uint for *uint,
+// which Ident keeps an identifier
+func Instance(name string, types []string) string {
+	syms := []string{}
+	for _, t := range types {
+		t = strings.NewReplacer("*", "p_", "[", "a", "]", "_").Replace(t)
+		syms = append(syms, strings.Map(func(r rune) rune {
+			if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, t))
+	}
+	return name + "__" + strings.Join(syms, "_")
+}
@@ -0,0 +1,34 @@
+package astutil
+
+import "yal/parser"
+
+// Returns the field naming the method a call of the package is to, along
+// with the value it is called on, or nil for a call to a fn
+func (p *Package) Method(n *parser.FnCall, local func(name string) bool) *parser.Field {
+	field, ok := n.Callee.(*parser.Field)
+	if !ok || p.Callee(n, local) != "" {
+		return nil
+	}
+	return field
+}
+
+// Returns the name in the program of method name of type t, as an impl
+// declares it
+func MethodOf(t string, name string) string {
+	return t + "." + name
+}
+
+// Returns the declaration of a method of the interface def defines, its
+// untyped self taking the interface as its type as the self of an impl
+// method takes the type of the impl
+func MethodDecl(def *parser.DefineTypeStatement, m *parser.MethodSig) *parser.FnDeclStmt {
+	args := append(parser.FnArgs{}, *m.Args...)
+	if len(args) > 0 {
+		if self, ok := args[0].(*parser.VarDeclExpression); ok && self.Type == nil {
+			typed := *self
+			typed.Type = &parser.TypeName{Loc: self.Loc, Name: def.Name}
+			args[0] = &typed
+		}
+	}
+	return &parser.FnDeclStmt{Loc: m.Loc, Name: m.Name, Type: m.Type, Args: &args}
+}
@@ -0,0 +1,76 @@
+package astutil
+
+import (
+	"strings"
+	"unicode"
+	"yal/parser"
+)
+
+// Package generated along with the others of a program. Its fns and types
+// are named after Path, except for the main package whose Path is empty,
+// and Imports maps the names it imports modules as to their paths.
+type Package struct {
+	Path    string
+	Stmts   []parser.IStatement
+	Imports map[string]string
+}
+
+// Returns the name a declaration of the package at path has in the
+// program: path.name, or name in the main package
+func Qualify(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Returns an identifier for a name in the program, the path it is
+// qualified by being written with underscores for the runes that can't be
+// in identifiers and separated from the name by two
+func Ident(name string) string {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return name
+	}
+	path := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name[:i])
+	return path + "__" + name[i+1:]
+}
+
+// Returns the name in the program of the type a type name of the package
+// refers to, an empty one for a module it doesn't import
+func (p *Package) TypeRef(t *parser.TypeName) string {
+	if t.Module == nil {
+		return Qualify(p.Path, t.Name.Lexeme)
+	}
+	if path, ok := p.Imports[t.Module.Lexeme]; ok {
+		return Qualify(path, t.Name.Lexeme)
+	}
+	return ""
+}
+
+// Returns the name in the program of the fn a call of the package is to,
+// one of the package or of a module it imports, or an empty name for a call
+// to a fn value. local reports whether a name refers to a variable or a
+// constant in scope, which shadow fns and modules.
+func (p *Package) Callee(n *parser.FnCall, local func(name string) bool) string {
+	if n.Callee == nil {
+		if local(n.Name.Lexeme) {
+			return ""
+		}
+		return Qualify(p.Path, n.Name.Lexeme)
+	}
+
+	if field, ok := n.Callee.(*parser.Field); ok {
+		if v, ok := field.Object.(*parser.Variable); ok && !local(v.Name.Lexeme) {
+			if path, ok := p.Imports[v.Name.Lexeme]; ok {
+				return Qualify(path, field.Name.Lexeme)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,332 @@
+package astutil
+
+import (
+	"fmt"
+	"strings"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Env gives the types of the names an expression refers to, types being
+// represented by their rendered annotation as the checker does
+type Env interface {
+	// Returns the type of a variable or constant in scope
+	VarType(name *lexer.Token) string
+	// Returns the value of a constant in scope, and whether there is one
+	Const(name *lexer.Token) (consteval.Value, bool)
+	// Returns the type the fn a call is to returns, and whether it is a
+	// declared fn
+	RetType(n *parser.FnCall) (string, bool)
+	// Returns the name in the program of the type defined by definetype a
+	// type name refers to, and whether there is one
+	Named(t *parser.TypeName) (string, bool)
+	// Returns the type a type defined by definetype stands for, and whether
+	// t is one
+	Defined(t string) (string, bool)
+	// Opens and closes a scope, in which Declare declares the variable or
+	// the constant of a statement
+	Push()
+	Pop()
+	Declare(stmt parser.IStatement)
+	// Declares a variable of type t in the innermost scope, as a match arm
+	// binds a value
+	Bind(name *lexer.Token, t string)
+	// Fails on a construct the backend can't generate, what naming it
+	Unsupported(node any, what string)
+}
+
+// Returns the type of a type annotation as the checker renders it, with
+// array sizes evaluated, and void for a missing one
+func TypeOf(env Env, ann parser.IExpression) string {
+	switch t := ann.(type) {
+	case nil:
+		return "void"
+	case *parser.TypeName:
+		if t.Module == nil && t.Name.Lexeme == "Result" && len(t.Args) == 2 {
+			return ResultOf(TypeOf(env, t.Args[0]), TypeOf(env, t.Args[1]))
+		}
+		if len(t.Args) > 0 {
+			break
+		}
+		if t.Module == nil {
+			switch name := t.Name.Lexeme; name {
+			case "int", "uint", "char", "bool", "float", "string", "void":
+				return name
+			}
+		}
+		if name, ok := env.Named(t); ok {
+			return name
+		}
+	case *parser.PointerType:
+		return "*" + TypeOf(env, t.Elem)
+	case *parser.ArrayType:
+		v, err := consteval.Eval(t.Size, env.Const)
+		if err != nil {
+			Fail(t, "%v", err)
+		}
+		if v.IsBool || v.Int.Sign() < 0 || !v.Int.IsInt64() {
+			Fail(t, "invalid array size %v", v)
+		}
+		return "[" + v.Int.String() + "]" + TypeOf(env, t.Elem)
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", ann), "*parser.")
+	if t, ok := ann.(*parser.TypeName); ok {
+		name = t.Name.Lexeme
+	}
+	env.Unsupported(ann, "type "+name)
+	return ""
+}
+
+// Returns the type a defined type stands for
+func Underlying(env Env, t string) string {
+	for {
+		u, ok := env.Defined(t)
+		if !ok {
+			return t
+		}
+		t = u
+	}
+}
+
+func IsPointer(t string) bool {
+	return strings.HasPrefix(t, "*") || t == "NULL"
+}
+
+// Returns the type of the Results holding values of type value or errors
+// of type err
+func ResultOf(value string, err string) string {
+	return "Result<" + value + ", " + err + ">"
+}
+
+func IsResult(t string) bool {
+	return strings.HasPrefix(t, "Result<")
+}
+
+// Returns the types of the value and of the error of Result type t
+func Outcomes(t string) (string, string) {
+	args := t[len("Result<") : len(t)-1]
+	depth := 0
+	for i, r := range args {
+		switch r {
+		case '<', '(', '[':
+			depth++
+		case '>', ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				return args[:i], strings.TrimSpace(args[i+1:])
+			}
+		}
+	}
+	return args, ""
+}
+
+// Returns the type of binding i of a pattern matching a Result of type t:
+// the one of its value for Ok and of its error for Err
+func VariantType(p *parser.VariantPattern, t string, i int) string {
+	value, err := Outcomes(t)
+	switch {
+	case i > 0:
+	case p.Variant.Lexeme == "Ok":
+		return value
+	case p.Variant.Lexeme == "Err":
+		return err
+	}
+	Fail(p, "pattern %s binds %d values of a Result", p.Variant.Lexeme, len(p.Bindings))
+	return ""
+}
+
+// Returns the size and the element type of array type t
+func ArrayOf(t string) (string, string) {
+	end := strings.Index(t, "]")
+	return t[1:end], t[end+1:]
+}
+
+// Returns the type of an expression, or an empty type for integer constants
+// whose type is given by where they are used
+func ExprType(env Env, expr parser.IExpression) string {
+	switch n := expr.(type) {
+	case *parser.Literal:
+		switch {
+		case n.Value == nil:
+		case n.Value.TokenType == lexer.True || n.Value.TokenType == lexer.False:
+			return "bool"
+		case n.Value.TokenType == lexer.String:
+			return "string"
+		case n.Value.TokenType == lexer.Null:
+			return "NULL"
+		case IsNumber(n.Value) && strings.Contains(n.Value.Lexeme, "."):
+			return "float"
+		}
+	case *parser.Variable:
+		return env.VarType(n.Name)
+	case *parser.Grouping:
+		return ExprType(env, n.Grouped)
+	case *parser.Binary:
+		if IsCompare(n.Operator.TokenType) || IsLogical(n.Operator.TokenType) {
+			return "bool"
+		}
+		if t := ExprType(env, n.Left); t != "" || IsShift(n.Operator.TokenType) {
+			return t
+		}
+		return ExprType(env, n.Right)
+	case *parser.Logical:
+		return "bool"
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			return "bool"
+		}
+		return ExprType(env, n.Right)
+	case *parser.Assign:
+		if n.Target != nil {
+			return ExprType(env, n.Target)
+		}
+		return env.VarType(n.Name)
+	case *parser.PrefixIncDec:
+		return ExprType(env, n.Target)
+	case *parser.PostfixIncDec:
+		return ExprType(env, n.Target)
+	case *parser.AddressOf:
+		return "*" + ExprType(env, n.Operand)
+	case *parser.Deref:
+		if t := Underlying(env, ExprType(env, n.Operand)); strings.HasPrefix(t, "*") {
+			return t[1:]
+		}
+	case *parser.Index:
+		if t := Underlying(env, ExprType(env, n.Object)); strings.HasPrefix(t, "[") {
+			_, elem := ArrayOf(t)
+			return elem
+		}
+	case *parser.FnCall:
+		if ret, ok := env.RetType(n); ok {
+			return ret
+		}
+		if n.Name == nil || n.Callee == nil && (n.Name.Lexeme == "Ok" || n.Name.Lexeme == "Err") {
+			// The type of a Result is given by where it is used
+			break
+		}
+		return "void"
+	case *parser.IfExpr:
+		return BranchType(env, n.ThenBranch)
+	case *parser.Try:
+		if t := Underlying(env, ExprType(env, n.Operand)); IsResult(t) {
+			value, _ := Outcomes(t)
+			return value
+		}
+	case *parser.MatchExpr:
+		t := Underlying(env, ExprType(env, n.Subject))
+		if !IsResult(t) {
+			break
+		}
+		for _, arm := range n.Arms {
+			if a := ArmType(env, arm, t); a != "" {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the type of the value a match arm on a Result of type t evaluates
+// to, empty if it has none. Its bindings are declared in a scope of their
+// own meanwhile.
+func ArmType(env Env, arm *parser.MatchArm, t string) string {
+	env.Push()
+	defer env.Pop()
+	for i, name := range arm.Pattern.Bindings {
+		env.Bind(name, VariantType(arm.Pattern, t, i))
+	}
+	if _, ok := arm.Body.(*parser.Block); ok {
+		return BranchType(env, arm.Body)
+	}
+	return ExprType(env, arm.Body.(parser.IExpression))
+}
+
+// Returns the type of the trailing expression a branch evaluates to, empty
+// if it has none. The variables the branch declares before are declared in
+// a scope of their own meanwhile.
+func BranchType(env Env, stmt parser.IStatement) string {
+	switch n := stmt.(type) {
+	case *parser.Block:
+		env.Push()
+		defer env.Pop()
+		for i, s := range n.Statements {
+			if i == len(n.Statements)-1 {
+				return BranchType(env, s)
+			}
+			switch s.(type) {
+			case *parser.VarDeclExpression, *parser.ConstDeclStmt:
+				env.Declare(s)
+			}
+		}
+	case *parser.FnReturn:
+		if n.Implicit {
+			return ExprType(env, n.Value)
+		}
+	case *parser.IfExpr:
+		return ExprType(env, n)
+	}
+	return ""
+}
+
+// Returns the type the operands of an arithmetic expression are converted
+// to: the one of the first typed operand, else the numeric hint, else int
+func OperandType(env Env, hint string, operands ...parser.IExpression) string {
+	for _, o := range operands {
+		if t := ExprType(env, o); t != "" {
+			return t
+		}
+	}
+	switch Underlying(env, hint) {
+	case "int", "uint", "char", "float":
+		return hint
+	}
+	return "int"
+}
+
+// Returns the type of the value of an expression, integer constants taking
+// the numeric hint
+func ValueType(env Env, expr parser.IExpression, hint string) string {
+	t := ExprType(env, expr)
+	if t == "" {
+		return OperandType(env, hint)
+	}
+	if t == "void" {
+		Fail(expr, "fn call without a value used as a value")
+	}
+	return t
+}
+
+// Returns the type of a declared variable, the one of its initializer when
+// it has no type annotation
+func DeclType(env Env, n *parser.VarDeclExpression) string {
+	if n.Type != nil {
+		return TypeOf(env, n.Type)
+	}
+	switch t := ExprType(env, n.Initializer); t {
+	case "":
+		return "int"
+	case "NULL":
+		Fail(n, "cannot infer the type of %s from NULL", n.Name.Lexeme)
+	}
+	return ExprType(env, n.Initializer)
+}
+
+// Evaluates a constant declaration, returning its value and its type,
+// which defaults to int or bool
+func Constant(env Env, n *parser.ConstDeclStmt) (consteval.Value, string) {
+	v, err := consteval.Eval(n.Value, env.Const)
+	if err != nil {
+		Fail(n, "%v", err)
+	}
+
+	t := "int"
+	switch {
+	case n.Type != nil:
+		t = TypeOf(env, n.Type)
+	case v.IsBool:
+		t = "bool"
+	}
+	return v, t
+}
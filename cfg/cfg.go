@@ -0,0 +1,367 @@
+package cfg
+
+import (
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Basic block of an fn body: statements always executed in sequence, ending
+// with a jump to its successors. A block with a Cond branches to Succs[0]
+// when it is true and to Succs[1] otherwise. A block with Cases is a switch
+// on Cond, branching to Succs[i] when it equals one of Cases[i] and to the
+// last successor otherwise.
+type Block struct {
+	ID      int
+	Comment string
+	Nodes   []parser.IStatement
+	Cond    parser.IExpression
+	Cases   [][]parser.IExpression
+	Succs   []*Block
+	Preds   []*Block
+}
+
+// Control flow graph of an fn. Entry is the first block executed and Exit
+// the one every return jumps to, holding no statements.
+type Graph struct {
+	Name   string
+	Fn     *parser.FnDeclStmt
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block
+}
+
+type loop struct {
+	brk  *Block
+	cont *Block
+}
+
+type builder struct {
+	g      *Graph
+	cur    *Block
+	loops  []loop
+	labels map[string]*Block
+}
+
+// Builds the graph of every fn declared in stmts, methods included, in
+// declaration order. Methods are named after their type, as in `Shape.area`.
+func BuildAll(stmts []parser.IStatement) []*Graph {
+	graphs := []*Graph{}
+	for _, stmt := range stmts {
+		switch n := stmt.(type) {
+		case *parser.FnDeclStmt:
+			graphs = append(graphs, Build(n))
+		case *parser.ImplStmt:
+			for _, m := range n.Methods {
+				g := Build(m)
+				g.Name = n.Type.Lexeme + "." + g.Name
+				graphs = append(graphs, g)
+			}
+		}
+	}
+	return graphs
+}
+
+// Builds the graph of an fn body. Short-circuiting conditions are split into
+// a block per operand, while the other expressions are left whole in the
+// block evaluating them. Blocks that can't be reached from Entry are left
+// out.
+func Build(fn *parser.FnDeclStmt) *Graph {
+	b := &builder{
+		g:      &Graph{Name: fn.Name.Lexeme, Fn: fn},
+		labels: map[string]*Block{},
+	}
+	b.g.Entry = b.newBlock("entry")
+	b.g.Exit = b.newBlock("exit")
+	b.cur = b.g.Entry
+
+	b.stmt(fn.Body, true)
+	b.jump(b.g.Exit)
+
+	b.prune()
+	return b.g
+}
+
+func (b *builder) newBlock(comment string) *Block {
+	block := &Block{ID: len(b.g.Blocks), Comment: comment}
+	b.g.Blocks = append(b.g.Blocks, block)
+	return block
+}
+
+// Returns the block being built, starting a new one when the statement
+// before it jumped away
+func (b *builder) current() *Block {
+	if b.cur == nil {
+		b.cur = b.newBlock("unreachable")
+	}
+	return b.cur
+}
+
+func (b *builder) add(node parser.IStatement) {
+	block := b.current()
+	block.Nodes = append(block.Nodes, node)
+}
+
+func edge(from *Block, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// Ends the block being built with an unconditional jump
+func (b *builder) jump(to *Block) {
+	if b.cur != nil {
+		edge(b.cur, to)
+	}
+	b.cur = nil
+}
+
+func (b *builder) label(name string) *Block {
+	if block, ok := b.labels[name]; ok {
+		return block
+	}
+	block := b.newBlock(name)
+	b.labels[name] = block
+	return block
+}
+
+// Lowers a statement into the block being built. A tail statement is the
+// last one executed by the fn, whose trailing expressions are the value it
+// returns; elsewhere their value is discarded.
+func (b *builder) stmt(stmt parser.IStatement, tail bool) {
+	switch n := stmt.(type) {
+	case *parser.Block:
+		for i, s := range n.Statements {
+			b.stmt(s, tail && i == len(n.Statements)-1)
+		}
+	case *parser.StatementExpression:
+		switch e := n.Expr.(type) {
+		case *parser.FnReturn:
+			b.stmt(e, tail)
+		case *parser.IfExpr:
+			b.stmt(e, tail)
+		default:
+			b.add(n)
+			if isPanic(e) {
+				b.jump(b.g.Exit)
+			}
+		}
+	case *parser.FnReturn:
+		if n.Implicit && !tail {
+			b.add(&parser.StatementExpression{Loc: n.Loc, Expr: n.Value})
+			return
+		}
+		b.add(n)
+		b.jump(b.g.Exit)
+	case *parser.IfExpr:
+		then := b.newBlock("if.then")
+		join := b.newBlock("if.end")
+		els := join
+		if n.ElseBranch != nil {
+			els = b.newBlock("if.else")
+		}
+		b.cond(n.Condition, then, els)
+
+		b.cur = then
+		b.stmt(n.ThenBranch, tail)
+		b.jump(join)
+		if n.ElseBranch != nil {
+			b.cur = els
+			b.stmt(n.ElseBranch, tail)
+			b.jump(join)
+		}
+		b.cur = join
+	case *parser.WhileLoop:
+		header := b.newBlock("while.cond")
+		b.jump(header)
+		b.cur = header
+		exit := b.loop(n.Condition, n.Body, header, "while")
+		b.cur = exit
+	case *parser.ForLoop:
+		if n.Initializer != nil {
+			b.stmt(n.Initializer, false)
+		}
+		header := b.newBlock("for.cond")
+		post := b.newBlock("for.post")
+		b.jump(header)
+		b.cur = header
+		exit := b.loop(n.Condition, n.Body, post, "for")
+
+		b.cur = post
+		if n.Apply != nil {
+			b.add(&parser.StatementExpression{Loc: locOf(n.Apply), Expr: n.Apply})
+		}
+		b.jump(header)
+		b.cur = exit
+	case *parser.SwitchStmt:
+		b.switchStmt(n, tail)
+	case *parser.BreakStmt:
+		if len(b.loops) > 0 {
+			b.jump(b.loops[len(b.loops)-1].brk)
+		}
+		b.cur = nil
+	case *parser.ContinueStmt:
+		if len(b.loops) > 0 {
+			b.jump(b.loops[len(b.loops)-1].cont)
+		}
+		b.cur = nil
+	case *parser.GotoStmt:
+		b.jump(b.label(n.Label.Lexeme))
+	case *parser.LabelStmt:
+		block := b.label(n.Name.Lexeme)
+		b.jump(block)
+		b.cur = block
+	default:
+		b.add(stmt)
+	}
+}
+
+// Lowers a loop whose condition is evaluated by the block being built.
+// Continuing jumps to cont, which must lead back to the condition. Returns
+// the block following the loop.
+func (b *builder) loop(cond parser.IExpression, body parser.IStatement, cont *Block, kind string) *Block {
+	first := b.newBlock(kind + ".body")
+	exit := b.newBlock(kind + ".end")
+	if cond != nil {
+		b.cond(cond, first, exit)
+	} else {
+		b.jump(first)
+	}
+
+	b.loops = append(b.loops, loop{brk: exit, cont: cont})
+	b.cur = first
+	b.stmt(body, false)
+	b.jump(cont)
+	b.loops = b.loops[:len(b.loops)-1]
+
+	return exit
+}
+
+// Lowers a condition into branches to t when it holds and to f otherwise,
+// only evaluating the right operand of && and || when it decides the result
+func (b *builder) cond(expr parser.IExpression, t *Block, f *Block) {
+	switch n := expr.(type) {
+	case *parser.Grouping:
+		b.cond(n.Grouped, t, f)
+		return
+	case *parser.UnaryRight:
+		if n.Operator.Lexeme == "!" {
+			b.cond(n.Right, f, t)
+			return
+		}
+	}
+
+	if left, op, right, ok := logical(expr); ok {
+		if op == lexer.DoubleAmpersand {
+			rhs := b.newBlock("and.rhs")
+			b.cond(left, rhs, f)
+			b.cur = rhs
+		} else {
+			rhs := b.newBlock("or.rhs")
+			b.cond(left, t, rhs)
+			b.cur = rhs
+		}
+		b.cond(right, t, f)
+		return
+	}
+
+	block := b.current()
+	block.Cond = expr
+	edge(block, t)
+	edge(block, f)
+	b.cur = nil
+}
+
+func (b *builder) switchStmt(n *parser.SwitchStmt, tail bool) {
+	block := b.current()
+	block.Cond = n.Subject
+	join := b.newBlock("switch.end")
+
+	bodies := []parser.IStatement{}
+	for _, sc := range n.Cases {
+		block.Cases = append(block.Cases, sc.Values)
+		bodies = append(bodies, sc.Body)
+	}
+	if n.Default != nil {
+		bodies = append(bodies, n.Default)
+	}
+
+	for i, body := range bodies {
+		c := b.newBlock("switch.case")
+		if i == len(n.Cases) {
+			c.Comment = "switch.default"
+		}
+		edge(block, c)
+		b.cur = c
+		b.stmt(body, tail)
+		b.jump(join)
+	}
+	if n.Default == nil {
+		edge(block, join)
+	}
+	b.cur = join
+}
+
+// Splits a && or || expression, which the parser builds either as a Logical
+// or as a Binary depending on the operators around it
+func logical(expr parser.IExpression) (parser.IExpression, lexer.TokenType, parser.IExpression, bool) {
+	switch n := expr.(type) {
+	case *parser.Logical:
+		return n.Left, n.Operator.TokenType, n.Right, true
+	case *parser.Binary:
+		switch n.Operator.TokenType {
+		case lexer.DoubleAmpersand, lexer.DoublePipe:
+			return n.Left, n.Operator.TokenType, n.Right, true
+		}
+	}
+	return nil, 0, nil, false
+}
+
+// Calls to the panic builtin never return
+func isPanic(expr parser.IExpression) bool {
+	call, ok := expr.(*parser.FnCall)
+	return ok && call.Name != nil && call.Name.Lexeme == "panic"
+}
+
+func locOf(node any) parser.Loc {
+	if n, ok := node.(interface{ Pos() parser.Loc }); ok {
+		return n.Pos()
+	}
+	return parser.Loc{}
+}
+
+// Removes the blocks that can't be reached from Entry, along with their
+// edges, and numbers the others in reverse postorder so that a block comes
+// before its successors unless it loops back to them. Exit is always kept,
+// as the last block.
+func (b *builder) prune() {
+	postorder := []*Block{}
+	reached := map[*Block]bool{b.g.Exit: true}
+	var visit func(*Block)
+	visit = func(block *Block) {
+		reached[block] = true
+		for i := len(block.Succs) - 1; i >= 0; i-- {
+			if !reached[block.Succs[i]] {
+				visit(block.Succs[i])
+			}
+		}
+		postorder = append(postorder, block)
+	}
+	visit(b.g.Entry)
+
+	blocks := []*Block{}
+	for i := len(postorder) - 1; i >= 0; i-- {
+		blocks = append(blocks, postorder[i])
+	}
+	blocks = append(blocks, b.g.Exit)
+
+	for i, block := range blocks {
+		preds := []*Block{}
+		for _, p := range block.Preds {
+			if reached[p] {
+				preds = append(preds, p)
+			}
+		}
+		block.Preds = preds
+		block.ID = i
+	}
+	b.g.Blocks = blocks
+}
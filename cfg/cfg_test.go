@@ -0,0 +1,259 @@
+package cfg_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"yal/cfg"
+	"yal/lexer"
+	"yal/parser"
+)
+
+func build(t *testing.T, src string) []*cfg.Graph {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg.BuildAll(parser.NewParser(ctx, tokens).Run())
+}
+
+// Renders the edges of g as "b0->b1,b2 b1->b3 ...", successors in order
+func edges(g *cfg.Graph) string {
+	s := []string{}
+	for _, b := range g.Blocks {
+		if len(b.Succs) == 0 {
+			continue
+		}
+		succs := []string{}
+		for _, succ := range b.Succs {
+			succs = append(succs, fmt.Sprintf("b%d", succ.ID))
+		}
+		s = append(s, fmt.Sprintf("b%d->%s", b.ID, strings.Join(succs, ",")))
+	}
+	return strings.Join(s, " ")
+}
+
+func expectEdges(t *testing.T, g *cfg.Graph, want string) {
+	if got := edges(g); got != want {
+		t.Errorf("expected edges %q, got %q\n", want, got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	t.Run("Test straight line fn", func(t *testing.T) {
+		g := build(t, `fn f(a: int) : int { let b = a + 1; return b; }`)[0]
+		if len(g.Blocks) != 2 || len(g.Entry.Nodes) != 2 {
+			t.Errorf("expected an entry block holding 2 statements and an exit, got %d blocks\n", len(g.Blocks))
+		}
+		expectEdges(t, g, "b0->b1")
+		if g.Exit != g.Blocks[1] {
+			t.Errorf("expected the exit to be the last block\n")
+		}
+	})
+
+	t.Run("Test if else", func(t *testing.T) {
+		g := build(t, `fn f(a: int) : int {
+  let b = 0;
+  if (a > 0) { b = 1; } else { b = 2; }
+  return b;
+}`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b3 b2->b3 b3->b4")
+		if g.Entry.Cond == nil {
+			t.Errorf("expected the entry block to branch on the condition\n")
+		}
+	})
+
+	t.Run("Test if without else", func(t *testing.T) {
+		g := build(t, `fn f(a: int) : void { if (a > 0) { print(a); } }`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b2 b2->b3")
+	})
+
+	t.Run("Test returning branches", func(t *testing.T) {
+		g := build(t, `fn f(a: int) : int { if (a > 0) { return 1; } else { return 2; } }`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b3 b2->b3")
+	})
+
+	t.Run("Test trailing if returns", func(t *testing.T) {
+		g := build(t, `fn max(a: int, b: int) : int { if (a > b) { a } else { b } }`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b3 b2->b3")
+		if _, ok := g.Blocks[1].Nodes[0].(*parser.FnReturn); !ok {
+			t.Errorf("expected the branch value to be returned, got %T\n", g.Blocks[1].Nodes[0])
+		}
+	})
+
+	t.Run("Test discarded branch values", func(t *testing.T) {
+		g := build(t, `fn f() : int { if (true) { 0 } else { 1 } 101 }`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b3 b2->b3 b3->b4")
+		if _, ok := g.Blocks[1].Nodes[0].(*parser.StatementExpression); !ok {
+			t.Errorf("expected the branch value to be discarded, got %T\n", g.Blocks[1].Nodes[0])
+		}
+	})
+
+	t.Run("Test while loop", func(t *testing.T) {
+		g := build(t, `fn f(n: int) : void { let i = 0; while (i < n) { ++i; } }`)[0]
+		expectEdges(t, g, "b0->b1 b1->b2,b3 b2->b1 b3->b4")
+	})
+
+	t.Run("Test for loop", func(t *testing.T) {
+		g := build(t, `fn f(n: int) : void { for (let i = 0; i < n; ++i) { print(i); } }`)[0]
+		expectEdges(t, g, "b0->b1 b1->b2,b4 b2->b3 b3->b1 b4->b5")
+		if len(g.Entry.Nodes) != 1 || len(g.Blocks[3].Nodes) != 1 {
+			t.Errorf("expected the initializer in the entry and the increment in its own block\n")
+		}
+	})
+
+	t.Run("Test break and continue", func(t *testing.T) {
+		g := build(t, `fn f(n: int) : void {
+  for (let i = 0; i < n; ++i) {
+    if (i == 2) { continue; }
+    if (i == 5) { break; }
+    print(i);
+  }
+}`)[0]
+		expectEdges(t, g, "b0->b1 b1->b2,b8 b2->b3,b4 b3->b7 b4->b5,b6 b5->b8 b6->b7 b7->b1 b8->b9")
+	})
+
+	t.Run("Test short circuit conditions", func(t *testing.T) {
+		g := build(t, `fn f(a: int, b: int) : void {
+  if (a > 0 && (b > 0 || !(a == b))) { print(a); }
+}`)[0]
+		// b0 evaluates a > 0, b1 b > 0 and b2 a == b, the operands of the
+		// negation taking the branches the other way around
+		expectEdges(t, g, "b0->b1,b4 b1->b3,b2 b2->b4,b3 b3->b4 b4->b5")
+	})
+
+	t.Run("Test switch", func(t *testing.T) {
+		g := build(t, `fn f(op: int) : int {
+  switch (op) {
+    case 0, 1:
+      return 1;
+    case 2:
+      print(op);
+  }
+  return 0;
+}`)[0]
+		expectEdges(t, g, "b0->b1,b2,b3 b1->b4 b2->b3 b3->b4")
+		if len(g.Entry.Cases) != 2 || len(g.Entry.Cases[0]) != 2 {
+			t.Errorf("expected the entry to switch over 2 cases, got %v\n", g.Entry.Cases)
+		}
+	})
+
+	t.Run("Test goto", func(t *testing.T) {
+		g := build(t, `fn f(n: int) : void {
+  start:
+  --n;
+  if (n > 0) { goto start; }
+}`)[0]
+		expectEdges(t, g, "b0->b1 b1->b2,b3 b2->b1 b3->b4")
+	})
+
+	t.Run("Test unreachable code is left out", func(t *testing.T) {
+		g := build(t, `fn f() : int { return 1; print("never"); }`)[0]
+		expectEdges(t, g, "b0->b1")
+		if len(g.Blocks) != 2 {
+			t.Errorf("expected 2 blocks, got %d\n", len(g.Blocks))
+		}
+	})
+
+	t.Run("Test panic exits", func(t *testing.T) {
+		g := build(t, `fn f(a: int) : int { if (a < 0) { panic("negative"); } a }`)[0]
+		expectEdges(t, g, "b0->b1,b2 b1->b3 b2->b3")
+	})
+
+	t.Run("Test infinite loop keeps the exit", func(t *testing.T) {
+		g := build(t, `fn f() : void { while (true) { print("again"); } }`)[0]
+		if g.Exit != g.Blocks[len(g.Blocks)-1] {
+			t.Errorf("expected the exit to be kept\n")
+		}
+	})
+
+	t.Run("Test methods", func(t *testing.T) {
+		graphs := build(t, `definetype Square = int;
+impl Square {
+  fn area(self) : int { self * self }
+}
+fn main() : void {}`)
+		if len(graphs) != 2 || graphs[0].Name != "Square.area" || graphs[1].Name != "main" {
+			t.Errorf("expected graphs for Square.area and main\n")
+		}
+	})
+}
+
+func TestDominators(t *testing.T) {
+	g := build(t, `fn f(n: int) : int {
+  let i = 0;
+  while (i < n) {
+    if (i == 3) { ++i; } else { i = i + 2; }
+  }
+  return i;
+}`)[0]
+	// b0 entry, b1 while.cond, b2 while.body, b3 if.then, b4 if.else,
+	// b5 if.end, b6 while.end, b7 exit
+	expectEdges(t, g, "b0->b1 b1->b2,b6 b2->b3,b4 b3->b5 b4->b5 b5->b1 b6->b7")
+	dom := cfg.Dominators(g)
+	b := g.Blocks
+
+	t.Run("Test immediate dominators", func(t *testing.T) {
+		idoms := map[int]int{1: 0, 2: 1, 3: 2, 4: 2, 5: 2, 6: 1, 7: 6}
+		for id, want := range idoms {
+			if got := dom.Idom(b[id]); got != b[want] {
+				t.Errorf("expected b%d to be immediately dominated by b%d, got %v\n", id, want, got)
+			}
+		}
+		if dom.Idom(g.Entry) != nil {
+			t.Errorf("expected the entry to have no dominator\n")
+		}
+	})
+
+	t.Run("Test dominates", func(t *testing.T) {
+		if !dom.Dominates(b[1], b[5]) || !dom.Dominates(b[5], b[5]) {
+			t.Errorf("expected the loop header to dominate its body\n")
+		}
+		if dom.Dominates(b[3], b[5]) || dom.Dominates(b[2], b[6]) {
+			t.Errorf("expected a branch not to dominate the join\n")
+		}
+	})
+
+	t.Run("Test children", func(t *testing.T) {
+		if len(dom.Children(b[2])) != 3 {
+			t.Errorf("expected b2 to dominate 3 blocks, got %v\n", dom.Children(b[2]))
+		}
+	})
+
+	t.Run("Test frontiers", func(t *testing.T) {
+		if f := dom.Frontier(b[3]); len(f) != 1 || f[0] != b[5] {
+			t.Errorf("expected the frontier of b3 to be b5, got %v\n", f)
+		}
+		if f := dom.Frontier(b[5]); len(f) != 1 || f[0] != b[1] {
+			t.Errorf("expected the frontier of b5 to be the loop header, got %v\n", f)
+		}
+	})
+}
+
+func TestDOT(t *testing.T) {
+	graphs := build(t, `fn f(a: int) : int { if (a > 0) { return a; } print("neg"); 0 }`)
+
+	var sb strings.Builder
+	if err := cfg.WriteDOT(&sb, graphs); err != nil {
+		t.Fatal(err)
+	}
+	dot := sb.String()
+
+	for _, want := range []string{
+		"digraph cfg {",
+		`label="f";`,
+		`f0_b0 [label="b0: entry\l  if a > 0\l"];`,
+		`f0_b2 [label="b2: if.end (idom b0)\l  print(\"neg\")\l  0\l"];`,
+		`f0_b0 -> f0_b1 [label="true"];`,
+		`f0_b0 -> f0_b2 [label="false"];`,
+		"f0_b1 -> f0_b3;",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("expected the DOT output to contain %q, got\n%s\n", want, dot)
+		}
+	}
+}
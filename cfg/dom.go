@@ -0,0 +1,155 @@
+package cfg
+
+// Dominator tree of a Graph. A block dominates another when every path from
+// Entry to the other goes through it, and immediately dominates it when it
+// is the closest such block.
+type DomTree struct {
+	idom     []*Block
+	children [][]*Block
+	frontier [][]*Block
+}
+
+// Returns the blocks reachable from Entry, each one after all of its
+// successors except for the ones reached through a back edge
+func (g *Graph) Postorder() []*Block {
+	order := []*Block{}
+	seen := make([]bool, len(g.Blocks))
+
+	var visit func(*Block)
+	visit = func(b *Block) {
+		seen[b.ID] = true
+		for _, s := range b.Succs {
+			if !seen[s.ID] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(g.Entry)
+
+	return order
+}
+
+// Returns the blocks reachable from Entry, each one before all of its
+// successors except for the ones reached through a back edge
+func (g *Graph) ReversePostorder() []*Block {
+	order := g.Postorder()
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// Computes the dominator tree of g, following "A Simple, Fast Dominance
+// Algorithm" by Cooper, Harvey and Kennedy
+func Dominators(g *Graph) *DomTree {
+	rpo := g.ReversePostorder()
+	index := make([]int, len(g.Blocks))
+	for i := range index {
+		index[i] = -1
+	}
+	for i, b := range rpo {
+		index[b.ID] = i
+	}
+
+	idom := make([]*Block, len(g.Blocks))
+	idom[g.Entry.ID] = g.Entry
+
+	intersect := func(a *Block, b *Block) *Block {
+		for a != b {
+			for index[a.ID] > index[b.ID] {
+				a = idom[a.ID]
+			}
+			for index[b.ID] > index[a.ID] {
+				b = idom[b.ID]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range rpo[1:] {
+			var dom *Block
+			for _, p := range b.Preds {
+				if idom[p.ID] == nil {
+					continue
+				}
+				if dom == nil {
+					dom = p
+				} else {
+					dom = intersect(p, dom)
+				}
+			}
+			if idom[b.ID] != dom {
+				idom[b.ID] = dom
+				changed = true
+			}
+		}
+	}
+	idom[g.Entry.ID] = nil
+
+	d := &DomTree{
+		idom:     idom,
+		children: make([][]*Block, len(g.Blocks)),
+		frontier: make([][]*Block, len(g.Blocks)),
+	}
+	for _, b := range rpo[1:] {
+		d.children[idom[b.ID].ID] = append(d.children[idom[b.ID].ID], b)
+	}
+
+	for _, b := range rpo {
+		if len(b.Preds) < 2 {
+			continue
+		}
+		for _, p := range b.Preds {
+			for runner := p; runner != idom[b.ID] && index[runner.ID] >= 0; runner = idom[runner.ID] {
+				if !contains(d.frontier[runner.ID], b) {
+					d.frontier[runner.ID] = append(d.frontier[runner.ID], b)
+				}
+				if runner == g.Entry {
+					break
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+func contains(blocks []*Block, b *Block) bool {
+	for _, block := range blocks {
+		if block == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the immediate dominator of b, nil for Entry and for the blocks
+// that can't be reached from it
+func (d *DomTree) Idom(b *Block) *Block {
+	return d.idom[b.ID]
+}
+
+// Returns the blocks b immediately dominates
+func (d *DomTree) Children(b *Block) []*Block {
+	return d.children[b.ID]
+}
+
+// Returns whether every path from Entry to b goes through a. Every block
+// dominates itself.
+func (d *DomTree) Dominates(a *Block, b *Block) bool {
+	for ; b != nil; b = d.idom[b.ID] {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the dominance frontier of b, the blocks where the paths b
+// dominates join the ones it doesn't
+func (d *DomTree) Frontier(b *Block) []*Block {
+	return d.frontier[b.ID]
+}
@@ -0,0 +1,88 @@
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writes graphs in the Graphviz DOT language, as a single digraph holding a
+// cluster per fn. Each block is labelled with its statements and immediate
+// dominator, and branch edges with the value taking them.
+func WriteDOT(w io.Writer, graphs []*Graph) error {
+	var sb strings.Builder
+
+	sb.WriteString("digraph cfg {\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for i, g := range graphs {
+		dom := Dominators(g)
+		id := func(b *Block) string {
+			return fmt.Sprintf("f%d_b%d", i, b.ID)
+		}
+
+		fmt.Fprintf(&sb, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "    label=%s;\n", quote(g.Name))
+		for _, b := range g.Blocks {
+			fmt.Fprintf(&sb, "    %s [label=\"%s\"];\n", id(b), blockLabel(b, dom))
+		}
+		for _, b := range g.Blocks {
+			for j, s := range b.Succs {
+				fmt.Fprintf(&sb, "    %s -> %s", id(b), id(s))
+				if label := edgeLabel(b, j); label != "" {
+					fmt.Fprintf(&sb, " [label=%s]", quote(label))
+				}
+				sb.WriteString(";\n")
+			}
+		}
+		sb.WriteString("  }\n")
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Returns the escaped label of a block, whose lines are left aligned by
+// ending them with \l
+func blockLabel(b *Block, dom *DomTree) string {
+	lines := []string{fmt.Sprintf("b%d: %s", b.ID, b.Comment)}
+	if idom := dom.Idom(b); idom != nil {
+		lines[0] += fmt.Sprintf(" (idom b%d)", idom.ID)
+	}
+	for _, node := range b.Nodes {
+		lines = append(lines, "  "+format(node))
+	}
+	switch {
+	case b.Cases != nil:
+		lines = append(lines, "  switch "+format(b.Cond))
+	case b.Cond != nil:
+		lines = append(lines, "  if "+format(b.Cond))
+	}
+	return escape(strings.Join(lines, "\n")) + "\\l"
+}
+
+func edgeLabel(b *Block, succ int) string {
+	switch {
+	case b.Cases != nil && succ < len(b.Cases):
+		return formatList(b.Cases[succ])
+	case b.Cases != nil:
+		return "default"
+	case b.Cond != nil && succ == 0:
+		return "true"
+	case b.Cond != nil:
+		return "false"
+	}
+	return ""
+}
+
+// Escapes s for a DOT string, turning its newlines into left aligned line
+// breaks
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return strings.ReplaceAll(s, "\n", "\\l")
+}
+
+func quote(s string) string {
+	return "\"" + escape(s) + "\""
+}
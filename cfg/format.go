@@ -0,0 +1,174 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Renders a statement or an expression on a single line, close to the way
+// it is written. Nested fn bodies and match arms are elided.
+func format(node any) string {
+	switch n := node.(type) {
+	case nil:
+		return ""
+	case *parser.StatementExpression:
+		return format(n.Expr)
+	case *parser.VarDeclExpression:
+		s := "let " + n.Name.Lexeme
+		if n.Type != nil {
+			s += ": " + formatType(n.Type)
+		}
+		if init := format(n.Initializer); init != "" {
+			s += " = " + init
+		}
+		return s
+	case *parser.TupleDecl:
+		names := []string{}
+		for _, name := range n.Names {
+			names = append(names, name.Lexeme)
+		}
+		return "let (" + strings.Join(names, ", ") + ") = " + format(n.Initializer)
+	case *parser.ConstDeclStmt:
+		return "const " + n.Name.Lexeme + " = " + format(n.Value)
+	case *parser.FnReturn:
+		if n.Implicit {
+			return format(n.Value)
+		}
+		if n.Value == nil {
+			return "return"
+		}
+		return "return " + format(n.Value)
+	case *parser.DeferStmt:
+		return "defer " + format(n.Expr)
+	case *parser.SpawnStmt:
+		return "spawn " + format(n.Call)
+	case *parser.FnDeclStmt:
+		return "fn " + n.Name.Lexeme + "(...) {...}"
+	case *parser.Literal:
+		// Declarations without an initializer hold an empty literal
+		if n.Value == nil {
+			return ""
+		}
+		if n.Value.TokenType == lexer.String {
+			return fmt.Sprintf("%q", n.Value.Lexeme)
+		}
+		return n.Value.Lexeme
+	case *parser.Variable:
+		return n.Name.Lexeme
+	case *parser.Grouping:
+		return "(" + format(n.Grouped) + ")"
+	case *parser.Binary:
+		return format(n.Left) + " " + n.Operator.Lexeme + " " + format(n.Right)
+	case *parser.Logical:
+		return format(n.Left) + " " + n.Operator.Lexeme + " " + format(n.Right)
+	case *parser.UnaryRight:
+		return n.Operator.Lexeme + format(n.Right)
+	case *parser.PrefixIncDec:
+		return n.Operator.Lexeme + format(n.Target)
+	case *parser.PostfixIncDec:
+		return format(n.Target) + n.Operator.Lexeme
+	case *parser.AddressOf:
+		return "&" + format(n.Operand)
+	case *parser.Deref:
+		return "*" + format(n.Operand)
+	case *parser.Assign:
+		target := format(n.Target)
+		if n.Target == nil {
+			target = n.Name.Lexeme
+		}
+		return target + " " + n.Operator.Lexeme + " " + format(n.Expr)
+	case *parser.Index:
+		return format(n.Object) + "[" + format(n.Index) + "]"
+	case *parser.Field:
+		return format(n.Object) + "." + n.Name.Lexeme
+	case *parser.FnCall:
+		callee := format(n.Callee)
+		if n.Callee == nil {
+			callee = n.Name.Lexeme
+		}
+		if len(n.TypeArgs) > 0 {
+			args := []string{}
+			for _, arg := range n.TypeArgs {
+				args = append(args, formatType(arg))
+			}
+			callee += "<" + strings.Join(args, ", ") + ">"
+		}
+		return callee + "(" + formatList(n.Args) + ")"
+	case *parser.NamedArg:
+		return n.Name.Lexeme + ": " + format(n.Value)
+	case *parser.Tuple:
+		return "(" + formatList(n.Elems) + ")"
+	case *parser.Try:
+		return format(n.Operand) + "?"
+	case *parser.Send:
+		return format(n.Channel) + " <- " + format(n.Value)
+	case *parser.Receive:
+		return "<- " + format(n.Channel)
+	case *parser.MakeChan:
+		return formatType(n.Type) + "(" + format(n.Size) + ")"
+	case *parser.Lambda:
+		return "(...) => {...}"
+	case *parser.IfExpr:
+		s := "if (" + format(n.Condition) + ") {...}"
+		if n.ElseBranch != nil {
+			s += " else {...}"
+		}
+		return s
+	case *parser.MatchExpr:
+		return "match (" + format(n.Subject) + ") {...}"
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func formatList(exprs []parser.IExpression) string {
+	s := []string{}
+	for _, e := range exprs {
+		s = append(s, format(e))
+	}
+	return strings.Join(s, ", ")
+}
+
+func formatType(ann parser.IExpression) string {
+	switch t := ann.(type) {
+	case *parser.TypeName:
+		s := t.Name.Lexeme
+		if t.Module != nil {
+			s = t.Module.Lexeme + "." + s
+		}
+		if len(t.Args) > 0 {
+			args := []string{}
+			for _, arg := range t.Args {
+				args = append(args, formatType(arg))
+			}
+			s += "<" + strings.Join(args, ", ") + ">"
+		}
+		return s
+	case *parser.PointerType:
+		return "*" + formatType(t.Elem)
+	case *parser.ArrayType:
+		return "[" + format(t.Size) + "]" + formatType(t.Elem)
+	case *parser.ChanType:
+		return "chan<" + formatType(t.Elem) + ">"
+	case *parser.VariadicType:
+		return "..." + formatType(t.Elem)
+	case *parser.TupleType:
+		return "(" + strings.Join(formatTypes(t.Elems), ", ") + ")"
+	case *parser.FnType:
+		s := "fn(" + strings.Join(formatTypes(t.Params), ", ") + ")"
+		if t.Return != nil {
+			s += ": " + formatType(t.Return)
+		}
+		return s
+	}
+	return "?"
+}
+
+func formatTypes(anns []parser.IExpression) []string {
+	s := []string{}
+	for _, ann := range anns {
+		s = append(s, formatType(ann))
+	}
+	return s
+}
@@ -0,0 +1,634 @@
+package cgen
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"yal/astutil"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Runtime included by the generated source, which must be written next to
+// it as HeaderName
+//
+//go:embed yal.h
+var Header string
+
+const HeaderName = "yal.h"
+
+// Variable or constant in scope. Variables whose address is taken are
+// allocated on the heap, name being a pointer to them.
+type local struct {
+	name  string
+	typ   string
+	addr  bool
+	konst *consteval.Value
+}
+
+// Signature of a fn, named after its name in the program. The signature of
+// an instance of a generic fn binds its type parameters to the type
+// arguments it is named after.
+type signature struct {
+	name     string
+	pkg      *astutil.Package
+	decl     *parser.FnDeclStmt
+	bindings map[string]string
+	params   []*parser.VarDeclExpression
+	types    []string
+	ret      string
+}
+
+// Type defined by a package, resolved from that package
+type alias struct {
+	pkg *astutil.Package
+	def *parser.DefineTypeStatement
+}
+
+// Names are mangled so that they can't clash with C keywords, the C library
+// or the runtime: fns start with f_, types with t_, constants with k_,
+// variables with v_ and labels with l_. Variables shadowing others get a
+// number after their prefix. The fns, types and constants of imported
+// packages are named after their name in the program, as astutil.Ident
+// writes it, and generic fns are generated once for each list of type
+// arguments they are called with, as astutil.Instance names them. Methods
+// are fns named after their type and their name, as astutil.MethodOf
+// writes them. The fns the tables of the methods of interfaces point to
+// start with m_, the tables with i_ and the fns copying the values that
+// interface values point to with b_. Results are structs named after the
+// types they hold, starting with r_, and the fns printing them start with
+// w_.
+type generator struct {
+	env      env
+	aliases  map[string]*alias
+	sigs     map[string]*signature
+	generics map[string]*signature
+	methods  map[string]*signature
+	fns      []*signature
+	consts   map[*astutil.Package]map[string]*local
+	pkg      *astutil.Package
+	globals  map[string]*local
+	types    strings.Builder
+	declared map[string]bool
+
+	// Fns making the calls deferred by the others, which come before them
+	deferred strings.Builder
+
+	// Method tables of the types converted to interfaces, along with the
+	// fns they are made of
+	tables strings.Builder
+
+	// State of the fn being generated
+	astutil.Writer
+	bindings map[string]string
+	scopes   []map[string]*local
+	used     map[string]bool
+	addrs    map[string]bool
+	temps    int
+	ret      string
+	name     string
+	defers   []*parser.DeferStmt
+}
+
+// Writes C99 source for the fns, constants and type definitions of a checked
+// package, including HeaderName. Types are mapped to fixed width C types and
+// arrays to structs so that they are copied as values, and the runtime
+// checks array indexes, pointer dereferences and divisions.
+func Generate(w io.Writer, stmts []parser.IStatement) error {
+	return GenerateProgram(w, []*astutil.Package{{Stmts: stmts}})
+}
+
+// Writes C99 source for the checked packages of a program, each package
+// coming after the ones it imports. Calls to the fns of imported modules
+// are generated as calls to the fns named after their name in the program.
+func GenerateProgram(w io.Writer, pkgs []*astutil.Package) (err error) {
+	defer astutil.Catch(&err)
+
+	g := &generator{
+		aliases:  map[string]*alias{},
+		sigs:     map[string]*signature{},
+		generics: map[string]*signature{},
+		methods:  map[string]*signature{},
+		consts:   map[*astutil.Package]map[string]*local{},
+		declared: map[string]bool{},
+	}
+	g.env = env{g}
+
+	consts := []*local{}
+	for _, pkg := range pkgs {
+		for _, stmt := range pkg.Stmts {
+			if n, ok := stmt.(*parser.DefineTypeStatement); ok {
+				g.aliases[astutil.Qualify(pkg.Path, n.Name.Lexeme)] = &alias{pkg: pkg, def: n}
+			}
+		}
+	}
+	// Constants come first as they may size the arrays of the other
+	// declarations
+	for _, pkg := range pkgs {
+		g.setPackage(pkg)
+		for _, stmt := range pkg.Stmts {
+			if n, ok := stmt.(*parser.ConstDeclStmt); ok {
+				l := g.constant(n, "k_"+astutil.Ident(astutil.Qualify(pkg.Path, n.Name.Lexeme)))
+				g.globals[n.Name.Lexeme] = l
+				consts = append(consts, l)
+			}
+		}
+	}
+	for _, pkg := range pkgs {
+		g.setPackage(pkg)
+		for _, stmt := range pkg.Stmts {
+			switch n := stmt.(type) {
+			case *parser.DefineTypeStatement:
+				g.typedef(astutil.Qualify(pkg.Path, n.Name.Lexeme))
+			case *parser.FnDeclStmt:
+				name := astutil.Qualify(pkg.Path, n.Name.Lexeme)
+				if len(n.TypeParams) > 0 {
+					g.generics[name] = &signature{name: name, pkg: pkg, decl: n}
+					continue
+				}
+				sig := g.signature(pkg, n, name, nil)
+				g.sigs[name] = sig
+				g.fns = append(g.fns, sig)
+			case *parser.ImplStmt:
+				t := astutil.Qualify(pkg.Path, n.Type.Lexeme)
+				for _, m := range n.Methods {
+					if len(m.TypeParams) > 0 {
+						astutil.Fail(m, "generic methods are not supported by the C backend")
+					}
+					name := astutil.MethodOf(t, m.Name.Lexeme)
+					sig := g.signature(pkg, m, name, nil)
+					if len(sig.params) == 0 || sig.params[0].Name.Lexeme != "self" {
+						astutil.Fail(m, "methods without self are not supported by the C backend")
+					}
+					g.sigs[name] = sig
+					g.fns = append(g.fns, sig)
+				}
+			case *parser.ConstDeclStmt, *parser.ImportStmt:
+			default:
+				g.unsupported(stmt)
+			}
+		}
+	}
+
+	main, ok := g.sigs["main"]
+	if !ok {
+		return fmt.Errorf("no main fn")
+	}
+	if len(main.params) > 0 {
+		return fmt.Errorf("main takes no params")
+	}
+
+	// The instances of generic fns are added to the fns as they are called,
+	// so the prototypes are written once all the fns are
+	var defs strings.Builder
+	g.W = &defs
+	for i := 0; i < len(g.fns); i++ {
+		g.Line("")
+		g.fn(g.fns[i])
+	}
+	var out strings.Builder
+	g.W = &out
+	for _, l := range consts {
+		g.Line("static const %s = %s;", g.declaration(l.typ, l.name), g.constValue(l))
+	}
+	if len(consts) > 0 {
+		g.Line("")
+	}
+	for _, fn := range g.fns {
+		g.Line("%s;", g.prototype(fn, nil))
+	}
+	out.WriteString(g.tables.String())
+	out.WriteString(g.deferred.String())
+	out.WriteString(defs.String())
+	g.W = &out
+
+	g.Line("")
+	g.Line("int main(void)\n{")
+	if main.ret == "void" {
+		g.Line("\tf_main();\n\treturn 0;")
+	} else {
+		g.Line("\treturn (int)f_main();")
+	}
+	g.Line("}")
+
+	src := "#include \"" + HeaderName + "\"\n\n"
+	if g.types.Len() > 0 {
+		src += g.types.String() + "\n"
+	}
+	_, err = io.WriteString(w, src+out.String())
+	return err
+}
+
+func (g *generator) unsupported(node any) {
+	g.env.Unsupported(node, strings.TrimPrefix(fmt.Sprintf("%T", node), "*parser."))
+}
+
+// Returns the C type of t, defining the structs of the array types it uses
+func (g *generator) cType(t string) string {
+	switch t {
+	case "int":
+		return "int64_t"
+	case "uint":
+		return "uint64_t"
+	case "char":
+		return "uint8_t"
+	case "bool", "void":
+		return t
+	case "float":
+		return "double"
+	case "string":
+		return "yal_string"
+	case "NULL":
+		return "void *"
+	}
+	switch {
+	case strings.HasPrefix(t, "*"):
+		return strings.TrimSuffix(g.cType(t[1:]), " ") + " *"
+	case strings.HasPrefix(t, "["):
+		name := mangle(t)
+		if !g.declared[name] {
+			size, elem := astutil.ArrayOf(t)
+			elemType := g.cType(elem)
+			g.declared[name] = true
+			fmt.Fprintf(&g.types, "typedef struct {\n\t%s data[%s];\n} %s;\n", elemType, size, name)
+		}
+		return name
+	case astutil.IsResult(t):
+		name := mangle(t)
+		if !g.declared[name] {
+			value, err := astutil.Outcomes(t)
+			valueType, errType := g.cType(value), g.cType(err)
+			g.declared[name] = true
+			fmt.Fprintf(&g.types, "typedef struct {\n\tbool ok;\n\t%s value;\n\t%s error;\n} %s;\n", valueType, errType, name)
+		}
+		return name
+	}
+	g.typedef(t)
+	return "t_" + astutil.Ident(t)
+}
+
+// Returns the name of the struct of array or Result type t, such as a4_int
+// for [4]int and r_int_string for Result<int, string>
+func mangle(t string) string {
+	switch {
+	case strings.HasPrefix(t, "*"):
+		return "p_" + mangle(t[1:])
+	case strings.HasPrefix(t, "["):
+		size, elem := astutil.ArrayOf(t)
+		return "a" + size + "_" + mangle(elem)
+	case astutil.IsResult(t):
+		value, err := astutil.Outcomes(t)
+		return "r_" + mangle(value) + "_" + mangle(err)
+	}
+	if _, ok := map[string]bool{"int": true, "uint": true, "char": true, "bool": true, "float": true, "string": true}[t]; ok {
+		return t
+	}
+	return "t_" + astutil.Ident(t)
+}
+
+// Defines a type as a typedef of the C type it stands for, after the types
+// it depends on
+func (g *generator) typedef(t string) {
+	name := "t_" + astutil.Ident(t)
+	if g.declared[name] {
+		return
+	}
+	if a := g.iface(t); a != nil {
+		g.ifaceDef(t, a)
+		return
+	}
+	u, ok := g.env.Defined(t)
+	if !ok {
+		astutil.Fail(g.aliases[t].def, "only definetype of a type is supported by the C backend")
+	}
+	g.declared[name] = true
+	fmt.Fprintf(&g.types, "typedef %s %s;\n", g.cType(u), name)
+}
+
+// Returns the definition of interface t, nil if t isn't one
+func (g *generator) iface(t string) *alias {
+	if a, ok := g.aliases[t]; ok && a.def.Interface != nil {
+		return a
+	}
+	return nil
+}
+
+// Defines an interface as a struct pointing to the value it holds and to
+// the table of the methods of its type, which take that pointer as self.
+// The struct is declared first as its methods may refer to it.
+func (g *generator) ifaceDef(t string, a *alias) {
+	name := "t_" + astutil.Ident(t)
+	g.declared[name] = true
+	if len(a.def.Interface.Methods) == 0 {
+		astutil.Fail(a.def, "interfaces without methods are not supported by the C backend")
+	}
+	fmt.Fprintf(&g.types, "typedef struct %s %s;\n", name, name)
+
+	fields := []string{}
+	for _, m := range a.def.Interface.Methods {
+		sig, _ := g.method(t, m.Name.Lexeme)
+		params := []string{"void *"}
+		for _, p := range sig.types[1:] {
+			params = append(params, strings.TrimSuffix(g.cType(p), " "))
+		}
+		fields = append(fields, "\t"+g.declaration(sig.ret, "(*f_"+m.Name.Lexeme+")("+strings.Join(params, ", ")+")")+";\n")
+	}
+	fmt.Fprintf(&g.types, "typedef struct {\n%s} %s__methods;\n", strings.Join(fields, ""), name)
+	fmt.Fprintf(&g.types, "struct %s {\n\tvoid *data;\n\tconst %s__methods *methods;\n};\n", name, name)
+}
+
+// Returns the signature of method name of interface t, whose self is of
+// type t
+func (g *generator) method(t string, name string) (*signature, bool) {
+	key := astutil.MethodOf(t, name)
+	if sig, ok := g.methods[key]; ok {
+		return sig, true
+	}
+	a := g.iface(t)
+	for _, m := range a.def.Interface.Methods {
+		if m.Name.Lexeme == name {
+			sig := g.signature(a.pkg, astutil.MethodDecl(a.def, m), key, nil)
+			g.methods[key] = sig
+			return sig, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the table of the methods of type t making it implement interface
+// iface, writing it along with the fns it is made of the first time
+func (g *generator) table(n any, t string, iface string) string {
+	name := "i_" + astutil.Ident(t) + "__" + astutil.Ident(iface)
+	if g.declared[name] {
+		return name
+	}
+	g.declared[name] = true
+
+	fns := []string{}
+	for _, m := range g.iface(iface).def.Interface.Methods {
+		sig, ok := g.sigs[astutil.MethodOf(t, m.Name.Lexeme)]
+		if !ok {
+			astutil.Fail(n, "type %s has no method %s", t, m.Name.Lexeme)
+		}
+		fn := "m_" + astutil.Ident(sig.name)
+		fns = append(fns, fn)
+		if g.declared[fn] {
+			continue
+		}
+		g.declared[fn] = true
+
+		params := []string{"void *self"}
+		args := []string{"*(" + g.cType(t) + " *)self"}
+		for i, p := range sig.types[1:] {
+			params = append(params, g.declaration(p, fmt.Sprintf("a%d", i+1)))
+			args = append(args, fmt.Sprintf("a%d", i+1))
+		}
+		call := "f_" + astutil.Ident(sig.name) + "(" + strings.Join(args, ", ") + ");"
+		if sig.ret != "void" {
+			call = "return " + call
+		}
+		fmt.Fprintf(&g.tables, "\nstatic %s\n{\n\t%s\n}\n", g.declaration(sig.ret, fn+"("+strings.Join(params, ", ")+")"), call)
+	}
+	fmt.Fprintf(&g.tables, "\nstatic const t_%s__methods %s = {%s};\n", astutil.Ident(iface), name, strings.Join(fns, ", "))
+	return name
+}
+
+// Returns C converting value v of type t to interface iface, which points
+// to a copy of it
+func (g *generator) convert(n any, v string, t string, iface string) string {
+	if g.iface(t) != nil {
+		astutil.Fail(n, "converting %s to %s is not supported by the C backend", t, iface)
+	}
+	table := g.table(n, t, iface)
+	box := "b_" + astutil.Ident(t)
+	if !g.declared[box] {
+		g.declared[box] = true
+		c := g.cType(t)
+		fmt.Fprintf(&g.tables, "\nstatic void *%s(%s v)\n{\n\t%s *p = yal_alloc(sizeof *p);\n\t*p = v;\n\treturn p;\n}\n", box, c, c)
+	}
+	return fmt.Sprintf("((t_%s){%s(%s), &%s})", astutil.Ident(iface), box, astutil.Unparen(v), table)
+}
+
+// Makes the declarations of pkg the ones in scope
+func (g *generator) setPackage(pkg *astutil.Package) {
+	if g.consts[pkg] == nil {
+		g.consts[pkg] = map[string]*local{}
+	}
+	g.pkg, g.globals = pkg, g.consts[pkg]
+}
+
+func (g *generator) lookup(name string) *local {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if l, ok := g.scopes[i][name]; ok {
+			return l
+		}
+	}
+	return g.globals[name]
+}
+
+// Reports whether name refers to a variable or a constant in scope
+func (g *generator) isLocal(name string) bool {
+	return g.lookup(name) != nil
+}
+
+// Declares a constant as name
+func (g *generator) constant(n *parser.ConstDeclStmt, name string) *local {
+	v, t := astutil.Constant(g.env, n)
+	return &local{name: name, typ: t, konst: &v}
+}
+
+func (g *generator) constValue(l *local) string {
+	if l.konst.IsBool {
+		return fmt.Sprint(l.konst.Bool)
+	}
+	return intLiteral(l.konst.Int, astutil.Underlying(g.env, l.typ))
+}
+
+// Returns a C literal of integer type t holding v, wrapped around to the
+// width of t
+func intLiteral(v *big.Int, t string) string {
+	bits := new(big.Int).And(v, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	switch {
+	case t == "uint":
+		return fmt.Sprintf("UINT64_C(%d)", bits)
+	case t == "char":
+		return fmt.Sprint(uint8(bits))
+	case int64(bits) == -1<<63:
+		return "INT64_MIN"
+	case int64(bits) < -1<<31 || int64(bits) >= 1<<31:
+		return fmt.Sprintf("INT64_C(%d)", int64(bits))
+	}
+	return fmt.Sprint(int64(bits))
+}
+
+// Returns the signature of a fn of pkg named name, its type parameters
+// bound by bindings
+func (g *generator) signature(pkg *astutil.Package, fn *parser.FnDeclStmt, name string, bindings map[string]string) *signature {
+	// Types are resolved from the package of the fn, out of the fn being
+	// generated
+	defer func(pkg *astutil.Package, bound map[string]string, scopes []map[string]*local) {
+		g.setPackage(pkg)
+		g.bindings, g.scopes = bound, scopes
+	}(g.pkg, g.bindings, g.scopes)
+	g.setPackage(pkg)
+	g.bindings, g.scopes = bindings, nil
+
+	sig := &signature{name: name, pkg: pkg, decl: fn, bindings: bindings, params: astutil.ParamDecls(fn.Args), ret: astutil.TypeOf(g.env, fn.Type)}
+	for _, p := range sig.params {
+		if _, ok := p.Type.(*parser.VariadicType); ok {
+			astutil.Fail(p, "variadic params are not supported by the C backend")
+		}
+		sig.types = append(sig.types, astutil.TypeOf(g.env, p.Type))
+	}
+	return sig
+}
+
+// Returns the signature of the instance of a generic fn a call is to,
+// adding it to the fns to generate the first time it is called
+func (g *generator) instantiate(n *parser.FnCall, generic *signature) *signature {
+	types := astutil.TypeArgs(g.env, n, generic.decl)
+	name := astutil.Instance(generic.name, types)
+	if sig, ok := g.sigs[name]; ok {
+		return sig
+	}
+
+	bindings := map[string]string{}
+	for i, param := range generic.decl.TypeParams {
+		bindings[param.Name.Lexeme] = types[i]
+	}
+	sig := g.signature(generic.pkg, generic.decl, name, bindings)
+	g.sigs[name] = sig
+	g.fns = append(g.fns, sig)
+	return sig
+}
+
+// Returns the C declaration of a fn, naming its params with names
+func (g *generator) prototype(sig *signature, names []string) string {
+	params := []string{}
+	for i, t := range sig.types {
+		p := strings.TrimSuffix(g.cType(t), " ")
+		if names != nil {
+			p = g.declaration(t, names[i])
+		}
+		params = append(params, p)
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	return g.declaration(sig.ret, "f_"+astutil.Ident(sig.name)+"("+strings.Join(params, ", ")+")")
+}
+
+// Returns the declaration of name with type t
+func (g *generator) declaration(t string, name string) string {
+	c := g.cType(t)
+	if strings.HasSuffix(c, "*") {
+		return c + name
+	}
+	return c + " " + name
+}
+
+func (g *generator) fn(sig *signature) {
+	fn := sig.decl
+	g.setPackage(sig.pkg)
+	g.bindings = sig.bindings
+	g.ret = sig.ret
+	g.scopes = []map[string]*local{{}}
+	g.used = map[string]bool{}
+	g.addrs = map[string]bool{}
+	g.temps = 0
+	g.name = astutil.Ident(sig.name)
+	astutil.Addressed(fn.Body, g.addrs)
+	g.defers = deferStmts(fn.Body, g.addrs)
+
+	names := []string{}
+	params := []*local{}
+	for i, p := range sig.params {
+		l := g.declare(p.Name.Lexeme, sig.types[i])
+		names = append(names, l.name)
+		if l.addr {
+			names[i] = g.fresh(p.Name.Lexeme)
+		}
+		params = append(params, l)
+	}
+
+	g.Line("%s\n{", g.prototype(sig, names))
+	g.Depth = 1
+	if len(g.defers) > 0 {
+		g.Line("yal_frame defers;")
+		g.Line("yal_enter(&defers);")
+	}
+	for i, l := range params {
+		if l.addr {
+			g.Line("%s = yal_alloc(sizeof *%s);", g.declaration("*"+l.typ, l.name), l.name)
+			g.Line("*%s = %s;", l.name, names[i])
+		}
+	}
+
+	var sink func(parser.IExpression)
+	if sig.ret != "void" {
+		sink = g.returnSink
+	}
+	if body, ok := fn.Body.(*parser.Block); ok {
+		g.stmts(body.Statements, sink)
+	} else {
+		g.stmt(fn.Body, sink)
+	}
+	if len(g.defers) > 0 && sig.ret == "void" {
+		g.Line("yal_leave(&defers);")
+	}
+	g.Depth = 0
+	g.Line("}")
+}
+
+// Returns an unused C name for variable name
+func (g *generator) fresh(name string) string {
+	c := "v_" + name
+	for i := 2; g.used[c]; i++ {
+		c = fmt.Sprintf("v%d_%s", i, name)
+	}
+	g.used[c] = true
+	return c
+}
+
+// Declares a variable in the innermost scope
+func (g *generator) declare(name string, t string) *local {
+	l := &local{name: g.fresh(name), typ: t, addr: g.addrs[name]}
+	g.scopes[len(g.scopes)-1][name] = l
+	return l
+}
+
+// Returns the defer statements within node, adding the names of the
+// variables their expressions refer to to names: those are allocated on the
+// heap as well, for the deferred calls to see the values they hold when the
+// fn returns.
+func deferStmts(node any, names map[string]bool) []*parser.DeferStmt {
+	defers := []*parser.DeferStmt{}
+	astutil.Visit(node, func(node any) {
+		if n, ok := node.(*parser.DeferStmt); ok {
+			defers = append(defers, n)
+			for _, name := range referred(n.Expr) {
+				names[name.Lexeme] = true
+			}
+		}
+	})
+	return defers
+}
+
+// Returns the names of the variables or constants an expression refers to
+func referred(expr parser.IExpression) []*lexer.Token {
+	names := []*lexer.Token{}
+	astutil.Visit(expr, func(node any) {
+		switch n := node.(type) {
+		case *parser.Variable:
+			names = append(names, n.Name)
+		case *parser.Assign:
+			if n.Target == nil {
+				names = append(names, n.Name)
+			}
+		}
+	})
+	return names
+}
@@ -0,0 +1,149 @@
+package cgen_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yal/astutil"
+	"yal/cgen"
+	"yal/internal/backendtest"
+)
+
+// Compiles src with the system C compiler and runs it, returning what it
+// writes to stdout and stderr and its exit code. C being generated from the
+// AST, there is no level to optimize at.
+func run(t *testing.T, src string, _ int) (string, string, int) {
+	return runPackages(t, []*astutil.Package{{Stmts: backendtest.Parse(t, src)}})
+}
+
+// Compiles the packages of a program with the system C compiler and runs
+// it like run
+func runPackages(t *testing.T, pkgs []*astutil.Package) (string, string, int) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is needed to compile programs")
+	}
+
+	var c strings.Builder
+	if err := cgen.GenerateProgram(&c, pkgs); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, cgen.HeaderName), []byte(cgen.Header), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.c"), []byte(c.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "main")
+	cc := exec.Command("cc", "-std=c99", "-pedantic", "-Wall", "-Werror", "-Wno-unused", "-o", out, "main.c")
+	cc.Dir = dir
+	if msg, err := cc.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s\n%s", err, msg, c.String())
+	}
+
+	var stdout, stderr strings.Builder
+	cmd := exec.Command(out)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestRun(t *testing.T) {
+	backendtest.RunPrograms(t, 0, run)
+
+	t.Run("Test floats", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Floats, 0, run)
+	})
+
+	t.Run("Test interfaces", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Interfaces, 0, run)
+	})
+
+	t.Run("Test results", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Results, 0, run)
+	})
+}
+
+func TestArrays(t *testing.T) {
+	out, _, code := run(t, backendtest.Arrays, 0)
+	if out != backendtest.ArraysOutput || code != 0 {
+		t.Errorf("expected %q and exit code 0, got %q and %d\n", backendtest.ArraysOutput, out, code)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	out, stderr, code := run(t, backendtest.Defer, 0)
+	if out != backendtest.DeferOutput || stderr != "line 13 column 6: division by zero\n" || code != 1 {
+		t.Errorf("expected %q, %q and exit code 1, got %q, %q and %d\n", backendtest.DeferOutput, "line 13 column 6: division by zero\n", out, stderr, code)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	out, _, code := runPackages(t, backendtest.ParsePackages(t, backendtest.Packages))
+	if out != backendtest.PackagesOutput || code != 0 {
+		t.Errorf("expected %q and exit code 0, got %q and %d\n", backendtest.PackagesOutput, out, code)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":            `fn main() : void { print(1); panic("oops", 2); }`,
+		"Test division by zero": `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test index":            `fn main() : int { let a: [3]int; let i = 3; return a[i]; }`,
+		"Test null pointer":     `fn main() : int { let p: *int = NULL; return *p; }`,
+		"Test null interface":   `definetype Shape = interface { fn area(self) : int; }; fn main() : int { let s: Shape; s.area() }`,
+	}
+	msgs := map[string]string{
+		"Test panic":            "panic: oops 2\n",
+		"Test division by zero": "line 1 column 34: division by zero\n",
+		"Test index":            "line 1 column 53: index 3 out of range [0, 3)\n",
+		"Test null pointer":     "line 1 column 46: null pointer dereference\n",
+		"Test null interface":   "line 1 column 89: method area of a null interface value\n",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, stderr, code := run(t, src, 0)
+			if stderr != msgs[name] || code != 1 {
+				t.Errorf("expected %q and exit code 1, got %q and %d\n", msgs[name], stderr, code)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := map[string]string{
+		"Test no main":         `fn f() : void {}`,
+		"Test fn values":       `fn f() : void {} fn main() : void { let g = f; }`,
+		"Test unsupported":     `fn main() : void { spawn main(); }`,
+		"Test printing array":  `fn main() : void { let a: [2]int; print(a); }`,
+		"Test generic methods": `definetype N = int; impl N { fn get<T>(self) : int { 0 } } fn main() : void {}`,
+		"Test recover":         `fn main() : void { recover(); }`,
+		"Test untyped result":  `fn main() : void { let r = Ok(1); }`,
+	}
+	errs := map[string]string{
+		"Test no main":         "no main fn",
+		"Test fn values":       "line 1 column 45: fn values are not supported by the C backend",
+		"Test unsupported":     "line 1 column 24: SpawnStmt is not supported by the C backend",
+		"Test printing array":  "line 1 column 40: printing [2]int is not supported by the C backend",
+		"Test generic methods": "line 1 column 35: generic methods are not supported by the C backend",
+		"Test recover":         "line 1 column 27: recover is not supported by the C backend",
+		"Test untyped result":  "line 1 column 30: Ok used where the type of its Result isn't known",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := cgen.Generate(&strings.Builder{}, backendtest.Parse(t, src))
+			if err == nil || err.Error() != errs[name] {
+				t.Errorf("expected %q, got %v\n", errs[name], err)
+			}
+		})
+	}
+}
@@ -0,0 +1,820 @@
+package cgen
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"yal/astutil"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+var binaryOps = map[lexer.TokenType]string{
+	lexer.Plus:           "+",
+	lexer.Minus:          "-",
+	lexer.Star:           "*",
+	lexer.Slash:          "/",
+	lexer.Rem:            "%",
+	lexer.Ampersand:      "&",
+	lexer.Pipe:           "|",
+	lexer.Xor:            "^",
+	lexer.Shl:            "<<",
+	lexer.Shr:            ">>",
+	lexer.EqualEqual:     "==",
+	lexer.BangEqual:      "!=",
+	lexer.Lesser:         "<",
+	lexer.LesserEqual:    "<=",
+	lexer.Greater:        ">",
+	lexer.GreaterEqual:   ">=",
+	lexer.PlusEqual:      "+",
+	lexer.MinusEqual:     "-",
+	lexer.StarEqual:      "*",
+	lexer.SlashEqual:     "/",
+	lexer.RemEqual:       "%",
+	lexer.AmpersandEqual: "&",
+	lexer.PipeEqual:      "|",
+	lexer.XorEqual:       "^",
+	lexer.ShlEqual:       "<<",
+	lexer.ShrEqual:       ">>",
+	lexer.Inc:            "+",
+	lexer.Dec:            "-",
+}
+
+// Runtime helpers of the int operations that would overflow or divide by
+// zero in C, and of the uint ones
+var intHelpers = map[string]string{
+	"+":  "yal_add",
+	"-":  "yal_sub",
+	"*":  "yal_mul",
+	"/":  "yal_div",
+	"%":  "yal_rem",
+	"<<": "yal_shl",
+	">>": "yal_shr",
+}
+
+var uintHelpers = map[string]string{
+	"/":  "yal_udiv",
+	"%":  "yal_urem",
+	"<<": "yal_ushl",
+	">>": "yal_ushr",
+}
+
+// Returns C evaluating an expression, compound ones being parenthesized,
+// and writes the statements it needs to run first. Integer constants take
+// the type hint when it is numeric.
+//
+// Since C leaves the order in which operands are evaluated unspecified, the
+// operands that must be evaluated before others are stored in temporaries.
+// Values of other types are converted to the interface the hint is.
+func (g *generator) expr(expr parser.IExpression, hint string) string {
+	if g.iface(hint) != nil {
+		if t := astutil.ExprType(g.env, expr); t != hint && t != "NULL" && t != "" {
+			return g.convert(expr, g.expr(expr, t), t, hint)
+		}
+	}
+
+	switch n := expr.(type) {
+	case *parser.Literal:
+		return g.literal(n, hint)
+	case *parser.Variable:
+		return g.variable(n.Name)
+	case *parser.Grouping:
+		return g.expr(n.Grouped, hint)
+	case *parser.Binary:
+		return g.binary(n, hint)
+	case *parser.Logical:
+		return g.logical(n.Left, n.Operator, n.Right)
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			return "(!" + g.expr(n.Right, "bool") + ")"
+		}
+		t := astutil.OperandType(g.env, hint, n.Right)
+		if lit, ok := n.Right.(*parser.Literal); ok && astutil.IsNumber(lit.Value) && astutil.Underlying(g.env, t) == "int" {
+			v, err := consteval.Eval(n, nil)
+			if err != nil {
+				astutil.Fail(n, "%v", err)
+			}
+			return intLiteral(v.Int, "int")
+		}
+		v := g.expr(n.Right, t)
+		switch astutil.Underlying(g.env, t) {
+		case "int":
+			return "yal_neg(" + astutil.Unparen(v) + ")"
+		case "char":
+			return "((uint8_t)-" + v + ")"
+		}
+		return "(-" + v + ")"
+	case *parser.Assign:
+		return g.assign(n)
+	case *parser.PrefixIncDec:
+		return g.incDec(n.Target, n.Operator, true)
+	case *parser.PostfixIncDec:
+		return g.incDec(n.Target, n.Operator, false)
+	case *parser.AddressOf:
+		v, ok := n.Operand.(*parser.Variable)
+		if !ok {
+			astutil.Fail(n, "only the address of variables is supported by the C backend")
+		}
+		l := g.resolve(v.Name)
+		if l.konst != nil {
+			astutil.Fail(n, "cannot take the address of constant %s", v.Name.Lexeme)
+		}
+		return l.name
+	case *parser.Deref:
+		return g.deref(n, g.expr(n.Operand, ""))
+	case *parser.Index:
+		return g.index(n, false)
+	case *parser.FnCall:
+		return g.call(n, hint)
+	case *parser.IfExpr:
+		return g.ifValue(n, hint)
+	case *parser.Try:
+		return g.try(n)
+	case *parser.MatchExpr:
+		return g.matchValue(n, hint)
+	}
+	g.unsupported(expr)
+	return ""
+}
+
+func (g *generator) literal(n *parser.Literal, hint string) string {
+	tk := n.Value
+	switch {
+	case tk == nil:
+		return g.zero(hint)
+	case tk.TokenType == lexer.True || tk.TokenType == lexer.False:
+		return strconv.FormatBool(tk.TokenType == lexer.True)
+	case tk.TokenType == lexer.String:
+		return fmt.Sprintf("yal_str(%s, %d)", quote(tk.Lexeme), len(tk.Lexeme))
+	case tk.TokenType == lexer.Null:
+		if g.iface(hint) != nil {
+			return "((" + g.cType(hint) + "){NULL, NULL})"
+		}
+		return "NULL"
+	case astutil.IsNumber(tk) && strings.Contains(tk.Lexeme, "."):
+		f, err := strconv.ParseFloat(tk.Lexeme, 64)
+		if err != nil {
+			astutil.Fail(n, "invalid float literal %s", tk.Lexeme)
+		}
+		return floatLiteral(f)
+	case astutil.IsNumber(tk):
+		v, err := consteval.Eval(n, nil)
+		if err != nil {
+			astutil.Fail(n, "%v", err)
+		}
+		switch u := astutil.Underlying(g.env, hint); u {
+		case "float":
+			f, _ := new(big.Float).SetInt(v.Int).Float64()
+			return floatLiteral(f)
+		case "uint", "char":
+			return intLiteral(v.Int, u)
+		}
+		return intLiteral(v.Int, "int")
+	}
+	g.unsupported(n)
+	return ""
+}
+
+func floatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// Quotes a string as a C string literal, escaping the bytes that aren't
+// printable ASCII along with the ones starting escapes and trigraphs
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\' || c == '?':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (g *generator) resolve(name *lexer.Token) *local {
+	l := g.lookup(name.Lexeme)
+	if l == nil {
+		fn := astutil.Qualify(g.pkg.Path, name.Lexeme)
+		if _, ok := g.sigs[fn]; ok || g.generics[fn] != nil {
+			astutil.Fail(name, "fn values are not supported by the C backend")
+		}
+		astutil.Fail(name, "unknown variable %s", name.Lexeme)
+	}
+	return l
+}
+
+func (g *generator) variable(name *lexer.Token) string {
+	l := g.resolve(name)
+	if l.addr {
+		return "(*" + l.name + ")"
+	}
+	return l.name
+}
+
+func (g *generator) binary(n *parser.Binary, hint string) string {
+	if astutil.IsLogical(n.Operator.TokenType) {
+		return g.logical(n.Left, n.Operator, n.Right)
+	}
+
+	t := astutil.OperandType(g.env, hint, n.Left, n.Right)
+	if astutil.IsShift(n.Operator.TokenType) {
+		t = astutil.OperandType(g.env, hint, n.Left)
+	}
+	ops := g.operands([]parser.IExpression{n.Left, n.Right}, []string{t, t}, 2)
+
+	op := binaryOps[n.Operator.TokenType]
+	if astutil.IsCompare(n.Operator.TokenType) {
+		return g.compare(n, op, t, ops[0], ops[1])
+	}
+	return g.arith(n.Operator, op, t, ops[0], ops[1])
+}
+
+func (g *generator) compare(n any, op string, t string, l string, r string) string {
+	switch u := astutil.Underlying(g.env, t); {
+	case u == "string":
+		return fmt.Sprintf("(yal_compare(%s, %s) %s 0)", l, r, op)
+	case strings.HasPrefix(u, "["):
+		astutil.Fail(n, "comparing arrays is not supported by the C backend")
+	case g.iface(u) != nil:
+		// Interface values are the same when they point to the same copy
+		return fmt.Sprintf("((%s).data %s (%s).data)", astutil.Unparen(l), op, astutil.Unparen(r))
+	case astutil.IsResult(u):
+		astutil.Fail(n, "comparing Results is not supported by the C backend")
+	}
+	return fmt.Sprintf("(%s %s %s)", l, op, r)
+}
+
+// Returns C applying arithmetic operator op to operands of type t, tk being
+// where the operator is written
+func (g *generator) arith(tk *lexer.Token, op string, t string, l string, r string) string {
+	native := fmt.Sprintf("(%s %s %s)", l, op, r)
+	helper := func(name string) string {
+		if op == "/" || op == "%" {
+			return fmt.Sprintf("%s(%s, %s, %d, %d)", name, astutil.Unparen(l), astutil.Unparen(r), tk.Line, tk.Column)
+		}
+		return fmt.Sprintf("%s(%s, %s)", name, astutil.Unparen(l), astutil.Unparen(r))
+	}
+
+	switch u := astutil.Underlying(g.env, t); {
+	case op == "&" || op == "|" || op == "^":
+		if u == "int" || u == "uint" || u == "char" || u == "bool" {
+			return native
+		}
+	case u == "int":
+		return helper(intHelpers[op])
+	case u == "uint":
+		if name, ok := uintHelpers[op]; ok {
+			return helper(name)
+		}
+		return native
+	case u == "char":
+		if name, ok := uintHelpers[op]; ok {
+			return "((uint8_t)" + helper(name) + ")"
+		}
+		return "((uint8_t)" + native + ")"
+	case u == "float":
+		if op != "%" && op != "<<" && op != ">>" {
+			return native
+		}
+	case u == "string":
+		if op == "+" {
+			return helper("yal_concat")
+		}
+	}
+	astutil.Fail(tk, "operator %s on %s is not supported by the C backend", tk.Lexeme, t)
+	return ""
+}
+
+// Generates && and ||, whose right operand is only evaluated, along with
+// the statements it needs, when the left one doesn't decide the result
+func (g *generator) logical(left parser.IExpression, operator *lexer.Token, right parser.IExpression) string {
+	l := g.expr(left, "bool")
+	r, pre := g.Split(g.Depth+1, func() string { return g.expr(right, "bool") })
+	op := "||"
+	if operator.TokenType == lexer.DoubleAmpersand {
+		op = "&&"
+	}
+	if pre == "" {
+		return fmt.Sprintf("(%s %s %s)", l, op, r)
+	}
+
+	v := g.temp("bool", l)
+	if op == "&&" {
+		g.Line("if (%s) {", v)
+	} else {
+		g.Line("if (!%s) {", v)
+	}
+	g.W.WriteString(pre)
+	g.Line("\t%s = %s;", v, astutil.Unparen(r))
+	g.Line("}")
+	return v
+}
+
+// Generates an if used as a value, assigning the values of its branches to
+// a temporary
+func (g *generator) ifValue(n *parser.IfExpr, hint string) string {
+	if n.ElseBranch == nil {
+		astutil.Fail(n, "if without else used as a value")
+	}
+	t := g.joinType(astutil.ExprType(g.env, n), hint)
+
+	g.temps++
+	v := fmt.Sprintf("tmp%d", g.temps)
+	g.Line("%s;", g.declaration(t, v))
+	g.ifStmt(n, g.assignSink(v, t))
+	return v
+}
+
+// Generates a match used as a value, assigning the values of its arms to a
+// temporary
+func (g *generator) matchValue(n *parser.MatchExpr, hint string) string {
+	t := g.joinType(astutil.ExprType(g.env, n), hint)
+
+	g.temps++
+	v := fmt.Sprintf("tmp%d", g.temps)
+	g.Line("%s;", g.declaration(t, v))
+	g.matchStmt(n, g.assignSink(v, t))
+	return v
+}
+
+// Returns the type of the value of an if or a match whose first branch
+// evaluates to a value of type t, which is given by the hint when it is an
+// integer constant, NULL, or a Result that Ok or Err make
+func (g *generator) joinType(t string, hint string) string {
+	switch {
+	case t != "" && t != "NULL":
+		return t
+	case astutil.IsPointer(hint) || astutil.IsResult(astutil.Underlying(g.env, hint)):
+		return hint
+	}
+	return astutil.OperandType(g.env, hint)
+}
+
+// Generates ?, which returns the error of a Result holding one from the fn
+// being generated, once it made the calls it deferred, and evaluates to the
+// value it holds otherwise
+func (g *generator) try(n *parser.Try) string {
+	t := astutil.ExprType(g.env, n.Operand)
+	u := astutil.Underlying(g.env, t)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "? applied to a value of type %s instead of a Result", t)
+	}
+	ret := astutil.Underlying(g.env, g.ret)
+	if !astutil.IsResult(ret) {
+		astutil.Fail(n, "? used in a fn returning %s instead of a Result", g.ret)
+	}
+	_, err := astutil.Outcomes(u)
+	if _, want := astutil.Outcomes(ret); err != want {
+		astutil.Fail(n, "? propagates %s errors from a fn returning %s errors", err, want)
+	}
+
+	r := g.expr(n.Operand, t)
+	if !isIdent(r) {
+		r = g.temp(t, r)
+	}
+	g.Line("if (!%s.ok) {", r)
+	g.Depth++
+	v := fmt.Sprintf("(%s){.error = %s.error}", g.cType(g.ret), r)
+	if len(g.defers) > 0 {
+		v = g.temp(g.ret, v)
+		g.leave()
+	}
+	g.Line("return %s;", v)
+	g.Depth--
+	g.Line("}")
+	return r + ".value"
+}
+
+func (g *generator) deref(n *parser.Deref, p string) string {
+	t := astutil.Underlying(g.env, astutil.ExprType(g.env, n.Operand))
+	if !strings.HasPrefix(t, "*") {
+		astutil.Fail(n, "dereferencing NULL")
+	}
+	return fmt.Sprintf("(*(%s)yal_nonnull(%s, %d, %d))", g.cType(t), astutil.Unparen(p), n.Line, n.Column)
+}
+
+// Generates an array index, checked against the length of the array. The
+// index is stored in a temporary when hoist is set, so that the element can
+// be referred to again after evaluating other expressions.
+func (g *generator) index(n *parser.Index, hoist bool) string {
+	t := astutil.Underlying(g.env, astutil.ExprType(g.env, n.Object))
+	if !strings.HasPrefix(t, "[") {
+		astutil.Fail(n, "only arrays can be indexed by the C backend")
+	}
+	size, _ := astutil.ArrayOf(t)
+
+	var obj string
+	switch o := n.Object.(type) {
+	case *parser.Variable, *parser.Grouping:
+		obj = g.expr(o, "")
+	case *parser.Deref:
+		obj = g.pointee(o, hoist)
+	case *parser.Index:
+		obj = g.index(o, hoist)
+	default:
+		// Indexing a struct returned by a call doesn't give an lvalue
+		obj = g.temp(t, g.expr(o, ""))
+	}
+
+	i := g.expr(n.Index, "int")
+	if (hoist || astutil.Effects(n.Index)) && !g.isConstant(n.Index) {
+		i = g.temp(astutil.ValueType(g.env, n.Index, "int"), i)
+	}
+	return fmt.Sprintf("%s.data[yal_index(%s, %s, %d, %d)]", obj, astutil.Unparen(i), size, n.Line, n.Column)
+}
+
+// Generates a pointer dereference, storing the pointer in a temporary when
+// hoist is set so that it can be referred to again after evaluating other
+// expressions
+func (g *generator) pointee(n *parser.Deref, hoist bool) string {
+	p := g.expr(n.Operand, "")
+	if hoist && !g.isConstant(n.Operand) {
+		p = g.temp(astutil.ExprType(g.env, n.Operand), p)
+	}
+	return g.deref(n, p)
+}
+
+// Generates an assignment, which evaluates to the assigned value. The
+// target is evaluated before the value, and compound assignments apply
+// their operator to the value the target holds once the value is
+// evaluated.
+func (g *generator) assign(n *parser.Assign) string {
+	compound := n.Operator.TokenType != lexer.Equal
+	lv, t := astutil.Lvalue(g.env, n.Name, n.Target, astutil.Effects(n.Expr) || compound && astutil.Effects(n.Target))
+	v := g.expr(n.Expr, t)
+	if !compound {
+		return fmt.Sprintf("(%s = %s)", lv, astutil.Unparen(v))
+	}
+
+	if astutil.Effects(n.Expr) {
+		v = g.temp(astutil.ValueType(g.env, n.Expr, t), v)
+	}
+	return fmt.Sprintf("(%s = %s)", lv, astutil.Unparen(g.arith(n.Operator, binaryOps[n.Operator.TokenType], t, lv, v)))
+}
+
+// Generates ++ and --, which evaluate to the updated value when prefixed and
+// to the value held before otherwise
+func (g *generator) incDec(target parser.IExpression, op *lexer.Token, prefix bool) string {
+	lv, t := astutil.Lvalue(g.env, nil, target, astutil.Effects(target))
+	if u := astutil.Underlying(g.env, t); u != "int" {
+		if u != "uint" && u != "char" && u != "float" {
+			astutil.Fail(op, "operator %s on %s is not supported by the C backend", op.Lexeme, t)
+		}
+		if prefix {
+			return "(" + op.Lexeme + lv + ")"
+		}
+		return "(" + lv + op.Lexeme + ")"
+	}
+
+	update := fmt.Sprintf("%s = %s", lv, g.arith(op, binaryOps[op.TokenType], t, lv, "1"))
+	if prefix {
+		return "(" + update + ")"
+	}
+	v := g.temp(t, lv)
+	g.Line("%s;", update)
+	return v
+}
+
+// Generates a call, the type of the Result Ok and Err make being given by
+// the hint
+func (g *generator) call(n *parser.FnCall, hint string) string {
+	name := g.pkg.Callee(n, g.isLocal)
+	field := g.pkg.Method(n, g.isLocal)
+	switch {
+	case field != nil:
+		name = astutil.MethodOf(astutil.ExprType(g.env, field.Object), field.Name.Lexeme)
+	case name == "":
+		astutil.Fail(n, "calls to fn values are not supported by the C backend")
+	case n.Callee == nil && (n.Name.Lexeme == "print" || n.Name.Lexeme == "panic"):
+		return g.print(n)
+	case n.Callee == nil && (n.Name.Lexeme == "Ok" || n.Name.Lexeme == "Err"):
+		return g.variant(n, hint)
+	case n.Callee == nil && n.Name.Lexeme == "recover":
+		astutil.Fail(n, "recover is not supported by the C backend")
+	}
+	sig, ok := g.callee(n)
+	if !ok {
+		astutil.Fail(n, "unknown fn %s", name)
+	}
+
+	// Arguments are evaluated in the order they are written, then defaults.
+	// The value a method is called on comes first, as its self.
+	slots := []int{}
+	exprs := []parser.IExpression{}
+	hints := []string{}
+	first := 0
+	if field != nil {
+		slots = append(slots, 0)
+		exprs = append(exprs, field.Object)
+		hints = append(hints, sig.types[0])
+		first = 1
+	}
+	for i, arg := range n.Args {
+		i += first
+		if named, ok := arg.(*parser.NamedArg); ok {
+			for j, p := range sig.params {
+				if p.Name.Lexeme == named.Name.Lexeme {
+					i = j
+				}
+			}
+			arg = named.Value
+		}
+		slots = append(slots, i)
+		exprs = append(exprs, arg)
+		hints = append(hints, sig.types[i])
+	}
+	given := map[int]bool{}
+	for _, i := range slots {
+		given[i] = true
+	}
+	for i, p := range sig.params {
+		if !given[i] {
+			slots = append(slots, i)
+			exprs = append(exprs, p.Initializer)
+			hints = append(hints, sig.types[i])
+		}
+	}
+
+	args := make([]string, len(sig.params))
+	for i, v := range g.operands(exprs, hints, len(exprs)) {
+		args[slots[i]] = astutil.Unparen(v)
+	}
+	if field != nil && g.iface(sig.types[0]) != nil {
+		return g.dispatch(field, sig, args)
+	}
+	return "f_" + astutil.Ident(sig.name) + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Generates Ok or Err as a Result of the type the hint is, holding their
+// arg as its value or as its error
+func (g *generator) variant(n *parser.FnCall, hint string) string {
+	u := astutil.Underlying(g.env, hint)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "%s used where the type of its Result isn't known", n.Name.Lexeme)
+	}
+	value, err := astutil.Outcomes(u)
+	if n.Name.Lexeme == "Err" {
+		return fmt.Sprintf("((%s){.error = %s})", g.cType(hint), astutil.Unparen(g.expr(n.Args[0], err)))
+	}
+	return fmt.Sprintf("((%s){.ok = true, .value = %s})", g.cType(hint), astutil.Unparen(g.expr(n.Args[0], value)))
+}
+
+// Generates a call to a method of an interface value, args starting with
+// the value, through the table of the methods of the type it holds
+func (g *generator) dispatch(field *parser.Field, sig *signature, args []string) string {
+	v := args[0]
+	if !isIdent(v) {
+		v = g.temp(sig.types[0], v)
+	}
+	args[0] = v + ".data"
+	name := field.Name.Lexeme
+	table := fmt.Sprintf("((const %s__methods *)yal_methods(%s.methods, %s, %d, %d))", g.cType(sig.types[0]), v, quote(name), field.Line, field.Column)
+	return table + "->f_" + name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Reports whether s is a C identifier
+func isIdent(s string) bool {
+	for i, r := range s {
+		if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Returns the signature of the declared fn or method a call is to,
+// instantiating the generic fns
+func (g *generator) callee(n *parser.FnCall) (*signature, bool) {
+	if field := g.pkg.Method(n, g.isLocal); field != nil {
+		t := astutil.ExprType(g.env, field.Object)
+		if g.iface(t) != nil {
+			return g.method(t, field.Name.Lexeme)
+		}
+		sig, ok := g.sigs[astutil.MethodOf(t, field.Name.Lexeme)]
+		return sig, ok
+	}
+	name := g.pkg.Callee(n, g.isLocal)
+	if generic, ok := g.generics[name]; ok {
+		return g.instantiate(n, generic), true
+	}
+	sig, ok := g.sigs[name]
+	return sig, ok
+}
+
+// Generates print and panic as calls to the runtime printing their args in
+// turn. Args are all evaluated before anything is printed.
+func (g *generator) print(n *parser.FnCall) string {
+	panics := n.Name.Lexeme == "panic"
+	exprs := []parser.IExpression{}
+	hints := []string{}
+	for _, arg := range n.Args {
+		exprs = append(exprs, arg)
+		hints = append(hints, "")
+	}
+	from := 1
+	if panics {
+		from = 0
+	}
+
+	calls := []string{}
+	if panics {
+		calls = append(calls, "yal_panic_begin()")
+	}
+	for i, v := range g.operands(exprs, hints, from) {
+		if i > 0 {
+			calls = append(calls, "yal_print_space()")
+		}
+		calls = append(calls, g.printValue(n, astutil.ValueType(g.env, exprs[i], ""), v))
+	}
+	if panics {
+		calls = append(calls, "yal_panic_end()")
+	} else {
+		calls = append(calls, "yal_print_newline()")
+	}
+	if len(calls) == 1 {
+		return calls[0]
+	}
+	return "(" + strings.Join(calls, ", ") + ")"
+}
+
+// Returns C printing value v of type t
+func (g *generator) printValue(n any, t string, v string) string {
+	switch u := astutil.Underlying(g.env, t); {
+	case u == "int" || u == "uint" || u == "char" || u == "bool" || u == "float" || u == "string":
+		return "yal_print_" + u + "(" + astutil.Unparen(v) + ")"
+	case astutil.IsPointer(u):
+		return "yal_print_ptr(" + astutil.Unparen(v) + ")"
+	case astutil.IsResult(u):
+		return g.printer(n, u) + "(" + astutil.Unparen(v) + ")"
+	}
+	astutil.Fail(n, "printing %s is not supported by the C backend", t)
+	return ""
+}
+
+// Returns the fn printing Results of type t as Ok(value) or Err(error),
+// writing it the first time
+func (g *generator) printer(n any, t string) string {
+	name := "w_" + mangle(t)
+	if g.declared[name] {
+		return name
+	}
+	g.declared[name] = true
+
+	value, err := astutil.Outcomes(t)
+	ok, failed := g.printValue(n, value, "v.value"), g.printValue(n, err, "v.error")
+	fmt.Fprintf(&g.tables, "\nstatic void %s(%s v)\n{\n", name, g.cType(t))
+	fmt.Fprintf(&g.tables, "\tif (v.ok) {\n\t\tyal_print_cstring(\"Ok(\");\n\t\t%s;\n", ok)
+	fmt.Fprintf(&g.tables, "\t} else {\n\t\tyal_print_cstring(\"Err(\");\n\t\t%s;\n\t}\n", failed)
+	fmt.Fprintf(&g.tables, "\tyal_print_cstring(\")\");\n}\n")
+	return name
+}
+
+// Generates operands in turn, storing in temporaries the ones that C could
+// evaluate in another order than they are written, because they have side
+// effects or they are affected by or fail along with others. The ones that
+// are impure from index from on are stored as well.
+func (g *generator) operands(exprs []parser.IExpression, hints []string, from int) []string {
+	out := make([]string, len(exprs))
+	for i, e := range exprs {
+		out[i] = g.expr(e, hints[i])
+		if g.isConstant(e) || strings.HasPrefix(out[i], "tmp") {
+			continue
+		}
+
+		hoist := i >= from && (astutil.Effects(e) || astutil.Fails(e))
+		for _, later := range exprs[i+1:] {
+			if astutil.Effects(e) && !g.isConstant(later) || astutil.Fails(e) && astutil.Fails(later) {
+				hoist = true
+			}
+			// Only assignments change the variables whose address isn't
+			// taken
+			if v, ok := e.(*parser.Variable); ok && !g.resolve(v.Name).addr {
+				hoist = hoist || astutil.Assigns(later)
+			} else {
+				hoist = hoist || astutil.Effects(later)
+			}
+		}
+		if hoist {
+			out[i] = g.temp(astutil.ValueType(g.env, e, hints[i]), out[i])
+		}
+	}
+	return out
+}
+
+// Gives astutil the types of the names in the scopes of a generator
+type env struct {
+	g *generator
+}
+
+func (e env) VarType(name *lexer.Token) string {
+	return e.g.resolve(name).typ
+}
+
+func (e env) RetType(n *parser.FnCall) (string, bool) {
+	sig, ok := e.g.callee(n)
+	if !ok {
+		return "", false
+	}
+	return sig.ret, true
+}
+
+func (e env) Const(name *lexer.Token) (consteval.Value, bool) {
+	l := e.g.lookup(name.Lexeme)
+	if l == nil || l.konst == nil {
+		return consteval.Value{}, false
+	}
+	return *l.konst, true
+}
+
+func (e env) Named(t *parser.TypeName) (string, bool) {
+	if bound, ok := e.g.bindings[t.Name.Lexeme]; ok && t.Module == nil {
+		return bound, true
+	}
+	name := e.g.pkg.TypeRef(t)
+	a, ok := e.g.aliases[name]
+	return name, ok && (a.def.Type != nil || a.def.Interface != nil) && len(a.def.TypeParams) == 0
+}
+
+// The type is resolved from the package defining it, out of the scopes of
+// the fn being generated
+func (e env) Defined(t string) (string, bool) {
+	a, ok := e.g.aliases[t]
+	if !ok || a.def.Type == nil || len(a.def.TypeParams) > 0 {
+		return "", false
+	}
+	defer func(pkg *astutil.Package, bound map[string]string, scopes []map[string]*local) {
+		e.g.setPackage(pkg)
+		e.g.bindings, e.g.scopes = bound, scopes
+	}(e.g.pkg, e.g.bindings, e.g.scopes)
+	e.g.setPackage(a.pkg)
+	e.g.bindings, e.g.scopes = nil, nil
+	return astutil.TypeOf(e, a.def.Type), true
+}
+
+func (e env) Push() {
+	e.g.scopes = append(e.g.scopes, map[string]*local{})
+}
+
+func (e env) Pop() {
+	e.g.scopes = e.g.scopes[:len(e.g.scopes)-1]
+}
+
+func (e env) Declare(stmt parser.IStatement) {
+	switch s := stmt.(type) {
+	case *parser.VarDeclExpression:
+		e.g.scopes[len(e.g.scopes)-1][s.Name.Lexeme] = &local{typ: astutil.DeclType(e, s)}
+	case *parser.ConstDeclStmt:
+		e.g.scopes[len(e.g.scopes)-1][s.Name.Lexeme] = e.g.constant(s, "")
+	}
+}
+
+func (e env) Bind(name *lexer.Token, t string) {
+	e.g.scopes[len(e.g.scopes)-1][name.Lexeme] = &local{typ: t}
+}
+
+func (e env) Unsupported(node any, what string) {
+	astutil.Fail(node, "%s is not supported by the C backend", what)
+}
+
+func (e env) Variable(name *lexer.Token) string {
+	return e.g.variable(name)
+}
+
+func (e env) Deref(n *parser.Deref, hoist bool) string {
+	return e.g.pointee(n, hoist)
+}
+
+func (e env) Index(n *parser.Index, hoist bool) string {
+	return e.g.index(n, hoist)
+}
+
+// Reports whether an expression is a literal or a constant
+func (g *generator) isConstant(expr parser.IExpression) bool {
+	switch n := expr.(type) {
+	case *parser.Literal:
+		return true
+	case *parser.Variable:
+		l := g.lookup(n.Name.Lexeme)
+		return l != nil && l.konst != nil
+	case *parser.Grouping:
+		return g.isConstant(n.Grouped)
+	case *parser.UnaryRight:
+		return g.isConstant(n.Right)
+	}
+	return false
+}
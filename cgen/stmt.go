@@ -0,0 +1,443 @@
+package cgen
+
+import (
+	"fmt"
+	"strings"
+	"yal/astutil"
+	"yal/parser"
+)
+
+// Generates statements, passing the value the last one ends with to sink
+func (g *generator) stmts(stmts []parser.IStatement, sink func(parser.IExpression)) {
+	for i, s := range stmts {
+		if i == len(stmts)-1 {
+			g.stmt(s, sink)
+		} else {
+			g.stmt(s, nil)
+		}
+	}
+}
+
+// Generates a statement. The value of an implicit return in tail position
+// is given to sink when it is set, which is the case at the end of a fn
+// returning a value or of a branch of an if or of an arm of a match used as
+// a value.
+func (g *generator) stmt(node parser.IStatement, sink func(parser.IExpression)) {
+	switch n := node.(type) {
+	case *parser.Block:
+		g.Line("{")
+		g.body(n, sink)
+		g.Line("}")
+	case *parser.VarDeclExpression:
+		g.varDecl(n)
+	case *parser.ConstDeclStmt:
+		l := g.constant(n, g.fresh(n.Name.Lexeme))
+		g.scopes[len(g.scopes)-1][n.Name.Lexeme] = l
+		g.Line("const %s = %s;", g.declaration(l.typ, l.name), g.constValue(l))
+	case *parser.StatementExpression:
+		switch e := n.Expr.(type) {
+		case *parser.FnReturn:
+			g.stmt(e, sink)
+		case *parser.IfExpr, *parser.MatchExpr:
+			g.stmt(e, sink)
+		default:
+			g.exprStmt(e)
+		}
+	case *parser.FnReturn:
+		switch {
+		case !n.Implicit && n.Value == nil:
+			g.leave()
+			g.Line("return;")
+		case !n.Implicit:
+			g.returnSink(n.Value)
+		case sink != nil:
+			sink(n.Value)
+		default:
+			g.exprStmt(n.Value)
+		}
+	case *parser.IfExpr:
+		g.ifStmt(n, sink)
+	case *parser.MatchExpr:
+		g.matchStmt(n, sink)
+	case *parser.WhileLoop:
+		g.loop(nil, n.Condition, nil, n.Body)
+	case *parser.ForLoop:
+		g.Line("{")
+		g.Depth++
+		g.scopes = append(g.scopes, map[string]*local{})
+		if n.Initializer != nil {
+			g.stmt(n.Initializer, nil)
+		}
+		g.loop(n.Initializer, n.Condition, n.Apply, n.Body)
+		g.scopes = g.scopes[:len(g.scopes)-1]
+		g.Depth--
+		g.Line("}")
+	case *parser.SwitchStmt:
+		g.switchStmt(n, sink)
+	case *parser.BreakStmt:
+		g.Line("break;")
+	case *parser.ContinueStmt:
+		g.Line("continue;")
+	case *parser.GotoStmt:
+		g.Line("goto l_%s;", n.Label.Lexeme)
+	case *parser.LabelStmt:
+		g.Line("l_%s:;", n.Name.Lexeme)
+	case *parser.DeferStmt:
+		g.deferStmt(n)
+	default:
+		g.unsupported(node)
+	}
+}
+
+// Generates the statements of a branch or of a loop body in a new scope,
+// one level deeper
+func (g *generator) body(stmt parser.IStatement, sink func(parser.IExpression)) {
+	g.Depth++
+	g.scopes = append(g.scopes, map[string]*local{})
+	if b, ok := stmt.(*parser.Block); ok {
+		g.stmts(b.Statements, sink)
+	} else if stmt != nil {
+		g.stmt(stmt, sink)
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.Depth--
+}
+
+func (g *generator) varDecl(n *parser.VarDeclExpression) {
+	t := astutil.DeclType(g.env, n)
+
+	// The initializer is generated before the variable is declared, as it
+	// may refer to a variable it shadows
+	init := ""
+	if lit, ok := n.Initializer.(*parser.Literal); !ok || lit.Value != nil {
+		init = astutil.Unparen(g.expr(n.Initializer, t))
+	}
+
+	g.define(n.Name.Lexeme, t, init)
+}
+
+// Declares variable name of type t holding init, or its zero value when
+// init is empty
+func (g *generator) define(name string, t string, init string) {
+	l := g.declare(name, t)
+	switch {
+	case l.addr:
+		g.Line("%s = yal_alloc(sizeof *%s);", g.declaration("*"+t, l.name), l.name)
+		if init != "" {
+			g.Line("*%s = %s;", l.name, init)
+		}
+	case init == "":
+		g.Line("%s = %s;", g.declaration(t, l.name), g.zero(t))
+	default:
+		g.Line("%s = %s;", g.declaration(t, l.name), init)
+	}
+}
+
+// Returns the initializer of a variable of type t holding its zero value
+func (g *generator) zero(t string) string {
+	switch u := astutil.Underlying(g.env, t); {
+	case u == "string" || strings.HasPrefix(u, "[") || g.iface(u) != nil || astutil.IsResult(u):
+		return "{0}"
+	case astutil.IsPointer(u):
+		return "NULL"
+	case u == "bool":
+		return "false"
+	}
+	return "0"
+}
+
+func (g *generator) exprStmt(expr parser.IExpression) {
+	switch n := expr.(type) {
+	case *parser.IfExpr:
+		g.ifStmt(n, nil)
+		return
+	case *parser.MatchExpr:
+		g.matchStmt(n, nil)
+		return
+	case *parser.PostfixIncDec:
+		// Its value being unused, it is the same as the prefix form
+		expr = &parser.PrefixIncDec{Loc: n.Loc, Operator: n.Operator, Target: n.Target}
+	}
+	g.Line("%s;", astutil.Unparen(g.expr(expr, "")))
+}
+
+// Returns the value of an expression from the fn being generated
+func (g *generator) returnSink(expr parser.IExpression) {
+	switch n := expr.(type) {
+	case *parser.IfExpr:
+		g.ifStmt(n, g.returnSink)
+		return
+	case *parser.MatchExpr:
+		g.matchStmt(n, g.returnSink)
+		return
+	}
+	if g.ret == "void" {
+		g.exprStmt(expr)
+		g.leave()
+		g.Line("return;")
+		return
+	}
+	v := g.expr(expr, g.ret)
+	if len(g.defers) > 0 {
+		// The value is the one before the deferred calls are made
+		v = g.temp(g.ret, v)
+		g.leave()
+	}
+	g.Line("return %s;", astutil.Unparen(v))
+}
+
+// Makes the calls deferred by the fn being generated before it returns
+func (g *generator) leave() {
+	if len(g.defers) > 0 {
+		g.Line("yal_leave(&defers);")
+	}
+}
+
+// Generates a defer statement, which pushes a call to a fn evaluating its
+// expression along with pointers to the variables it refers to, all of them
+// being allocated on the heap
+func (g *generator) deferStmt(n *parser.DeferStmt) {
+	index := 0
+	for i, d := range g.defers {
+		if d == n {
+			index = i
+		}
+	}
+	name := fmt.Sprintf("d_%s_%d", g.name, index)
+
+	// Constants are used as they are
+	captured := []*local{}
+	scope := map[string]*local{}
+	for _, tk := range referred(n.Expr) {
+		// Modules are not variables
+		if !g.isLocal(tk.Lexeme) {
+			continue
+		}
+		l := g.resolve(tk)
+		if _, ok := scope[tk.Lexeme]; ok || l.konst != nil {
+			scope[tk.Lexeme] = l
+			continue
+		}
+		captured = append(captured, l)
+		scope[tk.Lexeme] = &local{name: "c->" + l.name, typ: l.typ, addr: true}
+	}
+
+	g.Line("{")
+	g.Depth++
+	g.Line("struct %s *d = yal_alloc(sizeof *d);", name)
+	for _, l := range captured {
+		g.Line("d->%s = %s;", l.name, l.name)
+	}
+	g.Line("yal_defer_call(&defers, &d->base, %s);", name)
+	g.Depth--
+	g.Line("}")
+
+	// The fn making the call reads the variables through the pointers, and
+	// returns nothing
+	w, depth, scopes, ret := g.W, g.Depth, g.scopes, g.ret
+	g.W, g.Depth, g.ret = &g.deferred, 0, "void"
+	g.Line("\nstruct %s {\n\tyal_defer base;", name)
+	for _, l := range captured {
+		g.Line("\t%s;", g.declaration("*"+l.typ, l.name))
+	}
+	g.Line("};\n")
+	g.Line("static void %s(yal_defer *d)\n{", name)
+	g.Depth = 1
+	if len(captured) > 0 {
+		g.Line("struct %s *c = (struct %s *)d;", name, name)
+	}
+	g.scopes = []map[string]*local{scope}
+	g.exprStmt(n.Expr)
+	g.Depth = 0
+	g.Line("}")
+	g.W, g.Depth, g.scopes, g.ret = w, depth, scopes, ret
+}
+
+// Returns a sink assigning values to the variable name of type t
+func (g *generator) assignSink(name string, t string) func(parser.IExpression) {
+	var sink func(parser.IExpression)
+	sink = func(expr parser.IExpression) {
+		switch n := expr.(type) {
+		case *parser.IfExpr:
+			g.ifStmt(n, sink)
+			return
+		case *parser.MatchExpr:
+			g.matchStmt(n, sink)
+			return
+		}
+		g.Line("%s = %s;", name, astutil.Unparen(g.expr(expr, t)))
+	}
+	return sink
+}
+
+func (g *generator) ifStmt(n *parser.IfExpr, sink func(parser.IExpression)) {
+	g.Line("if (%s) {", astutil.Unparen(g.expr(n.Condition, "bool")))
+	g.body(n.ThenBranch, sink)
+	if n.ElseBranch != nil {
+		g.Line("} else {")
+		g.body(n.ElseBranch, sink)
+	}
+	g.Line("}")
+}
+
+// Generates a match on a Result as an if on the variant it holds, whose
+// arm binds its value or its error
+func (g *generator) matchStmt(n *parser.MatchExpr, sink func(parser.IExpression)) {
+	t := astutil.ExprType(g.env, n.Subject)
+	u := astutil.Underlying(g.env, t)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "match on a value of type %s is not supported by the C backend", t)
+	}
+	arms := map[string]*parser.MatchArm{}
+	for _, arm := range n.Arms {
+		if _, ok := arms[arm.Pattern.Variant.Lexeme]; !ok {
+			arms[arm.Pattern.Variant.Lexeme] = arm
+		}
+	}
+
+	g.Line("{")
+	g.Depth++
+	r := g.temp(t, g.expr(n.Subject, t))
+	for i, variant := range []struct{ name, field string }{{"Ok", "value"}, {"Err", "error"}} {
+		arm, found := arms[variant.name]
+		if !found {
+			arm, found = arms["_"]
+		}
+		if !found {
+			astutil.Fail(n, "match on a Result without an arm for %s", variant.name)
+		}
+		if i == 0 {
+			g.Line("if (%s.ok) {", r)
+		} else {
+			g.Line("} else {")
+		}
+		g.arm(arm, u, r+"."+variant.field, sink)
+	}
+	g.Line("}")
+	g.Depth--
+	g.Line("}")
+}
+
+// Generates the body of a match arm on a Result of type t in a new scope,
+// declaring its bindings as v
+func (g *generator) arm(arm *parser.MatchArm, t string, v string, sink func(parser.IExpression)) {
+	g.Depth++
+	g.scopes = append(g.scopes, map[string]*local{})
+	for i, name := range arm.Pattern.Bindings {
+		g.define(name.Lexeme, astutil.VariantType(arm.Pattern, t, i), v)
+	}
+	switch body := arm.Body.(type) {
+	case *parser.Block:
+		g.stmts(body.Statements, sink)
+	default:
+		if sink != nil {
+			sink(body.(parser.IExpression))
+		} else {
+			g.exprStmt(body.(parser.IExpression))
+		}
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.Depth--
+}
+
+// Generates a while loop, or the loop of a for loop once its initializer is
+// generated. A condition needing statements to be evaluated first is
+// checked at the start of the body, and an apply expression needing them is
+// evaluated there as well, from the second iteration on.
+func (g *generator) loop(init parser.IStatement, cond parser.IExpression, apply parser.IExpression, body parser.IStatement) {
+	c, condPre := "true", ""
+	if cond != nil {
+		c, condPre = g.Split(g.Depth+1, func() string { return astutil.Unparen(g.expr(cond, "bool")) })
+	}
+	a, applyPre := "", ""
+	if apply != nil {
+		a, applyPre = g.Split(g.Depth+2, func() string { return g.applyExpr(apply) })
+	}
+
+	switch {
+	case condPre == "" && applyPre == "" && apply == nil && init == nil:
+		g.Line("while (%s) {", c)
+	case condPre == "" && applyPre == "":
+		if cond == nil {
+			c = ""
+		}
+		g.Line("for (; %s; %s) {", c, a)
+	default:
+		first := ""
+		if apply != nil {
+			first = g.temp("bool", "true")
+		}
+		g.Line("for (;;) {")
+		g.Depth++
+		if apply != nil {
+			g.Line("if (!%s) {", first)
+			g.W.WriteString(applyPre)
+			g.Line("\t%s;", a)
+			g.Line("}")
+			g.Line("%s = false;", first)
+		}
+		g.W.WriteString(condPre)
+		if cond != nil {
+			g.Line("if (!(%s)) {", c)
+			g.Line("\tbreak;")
+			g.Line("}")
+		}
+		g.Depth--
+	}
+	g.body(body, nil)
+	g.Line("}")
+}
+
+func (g *generator) applyExpr(expr parser.IExpression) string {
+	if n, ok := expr.(*parser.PostfixIncDec); ok {
+		expr = &parser.PrefixIncDec{Loc: n.Loc, Operator: n.Operator, Target: n.Target}
+	}
+	return astutil.Unparen(g.expr(expr, ""))
+}
+
+// Generates a switch as a chain of ifs, since break within it applies to
+// the enclosing loop
+func (g *generator) switchStmt(n *parser.SwitchStmt, sink func(parser.IExpression)) {
+	t := astutil.ExprType(g.env, n.Subject)
+	if t == "" {
+		t = "int"
+	}
+	g.Line("{")
+	g.Depth++
+	subject := g.temp(t, astutil.Unparen(g.expr(n.Subject, t)))
+
+	for i, sc := range n.Cases {
+		conds := []string{}
+		for _, v := range sc.Values {
+			conds = append(conds, astutil.Unparen(g.compare(v, "==", t, subject, g.expr(v, t))))
+		}
+		format := "} else if (%s) {"
+		if i == 0 {
+			format = "if (%s) {"
+		}
+		g.Line(format, strings.Join(conds, " || "))
+		g.body(sc.Body, sink)
+	}
+	switch {
+	case len(n.Cases) == 0:
+		g.Depth--
+		g.body(n.Default, sink)
+		g.Depth++
+	case n.Default != nil:
+		g.Line("} else {")
+		g.body(n.Default, sink)
+		g.Line("}")
+	default:
+		g.Line("}")
+	}
+	g.Depth--
+	g.Line("}")
+}
+
+// Declares a temporary of type t holding value and returns its name
+func (g *generator) temp(t string, value string) string {
+	g.temps++
+	name := fmt.Sprintf("tmp%d", g.temps)
+	g.Line("%s = %s;", g.declaration(t, name), astutil.Unparen(value))
+	return name
+}
@@ -0,0 +1,329 @@
+/* Runtime of the C programs yal compiles to */
+#ifndef YAL_H
+#define YAL_H
+
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+/* Strings are immutable byte slices, string constants pointing to literals
+   and concatenations to the heap */
+typedef struct {
+	const char *data;
+	int64_t len;
+} yal_string;
+
+static FILE *yal_out;
+
+/* Call deferred by a fn, along with the values it needs */
+typedef struct yal_defer {
+	void (*run)(struct yal_defer *);
+	struct yal_defer *next;
+} yal_defer;
+
+/* Calls deferred by a fn being run, the last one first, the frames of the
+   fns deferring calls being linked to the one of their innermost caller
+   doing so */
+typedef struct yal_frame {
+	yal_defer *defers;
+	struct yal_frame *caller;
+} yal_frame;
+
+static yal_frame *yal_frames;
+
+static inline void yal_enter(yal_frame *f)
+{
+	f->defers = NULL;
+	f->caller = yal_frames;
+	yal_frames = f;
+}
+
+static inline void yal_defer_call(yal_frame *f, yal_defer *d, void (*run)(yal_defer *))
+{
+	d->run = run;
+	d->next = f->defers;
+	f->defers = d;
+}
+
+/* Makes the calls f deferred, the last one first, and removes it. A call
+   stopping the program leaves the others to yal_unwind. */
+static inline void yal_leave(yal_frame *f)
+{
+	while (f->defers != NULL) {
+		yal_defer *d = f->defers;
+		f->defers = d->next;
+		d->run(d);
+	}
+	yal_frames = f->caller;
+}
+
+/* Makes the calls deferred by every fn being run, before the program stops,
+   the innermost fn first */
+static inline void yal_unwind(void)
+{
+	while (yal_frames != NULL) {
+		yal_leave(yal_frames);
+	}
+}
+
+/* Reports a runtime error at a position of the source and exits, once the
+   deferred calls are made */
+static inline void yal_fail(int line, int column, const char *msg)
+{
+	yal_unwind();
+	fflush(stdout);
+	fprintf(stderr, "line %d column %d: %s\n", line, column, msg);
+	exit(1);
+}
+
+static inline yal_string yal_str(const char *data, int64_t len)
+{
+	yal_string s = {data, len};
+	return s;
+}
+
+static inline yal_string yal_concat(yal_string a, yal_string b)
+{
+	char *data = malloc(a.len + b.len + 1);
+	if (data == NULL) {
+		yal_fail(0, 0, "out of memory");
+	}
+	memcpy(data, a.data, a.len);
+	memcpy(data + a.len, b.data, b.len);
+	return yal_str(data, a.len + b.len);
+}
+
+/* Compares strings bytewise, returning a negative number, 0 or a positive
+   number as strcmp does */
+static inline int yal_compare(yal_string a, yal_string b)
+{
+	int64_t n = a.len < b.len ? a.len : b.len;
+	int c = n > 0 ? memcmp(a.data, b.data, n) : 0;
+	if (c != 0) {
+		return c;
+	}
+	return (a.len > b.len) - (a.len < b.len);
+}
+
+/* Memory for variables whose address is taken, which may outlive their fn */
+static inline void *yal_alloc(size_t size)
+{
+	void *p = calloc(1, size);
+	if (p == NULL) {
+		yal_fail(0, 0, "out of memory");
+	}
+	return p;
+}
+
+static inline void *yal_nonnull(void *p, int line, int column)
+{
+	if (p == NULL) {
+		yal_fail(line, column, "null pointer dereference");
+	}
+	return p;
+}
+
+/* Returns the method table of an interface value a method is called on,
+   which is null for a null value */
+static inline const void *yal_methods(const void *table, const char *name, int line, int column)
+{
+	char msg[128];
+	if (table == NULL) {
+		snprintf(msg, sizeof msg, "method %.64s of a null interface value", name);
+		yal_fail(line, column, msg);
+	}
+	return table;
+}
+
+static inline int64_t yal_index(int64_t i, int64_t len, int line, int column)
+{
+	if (i < 0 || i >= len) {
+		char msg[64];
+		snprintf(msg, sizeof msg, "index %lld out of range [0, %lld)", (long long)i, (long long)len);
+		yal_fail(line, column, msg);
+	}
+	return i;
+}
+
+/* Integer operations wrap around, shifts by 64 or more giving 0, or -1 for
+   right shifts of negative ints. Signed overflow being undefined in C, ints
+   are added, subtracted and multiplied as uints. */
+static inline int64_t yal_add(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a + (uint64_t)b);
+}
+
+static inline int64_t yal_sub(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a - (uint64_t)b);
+}
+
+static inline int64_t yal_mul(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a * (uint64_t)b);
+}
+
+static inline int64_t yal_neg(int64_t a)
+{
+	return (int64_t)(0 - (uint64_t)a);
+}
+
+static inline int64_t yal_div(int64_t a, int64_t b, int line, int column)
+{
+	if (b == 0) {
+		yal_fail(line, column, "division by zero");
+	}
+	return b == -1 ? yal_neg(a) : a / b;
+}
+
+static inline int64_t yal_rem(int64_t a, int64_t b, int line, int column)
+{
+	if (b == 0) {
+		yal_fail(line, column, "division by zero");
+	}
+	return b == -1 ? 0 : a % b;
+}
+
+static inline uint64_t yal_udiv(uint64_t a, uint64_t b, int line, int column)
+{
+	if (b == 0) {
+		yal_fail(line, column, "division by zero");
+	}
+	return a / b;
+}
+
+static inline uint64_t yal_urem(uint64_t a, uint64_t b, int line, int column)
+{
+	if (b == 0) {
+		yal_fail(line, column, "division by zero");
+	}
+	return a % b;
+}
+
+static inline int64_t yal_shl(int64_t a, uint64_t b)
+{
+	return b > 63 ? 0 : (int64_t)((uint64_t)a << b);
+}
+
+static inline int64_t yal_shr(int64_t a, uint64_t b)
+{
+	if (b > 63) {
+		return a < 0 ? -1 : 0;
+	}
+	return a < 0 ? ~(~a >> b) : a >> b;
+}
+
+static inline uint64_t yal_ushl(uint64_t a, uint64_t b)
+{
+	return b > 63 ? 0 : a << b;
+}
+
+static inline uint64_t yal_ushr(uint64_t a, uint64_t b)
+{
+	return b > 63 ? 0 : a >> b;
+}
+
+static inline void yal_print_string(yal_string s)
+{
+	if (s.len > 0) {
+		fwrite(s.data, 1, s.len, yal_out ? yal_out : stdout);
+	}
+}
+
+static inline void yal_print_cstring(const char *s)
+{
+	yal_print_string(yal_str(s, strlen(s)));
+}
+
+static inline void yal_print_int(int64_t v)
+{
+	char buf[32];
+	snprintf(buf, sizeof buf, "%lld", (long long)v);
+	yal_print_cstring(buf);
+}
+
+static inline void yal_print_uint(uint64_t v)
+{
+	char buf[32];
+	snprintf(buf, sizeof buf, "%llu", (unsigned long long)v);
+	yal_print_cstring(buf);
+}
+
+static inline void yal_print_char(uint8_t v)
+{
+	yal_print_string(yal_str((const char *)&v, 1));
+}
+
+static inline void yal_print_bool(bool v)
+{
+	yal_print_cstring(v ? "true" : "false");
+}
+
+static inline void yal_print_ptr(const void *p)
+{
+	yal_print_cstring(p ? "ptr" : "null");
+}
+
+/* Prints floats in the shortest form reading back the same, with an
+   exponent below 1e-4 and from 1e6 on, as Go formats them */
+static inline void yal_print_float(double v)
+{
+	char buf[40];
+	int digits, exp;
+
+	if (v != v) {
+		yal_print_cstring("NaN");
+		return;
+	}
+	if (v == 1.0 / 0.0 || v == -1.0 / 0.0) {
+		yal_print_cstring(v > 0 ? "+Inf" : "-Inf");
+		return;
+	}
+
+	for (digits = 1; digits < 17; digits++) {
+		snprintf(buf, sizeof buf, "%.*e", digits - 1, v);
+		if (strtod(buf, NULL) == v) {
+			break;
+		}
+	}
+	snprintf(buf, sizeof buf, "%.*e", digits - 1, v);
+	exp = atoi(strchr(buf, 'e') + 1);
+	if (exp < -4 || exp >= 6) {
+		yal_print_cstring(buf);
+		return;
+	}
+	snprintf(buf, sizeof buf, "%.*f", digits - 1 - exp > 0 ? digits - 1 - exp : 0, v);
+	yal_print_cstring(buf);
+}
+
+static inline void yal_print_space(void)
+{
+	yal_print_cstring(" ");
+}
+
+static inline void yal_print_newline(void)
+{
+	yal_print_cstring("\n");
+}
+
+/* A panic prints its args as print does, to stderr, and exits once the
+   deferred calls are made */
+static inline void yal_panic_begin(void)
+{
+	fflush(stdout);
+	yal_out = stderr;
+	yal_print_cstring("panic: ");
+}
+
+static inline void yal_panic_end(void)
+{
+	yal_print_newline();
+	yal_out = stdout;
+	yal_unwind();
+	fflush(stdout);
+	exit(1);
+}
+
+#endif
@@ -0,0 +1,140 @@
+package checker
+
+import (
+	"yal/lexer"
+	"yal/parser"
+)
+
+func paramDecls(args *parser.FnArgs) []*parser.VarDeclExpression {
+	decls := []*parser.VarDeclExpression{}
+	if args == nil {
+		return decls
+	}
+	for _, arg := range *args {
+		if decl, ok := arg.(*parser.VarDeclExpression); ok {
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+func hasDefault(decl *parser.VarDeclExpression) bool {
+	l, ok := decl.Initializer.(*parser.Literal)
+	return !ok || l.Value != nil
+}
+
+func isVariadic(decl *parser.VarDeclExpression) bool {
+	_, ok := decl.Type.(*parser.VariadicType)
+	return ok
+}
+
+// Checks and defines the params of an fn. Only the last param can be
+// variadic, and params with a default value can only be followed by other
+// ones with a default or by the variadic param.
+func (c *Checker) checkParams(args *parser.FnArgs) {
+	decls := paramDecls(args)
+	defaulted := false
+
+	for i, decl := range decls {
+		c.checkType(decl.Type)
+		t := typeString(decl.Type)
+
+		switch {
+		case isVariadic(decl):
+			if i != len(decls)-1 {
+				c.errorf(decl.Loc, "variadic param %s must be the last one", decl.Name.Lexeme)
+			}
+			if hasDefault(decl) {
+				c.errorf(decl.Loc, "variadic param %s cannot have a default value", decl.Name.Lexeme)
+			}
+			t = "[]" + typeString(decl.Type.(*parser.VariadicType).Elem)
+		case hasDefault(decl):
+			defaulted = true
+			c.checkFits(decl.Loc, decl.Initializer, t)
+			c.checkNullable(decl.Loc, decl.Initializer, t)
+			if init := c.check(decl.Initializer); t == unknownType {
+				t = init
+			}
+		case defaulted:
+			c.errorf(decl.Loc, "param %s without a default value follows params with one", decl.Name.Lexeme)
+		}
+
+		c.define(decl.Name, t)
+	}
+}
+
+// Matches the arguments of a call to the params of fn. Returns the type of
+// the argument passed for each param, unknownType for the ones left to
+// their default, and the types of the arguments collected by a variadic
+// param.
+func (c *Checker) bindArgs(n *parser.FnCall, fn *parser.FnDeclStmt, args []string) ([]string, []string) {
+	name := fn.Name.Lexeme
+	decls := paramDecls(fn.Args)
+	variadic := len(decls) > 0 && isVariadic(decls[len(decls)-1])
+
+	bound := make([]string, len(decls))
+	given := make([]bool, len(decls))
+	extra := []string{}
+	named := false
+
+	for i, arg := range n.Args {
+		if na, ok := arg.(*parser.NamedArg); ok {
+			named = true
+			j := paramIndex(decls, na.Name)
+			switch {
+			case j < 0:
+				c.errorf(na.Loc, "unknown param %s in call to %s", na.Name.Lexeme, name)
+			case variadic && j == len(decls)-1:
+				c.errorf(na.Loc, "variadic param %s cannot be passed by name", na.Name.Lexeme)
+			case given[j]:
+				c.errorf(na.Loc, "param %s given more than once in call to %s", na.Name.Lexeme, name)
+			default:
+				bound[j], given[j] = args[i], true
+			}
+			continue
+		}
+
+		switch {
+		case named:
+			c.errorf(n.Loc, "positional argument after named arguments in call to %s", name)
+		case variadic && i >= len(decls)-1:
+			extra = append(extra, args[i])
+		case i < len(decls):
+			bound[i], given[i] = args[i], true
+		case i == len(decls):
+			c.errorf(n.Loc, "too many arguments in call to %s", name)
+		}
+	}
+
+	for j, decl := range decls {
+		if !given[j] && !hasDefault(decl) && !(variadic && j == len(decls)-1) {
+			c.errorf(n.Loc, "missing argument for param %s in call to %s", decl.Name.Lexeme, name)
+		}
+	}
+
+	return bound, extra
+}
+
+func paramIndex(decls []*parser.VarDeclExpression, name *lexer.Token) int {
+	for i, decl := range decls {
+		if decl.Name.Lexeme == name.Lexeme {
+			return i
+		}
+	}
+	return -1
+}
+
+// Checks that the arguments passed for interface typed params implement
+// their interface
+func (c *Checker) checkArgs(n *parser.FnCall, fn *parser.FnDeclStmt, bound []string, extra []string) {
+	decls := paramDecls(fn.Args)
+	for i, arg := range bound {
+		c.checkImplements(n.Loc, arg, typeString(decls[i].Type))
+	}
+	if len(extra) > 0 {
+		variadic := decls[len(decls)-1].Type.(*parser.VariadicType)
+		for _, arg := range extra {
+			c.checkImplements(n.Loc, arg, typeString(variadic.Elem))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package checker
+
+import (
+	"yal/lexer"
+	"yal/parser"
+)
+
+const resultType = "Result"
+
+// Declarations every package starts with
+const prelude = `definetype Result<T, E> = enum { Ok(value: T), Err(error: E) };`
+
+// Builtin fns, panic stopping the program with a message and the trace of
+// the fns it was in unless a deferred call recovers from it, and recover
+// returning the message of the panic being recovered from and whether there
+// was one
+var builtins = map[string]string{
+	"panic":   "fn(string): void",
+	"recover": "fn(): (string, bool)",
+}
+
+// Returns the parsed prelude after defining the builtin fns in the global
+// scope
+func (c *Checker) prelude() []parser.IStatement {
+	for name, t := range builtins {
+		c.scopes[0].vars[name] = t
+	}
+
+	tokens, err := lexer.NewLexer(c.ctx, prelude).Scan()
+	if err != nil {
+		panic(err)
+	}
+	return parser.NewParser(c.ctx, tokens).Run()
+}
+
+// Checks the arguments of a call to a builtin fn that isn't shadowed
+func (c *Checker) checkBuiltinCall(n *parser.FnCall, args []string) {
+	if n.Name == nil {
+		return
+	}
+	t, ok := builtins[n.Name.Lexeme]
+	if !ok || c.resolve(n.Name) != t {
+		return
+	}
+	if _, ok := c.funcs[n.Name.Lexeme]; ok {
+		return
+	}
+
+	params := fnParams(t)
+	if len(args) != len(params) {
+		c.errorf(n.Loc, "%s expects %d arguments, got %d", n.Name.Lexeme, len(params), len(args))
+		return
+	}
+	for i, arg := range args {
+		if _, ok := unify(arg, params[i]); !ok {
+			c.errorf(n.Loc, "cannot use %s as %s argument of %s", arg, params[i], n.Name.Lexeme)
+		}
+	}
+}
+
+// Checks the ? operator, which only applies to a Result and propagates its
+// error from a fn returning a Result with the same error type
+func (c *Checker) checkTry(n *parser.Try) string {
+	t := c.check(n.Operand)
+	if t == unknownType {
+		return unknownType
+	}
+
+	args := typeArgsOf(t)
+	if baseType(t) != resultType || len(args) != 2 {
+		c.errorf(n.Loc, "? applied to non-Result type %s", t)
+		return unknownType
+	}
+
+	if len(c.rets) == 0 {
+		c.errorf(n.Loc, "? used outside of a fn")
+		return args[0]
+	}
+
+	ret := c.rets[len(c.rets)-1]
+	retArgs := typeArgsOf(ret)
+	switch {
+	case ret == unknownType:
+	case baseType(ret) != resultType || len(retArgs) != 2:
+		c.errorf(n.Loc, "? used in a fn returning %s instead of a Result", ret)
+	case retArgs[1] != args[1]:
+		c.errorf(n.Loc, "? propagates %s errors from a fn returning %s errors", args[1], retArgs[1])
+	}
+	return args[0]
+}
@@ -0,0 +1,33 @@
+package checker
+
+import (
+	"strings"
+	"yal/parser"
+)
+
+// Returns the type of the values carried by channels of type t, reporting
+// types that can't be a channel. Named types may alias a channel type and
+// are never reported.
+func (c *Checker) chanElem(loc parser.Loc, t string, op string) string {
+	switch {
+	case strings.HasPrefix(t, "chan<") && strings.HasSuffix(t, ">"):
+		return t[len("chan<") : len(t)-1]
+	case t == nullType || isPointer(t) || isNonPointer(t):
+		c.errorf(loc, "cannot %s non-channel type %s", op, t)
+	}
+	return unknownType
+}
+
+func (c *Checker) checkSend(n *parser.Send) string {
+	ch := c.check(n.Channel)
+	v := c.check(n.Value)
+	elem := c.chanElem(n.Loc, ch, "send to")
+	if _, ok := unify(v, elem); !ok {
+		c.errorf(n.Loc, "cannot send %s to %s", v, ch)
+	}
+	return voidType
+}
+
+func (c *Checker) checkReceive(n *parser.Receive) string {
+	return c.chanElem(n.Loc, c.check(n.Channel), "receive from")
+}
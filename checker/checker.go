@@ -0,0 +1,778 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Error reported by the Checker, holding the position it refers to
+type Error struct {
+	parser.Loc
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Variables declared in a block with their types, depth being how many fns
+// enclose it
+type scope struct {
+	vars       map[string]string
+	consts     map[string]consteval.Value
+	typeParams map[string]string
+	depth      int
+}
+
+// Checker struct responsible for the semantic analysis of a parsed AST
+type Checker struct {
+	stmts    []parser.IStatement
+	enums    map[string]*parser.DefineTypeStatement
+	variants map[string]*parser.DefineTypeStatement
+	funcs    map[string]*parser.FnDeclStmt
+	types    map[string]*parser.DefineTypeStatement
+	methods  map[string]map[string]*parser.FnDeclStmt
+	imports  map[string]map[string]*member
+	scopes   []*scope
+	fns      []*parser.Lambda
+	rets     []string
+	loops    int
+	errors   []error
+	ctx      context.Context
+}
+
+// Returns a new Checker for the given AST
+func NewChecker(ctx context.Context, stmts []parser.IStatement) *Checker {
+	return &Checker{
+		stmts:    stmts,
+		enums:    make(map[string]*parser.DefineTypeStatement),
+		variants: make(map[string]*parser.DefineTypeStatement),
+		funcs:    make(map[string]*parser.FnDeclStmt),
+		types:    make(map[string]*parser.DefineTypeStatement),
+		methods:  make(map[string]map[string]*parser.FnDeclStmt),
+		imports:  make(map[string]map[string]*member),
+		scopes: []*scope{{
+			vars:       map[string]string{},
+			consts:     map[string]consteval.Value{},
+			typeParams: map[string]string{},
+		}},
+		fns:    []*parser.Lambda{},
+		rets:   []string{},
+		errors: []error{},
+		ctx:    ctx,
+	}
+}
+
+// Walks the whole AST and returns every error found
+func (c *Checker) Run() []error {
+	stmts := append(c.prelude(), c.stmts...)
+
+	for _, stmt := range stmts {
+		c.declare(stmt)
+	}
+
+	for _, stmt := range stmts {
+		c.checkStmt(stmt)
+	}
+
+	return c.errors
+}
+
+func (c *Checker) errorf(loc parser.Loc, s string, args ...any) {
+	c.errors = append(c.errors, &Error{
+		Loc:     loc,
+		Message: fmt.Sprintf(s, args...),
+	})
+}
+
+// Collects the top level type definitions so they can be referenced before
+// being declared
+func (c *Checker) declare(stmt parser.IStatement) {
+	if fn, ok := stmt.(*parser.FnDeclStmt); ok {
+		c.define(fn.Name, fnType(fn.Args, fn.Type))
+		c.funcs[fn.Name.Lexeme] = fn
+		return
+	}
+
+	if impl, ok := stmt.(*parser.ImplStmt); ok {
+		c.declareMethods(impl.Type.Lexeme, impl.Methods, true)
+		return
+	}
+
+	dt, ok := stmt.(*parser.DefineTypeStatement)
+	if !ok {
+		return
+	}
+	c.types[dt.Name.Lexeme] = dt
+	if dt.Enum == nil {
+		return
+	}
+
+	if _, ok := c.enums[dt.Name.Lexeme]; ok {
+		c.errorf(dt.Loc, "enum %s redeclared", dt.Name.Lexeme)
+		return
+	}
+	c.enums[dt.Name.Lexeme] = dt
+
+	for _, v := range dt.Enum.Variants {
+		if other, ok := c.variants[v.Name.Lexeme]; ok {
+			c.errorf(v.Loc, "variant %s already declared by enum %s", v.Name.Lexeme, other.Name.Lexeme)
+			continue
+		}
+		c.variants[v.Name.Lexeme] = dt
+	}
+}
+
+func (c *Checker) beginScope() {
+	c.scopes = append(c.scopes, &scope{
+		vars:       map[string]string{},
+		consts:     map[string]consteval.Value{},
+		typeParams: map[string]string{},
+		depth:      len(c.fns),
+	})
+}
+
+func (c *Checker) endScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *Checker) define(name *lexer.Token, t string) {
+	if name == nil {
+		return
+	}
+	switch t {
+	case untypedIntType:
+		t = "int"
+	case nullType:
+		t = unknownType
+	}
+	c.scopes[len(c.scopes)-1].vars[name.Lexeme] = t
+}
+
+// Resolves a variable use returning its type, and recording it as a capture
+// of every lambda between the use and the fn that declared the variable.
+// Globals are never captured.
+func (c *Checker) resolve(name *lexer.Token) string {
+	if name == nil {
+		return unknownType
+	}
+
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		s := c.scopes[i]
+		t, ok := s.vars[name.Lexeme]
+		if !ok {
+			continue
+		}
+		if s.depth == 0 {
+			return t
+		}
+		for _, fn := range c.fns[s.depth:] {
+			if fn != nil {
+				addCapture(fn, name)
+			}
+		}
+		return t
+	}
+
+	return unknownType
+}
+
+// Returns whether name is a fn, a variable that may hold one, a variant or
+// print, which every backend provides
+func (c *Checker) callable(name string) bool {
+	if _, ok := c.variants[name]; ok || name == "print" {
+		return true
+	}
+	for _, s := range c.scopes {
+		if _, ok := s.vars[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func addCapture(fn *parser.Lambda, name *lexer.Token) {
+	for _, captured := range fn.Captures {
+		if captured.Lexeme == name.Lexeme {
+			return
+		}
+	}
+	fn.Captures = append(fn.Captures, name)
+}
+
+// Renders the type of an fn from its args and return annotation
+func fnType(args *parser.FnArgs, ret parser.IExpression) string {
+	params := []string{}
+	if args != nil {
+		for _, arg := range *args {
+			if decl, ok := arg.(*parser.VarDeclExpression); ok {
+				params = append(params, typeString(decl.Type))
+			}
+		}
+	}
+
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if ret != nil {
+		s += ": " + typeString(ret)
+	}
+	return s
+}
+
+// Returns the type the fn type t returns when called
+func fnReturnType(t string) string {
+	if !strings.HasPrefix(t, "fn(") {
+		return unknownType
+	}
+
+	depth := 0
+	for i, r := range t {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return strings.TrimPrefix(t[i+1:], ": ")
+			}
+		}
+	}
+	return unknownType
+}
+
+// Returns the types of the params of the fn type t
+func fnParams(t string) []string {
+	if !strings.HasPrefix(t, "fn(") {
+		return nil
+	}
+
+	depth := 0
+	for i, r := range t {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i == len("fn(") {
+				return nil
+			} else if depth == 0 {
+				return splitTypes(t[len("fn("):i])
+			}
+		}
+	}
+	return nil
+}
+
+// Checks a fn body, lambda being nil for named fns
+func (c *Checker) checkFn(lambda *parser.Lambda, args *parser.FnArgs, ret parser.IExpression, body parser.IStatement) {
+	retType := typeString(ret)
+	loops := c.loops
+	c.fns = append(c.fns, lambda)
+	c.rets = append(c.rets, retType)
+	c.loops = 0
+	c.beginScope()
+
+	c.checkParams(args)
+	t := c.checkBody(body, retType != unknownType && retType != voidType)
+	if block, ok := body.(*parser.Block); ok {
+		if retType == voidType && t != voidType && t != unknownType {
+			c.errorf(block.Loc, "value returned from void fn")
+		} else if t != voidType {
+			c.checkReturn(block.Loc, t)
+		}
+		c.checkFlow(retType, block)
+	}
+
+	c.endScope()
+	c.loops = loops
+	c.rets = c.rets[:len(c.rets)-1]
+	c.fns = c.fns[:len(c.fns)-1]
+}
+
+// Checks a statement whose value, if any, is discarded
+func (c *Checker) checkStmt(node any) {
+	if n, ok := node.(*parser.IfExpr); ok {
+		c.checkIf(n, false)
+		return
+	}
+	c.check(node)
+}
+
+// Checks a block or a branch returning the type of the value it evaluates
+// to, which is the one of its trailing expression. When the value is needed
+// a trailing if must produce one as well.
+func (c *Checker) checkBody(node parser.IStatement, needed bool) string {
+	switch n := node.(type) {
+	case *parser.Block:
+		c.beginScope()
+		defer c.endScope()
+
+		t := voidType
+		for i, stmt := range n.Statements {
+			if i < len(n.Statements)-1 {
+				c.checkStmt(stmt)
+				continue
+			}
+			t = c.checkBody(stmt, needed)
+		}
+		return t
+	case *parser.IfExpr:
+		return c.checkIf(n, needed)
+	case *parser.FnReturn:
+		t := c.check(n.Value)
+		if n.Implicit {
+			return t
+		}
+		c.checkExplicitReturn(n, t)
+		// An explicit return leaves the block, which then agrees with any type
+		return unknownType
+	case *parser.StatementExpression:
+		if _, ok := n.Expr.(*parser.FnReturn); ok {
+			c.check(n.Expr)
+			return unknownType
+		}
+		c.check(n)
+		return voidType
+	default:
+		c.check(node)
+		return voidType
+	}
+}
+
+func (c *Checker) checkIf(n *parser.IfExpr, needed bool) string {
+	c.check(n.Condition)
+	then := c.checkBody(n.ThenBranch, needed)
+
+	if n.ElseBranch == nil {
+		if needed {
+			c.errorf(n.Loc, "if used as a value must have an else branch")
+		}
+		return unknownType
+	}
+	otherwise := c.checkBody(n.ElseBranch, needed)
+
+	if !needed {
+		return unknownType
+	}
+
+	t, ok := unify(then, otherwise)
+	if !ok {
+		c.errorf(n.Loc, "if branches have mismatched types %s and %s", then, otherwise)
+	}
+	return t
+}
+
+// Checks the node returning its type, or unknownType when it can't be told
+func (c *Checker) check(node any) string {
+	switch n := node.(type) {
+	case nil:
+	case *parser.Block:
+		c.checkBody(n, false)
+	case *parser.ImportStmt:
+		if len(c.scopes) > 1 {
+			c.errorf(n.Loc, "import must be at the top level")
+		}
+	case *parser.DefineTypeStatement:
+		c.beginScope()
+		c.declareTypeParams(n.TypeParams)
+		c.checkType(n.Type)
+		if n.Enum != nil {
+			for _, v := range n.Enum.Variants {
+				for _, field := range v.Fields {
+					c.checkType(field.(*parser.VarDeclExpression).Type)
+				}
+			}
+		}
+		if n.Interface != nil {
+			c.checkInterface(n.Interface)
+		}
+		c.endScope()
+	case *parser.ImplStmt:
+		c.checkImpl(n)
+	case *parser.FnDeclStmt:
+		c.define(n.Name, fnType(n.Args, n.Type))
+		c.beginScope()
+		c.declareTypeParams(n.TypeParams)
+		c.checkType(n.Type)
+		c.checkFn(nil, n.Args, n.Type, n.Body)
+		c.endScope()
+	case *parser.Lambda:
+		n.Captures = nil
+		c.checkType(n.Type)
+		c.checkFn(n, n.Args, n.Type, n.Body)
+		return fnType(n.Args, n.Type)
+	case *parser.IfExpr:
+		return c.checkIf(n, true)
+	case *parser.WhileLoop:
+		c.check(n.Condition)
+		c.loops++
+		c.checkBody(n.Body, false)
+		c.loops--
+	case *parser.ForLoop:
+		c.beginScope()
+		c.checkStmt(n.Initializer)
+		c.check(n.Condition)
+		c.check(n.Apply)
+		c.loops++
+		c.checkBody(n.Body, false)
+		c.loops--
+		c.endScope()
+	case *parser.BreakStmt:
+		if c.loops == 0 {
+			c.errorf(n.Loc, "break outside of a loop")
+		}
+	case *parser.ContinueStmt:
+		if c.loops == 0 {
+			c.errorf(n.Loc, "continue outside of a loop")
+		}
+	case *parser.GotoStmt:
+		if len(c.fns) == 0 {
+			c.errorf(n.Loc, "goto outside of a fn")
+		}
+	case *parser.VarDeclExpression:
+		c.checkType(n.Type)
+		c.checkFits(n.Loc, n.Initializer, typeString(n.Type))
+		c.checkNullable(n.Loc, n.Initializer, typeString(n.Type))
+		if _, ok := n.Type.(*parser.VariadicType); ok {
+			c.errorf(n.Loc, "variadic type %s is only allowed for the last fn param", typeString(n.Type))
+		}
+		t := typeString(n.Type)
+		init := c.check(n.Initializer)
+		if t == unknownType {
+			t = init
+		} else {
+			c.checkImplements(n.Loc, init, t)
+		}
+		c.define(n.Name, t)
+	case *parser.Variable:
+		if dt, v := c.variantOf(n.Name); v != nil && len(v.Fields) == 0 && len(dt.TypeParams) == 0 {
+			return dt.Name.Lexeme
+		}
+		return c.resolve(n.Name)
+	case *parser.Literal:
+		return literalType(n.Value)
+	case *parser.StatementExpression:
+		c.check(n.Expr)
+	case *parser.FnReturn:
+		t := c.check(n.Value)
+		if !n.Implicit {
+			c.checkExplicitReturn(n, t)
+		}
+	case *parser.Tuple:
+		return c.checkTuple(n)
+	case *parser.NamedArg:
+		return c.check(n.Value)
+	case *parser.Try:
+		return c.checkTry(n)
+	case *parser.TupleDecl:
+		c.checkTupleDecl(n)
+	case *parser.Assign:
+		value := c.check(n.Expr)
+		t := c.resolve(n.Name)
+		if n.Target != nil {
+			t = c.check(n.Target)
+		} else if _, ok := c.lookupConst(n.Name); ok {
+			c.errorf(n.Loc, "cannot assign to constant %s", n.Name.Lexeme)
+		}
+		if op := n.Operator.TokenType.CompoundOperator(); op != lexer.Eof {
+			if isArithmetic(op) && (t == boolType || value == boolType) {
+				c.errorf(n.Loc, "operator %s not defined on bool", n.Operator.Lexeme)
+			}
+		} else {
+			c.checkFits(n.Loc, n.Expr, t)
+			c.checkNullable(n.Loc, n.Expr, t)
+			c.checkImplements(n.Loc, value, t)
+		}
+		return t
+	case *parser.ConstDeclStmt:
+		c.checkConstDecl(n)
+	case *parser.SwitchStmt:
+		c.checkSwitch(n)
+	case *parser.Index:
+		t := c.check(n.Object)
+		c.check(n.Index)
+		return elemType(t)
+	case *parser.Field:
+		if v, ok := n.Object.(*parser.Variable); ok && c.isModule(v.Name.Lexeme) {
+			return c.checkMember(n.Loc, v.Name.Lexeme, n.Name.Lexeme, false)
+		}
+		return c.checkMethod(n, c.check(n.Object))
+	case *parser.Binary:
+		left, right := c.check(n.Left), c.check(n.Right)
+		c.checkTypeParamOp(n.Operator, left)
+		return binaryType(n.Operator, left, right)
+	case *parser.Logical:
+		c.check(n.Left)
+		c.check(n.Right)
+		return boolType
+	case *parser.UnaryRight:
+		t := c.check(n.Right)
+		if n.Operator.TokenType == lexer.Bang {
+			return boolType
+		}
+		c.checkTypeParamOp(n.Operator, t)
+		return t
+	case *parser.PrefixIncDec:
+		return c.checkIncDec(n.Loc, n.Operator, n.Target)
+	case *parser.PostfixIncDec:
+		return c.checkIncDec(n.Loc, n.Operator, n.Target)
+	case *parser.Grouping:
+		return c.check(n.Grouped)
+	case *parser.AddressOf:
+		return c.checkAddressOf(n)
+	case *parser.Deref:
+		return c.checkDeref(n)
+	case *parser.FnCall:
+		t := c.resolve(n.Name)
+		if n.Callee != nil {
+			t = c.check(n.Callee)
+		}
+		args := []string{}
+		for _, arg := range n.Args {
+			args = append(args, c.check(arg))
+		}
+		if dt, v := c.variantOf(n.Name); v != nil {
+			return c.checkVariantCall(n, dt, v, args)
+		}
+		fn := c.calledFn(n)
+		if fn != nil {
+			bound, extra := c.bindArgs(n, fn, args)
+			if len(fn.TypeParams) > 0 {
+				return c.checkGenericCall(n, fn, bound, extra)
+			}
+			c.checkArgs(n, fn, bound, extra)
+		} else {
+			c.checkBuiltinCall(n, args)
+		}
+		if n.Name != nil && !c.callable(n.Name.Lexeme) {
+			c.errorf(n.Loc, "call to undefined fn %s", n.Name.Lexeme)
+		}
+		if len(n.TypeArgs) > 0 {
+			c.errorf(n.Loc, "type arguments given to a fn that is not generic")
+		}
+		return fnReturnType(t)
+	case *parser.MatchExpr:
+		c.checkMatch(n)
+	case *parser.SpawnStmt:
+		c.check(n.Call)
+	case *parser.DeferStmt:
+		if len(c.fns) == 0 {
+			c.errorf(n.Loc, "defer outside of a fn")
+		}
+		c.check(n.Expr)
+	case *parser.MakeChan:
+		c.check(n.Size)
+		return typeString(n.Type)
+	case *parser.Send:
+		return c.checkSend(n)
+	case *parser.Receive:
+		return c.checkReceive(n)
+	}
+
+	return unknownType
+}
+
+func (c *Checker) checkIncDec(loc parser.Loc, op *lexer.Token, target parser.IExpression) string {
+	t := c.check(target)
+	if c.isConst(target) {
+		c.errorf(loc, "cannot assign to constant %s", target.(*parser.Variable).Name.Lexeme)
+	}
+	if !c.satisfies(t, integerConstraint) {
+		c.errorf(loc, "operator %s not defined on %s", op.Lexeme, t)
+	}
+	return t
+}
+
+func binaryType(op *lexer.Token, left, right string) string {
+	switch op.TokenType {
+	case lexer.Lesser, lexer.LesserEqual, lexer.Greater, lexer.GreaterEqual,
+		lexer.EqualEqual, lexer.BangEqual, lexer.DoubleAmpersand, lexer.DoublePipe:
+		return boolType
+	}
+
+	t, _ := unify(left, right)
+	return t
+}
+
+// Returns the enum declaring the variant name, and the variant, when name
+// isn't shadowed by a variable or a fn
+func (c *Checker) variantOf(name *lexer.Token) (*parser.DefineTypeStatement, *parser.EnumVariant) {
+	if name == nil {
+		return nil, nil
+	}
+	dt, ok := c.variants[name.Lexeme]
+	if !ok {
+		return nil, nil
+	}
+	for i := len(c.scopes) - 1; i > 0; i-- {
+		if _, ok := c.scopes[i].vars[name.Lexeme]; ok {
+			return nil, nil
+		}
+	}
+	if _, ok := c.funcs[name.Lexeme]; ok {
+		return nil, nil
+	}
+	for _, v := range dt.Enum.Variants {
+		if v.Name.Lexeme == name.Lexeme {
+			return dt, v
+		}
+	}
+	return nil, nil
+}
+
+// Checks a call to the constructor of variant v of the enum dt, which takes
+// the fields of the variant in order. Returns the enum type, with the type
+// arguments of a generic enum inferred from the fields, or unknownType when
+// some of them can't be.
+func (c *Checker) checkVariantCall(n *parser.FnCall, dt *parser.DefineTypeStatement, v *parser.EnumVariant, args []string) string {
+	name := v.Name.Lexeme
+	decls := paramDecls(&v.Fields)
+	if len(args) != len(decls) {
+		c.errorf(n.Loc, "variant %s has %d fields, got %d arguments", name, len(decls), len(args))
+	}
+
+	params := map[string]bool{}
+	for _, param := range dt.TypeParams {
+		params[param.Name.Lexeme] = true
+	}
+	bindings := map[string]string{}
+	for i, arg := range n.Args {
+		if na, ok := arg.(*parser.NamedArg); ok {
+			c.errorf(na.Loc, "field %s of variant %s cannot be passed by name", na.Name.Lexeme, name)
+			continue
+		}
+		if i >= len(decls) {
+			continue
+		}
+		c.infer(n.Loc, decls[i].Type, args[i], params, bindings)
+		if want := substType(decls[i].Type, bindings); !params[want] {
+			if _, ok := unify(args[i], want); !ok {
+				c.errorf(n.Loc, "cannot use %s as %s field %s of variant %s", args[i], want, decls[i].Name.Lexeme, name)
+			}
+		}
+	}
+
+	if len(dt.TypeParams) == 0 {
+		return dt.Name.Lexeme
+	}
+	targs := []string{}
+	for _, param := range dt.TypeParams {
+		t, ok := bindings[param.Name.Lexeme]
+		if !ok {
+			return unknownType
+		}
+		if t == untypedIntType {
+			t = "int"
+		}
+		targs = append(targs, t)
+	}
+	return dt.Name.Lexeme + "<" + strings.Join(targs, ", ") + ">"
+}
+
+// Returns the types of the fields of variant v of the enum dt, for a value
+// of type t, whose type arguments replace those of a generic enum
+func variantFields(dt *parser.DefineTypeStatement, v *parser.EnumVariant, t string) []string {
+	bindings := map[string]string{}
+	args := typeArgsOf(t)
+	for i, param := range dt.TypeParams {
+		bindings[param.Name.Lexeme] = unknownType
+		if i < len(args) {
+			bindings[param.Name.Lexeme] = args[i]
+		}
+	}
+
+	fields := []string{}
+	for _, decl := range paramDecls(&v.Fields) {
+		fields = append(fields, substType(decl.Type, bindings))
+	}
+	return fields
+}
+
+func (c *Checker) checkMatch(m *parser.MatchExpr) {
+	subject := c.check(m.Subject)
+
+	var enum *parser.DefineTypeStatement
+	covered := map[string]bool{}
+	wildcard := false
+
+	for _, arm := range m.Arms {
+		// Bindings take the types of the fields of the variant, and
+		// unknownType when the variant is unknown or has fewer fields
+		fields := []string{}
+		if dt, ok := c.variants[arm.Pattern.Variant.Lexeme]; ok {
+			for _, v := range dt.Enum.Variants {
+				if v.Name.Lexeme == arm.Pattern.Variant.Lexeme {
+					fields = variantFields(dt, v, subject)
+				}
+			}
+		}
+		c.beginScope()
+		for i, binding := range arm.Pattern.Bindings {
+			t := unknownType
+			if i < len(fields) {
+				t = fields[i]
+			}
+			c.define(binding, t)
+		}
+		c.checkBody(arm.Body, false)
+		c.endScope()
+
+		pattern := arm.Pattern
+		name := pattern.Variant.Lexeme
+
+		if name == "_" && len(pattern.Bindings) == 0 {
+			if wildcard {
+				c.errorf(arm.Loc, "unreachable match arm: wildcard already matched")
+			}
+			wildcard = true
+			continue
+		}
+
+		owner, ok := c.variants[name]
+		if !ok {
+			c.errorf(pattern.Loc, "unknown enum variant %s", name)
+			continue
+		}
+		if enum == nil {
+			enum = owner
+			if subject != unknownType && baseType(subject) != owner.Name.Lexeme {
+				c.errorf(m.Loc, "cannot match %s against variants of enum %s", subject, owner.Name.Lexeme)
+			}
+		} else if enum != owner {
+			c.errorf(pattern.Loc, "variant %s belongs to enum %s, not %s", name, owner.Name.Lexeme, enum.Name.Lexeme)
+			continue
+		}
+
+		if wildcard || covered[name] {
+			c.errorf(arm.Loc, "unreachable match arm: %s already matched", name)
+		}
+		covered[name] = true
+
+		for _, v := range owner.Enum.Variants {
+			if v.Name.Lexeme == name && len(v.Fields) != len(pattern.Bindings) {
+				c.errorf(pattern.Loc, "variant %s has %d fields but pattern binds %d", name, len(v.Fields), len(pattern.Bindings))
+			}
+		}
+	}
+
+	if enum == nil || wildcard {
+		if len(m.Arms) == 0 {
+			c.errorf(m.Loc, "match without arms")
+		}
+		return
+	}
+
+	missing := []string{}
+	for _, v := range enum.Enum.Variants {
+		if !covered[v.Name.Lexeme] {
+			missing = append(missing, v.Name.Lexeme)
+		}
+	}
+
+	if len(missing) > 0 {
+		c.errorf(m.Loc, "non-exhaustive match on %s: missing %s", enum.Name.Lexeme, strings.Join(missing, ", "))
+	}
+}
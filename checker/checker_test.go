@@ -0,0 +1,774 @@
+package checker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"yal/checker"
+	"yal/lexer"
+	"yal/parser"
+)
+
+func check(t *testing.T, src string) []error {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := parser.NewParser(ctx, tokens).Run()
+
+	return checker.NewChecker(ctx, tree).Run()
+}
+
+func expectError(t *testing.T, errs []error, msg string) {
+	for _, err := range errs {
+		if strings.Contains(err.Error(), msg) {
+			return
+		}
+	}
+	t.Errorf("expected an error containing %q, got %v\n", msg, errs)
+}
+
+func TestMatch(t *testing.T) {
+	shape := `definetype Shape = enum { Circle(r: int), Rect(w: int, h: int), Empty };`
+
+	t.Run("Test exhaustive match", func(t *testing.T) {
+		src := shape + `
+fn area(s: Shape) : int {
+  match (s) {
+    Circle(r) => r * r * 3,
+    Rect(w, h) => w * h,
+    Empty => 0,
+  }
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test wildcard arm", func(t *testing.T) {
+		src := shape + `
+fn isCircle(s: Shape) : bool {
+  match (s) {
+    Circle(r) => true,
+    _ => false
+  }
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test missing variants", func(t *testing.T) {
+		src := shape + `
+fn area(s: Shape) : int {
+  match (s) {
+    Circle(r) => { r * r * 3 }
+  }
+}`
+		expectError(t, check(t, src), "non-exhaustive match on Shape: missing Rect, Empty")
+	})
+
+	t.Run("Test pattern arity", func(t *testing.T) {
+		src := shape + `
+fn area(s: Shape) : int {
+  match (s) {
+    Circle(r) => r,
+    Rect(w) => w,
+    Empty => 0
+  }
+}`
+		expectError(t, check(t, src), "variant Rect has 2 fields but pattern binds 1")
+	})
+
+	t.Run("Test unknown variant", func(t *testing.T) {
+		src := shape + `
+fn area(s: Shape) : int {
+  match (s) {
+    Square(a) => a,
+    _ => 0
+  }
+}`
+		expectError(t, check(t, src), "unknown enum variant Square")
+	})
+
+	t.Run("Test subject of another type", func(t *testing.T) {
+		src := shape + `
+definetype Other = int;
+
+fn area(s: Other) : int {
+  match (s) {
+    Circle(r) => r,
+    _ => 0
+  }
+}`
+		expectError(t, check(t, src), "cannot match Other against variants of enum Shape")
+	})
+
+	t.Run("Test constructors", func(t *testing.T) {
+		src := shape + `
+fn shapes() : Shape {
+  let c: Shape = Circle(2);
+  let e: Shape = Empty;
+  Rect(1, 2)
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		errs := check(t, shape+`fn bad() : Shape { Circle("x", 2, 3) }`)
+		expectError(t, errs, "variant Circle has 1 fields, got 3 arguments")
+		expectError(t, errs, "cannot use string as int field r of variant Circle")
+	})
+
+	t.Run("Test binding types", func(t *testing.T) {
+		src := shape + `
+definetype Box = enum { Boxed(s: Shape), Flag(b: bool) };
+
+fn unbox(b: Box, r: Result<int, string>) : Shape {
+  match (r) {
+    Ok(n) => Circle(n),
+    Err(e) => Circle(e),
+  };
+  match (b) {
+    Boxed(s) => s,
+    Flag(f) => Circle(f),
+  }
+}`
+		errs := check(t, src)
+		expectError(t, errs, "cannot use string as int field r of variant Circle")
+		expectError(t, errs, "cannot use bool as int field r of variant Circle")
+		if len(errs) != 2 {
+			t.Errorf("expected 2 errors, got %v\n", errs)
+		}
+	})
+}
+
+func TestCaptures(t *testing.T) {
+	src := `
+let global = 1;
+
+fn counter(start: int) : fn(): int {
+  let count = start;
+  let unused = 0;
+  let inc = () : int => {
+    let local = 1;
+    count = count + local + global;
+    let nested = () : int => start;
+    count
+  };
+  inc
+}`
+	ctx := context.Background()
+	tokens, _ := lexer.NewLexer(ctx, src).Scan()
+	tree := parser.NewParser(ctx, tokens).Run()
+
+	if errs := checker.NewChecker(ctx, tree).Run(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v\n", errs)
+	}
+
+	body := tree[1].(*parser.FnDeclStmt).Body.(*parser.Block)
+	inc := body.Statements[2].(*parser.VarDeclExpression).Initializer.(*parser.Lambda)
+
+	captured := []string{}
+	for _, name := range inc.Captures {
+		captured = append(captured, name.Lexeme)
+	}
+
+	if strings.Join(captured, ",") != "count,start" {
+		t.Errorf("expected inc to capture count and start, got %v\n", captured)
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	t.Run("Test if as a value", func(t *testing.T) {
+		src := `
+fn pick(c: bool, a: uint) : uint {
+  let b = if (c) { a } else if (!c) { 2 } else { 3 };
+  return if (false) { b } else { 20 };
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test if statement without else", func(t *testing.T) {
+		src := `
+fn run(c: bool) : void {
+  if (c) { print("c"); }
+  if (c) { 1 }
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test missing else", func(t *testing.T) {
+		expectError(t, check(t, `let a = if (true) { 1 };`), "if used as a value must have an else branch")
+	})
+
+	t.Run("Test trailing if without else in non void fn", func(t *testing.T) {
+		src := `
+fn pick(c: bool) : int {
+  if (c) { 1 }
+}`
+		expectError(t, check(t, src), "if used as a value must have an else branch")
+	})
+
+	t.Run("Test mismatched branches", func(t *testing.T) {
+		expectError(t, check(t, `let a = if (true) { 1 } else { "one" };`), "if branches have mismatched types untyped int and string")
+	})
+
+	t.Run("Test explicit return in a branch", func(t *testing.T) {
+		src := `
+fn pick(c: bool) : int {
+  let a = if (c) { return 0; } else { 1 };
+  a
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	t.Run("Test arithmetic on integers", func(t *testing.T) {
+		src := `
+fn run(a: int) : int {
+  a += 1;
+  a <<= 2;
+  a
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test arithmetic on bool", func(t *testing.T) {
+		src := `
+fn run(b: bool) : void {
+  b += true;
+}`
+		expectError(t, check(t, src), "operator += not defined on bool")
+	})
+}
+
+func TestIncDec(t *testing.T) {
+	expectError(t, check(t, `
+fn run(s: string) : void {
+  s++;
+}`), "operator ++ not defined on string")
+}
+
+func TestImports(t *testing.T) {
+	ctx := context.Background()
+
+	parse := func(src string) []parser.IStatement {
+		tokens, _ := lexer.NewLexer(ctx, src).Scan()
+		return parser.NewParser(ctx, tokens).Run()
+	}
+
+	geo := parse(`
+pub definetype Shape = int;
+pub fn area(r: int) : int { r * r }
+fn hidden() : int { 1 }
+`)
+
+	run := func(src string) []error {
+		c := checker.NewChecker(ctx, parse(src))
+		c.Import("geo", geo)
+		return c.Run()
+	}
+
+	t.Run("Test exported members", func(t *testing.T) {
+		src := `
+import "lib/geo";
+fn main() : int {
+  let s: geo.Shape = 1;
+  geo.area(2)
+}`
+		if errs := run(src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test private member", func(t *testing.T) {
+		expectError(t, run(`fn main() : int { geo.hidden() }`), "hidden is not exported by module geo")
+	})
+
+	t.Run("Test missing member", func(t *testing.T) {
+		expectError(t, run(`fn main() : int { geo.volume(1) }`), "module geo has no member volume")
+	})
+
+	t.Run("Test value used as a type", func(t *testing.T) {
+		expectError(t, run(`let s: geo.area = 1;`), "geo.area is not a type")
+	})
+
+	t.Run("Test shadowed module", func(t *testing.T) {
+		src := `
+fn main(geo: int) : int {
+  geo.hidden
+}`
+		if errs := run(src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test nested import", func(t *testing.T) {
+		expectError(t, run(`fn main() : int { import "geo"; 0 }`), "import must be at the top level")
+	})
+}
+
+func TestConstants(t *testing.T) {
+	t.Run("Test constant uses", func(t *testing.T) {
+		src := `
+const Size = 0x10 * 2;
+const Mask: uint = (1 << 64) - 1;
+fn run(op: int) : int {
+  let buf: [Size]int;
+  let c: char = 255;
+  switch (op) {
+    case 0, Size:
+      1;
+    case Size + 1:
+      2;
+    default:
+      3;
+  }
+  buf[0]
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test overflow", func(t *testing.T) {
+		expectError(t, check(t, `const Big: int = 1 << 63;`), "constant 9223372036854775808 overflows int")
+		expectError(t, check(t, `let c: char = 256;`), "constant 256 overflows char")
+		expectError(t, check(t, `fn run(u: uint) : void { u = 2 - 3; }`), "constant -1 overflows uint")
+	})
+
+	t.Run("Test non constant initializer", func(t *testing.T) {
+		expectError(t, check(t, `fn run(a: int) : void { const B = a + 1; }`), "initializer of constant B is not a constant expression")
+	})
+
+	t.Run("Test assignment to constant", func(t *testing.T) {
+		expectError(t, check(t, `const A = 1; fn run() : void { A = 2; }`), "cannot assign to constant A")
+		expectError(t, check(t, `const A = 1; fn run() : void { A++; }`), "cannot assign to constant A")
+	})
+
+	t.Run("Test array size", func(t *testing.T) {
+		expectError(t, check(t, `fn run(n: int) : void { let a: [n]int; }`), "array size is not a constant expression")
+		expectError(t, check(t, `let a: [1 - 1]int;`), "invalid array size 0")
+	})
+
+	t.Run("Test switch cases", func(t *testing.T) {
+		src := `
+const A = 2;
+fn run(op: int, b: int) : void {
+  switch (op) {
+    case 1 + 1:
+      1;
+    case A:
+      2;
+    case b:
+      3;
+  }
+}`
+		errs := check(t, src)
+		expectError(t, errs, "duplicate case 2 in switch")
+		expectError(t, errs, "case value is not a constant expression")
+	})
+
+	t.Run("Test division by zero", func(t *testing.T) {
+		expectError(t, check(t, `const A = 1 % 0;`), "division by zero in constant expression")
+	})
+}
+
+func TestPointers(t *testing.T) {
+	t.Run("Test pointer uses", func(t *testing.T) {
+		src := `
+fn swap(a: *int, b: *int) : void {
+  let t = *a;
+  *a = *b;
+  *b = t;
+}
+fn run() : int {
+  let x = 1;
+  let y = 2;
+  let p: *int = NULL;
+  p = &x;
+  swap(p, &y);
+  *p + 1
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test NULL as non pointer", func(t *testing.T) {
+		expectError(t, check(t, `let x: int = NULL;`), "cannot use NULL as int")
+		expectError(t, check(t, `fn run(b: bool) : void { b = NULL; }`), "cannot use NULL as bool")
+	})
+
+	t.Run("Test dereference", func(t *testing.T) {
+		expectError(t, check(t, `fn run(a: int) : int { *a }`), "cannot dereference non-pointer type int")
+		expectError(t, check(t, `let x = *NULL;`), "dereference of NULL")
+	})
+
+	t.Run("Test address of", func(t *testing.T) {
+		expectError(t, check(t, `let p = &1;`), "cannot take the address of a value that is not a variable")
+		expectError(t, check(t, `const A = 1; let p = &A;`), "cannot take the address of constant A")
+	})
+}
+
+func TestChannels(t *testing.T) {
+	t.Run("Test channel uses", func(t *testing.T) {
+		src := `
+fn producer(ch: chan<int>, n: int) : void {
+  for (let i = 0; i < n; ++i) {
+    ch <- i;
+  }
+}
+fn consume() : int {
+  let ch = chan<int>(4);
+  spawn producer(ch, 3);
+  <- ch + <- ch
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test non channels", func(t *testing.T) {
+		expectError(t, check(t, `fn run(a: int) : void { a <- 1; }`), "cannot send to non-channel type int")
+		expectError(t, check(t, `fn run(a: *int) : int { <- a }`), "cannot receive from non-channel type *int")
+	})
+
+	t.Run("Test element types", func(t *testing.T) {
+		expectError(t, check(t, `fn run(ch: chan<int>) : void { ch <- true; }`), "cannot send bool to chan<int>")
+		expectError(t, check(t, `fn run(ch: chan<int>) : int { *(<- ch) }`), "cannot dereference non-pointer type int")
+	})
+}
+
+func TestGenerics(t *testing.T) {
+	max := `fn max<T: ordered>(a: T, b: T) : T { if (a > b) { a } else { b } }`
+
+	t.Run("Test inferred instantiation", func(t *testing.T) {
+		ctx := context.Background()
+		tokens, _ := lexer.NewLexer(ctx, max+`
+fn run(u: uint) : uint {
+  max(1, u)
+}`).Scan()
+		tree := parser.NewParser(ctx, tokens).Run()
+		if errs := checker.NewChecker(ctx, tree).Run(); len(errs) != 0 {
+			t.Fatalf("expected no errors, got %v\n", errs)
+		}
+
+		body := tree[1].(*parser.FnDeclStmt).Body.(*parser.Block)
+		call := body.Statements[0].(*parser.FnReturn).Value.(*parser.FnCall)
+		if len(call.Instance) != 1 || call.Instance[0] != "uint" {
+			t.Errorf("expected max instantiated with uint, got %v\n", call.Instance)
+		}
+	})
+
+	t.Run("Test instantiated return type", func(t *testing.T) {
+		src := max + `
+fn run(b: bool) : int {
+  if (b) { max<int>(1, 2) } else { true }
+}`
+		expectError(t, check(t, src), "if branches have mismatched types int and bool")
+	})
+
+	t.Run("Test generic types", func(t *testing.T) {
+		src := `
+definetype Option<T> = enum { Some(v: T), None };
+definetype Ptr<T: comparable> = *T;
+fn first<T>(o: Option<T>, fallback: T) : T { fallback }
+let p: Ptr<int> = NULL;`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		expectError(t, check(t, `definetype Option<T> = enum { Some(v: T) }; let o: Option;`), "type Option expects 1 type arguments, got 0")
+		expectError(t, check(t, `let o: int<bool>;`), "type int is not generic")
+	})
+
+	t.Run("Test inference errors", func(t *testing.T) {
+		expectError(t, check(t, max+`let m = max(1, true);`), "conflicting types untyped int and bool for type parameter T")
+		expectError(t, check(t, `fn zero<T>() : int { 0 } let z = zero();`), "cannot infer type parameter T of zero")
+		expectError(t, check(t, max+`let m = max<int, int>(1, 2);`), "max expects 1 type arguments, got 2")
+		expectError(t, check(t, `fn f(a: int) : int { a } let x = f<int>(1);`), "type arguments given to a fn that is not generic")
+	})
+
+	t.Run("Test imported generic fn", func(t *testing.T) {
+		ctx := context.Background()
+		lib, _ := lexer.NewLexer(ctx, "pub "+max).Scan()
+		tokens, _ := lexer.NewLexer(ctx, `
+import "lib/util";
+fn run(b: bool) : int {
+  if (b) { util.max(1, 2) } else { false }
+}`).Scan()
+
+		c := checker.NewChecker(ctx, parser.NewParser(ctx, tokens).Run())
+		c.Import("util", parser.NewParser(ctx, lib).Run())
+		expectError(t, c.Run(), "if branches have mismatched types int and bool")
+	})
+
+	t.Run("Test constraints", func(t *testing.T) {
+		expectError(t, check(t, max+`let m = max(true, false);`), "bool does not satisfy ordered constraint of type parameter T")
+		expectError(t, check(t, `fn add<T>(a: T, b: T) : T { a + b }`), "operator + not defined on type parameter T constrained by any")
+		expectError(t, check(t, `fn f<T: sortable>(a: T) : T { a }`), "unknown constraint sortable")
+		if errs := check(t, `fn inc<T: integer>(a: T) : T { a++; a * 2 }`); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+}
+
+func TestMethods(t *testing.T) {
+	shapes := `
+definetype Shape = interface { fn area(self) : int; };
+definetype Square = int;
+definetype Label = string;
+impl Square {
+  fn area(self) : int { self * self }
+}
+impl Label {
+  fn area(self) : bool { false }
+}
+`
+
+	t.Run("Test method calls and interfaces", func(t *testing.T) {
+		src := shapes + `
+fn total(a: Shape, b: Shape) : int { a.area() + b.area() }
+fn biggest<T: Shape>(a: T, b: T) : int { max(a.area(), b.area()) }
+fn max(a: int, b: int) : int { if (a > b) { a } else { b } }
+fn run(sq: Square) : int {
+  let s: Shape = sq;
+  total(s, sq) + biggest(sq, sq)
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test method types", func(t *testing.T) {
+		src := shapes + `
+fn run(sq: Square, b: bool) : int {
+  if (b) { sq.area() } else { true }
+}`
+		expectError(t, check(t, src), "if branches have mismatched types int and bool")
+		expectError(t, check(t, shapes+`fn run(sq: Square) : int { sq.perimeter() }`), "type Square has no method perimeter")
+	})
+
+	t.Run("Test interface satisfaction", func(t *testing.T) {
+		expectError(t, check(t, shapes+`fn run(l: Label) : void { let s: Shape = l; }`), "Label does not implement Shape: method area has type fn(): bool, want fn(): int")
+		expectError(t, check(t, shapes+`fn draw(s: Shape) : void {} fn run(n: int) : void { draw(n); }`), "int does not implement Shape: missing method area")
+		expectError(t, check(t, shapes+`fn big<T: Shape>(a: T) : int { a.area() } let x = big(1);`), "int does not satisfy Shape constraint of type parameter T")
+	})
+
+	t.Run("Test impl errors", func(t *testing.T) {
+		expectError(t, check(t, `impl Circle { fn area(self) : int { 1 } }`), "impl for unknown type Circle")
+		expectError(t, check(t, shapes+`impl Shape { fn area(self) : int { 1 } }`), "cannot declare methods on interface Shape")
+		expectError(t, check(t, shapes+`impl Square { fn area(self) : int { 2 } }`), "method area already declared for Square")
+	})
+}
+
+func TestTuples(t *testing.T) {
+	divmod := `
+fn divmod(a: int, b: int) : (int, int) {
+  return a / b, a % b;
+}
+`
+
+	t.Run("Test destructuring", func(t *testing.T) {
+		src := divmod + `
+fn run(b: bool) : int {
+  let (q, r) = divmod(7, 2);
+  let (ok, _) = (true, 1);
+  if (ok) { q } else { r }
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		expectError(t, check(t, divmod+`fn run(b: bool) : int { let (q, r) = divmod(7, 2); if (b) { q } else { false } }`), "if branches have mismatched types int and bool")
+	})
+
+	t.Run("Test destructuring errors", func(t *testing.T) {
+		expectError(t, check(t, divmod+`let (a, b, c) = divmod(7, 2);`), "cannot destructure (int, int) into 3 variables")
+		expectError(t, check(t, `let (a, b) = 1;`), "cannot destructure non-tuple type untyped int")
+	})
+
+	t.Run("Test returned value count", func(t *testing.T) {
+		expectError(t, check(t, `fn f() : (int, bool) { return 1, true, 2; }`), "fn returns 2 values, got 3")
+		expectError(t, check(t, `fn f() : int { return 1, 2; }`), "fn returns 1 values, got 2")
+		expectError(t, check(t, `fn f() : (int, int) { 1 }`), "fn returns 2 values, got 1")
+	})
+}
+
+func TestResults(t *testing.T) {
+	parse := `
+fn parse(s: string) : Result<int, string> {
+  if (s == "") { return Err("empty"); }
+  Ok(1)
+}
+`
+
+	t.Run("Test propagation", func(t *testing.T) {
+		src := parse + `
+fn double(s: string) : Result<int, string> {
+  let n = parse(s)?;
+  Ok(n * 2)
+}
+fn run(s: string) : int {
+  match (parse(s)) {
+    Ok(n) => n,
+    Err(_) => 0,
+  }
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		expectError(t, check(t, parse+`fn run(s: string, b: bool) : Result<int, string> { if (b) { parse(s)? } else { true } }`), "if branches have mismatched types int and bool")
+	})
+
+	t.Run("Test propagation errors", func(t *testing.T) {
+		expectError(t, check(t, `fn run(n: int) : Result<int, string> { n? }`), "? applied to non-Result type int")
+		expectError(t, check(t, parse+`fn run(s: string) : int { parse(s)? }`), "? used in a fn returning int instead of a Result")
+		expectError(t, check(t, parse+`fn run(s: string) : Result<int, bool> { Ok(parse(s)?) }`), "? propagates string errors from a fn returning bool errors")
+		expectError(t, check(t, parse+`let n = parse("1")?;`), "? used outside of a fn")
+	})
+
+	t.Run("Test panic and recover", func(t *testing.T) {
+		if errs := check(t, `fn run(n: int) : int { if (n < 0) { panic("negative"); } n }`); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		src := `
+fn run() : string {
+  let (msg, ok) = recover();
+  if (!ok) { panic("nothing to recover"); }
+  msg
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		expectError(t, check(t, `fn run() : void { let (msg, ok) = recover(1); }`), "recover expects 0 arguments, got 1")
+		expectError(t, check(t, `fn run() : void { panic(); }`), "panic expects 1 arguments, got 0")
+		expectError(t, check(t, `fn run() : void { panic(1.5); }`), "cannot use float as string argument of panic")
+	})
+}
+
+func TestDefer(t *testing.T) {
+	src := `
+fn run(n: int) : int {
+  defer panic("done");
+  let f = () : void => {
+    defer n--;
+  };
+  n
+}`
+	if errs := check(t, src); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v\n", errs)
+	}
+
+	expectError(t, check(t, `defer panic("top");`), "defer outside of a fn")
+	expectError(t, check(t, `{ defer panic("block"); }`), "defer outside of a fn")
+	expectError(t, check(t, `fn run() : void { defer panic(); }`), "panic expects 1 arguments, got 0")
+}
+
+func TestFnArgs(t *testing.T) {
+	sum := `
+fn sum(base: int = 0, nums: ...int) : int {
+  base + nums[0]
+}
+fn area(w: int, h: int = 1) : int { w * h }
+`
+
+	t.Run("Test calls", func(t *testing.T) {
+		src := sum + `
+fn max<T: ordered>(first: T, rest: ...T) : T { first }
+fn run() : int {
+  sum() + sum(1, 2, 3) + area(2) + area(h: 3, w: 2) + area(4, h: 2) + max(1, 2, 3)
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+		expectError(t, check(t, `fn max<T: ordered>(first: T, rest: ...T) : T { first } let m = max(1, true);`), "conflicting types untyped int and bool for type parameter T")
+	})
+
+	t.Run("Test call errors", func(t *testing.T) {
+		expectError(t, check(t, sum+`let a = area();`), "missing argument for param w in call to area")
+		expectError(t, check(t, sum+`let a = area(1, 2, 3);`), "too many arguments in call to area")
+		expectError(t, check(t, sum+`let a = area(d: 1);`), "unknown param d in call to area")
+		expectError(t, check(t, sum+`let a = area(1, w: 2);`), "param w given more than once in call to area")
+		expectError(t, check(t, sum+`let a = area(h: 1, 2);`), "positional argument after named arguments in call to area")
+		expectError(t, check(t, sum+`let s = sum(nums: 1);`), "variadic param nums cannot be passed by name")
+	})
+
+	t.Run("Test param errors", func(t *testing.T) {
+		expectError(t, check(t, `fn f(a: ...int, b: int) : void {}`), "variadic param a must be the last one")
+		expectError(t, check(t, `fn f(a: int = 1, b: int) : void {}`), "param b without a default value follows params with one")
+		expectError(t, check(t, `fn f(c: char = 300) : void {}`), "constant 300 overflows char")
+		expectError(t, check(t, `let a: ...int;`), "variadic type ...int is only allowed for the last fn param")
+	})
+}
+
+func TestFlow(t *testing.T) {
+	t.Run("Test returning fns", func(t *testing.T) {
+		src := `
+fn a(b: bool) : int {
+  if (b) { return 1; } else { return 2; }
+}
+fn c(n: int) : int {
+  switch (n) {
+    case 0:
+      return 1;
+    default:
+      panic("bad");
+  }
+}
+fn d() : int {
+  while (true) {
+    return 1;
+  }
+}
+fn e(b: bool) : int {
+  if (b) { 1 } else { 2 }
+}
+fn f() : void {
+  let i = 0;
+start:
+  i++;
+  if (i < 10) { goto start; }
+  return;
+}`
+		if errs := check(t, src); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v\n", errs)
+		}
+	})
+
+	t.Run("Test missing return", func(t *testing.T) {
+		expectError(t, check(t, `fn a(b: bool) : int { if (b) { return 1; } }`), "line 1 column 44: missing return")
+		expectError(t, check(t, `fn a() : int { while (true) { break; } }`), "missing return")
+		expectError(t, check(t, `fn a(n: int) : int { switch (n) { case 0: return 1; } }`), "missing return")
+		expectError(t, check(t, `fn a() : int { return; }`), "missing return value")
+	})
+
+	t.Run("Test unreachable code", func(t *testing.T) {
+		expectError(t, check(t, "fn a() : int {\n  return 1;\n  let x = 2;\n  x\n}"), "line 3 column 8: unreachable code")
+		expectError(t, check(t, `fn a() : void { while (true) { break; a(); } }`), "unreachable code")
+		expectError(t, check(t, `fn a() : void { goto end; a(); end: }`), "unreachable code")
+	})
+
+	t.Run("Test value returned from void fn", func(t *testing.T) {
+		expectError(t, check(t, `fn a() : void { return 1; }`), "value returned from void fn")
+		expectError(t, check(t, `fn a() : void { 1 }`), "value returned from void fn")
+	})
+
+	t.Run("Test jumps", func(t *testing.T) {
+		expectError(t, check(t, `fn a() : void { break; }`), "break outside of a loop")
+		expectError(t, check(t, `fn a() : void { while (true) { let f = () : void => { continue; }; } }`), "continue outside of a loop")
+		expectError(t, check(t, `fn a() : void { goto nowhere; }`), "undefined label nowhere")
+		expectError(t, check(t, `fn a() : void { l: l: }`), "label l redeclared")
+	})
+}
@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"errors"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Resolves a named constant, returning false when the name refers to a
+// variable or to nothing
+func (c *Checker) lookupConst(name *lexer.Token) (consteval.Value, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		s := c.scopes[i]
+		if _, ok := s.vars[name.Lexeme]; ok {
+			v, ok := s.consts[name.Lexeme]
+			return v, ok
+		}
+	}
+	return consteval.Value{}, false
+}
+
+func (c *Checker) isConst(expr parser.IExpression) bool {
+	v, ok := expr.(*parser.Variable)
+	if !ok {
+		return false
+	}
+	_, ok = c.lookupConst(v.Name)
+	return ok
+}
+
+// Evaluates a constant expression, reporting evaluation errors such as a
+// division by zero. Returns false when expr isn't constant.
+func (c *Checker) evalConst(expr parser.IExpression) (consteval.Value, bool) {
+	v, err := consteval.Eval(expr, c.lookupConst)
+	if err == nil {
+		return v, true
+	}
+
+	var evalErr *consteval.Error
+	if errors.As(err, &evalErr) {
+		c.errorf(evalErr.Loc, "%s", evalErr.Message)
+	}
+	return v, false
+}
+
+// Reports an overflow when expr is a constant not representable by the
+// integer type t
+func (c *Checker) checkFits(loc parser.Loc, expr parser.IExpression, t string) {
+	if !isInteger(t) {
+		return
+	}
+
+	v, ok := c.evalConst(expr)
+	if !ok || v.IsBool {
+		return
+	}
+	if !consteval.Fits(v.Int, t) {
+		c.errorf(loc, "constant %s overflows %s", v, t)
+	}
+}
+
+func (c *Checker) checkConstDecl(n *parser.ConstDeclStmt) {
+	c.checkType(n.Type)
+	c.check(n.Value)
+
+	v, ok := c.evalConst(n.Value)
+	if !ok {
+		c.errorf(n.Loc, "initializer of constant %s is not a constant expression", n.Name.Lexeme)
+		c.define(n.Name, typeString(n.Type))
+		return
+	}
+
+	t := typeString(n.Type)
+	switch {
+	case v.IsBool && t == unknownType:
+		t = boolType
+	case !v.IsBool && t == unknownType:
+		t = "int"
+	}
+	if !v.IsBool && !consteval.Fits(v.Int, t) {
+		c.errorf(n.Loc, "constant %s overflows %s", v, t)
+	}
+
+	c.define(n.Name, t)
+	c.scopes[len(c.scopes)-1].consts[n.Name.Lexeme] = v
+}
+
+func (c *Checker) checkArraySize(t *parser.ArrayType) {
+	c.check(t.Size)
+
+	v, ok := c.evalConst(t.Size)
+	switch {
+	case !ok:
+		c.errorf(t.Loc, "array size is not a constant expression")
+	case v.IsBool || v.Int.Sign() <= 0 || !consteval.Fits(v.Int, "int"):
+		c.errorf(t.Loc, "invalid array size %s", v)
+	}
+}
+
+func (c *Checker) checkSwitch(n *parser.SwitchStmt) {
+	c.check(n.Subject)
+
+	seen := []consteval.Value{}
+	for _, sc := range n.Cases {
+		for _, value := range sc.Values {
+			c.check(value)
+
+			v, ok := c.evalConst(value)
+			if !ok {
+				c.errorf(sc.Loc, "case value is not a constant expression")
+				continue
+			}
+			for _, other := range seen {
+				if v.Equal(other) {
+					c.errorf(sc.Loc, "duplicate case %s in switch", v)
+				}
+			}
+			seen = append(seen, v)
+		}
+		c.checkBody(sc.Body, false)
+	}
+
+	if n.Default != nil {
+		c.checkBody(n.Default, false)
+	}
+}
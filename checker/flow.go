@@ -0,0 +1,201 @@
+package checker
+
+import (
+	"yal/parser"
+)
+
+// Control flow analysis of an fn body, run once its statements are checked
+type flow struct {
+	c          *Checker
+	terminates map[parser.IStatement]bool
+	labels     map[string]bool
+	gotos      []*parser.GotoStmt
+}
+
+// Returns the position of a statement, or of the expression it wraps
+func locOf(stmt any) parser.Loc {
+	if s, ok := stmt.(*parser.StatementExpression); ok {
+		return locOf(s.Expr)
+	}
+	if n, ok := stmt.(interface{ Pos() parser.Loc }); ok {
+		return n.Pos()
+	}
+	return parser.Loc{}
+}
+
+// Reports the unreachable statements of an fn body and its gotos to
+// undefined labels. When the fn returns a value, reports a missing return
+// if the end of the body can be reached without one.
+func (c *Checker) checkFlow(ret string, body *parser.Block) {
+	f := &flow{
+		c:          c,
+		terminates: map[parser.IStatement]bool{},
+		labels:     map[string]bool{},
+	}
+	f.stmt(body)
+
+	for _, g := range f.gotos {
+		if !f.labels[g.Label.Lexeme] {
+			c.errorf(g.Loc, "undefined label %s", g.Label.Lexeme)
+		}
+	}
+
+	if ret != unknownType && ret != voidType && !f.returns(body) {
+		c.errorf(body.Loc, "missing return")
+	}
+}
+
+// Walks a statement, returning whether it terminates, that is whether the
+// statement following it can't be reached by falling through
+func (f *flow) stmt(stmt parser.IStatement) bool {
+	t := false
+
+	switch n := stmt.(type) {
+	case *parser.Block:
+		t = f.block(n.Statements)
+	case *parser.StatementExpression:
+		switch e := n.Expr.(type) {
+		case *parser.FnReturn:
+			t = !e.Implicit
+		case *parser.FnCall:
+			t = f.isPanic(e)
+		case *parser.MatchExpr:
+			t = f.match(e)
+		}
+	case *parser.FnReturn:
+		if m, ok := n.Value.(*parser.MatchExpr); ok {
+			f.match(m)
+		}
+		t = !n.Implicit
+	case *parser.IfExpr:
+		then := f.stmt(n.ThenBranch)
+		t = n.ElseBranch != nil && f.stmt(n.ElseBranch) && then
+	case *parser.WhileLoop:
+		t = f.loop(n.Condition, n.Body)
+	case *parser.ForLoop:
+		t = f.loop(n.Condition, n.Body)
+	case *parser.SwitchStmt:
+		t = n.Default != nil
+		for _, sc := range n.Cases {
+			t = f.stmt(sc.Body) && t
+		}
+		if n.Default != nil {
+			t = f.stmt(n.Default) && t
+		}
+	case *parser.BreakStmt, *parser.ContinueStmt:
+		t = true
+	case *parser.GotoStmt:
+		f.gotos = append(f.gotos, n)
+		t = true
+	case *parser.LabelStmt:
+		if f.labels[n.Name.Lexeme] {
+			f.c.errorf(n.Loc, "label %s redeclared", n.Name.Lexeme)
+		}
+		f.labels[n.Name.Lexeme] = true
+	}
+
+	f.terminates[stmt] = t
+	return t
+}
+
+// Reports the first statement following a terminating one, unless it is a
+// label a goto can jump to
+func (f *flow) block(stmts []parser.IStatement) bool {
+	terminated, reported := false, false
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*parser.LabelStmt); ok {
+			terminated = false
+		} else if terminated && !reported {
+			f.c.errorf(locOf(stmt), "unreachable code")
+			reported = true
+		}
+		if f.stmt(stmt) {
+			terminated = true
+		}
+	}
+	return terminated
+}
+
+// A loop only terminates when its condition is always true and nothing
+// breaks out of it
+func (f *flow) loop(cond parser.IExpression, body parser.IStatement) bool {
+	f.stmt(body)
+
+	if cond != nil {
+		lit, ok := cond.(*parser.Literal)
+		if !ok || lit.Value == nil || lit.Value.Lexeme != "true" {
+			return false
+		}
+	}
+	return !breaks(body)
+}
+
+func (f *flow) match(m *parser.MatchExpr) bool {
+	t := len(m.Arms) > 0
+	for _, arm := range m.Arms {
+		t = f.stmt(arm.Body) && t
+	}
+	return t
+}
+
+// Calls to the panic builtin never return
+func (f *flow) isPanic(call *parser.FnCall) bool {
+	if call.Name == nil || call.Name.Lexeme != "panic" {
+		return false
+	}
+	_, declared := f.c.funcs["panic"]
+	return !declared
+}
+
+// Returns whether the end of stmt is only reached with a value to return,
+// either from a trailing expression or from a branch producing one
+func (f *flow) returns(stmt parser.IStatement) bool {
+	if f.terminates[stmt] {
+		return true
+	}
+
+	switch n := stmt.(type) {
+	case *parser.Block:
+		return len(n.Statements) > 0 && f.returns(n.Statements[len(n.Statements)-1])
+	case *parser.FnReturn:
+		return n.Implicit
+	case *parser.IfExpr:
+		return n.ElseBranch != nil && f.returns(n.ThenBranch) && f.returns(n.ElseBranch)
+	case *parser.SwitchStmt:
+		if n.Default == nil || !f.returns(n.Default) {
+			return false
+		}
+		for _, sc := range n.Cases {
+			if !f.returns(sc.Body) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Returns whether a break leaves the loop whose body is stmt, not counting
+// the ones of nested loops
+func breaks(stmt parser.IStatement) bool {
+	switch n := stmt.(type) {
+	case *parser.BreakStmt:
+		return true
+	case *parser.Block:
+		for _, s := range n.Statements {
+			if breaks(s) {
+				return true
+			}
+		}
+	case *parser.IfExpr:
+		return breaks(n.ThenBranch) || (n.ElseBranch != nil && breaks(n.ElseBranch))
+	case *parser.SwitchStmt:
+		for _, sc := range n.Cases {
+			if breaks(sc.Body) {
+				return true
+			}
+		}
+		return n.Default != nil && breaks(n.Default)
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package checker
+
+import (
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Constraints a type parameter can be bound by. Each one accepts a subset of
+// the types accepted by the ones ranked below it.
+const (
+	anyConstraint        = "any"
+	comparableConstraint = "comparable"
+	orderedConstraint    = "ordered"
+	integerConstraint    = "integer"
+)
+
+var constraintRanks = map[string]int{
+	anyConstraint:        0,
+	comparableConstraint: 1,
+	orderedConstraint:    2,
+	integerConstraint:    3,
+}
+
+// Returns the constraint of a type parameter, either one of the builtin
+// constraints or an interface type
+func (c *Checker) constraintOf(param *parser.TypeParam) string {
+	if param.Constraint == nil {
+		return anyConstraint
+	}
+	name := typeString(param.Constraint)
+	if _, ok := constraintRanks[name]; ok || c.interfaceOf(name) != nil {
+		return name
+	}
+	return anyConstraint
+}
+
+// Makes the type parameters of a generic fn or type usable in the current
+// scope
+func (c *Checker) declareTypeParams(params []*parser.TypeParam) {
+	s := c.scopes[len(c.scopes)-1]
+	for _, param := range params {
+		name := param.Name.Lexeme
+		if _, ok := s.typeParams[name]; ok {
+			c.errorf(param.Loc, "type parameter %s redeclared", name)
+			continue
+		}
+		if param.Constraint != nil {
+			c.checkType(param.Constraint)
+			k := typeString(param.Constraint)
+			if _, ok := constraintRanks[k]; !ok && c.interfaceOf(k) == nil {
+				c.errorf(param.Loc, "unknown constraint %s", k)
+			}
+		}
+		s.typeParams[name] = c.constraintOf(param)
+	}
+}
+
+// Returns the constraint of t when it names a type parameter in scope
+func (c *Checker) lookupTypeParam(t string) (string, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if k, ok := c.scopes[i].typeParams[t]; ok {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Returns whether the type t is accepted by constraint. A type parameter
+// satisfies the constraints its own constraint implies.
+func (c *Checker) satisfies(t string, constraint string) bool {
+	if t == unknownType {
+		return true
+	}
+	if c.interfaceOf(constraint) != nil {
+		return c.missingMethod(t, constraint) == ""
+	}
+	if k, ok := c.lookupTypeParam(t); ok {
+		return constraintRanks[k] >= constraintRanks[constraint]
+	}
+
+	switch constraint {
+	case comparableConstraint:
+		return !strings.HasPrefix(t, "fn(")
+	case orderedConstraint:
+		return isInteger(t) || t == floatType || t == stringType
+	case integerConstraint:
+		return isInteger(t)
+	}
+	return true
+}
+
+// Returns the constraint a type parameter needs for op to apply to its values
+func operatorConstraint(op lexer.TokenType) string {
+	switch op {
+	case lexer.EqualEqual, lexer.BangEqual:
+		return comparableConstraint
+	case lexer.Lesser, lexer.LesserEqual, lexer.Greater, lexer.GreaterEqual, lexer.Plus:
+		return orderedConstraint
+	case lexer.Minus, lexer.Star, lexer.Slash, lexer.Rem, lexer.Shl, lexer.Shr,
+		lexer.Ampersand, lexer.Pipe, lexer.Xor:
+		return integerConstraint
+	}
+	return anyConstraint
+}
+
+// Reports op being applied to a value of the type parameter t when its
+// constraint doesn't provide it
+func (c *Checker) checkTypeParamOp(op *lexer.Token, t string) {
+	k, ok := c.lookupTypeParam(t)
+	if !ok {
+		return
+	}
+	if need := operatorConstraint(op.TokenType); constraintRanks[k] < constraintRanks[need] {
+		c.errorf(parser.Loc{Line: op.Line, Column: op.Column},
+			"operator %s not defined on type parameter %s constrained by %s", op.Lexeme, t, k)
+	}
+}
+
+// Checks a call to a generic fn, inferring the type arguments not given
+// explicitly from the types of the arguments bound to its params. Records
+// the instantiation on the call and returns the type the instance returns.
+func (c *Checker) checkGenericCall(n *parser.FnCall, fn *parser.FnDeclStmt, bound []string, extra []string) string {
+	name := fn.Name.Lexeme
+	if len(n.TypeArgs) > len(fn.TypeParams) {
+		c.errorf(n.Loc, "%s expects %d type arguments, got %d", name, len(fn.TypeParams), len(n.TypeArgs))
+	}
+
+	params := map[string]bool{}
+	for _, param := range fn.TypeParams {
+		params[param.Name.Lexeme] = true
+	}
+
+	bindings := map[string]string{}
+	for i, arg := range n.TypeArgs {
+		c.checkType(arg)
+		if i < len(fn.TypeParams) {
+			bindings[fn.TypeParams[i].Name.Lexeme] = typeString(arg)
+		}
+	}
+
+	decls := paramDecls(fn.Args)
+	for i, arg := range bound {
+		c.infer(n.Loc, decls[i].Type, arg, params, bindings)
+	}
+	if len(extra) > 0 {
+		variadic := decls[len(decls)-1].Type.(*parser.VariadicType)
+		for _, arg := range extra {
+			c.infer(n.Loc, variadic.Elem, arg, params, bindings)
+		}
+	}
+
+	n.Instance = []string{}
+	for _, param := range fn.TypeParams {
+		t, ok := bindings[param.Name.Lexeme]
+		switch {
+		case !ok:
+			c.errorf(n.Loc, "cannot infer type parameter %s of %s", param.Name.Lexeme, name)
+		case t == untypedIntType:
+			t = "int"
+		}
+		if k := c.constraintOf(param); !c.satisfies(t, k) {
+			c.errorf(n.Loc, "%s does not satisfy %s constraint of type parameter %s", t, k, param.Name.Lexeme)
+		}
+		bindings[param.Name.Lexeme] = t
+		n.Instance = append(n.Instance, t)
+	}
+
+	return substType(fn.Type, bindings)
+}
+
+// Binds the type parameters found in the annotation param by matching it
+// against the type of the argument passed for it
+func (c *Checker) infer(loc parser.Loc, param parser.IExpression, arg string, params map[string]bool, bindings map[string]string) {
+	if arg == unknownType || arg == nullType {
+		return
+	}
+
+	switch p := param.(type) {
+	case *parser.TypeName:
+		name := p.Name.Lexeme
+		if p.Module != nil || !params[name] {
+			return
+		}
+		bound, ok := bindings[name]
+		if !ok {
+			bindings[name] = arg
+			return
+		}
+		t, ok := unify(bound, arg)
+		if !ok {
+			c.errorf(loc, "conflicting types %s and %s for type parameter %s", bound, arg, name)
+			return
+		}
+		bindings[name] = t
+	case *parser.PointerType:
+		if isPointer(arg) {
+			c.infer(loc, p.Elem, arg[1:], params, bindings)
+		}
+	case *parser.ArrayType:
+		c.infer(loc, p.Elem, elemType(arg), params, bindings)
+	case *parser.ChanType:
+		if strings.HasPrefix(arg, "chan<") && strings.HasSuffix(arg, ">") {
+			c.infer(loc, p.Elem, arg[len("chan<"):len(arg)-1], params, bindings)
+		}
+	}
+}
+
+// Checks the type arguments given to a type against its type parameters
+func (c *Checker) checkTypeArgs(t *parser.TypeName, params []*parser.TypeParam) {
+	switch {
+	case len(params) == 0 && len(t.Args) == 0:
+		return
+	case len(params) == 0:
+		c.errorf(t.Loc, "type %s is not generic", t.Name.Lexeme)
+		return
+	case len(t.Args) != len(params):
+		c.errorf(t.Loc, "type %s expects %d type arguments, got %d", t.Name.Lexeme, len(params), len(t.Args))
+		return
+	}
+
+	for i, arg := range t.Args {
+		if k := c.constraintOf(params[i]); !c.satisfies(typeString(arg), k) {
+			c.errorf(t.Loc, "%s does not satisfy %s constraint of type parameter %s", typeString(arg), k, params[i].Name.Lexeme)
+		}
+	}
+}
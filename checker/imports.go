@@ -0,0 +1,131 @@
+package checker
+
+import (
+	"yal/parser"
+)
+
+// Top level declaration of an imported module
+type member struct {
+	typ        string
+	isType     bool
+	public     bool
+	fn         *parser.FnDeclStmt
+	typeParams []*parser.TypeParam
+	iface      *parser.InterfaceType
+}
+
+// Makes the top level declarations of an imported module available under
+// name, so that `name.member` can be checked
+func (c *Checker) Import(name string, stmts []parser.IStatement) {
+	members := map[string]*member{}
+
+	for _, stmt := range stmts {
+		switch n := stmt.(type) {
+		case *parser.FnDeclStmt:
+			members[n.Name.Lexeme] = &member{
+				typ:    fnType(n.Args, n.Type),
+				public: n.Public,
+				fn:     n,
+			}
+		case *parser.DefineTypeStatement:
+			members[n.Name.Lexeme] = &member{
+				typ:        name + "." + n.Name.Lexeme,
+				isType:     true,
+				public:     n.Public,
+				typeParams: n.TypeParams,
+				iface:      n.Interface,
+			}
+		case *parser.ImplStmt:
+			public := []*parser.FnDeclStmt{}
+			for _, m := range n.Methods {
+				if m.Public {
+					public = append(public, m)
+				}
+			}
+			c.declareMethods(name+"."+n.Type.Lexeme, public, false)
+		}
+	}
+
+	c.imports[name] = members
+}
+
+// Returns whether name refers to an imported module rather than a variable
+// shadowing it
+func (c *Checker) isModule(name string) bool {
+	if _, ok := c.imports[name]; !ok {
+		return false
+	}
+	for _, s := range c.scopes {
+		if _, ok := s.vars[name]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks an access to a module member, returning its type
+func (c *Checker) checkMember(loc parser.Loc, module string, name string, wantType bool) string {
+	m, ok := c.imports[module][name]
+	switch {
+	case !ok:
+		c.errorf(loc, "module %s has no member %s", module, name)
+		return unknownType
+	case !m.public:
+		c.errorf(loc, "%s is not exported by module %s", name, module)
+	case m.isType != wantType && wantType:
+		c.errorf(loc, "%s.%s is not a type", module, name)
+	case m.isType != wantType:
+		c.errorf(loc, "%s.%s is a type, not a value", module, name)
+	}
+	return m.typ
+}
+
+// Checks the types a type annotation refers to
+func (c *Checker) checkType(ann parser.IExpression) {
+	switch t := ann.(type) {
+	case *parser.TypeName:
+		for _, arg := range t.Args {
+			c.checkType(arg)
+		}
+		if t.Module != nil {
+			if !c.isModule(t.Module.Lexeme) {
+				c.errorf(t.Loc, "unknown module %s", t.Module.Lexeme)
+				return
+			}
+			c.checkMember(t.Loc, t.Module.Lexeme, t.Name.Lexeme, true)
+			if m, ok := c.imports[t.Module.Lexeme][t.Name.Lexeme]; ok {
+				c.checkTypeArgs(t, m.typeParams)
+			}
+			return
+		}
+		if _, ok := c.lookupTypeParam(t.Name.Lexeme); ok {
+			if len(t.Args) > 0 {
+				c.errorf(t.Loc, "type %s is not generic", t.Name.Lexeme)
+			}
+			return
+		}
+		var params []*parser.TypeParam
+		if dt, ok := c.types[t.Name.Lexeme]; ok {
+			params = dt.TypeParams
+		}
+		c.checkTypeArgs(t, params)
+	case *parser.FnType:
+		for _, p := range t.Params {
+			c.checkType(p)
+		}
+		c.checkType(t.Return)
+	case *parser.ChanType:
+		c.checkType(t.Elem)
+	case *parser.ArrayType:
+		c.checkArraySize(t)
+		c.checkType(t.Elem)
+	case *parser.PointerType:
+		c.checkType(t.Elem)
+	case *parser.VariadicType:
+		c.checkType(t.Elem)
+	case *parser.TupleType:
+		for _, elem := range t.Elems {
+			c.checkType(elem)
+		}
+	}
+}
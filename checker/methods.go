@@ -0,0 +1,191 @@
+package checker
+
+import (
+	"strings"
+	"yal/parser"
+)
+
+// Renders the type of a method as seen through a value, without its self arg
+func methodType(args *parser.FnArgs, ret parser.IExpression) string {
+	if args != nil && len(*args) > 0 {
+		if self, ok := (*args)[0].(*parser.VarDeclExpression); ok && self.Name.Lexeme == "self" {
+			rest := (*args)[1:]
+			args = &rest
+		}
+	}
+	return fnType(args, ret)
+}
+
+// Returns the named type t refers to, without its type arguments
+func baseType(t string) string {
+	if i := strings.Index(t, "<"); i > 0 && !strings.HasPrefix(t, "chan<") {
+		return t[:i]
+	}
+	return t
+}
+
+// Returns the type arguments of the instantiated generic type t
+func typeArgsOf(t string) []string {
+	base := baseType(t)
+	if base == t || !strings.HasSuffix(t, ">") {
+		return nil
+	}
+	return splitTypes(t[len(base)+1 : len(t)-1])
+}
+
+// Registers methods of the type named typ, reporting duplicates when the
+// methods are declared by the checked package
+func (c *Checker) declareMethods(typ string, methods []*parser.FnDeclStmt, report bool) {
+	if c.methods[typ] == nil {
+		c.methods[typ] = map[string]*parser.FnDeclStmt{}
+	}
+	for _, m := range methods {
+		if _, ok := c.methods[typ][m.Name.Lexeme]; ok && report {
+			c.errorf(m.Loc, "method %s already declared for %s", m.Name.Lexeme, typ)
+			continue
+		}
+		c.methods[typ][m.Name.Lexeme] = m
+	}
+}
+
+// Returns the interface the type t stands for, or nil when it isn't one
+func (c *Checker) interfaceOf(t string) *parser.InterfaceType {
+	if module, name, ok := strings.Cut(t, "."); ok {
+		if m, ok := c.imports[module][name]; ok {
+			return m.iface
+		}
+		return nil
+	}
+	if dt, ok := c.types[t]; ok {
+		return dt.Interface
+	}
+	return nil
+}
+
+// Returns the type of the method name of the type t
+func (c *Checker) methodOf(t string, name string) (string, bool) {
+	if k, ok := c.lookupTypeParam(t); ok {
+		t = k
+	}
+
+	if iface := c.interfaceOf(t); iface != nil {
+		for _, sig := range iface.Methods {
+			if sig.Name.Lexeme == name {
+				return methodType(sig.Args, sig.Type), true
+			}
+		}
+		return unknownType, false
+	}
+
+	if m, ok := c.methods[baseType(t)][name]; ok {
+		return methodType(m.Args, m.Type), true
+	}
+	return unknownType, false
+}
+
+// Checks a method access on a value of type t, returning the method type.
+// Only declared named types are known to lack a method.
+func (c *Checker) checkMethod(n *parser.Field, t string) string {
+	if m, ok := c.methodOf(t, n.Name.Lexeme); ok {
+		return m
+	}
+
+	_, param := c.lookupTypeParam(t)
+	_, local := c.types[baseType(t)]
+	if local || param || c.interfaceOf(t) != nil {
+		c.errorf(n.Loc, "type %s has no method %s", t, n.Name.Lexeme)
+	}
+	return unknownType
+}
+
+// Returns why the type t doesn't implement the interface iface, or an empty
+// string when it does. Interfaces are satisfied structurally, by having
+// methods of the same name and type.
+func (c *Checker) missingMethod(t string, iface string) string {
+	if t == iface {
+		return ""
+	}
+	for _, sig := range c.interfaceOf(iface).Methods {
+		want := methodType(sig.Args, sig.Type)
+		got, ok := c.methodOf(t, sig.Name.Lexeme)
+		if !ok {
+			return "missing method " + sig.Name.Lexeme
+		}
+		if got != want {
+			return "method " + sig.Name.Lexeme + " has type " + got + ", want " + want
+		}
+	}
+	return ""
+}
+
+// Reports a value of type t used as the interface type target when t
+// doesn't implement it
+func (c *Checker) checkImplements(loc parser.Loc, t string, target string) {
+	if t == unknownType || t == nullType || c.interfaceOf(target) == nil {
+		return
+	}
+	if reason := c.missingMethod(t, target); reason != "" {
+		c.errorf(loc, "%s does not implement %s: %s", t, target, reason)
+	}
+}
+
+func (c *Checker) checkInterface(iface *parser.InterfaceType) {
+	seen := map[string]bool{}
+	for _, sig := range iface.Methods {
+		if seen[sig.Name.Lexeme] {
+			c.errorf(sig.Loc, "method %s already declared", sig.Name.Lexeme)
+		}
+		seen[sig.Name.Lexeme] = true
+
+		for i, arg := range *sig.Args {
+			decl := arg.(*parser.VarDeclExpression)
+			if i > 0 || decl.Name.Lexeme != "self" {
+				c.checkType(decl.Type)
+			}
+		}
+		c.checkType(sig.Type)
+	}
+}
+
+func (c *Checker) checkImpl(n *parser.ImplStmt) {
+	name := n.Type.Lexeme
+	dt, ok := c.types[name]
+	switch {
+	case !ok:
+		c.errorf(n.Loc, "impl for unknown type %s", name)
+	case dt.Interface != nil:
+		c.errorf(n.Loc, "cannot declare methods on interface %s", name)
+	}
+
+	for _, m := range n.Methods {
+		c.beginScope()
+		c.declareTypeParams(m.TypeParams)
+		c.checkType(m.Type)
+		c.checkFn(nil, m.Args, m.Type, m.Body)
+		c.endScope()
+	}
+}
+
+// Returns the declaration of the fn or method a call refers to, or nil when
+// it is called through a value
+func (c *Checker) calledFn(n *parser.FnCall) *parser.FnDeclStmt {
+	if n.Name != nil {
+		for i := len(c.scopes) - 1; i > 0; i-- {
+			if _, ok := c.scopes[i].vars[n.Name.Lexeme]; ok {
+				return nil
+			}
+		}
+		return c.funcs[n.Name.Lexeme]
+	}
+
+	field, ok := n.Callee.(*parser.Field)
+	if !ok {
+		return nil
+	}
+	if v, ok := field.Object.(*parser.Variable); ok && c.isModule(v.Name.Lexeme) {
+		if m, ok := c.imports[v.Name.Lexeme][field.Name.Lexeme]; ok {
+			return m.fn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package checker
+
+import (
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Returns whether expr denotes a storage location whose address can be taken
+func isAddressable(expr parser.IExpression) bool {
+	switch e := expr.(type) {
+	case *parser.Variable, *parser.Index, *parser.Field, *parser.Deref:
+		return true
+	case *parser.Grouping:
+		return isAddressable(e.Grouped)
+	}
+	return false
+}
+
+func isNull(expr parser.IExpression) bool {
+	switch e := expr.(type) {
+	case *parser.Literal:
+		return e.Value != nil && e.Value.TokenType == lexer.Null
+	case *parser.Grouping:
+		return isNull(e.Grouped)
+	}
+	return false
+}
+
+func (c *Checker) checkAddressOf(n *parser.AddressOf) string {
+	t := c.check(n.Operand)
+	if !isAddressable(n.Operand) {
+		c.errorf(n.Loc, "cannot take the address of a value that is not a variable")
+		return unknownType
+	}
+	if c.isConst(n.Operand) {
+		c.errorf(n.Loc, "cannot take the address of constant %s", n.Operand.(*parser.Variable).Name.Lexeme)
+	}
+	if t == unknownType {
+		return unknownType
+	}
+	if t == untypedIntType {
+		t = "int"
+	}
+	return "*" + t
+}
+
+func (c *Checker) checkDeref(n *parser.Deref) string {
+	t := c.check(n.Operand)
+	switch {
+	case isNull(n.Operand):
+		c.errorf(n.Loc, "dereference of NULL")
+	case t != unknownType && !isPointer(t):
+		c.errorf(n.Loc, "cannot dereference non-pointer type %s", t)
+	case isPointer(t):
+		return t[1:]
+	}
+	return unknownType
+}
+
+// Returns whether t is a builtin type other than a pointer. Named types may
+// alias a pointer type and are never reported.
+func isNonPointer(t string) bool {
+	switch {
+	case isInteger(t), t == boolType, t == stringType, t == floatType:
+		return true
+	}
+	for _, prefix := range []string{"fn(", "chan<", "["} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports NULL being used as a value of the non-pointer type t, as only
+// pointers are nullable
+func (c *Checker) checkNullable(loc parser.Loc, expr parser.IExpression, t string) {
+	if isNull(expr) && isNonPointer(t) {
+		c.errorf(loc, "cannot use NULL as %s", t)
+	}
+}
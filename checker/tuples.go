@@ -0,0 +1,118 @@
+package checker
+
+import (
+	"strings"
+	"yal/parser"
+)
+
+// Returns the element types of the tuple type t, or nil when t is not a
+// tuple
+func tupleElems(t string) []string {
+	if !strings.HasPrefix(t, "(") || !strings.HasSuffix(t, ")") {
+		return nil
+	}
+	return splitTypes(t[1 : len(t)-1])
+}
+
+// Splits a comma separated list of types, ignoring the commas nested in
+// the types themselves
+func splitTypes(list string) []string {
+	types := []string{}
+	depth, start := 0, 0
+	for i, r := range list {
+		switch r {
+		case '(', '<', '[':
+			depth++
+		case ')', '>', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(types, strings.TrimSpace(list[start:]))
+}
+
+// Returns how many values a value of type t stands for
+func valueCount(t string) int {
+	if elems := tupleElems(t); elems != nil {
+		return len(elems)
+	}
+	return 1
+}
+
+func (c *Checker) checkTuple(n *parser.Tuple) string {
+	elems := []string{}
+	for _, elem := range n.Elems {
+		t := c.check(elem)
+		switch t {
+		case untypedIntType:
+			t = "int"
+		case unknownType:
+			// A tuple is only known when all of its elements are
+			return unknownType
+		}
+		elems = append(elems, t)
+	}
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+func (c *Checker) checkTupleDecl(n *parser.TupleDecl) {
+	t := c.check(n.Initializer)
+	elems := tupleElems(t)
+
+	switch {
+	case t == unknownType:
+	case elems == nil:
+		c.errorf(n.Loc, "cannot destructure non-tuple type %s", t)
+	case len(elems) != len(n.Names):
+		c.errorf(n.Loc, "cannot destructure %s into %d variables", t, len(n.Names))
+		elems = nil
+	}
+
+	for i, name := range n.Names {
+		if name.Lexeme == "_" {
+			continue
+		}
+		if i < len(elems) {
+			c.define(name, elems[i])
+		} else {
+			c.define(name, unknownType)
+		}
+	}
+}
+
+// Checks a return statement returning a value of type t
+func (c *Checker) checkExplicitReturn(n *parser.FnReturn, t string) {
+	if len(c.rets) == 0 {
+		c.errorf(n.Loc, "return outside of a fn")
+		return
+	}
+
+	ret := c.rets[len(c.rets)-1]
+	switch {
+	case ret == voidType && n.Value != nil:
+		c.errorf(n.Loc, "value returned from void fn")
+	case ret != voidType && ret != unknownType && n.Value == nil:
+		c.errorf(n.Loc, "missing return value")
+	default:
+		c.checkReturn(n.Loc, t)
+	}
+}
+
+// Reports a value of type t returned from the enclosing fn when it doesn't
+// hold as many values as the fn returns
+func (c *Checker) checkReturn(loc parser.Loc, t string) {
+	if len(c.rets) == 0 {
+		return
+	}
+	ret := c.rets[len(c.rets)-1]
+	if ret == unknownType || ret == voidType || t == unknownType {
+		return
+	}
+	if want, got := valueCount(ret), valueCount(t); want != got {
+		c.errorf(loc, "fn returns %d values, got %d", want, got)
+	}
+}
@@ -0,0 +1,152 @@
+package checker
+
+import (
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Types are represented by their rendered annotation, such as "int" or
+// "fn(int): int". An empty string stands for a type that is not known.
+const (
+	unknownType    = ""
+	voidType       = "void"
+	boolType       = "bool"
+	stringType     = "string"
+	floatType      = "float"
+	untypedIntType = "untyped int"
+	nullType       = "NULL"
+)
+
+func isInteger(t string) bool {
+	switch t {
+	case "int", "uint", "char", untypedIntType:
+		return true
+	}
+	return false
+}
+
+func isPointer(t string) bool {
+	return strings.HasPrefix(t, "*")
+}
+
+func isArithmetic(op lexer.TokenType) bool {
+	switch op {
+	case lexer.Plus, lexer.Minus, lexer.Star, lexer.Slash, lexer.Rem,
+		lexer.Shl, lexer.Shr:
+		return true
+	}
+	return false
+}
+
+// Renders a type annotation node, returning unknownType for a missing one
+func typeString(ann parser.IExpression) string {
+	return substType(ann, nil)
+}
+
+// Renders a type annotation node with the type parameters bound in bindings
+// replaced by their type
+func substType(ann parser.IExpression, bindings map[string]string) string {
+	switch t := ann.(type) {
+	case *parser.TypeName:
+		s := t.Name.Lexeme
+		if t.Module != nil {
+			s = t.Module.Lexeme + "." + s
+		} else if b, ok := bindings[s]; ok {
+			return b
+		}
+		if len(t.Args) > 0 {
+			args := []string{}
+			for _, arg := range t.Args {
+				args = append(args, substType(arg, bindings))
+			}
+			s += "<" + strings.Join(args, ", ") + ">"
+		}
+		return s
+	case *parser.FnType:
+		params := []string{}
+		for _, p := range t.Params {
+			params = append(params, substType(p, bindings))
+		}
+		s := "fn(" + strings.Join(params, ", ") + ")"
+		if t.Return != nil {
+			s += ": " + substType(t.Return, bindings)
+		}
+		return s
+	case *parser.ChanType:
+		return "chan<" + substType(t.Elem, bindings) + ">"
+	case *parser.ArrayType:
+		return "[" + sizeString(t.Size) + "]" + substType(t.Elem, bindings)
+	case *parser.PointerType:
+		return "*" + substType(t.Elem, bindings)
+	case *parser.VariadicType:
+		return "..." + substType(t.Elem, bindings)
+	case *parser.TupleType:
+		elems := []string{}
+		for _, elem := range t.Elems {
+			elems = append(elems, substType(elem, bindings))
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	}
+	return unknownType
+}
+
+// Renders an array size as written, as types are compared by name
+func sizeString(size parser.IExpression) string {
+	switch s := size.(type) {
+	case *parser.Literal:
+		return s.Value.Lexeme
+	case *parser.Variable:
+		return s.Name.Lexeme
+	}
+	return "?"
+}
+
+// Returns the type of the elements of the array type t
+func elemType(t string) string {
+	if !strings.HasPrefix(t, "[") {
+		return unknownType
+	}
+	return t[strings.Index(t, "]")+1:]
+}
+
+func literalType(tk *lexer.Token) string {
+	if tk == nil {
+		return unknownType
+	}
+
+	switch tk.TokenType {
+	case lexer.Number2, lexer.Number8, lexer.Number10, lexer.Number16:
+		if strings.Contains(tk.Lexeme, ".") {
+			return floatType
+		}
+		return untypedIntType
+	case lexer.String:
+		return stringType
+	case lexer.True, lexer.False:
+		return boolType
+	case lexer.Null:
+		return nullType
+	}
+	return unknownType
+}
+
+// Returns the type both a and b can be used as, an unknown type agreeing
+// with anything and an untyped integer with every integer type
+func unify(a, b string) (string, bool) {
+	switch {
+	case a == unknownType:
+		return b, true
+	case b == unknownType, a == b:
+		return a, true
+	case a == untypedIntType && isInteger(b):
+		return b, true
+	case b == untypedIntType && isInteger(a):
+		return a, true
+	case a == nullType && isPointer(b):
+		return b, true
+	case b == nullType && isPointer(a):
+		return a, true
+	}
+	return unknownType, false
+}
@@ -4,46 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"yal/lexer"
-	"yal/parser"
+	"yal/driver"
 )
 
 func main() {
 	ctx := context.Background()
 
 	if len(os.Args) != 2 {
-		panic("there must have 1 parameter, a file or - for stdin")
+		panic("there must have 1 parameter, a file, a package directory or - for stdin")
 	}
 
-	var f *os.File
-	var data []byte
-	var err error
-
-	if os.Args[1] == "-" {
-		f = os.Stdin
-	} else {
-		f, err = os.Open(os.Args[1])
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	data, err = io.ReadAll(f)
+	pkg, err := driver.Load(ctx, os.Args[1])
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	l := lexer.NewLexer(ctx, string(data))
-
-	tokens, err := l.Scan()
-	if err != nil {
-		panic(err)
+	errs := driver.Check(ctx, pkg)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
 	}
 
-	yalParser := parser.NewParser(ctx, tokens)
-	tree := yalParser.Run()
+	tree := pkg.Stmts()
 
 	// for _, stmt := range tree {
 	// 	switch stmt.(type) {
@@ -63,7 +49,7 @@ func main() {
 	// 	}
 	// }
 
-	data, err = json.MarshalIndent(tree, "", " ")
+	data, err := json.MarshalIndent(tree, "", " ")
 	if err != nil {
 		panic(err)
 	}
@@ -1,5 +1,61 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"yal/driver"
+	"yal/vm"
+)
+
+const usage = `usage: vm [flags] <file, package directory or ->
+
+Runs the main fn of a package, exiting with the int it returns.
+
+flags:
+  -O0, -O1, -O2  optimization level, 0 by default
+`
+
 func main() {
+	ctx := context.Background()
+
+	flags := flag.NewFlagSet("vm", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	level := driver.OptLevel(flags)
+	_ = flags.Parse(os.Args[1:])
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	pkg, err := driver.Load(ctx, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	errs := driver.Check(ctx, pkg)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	m, err := driver.Lower(pkg, level(), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
+	code, err := vm.New(m, os.Stdout).Run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if re, ok := err.(*vm.RuntimeError); ok {
+			fmt.Fprint(os.Stderr, re.Stack())
+		}
+		os.Exit(1)
+	}
+	os.Exit(code)
 }
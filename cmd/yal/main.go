@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"yal/amd64"
+	"yal/cfg"
+	"yal/cgen"
+	"yal/driver"
+	"yal/gogen"
+	"yal/llvm"
+	"yal/module"
+	"yal/parser"
+	"yal/wasm"
+)
+
+const usage = `usage: yal <command> [flags] <file, package directory or ->
+
+commands:
+  ast    print the syntax tree of the package as JSON
+  cfg    print the control flow graph of each fn in the DOT language
+  ir     print the SSA form of the package
+  build  compile the package to an executable
+
+flags of ir and build:
+  -O0, -O1, -O2  optimization level, 0 by default
+
+flags of ir:
+  -stats         print the changes and time of each optimization pass
+
+flags of build:
+  -target=amd64|wasm
+                 architecture to compile for, amd64 by default
+  -emit=exe|asm|c|ll|go
+                 output to write, an executable linked with as and ld by
+                 default, the assembly it is built from, C99 source
+                 written along with the yal.h header it includes, LLVM
+                 IR with debug info or Go source. For wasm, exe is a
+                 binary .wasm module and asm its text format.
+  -pkg name      package of the Go source, main by default
+  -o file        file to write, named after the package argument by default
+                 or stdout for assembly
+`
+
+func main() {
+	ctx := context.Background()
+
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("yal "+os.Args[1], flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	var run func(pkg *module.Package) error
+	switch os.Args[1] {
+	case "ast":
+		run = printAST
+	case "cfg":
+		run = printCFG
+	case "ir":
+		level := driver.OptLevel(flags)
+		stats := flags.Bool("stats", false, "")
+		run = func(pkg *module.Package) error {
+			return printIR(pkg, level(), *stats)
+		}
+	case "build":
+		level := driver.OptLevel(flags)
+		target := flags.String("target", "amd64", "")
+		emit := flags.String("emit", "exe", "")
+		out := flags.String("o", "", "")
+		pkgName := flags.String("pkg", "main", "")
+		run = func(pkg *module.Package) error {
+			switch {
+			case *out == "" && *emit == "exe" && *target == "wasm":
+				*out = outputName(flags.Arg(0)) + ".wasm"
+			case *out == "" && *emit == "exe":
+				*out = outputName(flags.Arg(0))
+			case *out == "" && *emit == "c":
+				*out = outputName(flags.Arg(0)) + ".c"
+			case *out == "" && *emit == "ll":
+				*out = outputName(flags.Arg(0)) + ".ll"
+			case *out == "" && *emit == "go":
+				*out = outputName(flags.Arg(0)) + ".go"
+			}
+			if *emit == "go" {
+				return buildGo(pkg, *pkgName, *out)
+			}
+			return build(ctx, pkg, level(), *target, *emit, *out)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	_ = flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	pkg, err := driver.Load(ctx, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	errs := driver.Check(ctx, pkg)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	if err := run(pkg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func printAST(pkg *module.Package) error {
+	data, err := json.MarshalIndent(pkg.Stmts(), "", " ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("%v\n", string(data))
+	return err
+}
+
+func printCFG(pkg *module.Package) error {
+	return cfg.WriteDOT(os.Stdout, cfg.BuildAll(pkg.Stmts()))
+}
+
+func printIR(pkg *module.Package, level int, stats bool) error {
+	var w io.Writer
+	if stats {
+		w = os.Stderr
+	}
+	m, err := driver.Lower(pkg, level, w)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Print(m)
+	return err
+}
+
+func build(ctx context.Context, pkg *module.Package, level int, target string, emit string, out string) error {
+	if target != "amd64" && target != "wasm" {
+		return fmt.Errorf("unknown target %s", target)
+	}
+	switch emit {
+	case "c":
+		return buildC(pkg, out)
+	case "ll":
+		return buildLL(pkg, level, out)
+	case "exe", "asm":
+	default:
+		return fmt.Errorf("unknown output %s", emit)
+	}
+
+	m, err := driver.Lower(pkg, level, nil)
+	if err != nil {
+		return err
+	}
+	var asm bytes.Buffer
+	switch {
+	case target == "wasm" && emit == "exe":
+		err = wasm.GenerateBinary(&asm, m)
+	case target == "wasm":
+		err = wasm.GenerateText(&asm, m)
+	default:
+		err = amd64.Generate(&asm, m)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case emit == "exe" && target == "amd64":
+		return amd64.Link(ctx, asm.Bytes(), out)
+	case out == "":
+		_, err = os.Stdout.Write(asm.Bytes())
+		return err
+	}
+	return os.WriteFile(out, asm.Bytes(), 0o644)
+}
+
+// Writes the C source of a package and the packages it imports to out and
+// the header it includes next to it
+func buildC(pkg *module.Package, out string) error {
+	var src bytes.Buffer
+	if err := cgen.GenerateProgram(&src, driver.Packages(pkg)); err != nil {
+		return err
+	}
+	header := filepath.Join(filepath.Dir(out), cgen.HeaderName)
+	if err := os.WriteFile(header, []byte(cgen.Header), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(out, src.Bytes(), 0o644)
+}
+
+// Writes the LLVM IR of a package to out, with debug info pointing at the
+// files its fns are declared in
+func buildLL(pkg *module.Package, level int, out string) error {
+	m, err := driver.Lower(pkg, level, nil)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{}
+	for _, file := range pkg.Files {
+		path, err := filepath.Abs(file.Name)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range file.Stmts {
+			if fn, ok := stmt.(*parser.FnDeclStmt); ok {
+				files[fn.Name.Lexeme] = path
+			}
+		}
+	}
+
+	var ll bytes.Buffer
+	if err := llvm.Generate(&ll, m, files); err != nil {
+		return err
+	}
+	return os.WriteFile(out, ll.Bytes(), 0o644)
+}
+
+// Writes the Go source of a package and the packages it imports to out as
+// package name
+func buildGo(pkg *module.Package, name string, out string) error {
+	var src bytes.Buffer
+	if err := gogen.GenerateProgram(&src, driver.Packages(pkg), name); err != nil {
+		return err
+	}
+	return os.WriteFile(out, src.Bytes(), 0o644)
+}
+
+// Names executables after the file or directory they are built from
+func outputName(arg string) string {
+	if arg == "-" {
+		return "main"
+	}
+	return strings.TrimSuffix(filepath.Base(arg), ".yal")
+}
@@ -0,0 +1,250 @@
+package consteval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Returned by Eval when the expression isn't a constant expression
+var ErrNotConstant = errors.New("not a constant expression")
+
+// Error in a constant expression, such as a division by zero
+type Error struct {
+	parser.Loc
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Value of a constant expression, an arbitrary precision integer unless
+// IsBool is set
+type Value struct {
+	Int    *big.Int
+	Bool   bool
+	IsBool bool
+}
+
+func (v Value) String() string {
+	if v.IsBool {
+		return fmt.Sprint(v.Bool)
+	}
+	return v.Int.String()
+}
+
+// Returns whether both values are the same constant
+func (v Value) Equal(o Value) bool {
+	if v.IsBool || o.IsBool {
+		return v.IsBool == o.IsBool && v.Bool == o.Bool
+	}
+	return v.Int.Cmp(o.Int) == 0
+}
+
+// Resolves the value of a named constant, returning false when the name
+// doesn't refer to one
+type Lookup func(name *lexer.Token) (Value, bool)
+
+// Evaluates a constant expression made of literals, named constants and the
+// Binary, UnaryRight and Grouping nodes over them. Integers never overflow
+// during evaluation, see Fits to check them against a type.
+func Eval(expr parser.IExpression, lookup Lookup) (Value, error) {
+	switch n := expr.(type) {
+	case *parser.Literal:
+		return literal(n.Value)
+	case *parser.Grouping:
+		return Eval(n.Grouped, lookup)
+	case *parser.Variable:
+		if lookup != nil {
+			if v, ok := lookup(n.Name); ok {
+				return v, nil
+			}
+		}
+		return Value{}, ErrNotConstant
+	case *parser.UnaryRight:
+		v, err := Eval(n.Right, lookup)
+		if err != nil {
+			return v, err
+		}
+		return unary(n.Operator, v)
+	case *parser.Binary:
+		left, err := Eval(n.Left, lookup)
+		if err != nil {
+			return left, err
+		}
+		right, err := Eval(n.Right, lookup)
+		if err != nil {
+			return right, err
+		}
+		return binary(n.Operator, left, right)
+	case *parser.Logical:
+		left, err := Eval(n.Left, lookup)
+		if err != nil {
+			return left, err
+		}
+		right, err := Eval(n.Right, lookup)
+		if err != nil {
+			return right, err
+		}
+		return binary(n.Operator, left, right)
+	}
+
+	return Value{}, ErrNotConstant
+}
+
+// Returns whether v can be represented by the integer type t. Unknown types
+// always fit.
+func Fits(v *big.Int, t string) bool {
+	min, max, ok := Range(t)
+	if !ok {
+		return true
+	}
+	return v.Cmp(min) >= 0 && v.Cmp(max) <= 0
+}
+
+// Returns the smallest and largest values of the integer type t
+func Range(t string) (*big.Int, *big.Int, bool) {
+	switch t {
+	case "int":
+		return big.NewInt(-1 << 63), big.NewInt(1<<63 - 1), true
+	case "uint":
+		return big.NewInt(0), new(big.Int).SetUint64(1<<64 - 1), true
+	case "char":
+		return big.NewInt(0), big.NewInt(1<<8 - 1), true
+	}
+	return nil, nil, false
+}
+
+func errorAt(tk *lexer.Token, s string, args ...any) *Error {
+	return &Error{
+		Loc: parser.Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Message: fmt.Sprintf(s, args...),
+	}
+}
+
+func literal(tk *lexer.Token) (Value, error) {
+	if tk == nil {
+		return Value{}, ErrNotConstant
+	}
+
+	switch tk.TokenType {
+	case lexer.True, lexer.False:
+		return Value{Bool: tk.TokenType == lexer.True, IsBool: true}, nil
+	case lexer.Number2, lexer.Number8, lexer.Number10, lexer.Number16:
+	default:
+		return Value{}, ErrNotConstant
+	}
+
+	if strings.Contains(tk.Lexeme, ".") {
+		return Value{}, errorAt(tk, "floating point constant %s is not supported", tk.Lexeme)
+	}
+
+	digits, base := tk.Lexeme, 10
+	switch tk.TokenType {
+	case lexer.Number2:
+		digits, base = digits[2:], 2
+	case lexer.Number16:
+		digits, base = digits[2:], 16
+	case lexer.Number8:
+		digits, base = strings.TrimPrefix(strings.TrimPrefix(digits, "0o"), "0"), 8
+		if digits == "" {
+			digits = "0"
+		}
+	}
+
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return Value{}, errorAt(tk, "invalid %s literal %s", tk.TokenType, tk.Lexeme)
+	}
+	return Value{Int: i}, nil
+}
+
+func unary(op *lexer.Token, v Value) (Value, error) {
+	switch op.TokenType {
+	case lexer.Bang:
+		if !v.IsBool {
+			return Value{}, errorAt(op, "operator ! not defined on integer constant")
+		}
+		return Value{Bool: !v.Bool, IsBool: true}, nil
+	case lexer.Minus:
+		if v.IsBool {
+			return Value{}, errorAt(op, "operator - not defined on bool constant")
+		}
+		return Value{Int: new(big.Int).Neg(v.Int)}, nil
+	}
+	return Value{}, ErrNotConstant
+}
+
+func binary(op *lexer.Token, left, right Value) (Value, error) {
+	if left.IsBool != right.IsBool {
+		return Value{}, errorAt(op, "mismatched constant types in %s", op.Lexeme)
+	}
+
+	if left.IsBool {
+		switch op.TokenType {
+		case lexer.DoubleAmpersand:
+			return Value{Bool: left.Bool && right.Bool, IsBool: true}, nil
+		case lexer.DoublePipe:
+			return Value{Bool: left.Bool || right.Bool, IsBool: true}, nil
+		case lexer.EqualEqual:
+			return Value{Bool: left.Bool == right.Bool, IsBool: true}, nil
+		case lexer.BangEqual:
+			return Value{Bool: left.Bool != right.Bool, IsBool: true}, nil
+		}
+		return Value{}, errorAt(op, "operator %s not defined on bool constants", op.Lexeme)
+	}
+
+	l, r := left.Int, right.Int
+	cmp := l.Cmp(r)
+	switch op.TokenType {
+	case lexer.Plus:
+		return Value{Int: new(big.Int).Add(l, r)}, nil
+	case lexer.Minus:
+		return Value{Int: new(big.Int).Sub(l, r)}, nil
+	case lexer.Star:
+		return Value{Int: new(big.Int).Mul(l, r)}, nil
+	case lexer.Slash, lexer.Rem:
+		if r.Sign() == 0 {
+			return Value{}, errorAt(op, "division by zero in constant expression")
+		}
+		if op.TokenType == lexer.Slash {
+			return Value{Int: new(big.Int).Quo(l, r)}, nil
+		}
+		return Value{Int: new(big.Int).Rem(l, r)}, nil
+	case lexer.Ampersand:
+		return Value{Int: new(big.Int).And(l, r)}, nil
+	case lexer.Pipe:
+		return Value{Int: new(big.Int).Or(l, r)}, nil
+	case lexer.Xor:
+		return Value{Int: new(big.Int).Xor(l, r)}, nil
+	case lexer.Shl, lexer.Shr:
+		if r.Sign() < 0 || !r.IsUint64() || r.Uint64() > 1<<16 {
+			return Value{}, errorAt(op, "invalid shift count %s in constant expression", r)
+		}
+		if op.TokenType == lexer.Shl {
+			return Value{Int: new(big.Int).Lsh(l, uint(r.Uint64()))}, nil
+		}
+		return Value{Int: new(big.Int).Rsh(l, uint(r.Uint64()))}, nil
+	case lexer.EqualEqual:
+		return Value{Bool: cmp == 0, IsBool: true}, nil
+	case lexer.BangEqual:
+		return Value{Bool: cmp != 0, IsBool: true}, nil
+	case lexer.Lesser:
+		return Value{Bool: cmp < 0, IsBool: true}, nil
+	case lexer.LesserEqual:
+		return Value{Bool: cmp <= 0, IsBool: true}, nil
+	case lexer.Greater:
+		return Value{Bool: cmp > 0, IsBool: true}, nil
+	case lexer.GreaterEqual:
+		return Value{Bool: cmp >= 0, IsBool: true}, nil
+	}
+
+	return Value{}, errorAt(op, "operator %s not defined on integer constants", op.Lexeme)
+}
@@ -0,0 +1,81 @@
+package consteval_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Evaluates the initializer of the single let statement in src
+func eval(t *testing.T, src string) (consteval.Value, error) {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := parser.NewParser(ctx, tokens).Run()
+
+	return consteval.Eval(tree[0].(*parser.VarDeclExpression).Initializer, nil)
+}
+
+func TestEval(t *testing.T) {
+	values := map[string]string{
+		"let a = 0x1F + 0b101 + 017 + 0o17 + 10;":                "76",
+		"let a = -(2 - 5) * 4 / 3 % 3;":                          "1",
+		"let a = 1 << 70;":                                       "1180591620717411303424",
+		"let a = 0xFFFFFFFFFFFFFFFFFF >> 8;":                     "18446744073709551615",
+		"let a = (6 & 3) | (8 ^ 12);":                            "6",
+		"let a = 100000000000000000000 * 100000000000000000000;": "10000000000000000000000000000000000000000",
+		"let a = 3 > 2 && !(1 == 2);":                            "true",
+	}
+
+	for src, expected := range values {
+		v, err := eval(t, src)
+		if err != nil {
+			t.Errorf("%s: %v\n", src, err)
+			continue
+		}
+		if v.String() != expected {
+			t.Errorf("%s: expected %s, got %s\n", src, expected, v)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	t.Run("Test division by zero", func(t *testing.T) {
+		_, err := eval(t, "let a = 1 / (2 - 2);")
+
+		var evalErr *consteval.Error
+		if !errors.As(err, &evalErr) || evalErr.Message != "division by zero in constant expression" {
+			t.Errorf("expected division by zero, got %v\n", err)
+		}
+	})
+
+	t.Run("Test not constant", func(t *testing.T) {
+		if _, err := eval(t, "let a = 1 + b;"); err != consteval.ErrNotConstant {
+			t.Errorf("expected ErrNotConstant, got %v\n", err)
+		}
+	})
+}
+
+func TestFits(t *testing.T) {
+	max := new(big.Int).SetUint64(1<<64 - 1)
+
+	if !consteval.Fits(max, "uint") {
+		t.Errorf("expected %s to fit uint\n", max)
+	}
+	if consteval.Fits(max, "int") {
+		t.Errorf("expected %s to overflow int\n", max)
+	}
+	if consteval.Fits(big.NewInt(-1), "uint") {
+		t.Errorf("expected -1 to overflow uint\n")
+	}
+	if consteval.Fits(big.NewInt(256), "char") {
+		t.Errorf("expected 256 to overflow char\n")
+	}
+}
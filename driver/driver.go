@@ -0,0 +1,137 @@
+package driver
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"yal/astutil"
+	"yal/checker"
+	"yal/ir"
+	"yal/module"
+	"yal/opt"
+)
+
+// Loads the package a command line argument refers to: a file, a package
+// directory or - for a single file read from stdin
+func Load(ctx context.Context, arg string) (*module.Package, error) {
+	if arg == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		return module.NewLoader(ctx, ".").LoadSource("main", string(data))
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Imports are resolved relative to the package directory, or to the
+	// directory of the file being compiled
+	root := arg
+	if !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+
+	return module.NewLoader(ctx, root).Load(arg)
+}
+
+// Checks pkg and every package it depends on, returning the errors found
+// prefixed by the path of the package they were found in
+func Check(ctx context.Context, pkg *module.Package) []error {
+	errs := []error{}
+	for _, p := range pkg.Deps() {
+		yalChecker := checker.NewChecker(ctx, p.Stmts())
+		for name, dep := range p.Imports {
+			yalChecker.Import(name, dep.Stmts())
+		}
+
+		for _, err := range yalChecker.Run() {
+			errs = append(errs, fmt.Errorf("%s: %v", p.Path, err))
+		}
+	}
+	return errs
+}
+
+// Adds the -O0, -O1 and -O2 flags to flags, returning a func giving the
+// highest level set
+func OptLevel(flags *flag.FlagSet) func() int {
+	levels := []*bool{}
+	for i := 0; i <= 2; i++ {
+		levels = append(levels, flags.Bool(fmt.Sprintf("O%d", i), false, ""))
+	}
+	return func() int {
+		level := 0
+		for i, set := range levels {
+			if *set {
+				level = i
+			}
+		}
+		return level
+	}
+}
+
+// Returns a checked package along with every package it depends on, each
+// one after the ones it imports, for the backends generating source from
+// the AST. The package itself is the main one, with an empty path.
+func Packages(pkg *module.Package) []*astutil.Package {
+	pkgs := []*astutil.Package{}
+	for _, p := range pkg.Deps() {
+		astPkg := &astutil.Package{Path: p.Path, Stmts: p.Stmts(), Imports: map[string]string{}}
+		if p == pkg {
+			astPkg.Path = ""
+		}
+		for name, dep := range p.Imports {
+			astPkg.Imports[name] = dep.Path
+		}
+		pkgs = append(pkgs, astPkg)
+	}
+	return pkgs
+}
+
+// Lowers a checked package along with every package it depends on to the
+// IR and optimizes it at level, writing the stats of the passes to stats
+// unless it is nil
+func Lower(pkg *module.Package, level int, stats io.Writer) (*ir.Module, error) {
+	pkgs := []*ir.Package{}
+	for _, p := range pkg.Deps() {
+		irPkg := &ir.Package{Path: p.Path, Stmts: p.Stmts(), Imports: map[string]string{}}
+		if p == pkg {
+			irPkg.Path = ""
+		}
+		for name, dep := range p.Imports {
+			irPkg.Imports[name] = dep.Path
+		}
+		pkgs = append(pkgs, irPkg)
+	}
+
+	m, err := ir.BuildProgram(pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	pm := opt.NewManager(level)
+	if err := pm.Run(m); err != nil {
+		return nil, err
+	}
+	if stats != nil {
+		if err := pm.WriteStats(stats); err != nil {
+			return nil, err
+		}
+	}
+
+	if errs := ir.Verify(m); len(errs) > 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, fmt.Errorf("invalid IR:\n%s", strings.Join(msgs, "\n"))
+	}
+	return m, nil
+}
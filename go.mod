@@ -1,3 +1,5 @@
 module yal
 
 go 1.19
+
+require github.com/tetratelabs/wazero v1.6.0
@@ -0,0 +1,1006 @@
+package gogen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"yal/astutil"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+var binaryOps = map[lexer.TokenType]string{
+	lexer.Plus:           "+",
+	lexer.Minus:          "-",
+	lexer.Star:           "*",
+	lexer.Slash:          "/",
+	lexer.Rem:            "%",
+	lexer.Ampersand:      "&",
+	lexer.Pipe:           "|",
+	lexer.Xor:            "^",
+	lexer.Shl:            "<<",
+	lexer.Shr:            ">>",
+	lexer.EqualEqual:     "==",
+	lexer.BangEqual:      "!=",
+	lexer.Lesser:         "<",
+	lexer.LesserEqual:    "<=",
+	lexer.Greater:        ">",
+	lexer.GreaterEqual:   ">=",
+	lexer.PlusEqual:      "+",
+	lexer.MinusEqual:     "-",
+	lexer.StarEqual:      "*",
+	lexer.SlashEqual:     "/",
+	lexer.RemEqual:       "%",
+	lexer.AmpersandEqual: "&",
+	lexer.PipeEqual:      "|",
+	lexer.XorEqual:       "^",
+	lexer.ShlEqual:       "<<",
+	lexer.ShrEqual:       ">>",
+	lexer.Inc:            "+",
+	lexer.Dec:            "-",
+}
+
+// Returns Go evaluating an expression, compound ones being parenthesized,
+// and writes the statements it needs to run first. Integer constants take
+// the type hint when it is numeric. Constant expressions are folded as the
+// vm evaluates them, step by step, since Go evaluates them exactly.
+//
+// Go has no assignment expressions, so assignments, ++ and -- are written
+// as statements before the expression using their value. Since Go only
+// orders the calls of an expression, the operands that must be evaluated
+// before others are stored in temporaries. Values of other types are
+// converted to the interface the hint is.
+func (g *generator) expr(expr parser.IExpression, hint string) string {
+	if g.iface(hint) != nil {
+		if t := astutil.ExprType(g.env, expr); t != hint && t != "NULL" && t != "" {
+			return g.convert(expr, g.expr(expr, t), t, hint)
+		}
+	}
+
+	switch expr.(type) {
+	case *parser.Binary, *parser.UnaryRight, *parser.Logical:
+		if v, ok := g.eval(expr, hint); ok {
+			return g.render(v)
+		}
+	}
+
+	switch n := expr.(type) {
+	case *parser.Literal:
+		return g.literal(n, hint)
+	case *parser.Variable:
+		return g.variable(n.Name)
+	case *parser.Grouping:
+		return g.expr(n.Grouped, hint)
+	case *parser.Binary:
+		return g.binary(n, hint)
+	case *parser.Logical:
+		return g.logical(n.Left, n.Operator, n.Right)
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			return "(!" + g.expr(n.Right, "bool") + ")"
+		}
+		return "(-" + g.expr(n.Right, astutil.OperandType(g.env, hint, n.Right)) + ")"
+	case *parser.Assign:
+		s, lv := g.assign(n)
+		g.Line("%s", s)
+		g.read(n.Name, n.Target)
+		return lv
+	case *parser.PrefixIncDec:
+		s, lv := g.incDec(n.Target, n.Operator)
+		g.Line("%s", s)
+		g.read(nil, n.Target)
+		return lv
+	case *parser.PostfixIncDec:
+		s, lv := g.incDec(n.Target, n.Operator)
+		g.read(nil, n.Target)
+		v := g.temp(lv)
+		g.Line("%s", s)
+		return v
+	case *parser.AddressOf:
+		v, ok := n.Operand.(*parser.Variable)
+		if !ok {
+			astutil.Fail(n, "only the address of variables is supported by the Go backend")
+		}
+		l := g.resolve(v.Name)
+		if l.konst != nil {
+			astutil.Fail(n, "cannot take the address of constant %s", v.Name.Lexeme)
+		}
+		l.used = true
+		return "(&" + l.name + ")"
+	case *parser.Deref:
+		return g.deref(n, g.expr(n.Operand, ""))
+	case *parser.Index:
+		return g.index(n, false)
+	case *parser.FnCall:
+		return g.call(n, hint)
+	case *parser.IfExpr:
+		return g.ifValue(n, hint)
+	case *parser.Try:
+		return g.try(n)
+	case *parser.MatchExpr:
+		return g.matchValue(n, hint)
+	}
+	g.unsupported(expr)
+	return ""
+}
+
+func (g *generator) literal(n *parser.Literal, hint string) string {
+	tk := n.Value
+	switch {
+	case tk == nil:
+		return g.zero(hint)
+	case tk.TokenType == lexer.True || tk.TokenType == lexer.False:
+		return strconv.FormatBool(tk.TokenType == lexer.True)
+	case tk.TokenType == lexer.String:
+		return strconv.Quote(tk.Lexeme)
+	case tk.TokenType == lexer.Null:
+		return "nil"
+	case astutil.IsNumber(tk):
+		v, _ := g.eval(n, hint)
+		return g.render(v)
+	}
+	g.unsupported(n)
+	return ""
+}
+
+// Returns a Go constant holding v, a value of a yal type
+func (g *generator) render(v any) string {
+	f, ok := v.(float64)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	switch {
+	case math.IsNaN(f):
+		g.imports["math"] = true
+		return "math.NaN()"
+	case math.IsInf(f, 1):
+		g.imports["math"] = true
+		return "math.Inf(1)"
+	case math.IsInf(f, -1):
+		g.imports["math"] = true
+		return "math.Inf(-1)"
+	case f == 0 && math.Signbit(f):
+		g.imports["math"] = true
+		return "math.Copysign(0, -1)"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func (g *generator) resolve(name *lexer.Token) *local {
+	l := g.lookup(name.Lexeme)
+	if l == nil {
+		fn := astutil.Qualify(g.pkg.Path, name.Lexeme)
+		if _, ok := g.sigs[fn]; ok || g.generics[fn] != nil {
+			astutil.Fail(name, "fn values are not supported by the Go backend")
+		}
+		astutil.Fail(name, "unknown variable %s", name.Lexeme)
+	}
+	return l
+}
+
+func (g *generator) variable(name *lexer.Token) string {
+	l := g.resolve(name)
+	l.used = true
+	return l.name
+}
+
+// Marks the variable an assignment, ++ or -- stores to as used, when its
+// value is read afterwards
+func (g *generator) read(name *lexer.Token, target parser.IExpression) {
+	switch n := target.(type) {
+	case nil:
+		g.resolve(name).used = true
+	case *parser.Variable:
+		g.resolve(n.Name).used = true
+	}
+}
+
+func (g *generator) binary(n *parser.Binary, hint string) string {
+	if astutil.IsLogical(n.Operator.TokenType) {
+		return g.logical(n.Left, n.Operator, n.Right)
+	}
+
+	t := astutil.OperandType(g.env, hint, n.Left, n.Right)
+	if astutil.IsShift(n.Operator.TokenType) {
+		t = astutil.OperandType(g.env, hint, n.Left)
+	}
+	ops := g.operands([]parser.IExpression{n.Left, n.Right}, []string{t, t})
+
+	op := binaryOps[n.Operator.TokenType]
+	switch {
+	case astutil.IsCompare(n.Operator.TokenType):
+		return g.compare(n, op, t, ops[0], ops[1])
+	case astutil.IsShift(n.Operator.TokenType):
+		if g.untyped(n.Left) {
+			ops[0] = g.conversion(t, ops[0])
+		}
+		ops[1] = g.count(n.Right, t, ops[1])
+	case op == "/" || op == "%":
+		g.divisor(n.Operator, n.Right, t)
+	case (op == "&" || op == "|") && astutil.Underlying(g.env, t) == "bool" && astutil.Effects(n.Right) && !g.temps[ops[1]]:
+		// && and || would skip the right operand
+		ops[1] = g.temp(ops[1])
+	}
+	return g.arith(n.Operator, op, t, ops[0], ops[1])
+}
+
+func (g *generator) compare(n any, op string, t string, l string, r string) string {
+	switch u := astutil.Underlying(g.env, t); {
+	case strings.HasPrefix(u, "["):
+		astutil.Fail(n, "comparing arrays is not supported by the Go backend")
+	case astutil.IsResult(u):
+		astutil.Fail(n, "comparing Results is not supported by the Go backend")
+	}
+	return fmt.Sprintf("(%s %s %s)", l, op, r)
+}
+
+// Returns Go applying arithmetic operator op to operands of type t, tk being
+// where the operator is written
+func (g *generator) arith(tk *lexer.Token, op string, t string, l string, r string) string {
+	native := fmt.Sprintf("(%s %s %s)", l, op, r)
+	switch u := astutil.Underlying(g.env, t); u {
+	case "int", "uint", "char":
+		return native
+	case "bool":
+		switch op {
+		case "&":
+			return fmt.Sprintf("(%s && %s)", l, r)
+		case "|":
+			return fmt.Sprintf("(%s || %s)", l, r)
+		case "^":
+			return fmt.Sprintf("(%s != %s)", l, r)
+		}
+	case "float":
+		if op == "+" || op == "-" || op == "*" || op == "/" {
+			return native
+		}
+	case "string":
+		if op == "+" {
+			return native
+		}
+	}
+	astutil.Fail(tk, "operator %s on %s is not supported by the Go backend", tk.Lexeme, t)
+	return ""
+}
+
+// Fails for a constant zero divisor, which Go rejects while the vm stops
+// the program once it divides by it
+func (g *generator) divisor(tk *lexer.Token, expr parser.IExpression, t string) {
+	if v, ok := g.eval(expr, t); ok && (v == int64(0) || v == uint64(0) || v == uint8(0) || v == 0.0) {
+		astutil.Fail(tk, "division by zero")
+	}
+}
+
+// Returns the count of a shift. The vm takes counts as unsigned, so that
+// negative ones give 0 or -1 like the ones of 64 or more, which constant
+// counts are capped to.
+func (g *generator) count(expr parser.IExpression, t string, r string) string {
+	if v, ok := g.eval(expr, t); ok {
+		n := bits(v)
+		if n > 64 {
+			n = 64
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	if astutil.Underlying(g.env, astutil.ValueType(g.env, expr, t)) == "int" {
+		return "uint64(" + astutil.Unparen(r) + ")"
+	}
+	return r
+}
+
+// Generates && and ||, whose right operand is only evaluated, along with
+// the statements it needs, when the left one doesn't decide the result
+func (g *generator) logical(left parser.IExpression, operator *lexer.Token, right parser.IExpression) string {
+	l := g.expr(left, "bool")
+	r, pre := g.Split(g.Depth+1, func() string { return g.expr(right, "bool") })
+	op := "||"
+	if operator.TokenType == lexer.DoubleAmpersand {
+		op = "&&"
+	}
+	if pre == "" {
+		return fmt.Sprintf("(%s %s %s)", l, op, r)
+	}
+
+	v := g.temp(l)
+	if op == "&&" {
+		g.Line("if %s {", v)
+	} else {
+		g.Line("if !%s {", v)
+	}
+	g.W.WriteString(pre)
+	g.Line("\t%s = %s", v, astutil.Unparen(r))
+	g.Line("}")
+	return v
+}
+
+// Generates an if used as a value, assigning the values of its branches to
+// a temporary
+func (g *generator) ifValue(n *parser.IfExpr, hint string) string {
+	if n.ElseBranch == nil {
+		astutil.Fail(n, "if without else used as a value")
+	}
+	t := g.joinType(astutil.ExprType(g.env, n), hint)
+
+	v := g.newTemp()
+	g.Line("var %s %s", v, g.goType(t))
+	g.ifStmt(n, g.assignSink(v, t))
+	return v
+}
+
+// Generates a match used as a value, assigning the values of its arms to a
+// temporary
+func (g *generator) matchValue(n *parser.MatchExpr, hint string) string {
+	t := g.joinType(astutil.ExprType(g.env, n), hint)
+
+	v := g.newTemp()
+	g.Line("var %s %s", v, g.goType(t))
+	g.matchStmt(n, g.assignSink(v, t))
+	return v
+}
+
+// Returns the type of the value of an if or a match whose first branch
+// evaluates to a value of type t, which is given by the hint when it is an
+// integer constant, NULL, or a Result that Ok or Err make
+func (g *generator) joinType(t string, hint string) string {
+	switch {
+	case t != "" && t != "NULL":
+		return t
+	case astutil.IsPointer(hint) || astutil.IsResult(astutil.Underlying(g.env, hint)):
+		return hint
+	}
+	return astutil.OperandType(g.env, hint)
+}
+
+// Generates ?, which returns the error of a Result holding one from the fn
+// being generated and evaluates to the value it holds otherwise
+func (g *generator) try(n *parser.Try) string {
+	t := astutil.ExprType(g.env, n.Operand)
+	u := astutil.Underlying(g.env, t)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "? applied to a value of type %s instead of a Result", t)
+	}
+	ret := astutil.Underlying(g.env, g.ret)
+	if !astutil.IsResult(ret) {
+		astutil.Fail(n, "? used in a fn returning %s instead of a Result", g.ret)
+	}
+	_, err := astutil.Outcomes(u)
+	if _, want := astutil.Outcomes(ret); err != want {
+		astutil.Fail(n, "? propagates %s errors from a fn returning %s errors", err, want)
+	}
+
+	r := g.expr(n.Operand, t)
+	if !g.temps[r] {
+		r = g.temp(r)
+	}
+	g.Line("if !%s.Ok {", r)
+	g.Line("\treturn %s{Err: %s.Err}", g.goType(g.ret), r)
+	g.Line("}")
+	return r + ".Value"
+}
+
+func (g *generator) deref(n *parser.Deref, p string) string {
+	if !strings.HasPrefix(astutil.Underlying(g.env, astutil.ExprType(g.env, n.Operand)), "*") {
+		astutil.Fail(n, "dereferencing NULL")
+	}
+	if _, ok := n.Operand.(*parser.AddressOf); ok {
+		return "(*" + p + ")"
+	}
+	g.imports[Runtime] = true
+	return fmt.Sprintf("(*gort.NonNil(%s, %d, %d))", astutil.Unparen(p), n.Line, n.Column)
+}
+
+// Generates an array index, which Go checks against the length of the
+// array, at compile time for constant indexes. The index is stored in a
+// temporary when hoist is set, so that the element can be referred to again
+// after evaluating other expressions.
+func (g *generator) index(n *parser.Index, hoist bool) string {
+	t := astutil.Underlying(g.env, astutil.ExprType(g.env, n.Object))
+	if !strings.HasPrefix(t, "[") {
+		astutil.Fail(n, "only arrays can be indexed by the Go backend")
+	}
+	size, _ := astutil.ArrayOf(t)
+
+	var obj string
+	switch o := n.Object.(type) {
+	case *parser.Deref:
+		obj = g.pointee(o, hoist)
+	case *parser.Index:
+		obj = g.index(o, hoist)
+	default:
+		obj = g.expr(o, "")
+	}
+
+	if v, ok := g.eval(n.Index, "int"); ok {
+		if length, _ := strconv.ParseUint(size, 10, 64); bits(v) >= length {
+			astutil.Fail(n, "index %v out of range [0, %d)", v, length)
+		}
+	}
+	i := g.expr(n.Index, "int")
+	if (hoist || astutil.Effects(n.Index)) && !g.isConstant(n.Index) && !g.temps[i] {
+		i = g.temp(i)
+	}
+	return obj + "[" + astutil.Unparen(i) + "]"
+}
+
+// Generates a pointer dereference, storing the pointer in a temporary when
+// hoist is set so that it can be referred to again after evaluating other
+// expressions
+func (g *generator) pointee(n *parser.Deref, hoist bool) string {
+	p := g.expr(n.Operand, "")
+	if hoist && !g.isConstant(n.Operand) {
+		p = g.temp(p)
+	}
+	return g.deref(n, p)
+}
+
+// Returns the statement of an assignment and the lvalue holding the
+// assigned value once it is run. The target is evaluated before the value,
+// and compound assignments apply their operator to the value the target
+// holds once the value is evaluated.
+func (g *generator) assign(n *parser.Assign) (string, string) {
+	compound := n.Operator.TokenType != lexer.Equal
+	hoist := astutil.Assigns(n.Expr) || astutil.Effects(n.Expr) && !g.fixed(n.Target) || compound && astutil.Effects(n.Target)
+	lv, t := astutil.Lvalue(g.env, n.Name, n.Target, hoist)
+	v := g.expr(n.Expr, t)
+	if !compound {
+		return lv + " = " + astutil.Unparen(v), lv
+	}
+
+	if astutil.Effects(n.Expr) && !g.stable(n.Target) && !g.temps[v] {
+		v = g.temp(v)
+	}
+	op := binaryOps[n.Operator.TokenType]
+	switch {
+	case op == "/" || op == "%":
+		g.divisor(n.Operator, n.Expr, t)
+	case op == "<<" || op == ">>":
+		v = g.count(n.Expr, t, v)
+	}
+	value := g.arith(n.Operator, op, t, lv, v)
+	if value == fmt.Sprintf("(%s %s %s)", lv, op, v) {
+		return lv + " " + op + "= " + astutil.Unparen(v), lv
+	}
+	return lv + " = " + astutil.Unparen(value), lv
+}
+
+// Returns the statement of ++ or -- and the lvalue it updates
+func (g *generator) incDec(target parser.IExpression, op *lexer.Token) (string, string) {
+	lv, t := astutil.Lvalue(g.env, nil, target, astutil.Effects(target))
+	switch astutil.Underlying(g.env, t) {
+	case "int", "uint", "char", "float":
+		return lv + op.Lexeme, lv
+	}
+	astutil.Fail(op, "operator %s on %s is not supported by the Go backend", op.Lexeme, t)
+	return "", ""
+}
+
+// Generates a call, the type of the Result Ok and Err make being given by
+// the hint
+func (g *generator) call(n *parser.FnCall, hint string) string {
+	name := g.pkg.Callee(n, g.isLocal)
+	field := g.pkg.Method(n, g.isLocal)
+	switch {
+	case field != nil:
+		name = astutil.MethodOf(astutil.ExprType(g.env, field.Object), field.Name.Lexeme)
+	case name == "":
+		astutil.Fail(n, "calls to fn values are not supported by the Go backend")
+	case n.Callee == nil && (n.Name.Lexeme == "print" || n.Name.Lexeme == "panic"):
+		return g.print(n)
+	case n.Callee == nil && (n.Name.Lexeme == "Ok" || n.Name.Lexeme == "Err"):
+		return g.variant(n, hint)
+	case n.Callee == nil && n.Name.Lexeme == "recover":
+		astutil.Fail(n, "recover is not supported by the Go backend")
+	}
+	sig, ok := g.callee(n)
+	if !ok {
+		astutil.Fail(n, "unknown fn %s", name)
+	}
+
+	// Arguments are evaluated in the order they are written, then defaults.
+	// The value a method is called on comes first, as its self.
+	slots := []int{}
+	exprs := []parser.IExpression{}
+	hints := []string{}
+	first := 0
+	if field != nil {
+		slots = append(slots, 0)
+		exprs = append(exprs, field.Object)
+		hints = append(hints, sig.types[0])
+		first = 1
+	}
+	for i, arg := range n.Args {
+		i += first
+		if named, ok := arg.(*parser.NamedArg); ok {
+			for j, p := range sig.params {
+				if p.Name.Lexeme == named.Name.Lexeme {
+					i = j
+				}
+			}
+			arg = named.Value
+		}
+		slots = append(slots, i)
+		exprs = append(exprs, arg)
+		hints = append(hints, sig.types[i])
+	}
+	given := map[int]bool{}
+	for _, i := range slots {
+		given[i] = true
+	}
+	for i, p := range sig.params {
+		if !given[i] {
+			slots = append(slots, i)
+			exprs = append(exprs, p.Initializer)
+			hints = append(hints, sig.types[i])
+		}
+	}
+
+	// Named args written before the ones of earlier params are evaluated
+	// first
+	args := make([]string, len(sig.params))
+	for i, v := range g.operands(exprs, hints) {
+		for _, j := range slots[i+1:] {
+			if j < slots[i] && !g.isConstant(exprs[i]) && !g.temps[v] {
+				v = g.temp(v)
+			}
+		}
+		args[slots[i]] = astutil.Unparen(v)
+	}
+	if field != nil && g.iface(sig.types[0]) != nil {
+		// The Go method of the interface value calls the method of the type
+		// it holds
+		g.imports[Runtime] = true
+		return fmt.Sprintf("gort.Receiver(%s, %s, %d, %d).%s(%s)", args[0], strconv.Quote(field.Name.Lexeme), field.Line, field.Column, sig.name, strings.Join(args[1:], ", "))
+	}
+	return sig.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Generates Ok or Err as a Result of the type the hint is, holding their
+// arg as its value or as its error
+func (g *generator) variant(n *parser.FnCall, hint string) string {
+	u := astutil.Underlying(g.env, hint)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "%s used where the type of its Result isn't known", n.Name.Lexeme)
+	}
+	value, err := astutil.Outcomes(u)
+	if n.Name.Lexeme == "Err" {
+		return g.goType(hint) + "{Err: " + astutil.Unparen(g.expr(n.Args[0], err)) + "}"
+	}
+	return g.goType(hint) + "{Ok: true, Value: " + astutil.Unparen(g.expr(n.Args[0], value)) + "}"
+}
+
+// Returns the signature of the declared fn or method a call is to,
+// instantiating the generic fns
+func (g *generator) callee(n *parser.FnCall) (*signature, bool) {
+	if field := g.pkg.Method(n, g.isLocal); field != nil {
+		t := astutil.ExprType(g.env, field.Object)
+		if g.iface(t) != nil {
+			return g.method(t, field.Name.Lexeme)
+		}
+		sig, ok := g.sigs[astutil.MethodOf(t, field.Name.Lexeme)]
+		return sig, ok
+	}
+	name := g.pkg.Callee(n, g.isLocal)
+	if generic, ok := g.generics[name]; ok {
+		return g.instantiate(n, generic), true
+	}
+	sig, ok := g.sigs[name]
+	return sig, ok
+}
+
+// Generates print and panic as calls to the runtime, which formats their
+// args. Untyped constants are converted to the type they have on the vm.
+func (g *generator) print(n *parser.FnCall) string {
+	exprs := []parser.IExpression{}
+	hints := []string{}
+	for _, arg := range n.Args {
+		exprs = append(exprs, arg)
+		hints = append(hints, "")
+	}
+
+	args := []string{}
+	for i, v := range g.operands(exprs, hints) {
+		t := astutil.ValueType(g.env, exprs[i], "")
+		switch u := astutil.Underlying(g.env, t); {
+		case u == "int" || u == "uint" || u == "char" || u == "bool" || u == "float" || u == "string":
+		case astutil.IsPointer(u) || astutil.IsResult(u):
+		default:
+			astutil.Fail(n, "printing %s is not supported by the Go backend", t)
+		}
+		if g.untyped(exprs[i]) {
+			v = g.conversion(t, v)
+		}
+		args = append(args, astutil.Unparen(v))
+	}
+
+	g.imports[Runtime] = true
+	if n.Name.Lexeme == "panic" {
+		return "panic(gort.Panic(" + strings.Join(args, ", ") + "))"
+	}
+	return "gort.Print(" + strings.Join(args, ", ") + ")"
+}
+
+// Generates operands in turn, storing in temporaries the ones that Go could
+// evaluate in another order than they are written: the ones changed by the
+// statements or the calls of later operands, the ones whose calls change
+// later operands and the ones failing along with later operands.
+func (g *generator) operands(exprs []parser.IExpression, hints []string) []string {
+	out := make([]string, len(exprs))
+	for i, e := range exprs {
+		out[i] = g.expr(e, hints[i])
+		if g.isConstant(e) || g.temps[out[i]] {
+			continue
+		}
+
+		hoist := false
+		for _, later := range exprs[i+1:] {
+			switch {
+			case astutil.Assigns(later),
+				astutil.Effects(later) && !g.stable(e),
+				astutil.Effects(e) && !g.stable(later),
+				astutil.Fails(e) && (astutil.Fails(later) || astutil.Effects(later)),
+				astutil.Effects(e) && astutil.Fails(later):
+				hoist = true
+			}
+		}
+		if hoist {
+			out[i] = g.temp(out[i])
+		}
+	}
+	return out
+}
+
+// Reports whether calls can't change the value of an expression, which
+// only reads variables whose address isn't taken, apart from the calls it
+// makes
+func (g *generator) stable(expr parser.IExpression) bool {
+	ok := true
+	astutil.Visit(expr, func(node any) {
+		switch n := node.(type) {
+		case *parser.Variable:
+			if l := g.lookup(n.Name.Lexeme); l != nil && l.addr {
+				ok = false
+			}
+		case *parser.Deref:
+			ok = false
+		}
+	})
+	return ok
+}
+
+// Reports whether calls can't change what an assignment target refers to
+func (g *generator) fixed(target parser.IExpression) bool {
+	switch n := target.(type) {
+	case nil, *parser.Variable:
+		return true
+	case *parser.Grouping:
+		return g.fixed(n.Grouped)
+	case *parser.Deref:
+		return g.stable(n.Operand)
+	case *parser.Index:
+		return g.fixed(n.Object) && g.stable(n.Index)
+	}
+	return false
+}
+
+// Gives astutil the types of the names in the scopes of a generator
+type env struct {
+	g *generator
+}
+
+func (e env) VarType(name *lexer.Token) string {
+	return e.g.resolve(name).typ
+}
+
+func (e env) RetType(n *parser.FnCall) (string, bool) {
+	sig, ok := e.g.callee(n)
+	if !ok {
+		return "", false
+	}
+	return sig.ret, true
+}
+
+func (e env) Const(name *lexer.Token) (consteval.Value, bool) {
+	l := e.g.lookup(name.Lexeme)
+	if l == nil || l.konst == nil {
+		return consteval.Value{}, false
+	}
+	return *l.konst, true
+}
+
+func (e env) Named(t *parser.TypeName) (string, bool) {
+	if bound, ok := e.g.bindings[t.Name.Lexeme]; ok && t.Module == nil {
+		return bound, true
+	}
+	name := e.g.pkg.TypeRef(t)
+	a, ok := e.g.aliases[name]
+	return name, ok && (a.def.Type != nil || a.def.Interface != nil) && len(a.def.TypeParams) == 0
+}
+
+// The type is resolved from the package defining it, out of the scopes of
+// the fn being generated
+func (e env) Defined(t string) (string, bool) {
+	a, ok := e.g.aliases[t]
+	if !ok || a.def.Type == nil || len(a.def.TypeParams) > 0 {
+		return "", false
+	}
+	defer func(pkg *astutil.Package, bound map[string]string, scopes []map[string]*local) {
+		e.g.setPackage(pkg)
+		e.g.bindings, e.g.scopes = bound, scopes
+	}(e.g.pkg, e.g.bindings, e.g.scopes)
+	e.g.setPackage(a.pkg)
+	e.g.bindings, e.g.scopes = nil, nil
+	return astutil.TypeOf(e, a.def.Type), true
+}
+
+func (e env) Push() {
+	e.g.scopes = append(e.g.scopes, map[string]*local{})
+}
+
+func (e env) Pop() {
+	e.g.scopes = e.g.scopes[:len(e.g.scopes)-1]
+}
+
+func (e env) Declare(stmt parser.IStatement) {
+	switch s := stmt.(type) {
+	case *parser.VarDeclExpression:
+		e.g.scopes[len(e.g.scopes)-1][s.Name.Lexeme] = &local{typ: astutil.DeclType(e, s)}
+	case *parser.ConstDeclStmt:
+		e.g.scopes[len(e.g.scopes)-1][s.Name.Lexeme] = e.g.constant(s, "")
+	}
+}
+
+func (e env) Bind(name *lexer.Token, t string) {
+	e.g.scopes[len(e.g.scopes)-1][name.Lexeme] = &local{typ: t}
+}
+
+func (e env) Unsupported(node any, what string) {
+	astutil.Fail(node, "%s is not supported by the Go backend", what)
+}
+
+// Stores go to the variable without reading it, leaving it unused
+func (e env) Variable(name *lexer.Token) string {
+	return e.g.resolve(name).name
+}
+
+func (e env) Deref(n *parser.Deref, hoist bool) string {
+	return e.g.pointee(n, hoist)
+}
+
+func (e env) Index(n *parser.Index, hoist bool) string {
+	return e.g.index(n, hoist)
+}
+
+// Reports whether an expression is a literal or a constant expression
+func (g *generator) isConstant(expr parser.IExpression) bool {
+	if _, ok := expr.(*parser.Literal); ok {
+		return true
+	}
+	_, ok := g.eval(expr, "")
+	return ok
+}
+
+// Reports whether an expression is generated as an untyped integer
+// constant, whose default Go type is int rather than the one of its yal
+// type. Named constants are declared with their type.
+func (g *generator) untyped(expr parser.IExpression) bool {
+	switch n := expr.(type) {
+	case *parser.Variable:
+		return false
+	case *parser.Grouping:
+		return g.untyped(n.Grouped)
+	}
+	switch v, _ := g.eval(expr, ""); v.(type) {
+	case int64, uint64, uint8:
+		return true
+	}
+	return false
+}
+
+// Returns the value of a constant expression as the vm computes it, of the
+// Go type of its yal type, integer literals taking the numeric hint. It
+// reports false for other expressions and for constant divisions by zero.
+func (g *generator) eval(expr parser.IExpression, hint string) (any, bool) {
+	switch n := expr.(type) {
+	case *parser.Literal:
+		tk := n.Value
+		switch {
+		case tk == nil:
+		case tk.TokenType == lexer.True || tk.TokenType == lexer.False:
+			return tk.TokenType == lexer.True, true
+		case astutil.IsNumber(tk) && strings.Contains(tk.Lexeme, "."):
+			f, err := strconv.ParseFloat(tk.Lexeme, 64)
+			if err != nil {
+				astutil.Fail(n, "invalid float literal %s", tk.Lexeme)
+			}
+			return f, true
+		case astutil.IsNumber(tk):
+			v, err := consteval.Eval(n, nil)
+			if err != nil {
+				astutil.Fail(n, "%v", err)
+			}
+			return wrap(v.Int, astutil.Underlying(g.env, astutil.OperandType(g.env, hint))), true
+		}
+	case *parser.Variable:
+		l := g.lookup(n.Name.Lexeme)
+		switch {
+		case l == nil || l.konst == nil:
+		case l.konst.IsBool:
+			return l.konst.Bool, true
+		default:
+			return wrap(l.konst.Int, astutil.Underlying(g.env, l.typ)), true
+		}
+	case *parser.Grouping:
+		return g.eval(n.Grouped, hint)
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			v, ok := g.eval(n.Right, "bool")
+			b, isBool := v.(bool)
+			return !b, ok && isBool
+		}
+		v, ok := g.eval(n.Right, astutil.OperandType(g.env, hint, n.Right))
+		switch v := v.(type) {
+		case int64:
+			return -v, ok
+		case uint64:
+			return -v, ok
+		case uint8:
+			return -v, ok
+		case float64:
+			return -v, ok
+		}
+	case *parser.Binary:
+		if astutil.IsLogical(n.Operator.TokenType) {
+			return g.evalLogical(n.Left, n.Operator, n.Right)
+		}
+		t := astutil.OperandType(g.env, hint, n.Left, n.Right)
+		if astutil.IsShift(n.Operator.TokenType) {
+			t = astutil.OperandType(g.env, hint, n.Left)
+		}
+		l, ok := g.eval(n.Left, t)
+		if !ok {
+			return nil, false
+		}
+		r, ok := g.eval(n.Right, t)
+		if !ok {
+			return nil, false
+		}
+		return fold(binaryOps[n.Operator.TokenType], l, r)
+	case *parser.Logical:
+		return g.evalLogical(n.Left, n.Operator, n.Right)
+	}
+	return nil, false
+}
+
+func (g *generator) evalLogical(left parser.IExpression, operator *lexer.Token, right parser.IExpression) (any, bool) {
+	l, ok := g.eval(left, "bool")
+	if !ok {
+		return nil, false
+	}
+	r, ok := g.eval(right, "bool")
+	if !ok {
+		return nil, false
+	}
+	lb, ok := l.(bool)
+	rb, ok2 := r.(bool)
+	if operator.TokenType == lexer.DoubleAmpersand {
+		return lb && rb, ok && ok2
+	}
+	return lb || rb, ok && ok2
+}
+
+// Applies a binary operator to constant operands of the same type
+func fold(op string, l any, r any) (any, bool) {
+	switch l := l.(type) {
+	case int64:
+		if r, ok := r.(int64); ok {
+			return foldInt(op, l, r)
+		}
+	case uint64:
+		if r, ok := r.(uint64); ok {
+			return foldInt(op, l, r)
+		}
+	case uint8:
+		if r, ok := r.(uint8); ok {
+			return foldInt(op, l, r)
+		}
+	case float64:
+		r, ok := r.(float64)
+		switch {
+		case !ok:
+		case op == "+":
+			return l + r, true
+		case op == "-":
+			return l - r, true
+		case op == "*":
+			return l * r, true
+		case op == "/":
+			return l / r, true
+		default:
+			return foldCompare(op, l, r)
+		}
+	case bool:
+		r, ok := r.(bool)
+		switch {
+		case !ok:
+		case op == "&":
+			return l && r, true
+		case op == "|":
+			return l || r, true
+		case op == "^" || op == "!=":
+			return l != r, true
+		case op == "==":
+			return l == r, true
+		}
+	}
+	return nil, false
+}
+
+// Applies a binary operator to integers, which wrap around and whose shift
+// counts are unsigned
+func foldInt[T int64 | uint64 | uint8](op string, x T, y T) (any, bool) {
+	switch op {
+	case "+":
+		return x + y, true
+	case "-":
+		return x - y, true
+	case "*":
+		return x * y, true
+	case "/", "%":
+		if y == 0 {
+			return nil, false
+		}
+		if op == "%" {
+			return x % y, true
+		}
+		return x / y, true
+	case "&":
+		return x & y, true
+	case "|":
+		return x | y, true
+	case "^":
+		return x ^ y, true
+	case "<<":
+		return x << uint64(y), true
+	case ">>":
+		return x >> uint64(y), true
+	}
+	return foldCompare(op, x, y)
+}
+
+func foldCompare[T int64 | uint64 | uint8 | float64](op string, x T, y T) (any, bool) {
+	switch op {
+	case "==":
+		return x == y, true
+	case "!=":
+		return x != y, true
+	case "<":
+		return x < y, true
+	case "<=":
+		return x <= y, true
+	case ">":
+		return x > y, true
+	case ">=":
+		return x >= y, true
+	}
+	return nil, false
+}
+
+// Returns the bits of an integer value as a uint64
+func bits(v any) uint64 {
+	switch v := v.(type) {
+	case int64:
+		return uint64(v)
+	case uint64:
+		return v
+	case uint8:
+		return uint64(v)
+	}
+	return 0
+}
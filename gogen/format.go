@@ -0,0 +1,173 @@
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+)
+
+// Formats generated source as gofmt does, without the parentheses that
+// don't change how it parses
+func tidy(src string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Go generated: %v", err)
+	}
+
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.BinaryExpr:
+			// Operators being left associative, right operands must bind
+			// tighter
+			n.X = strip(n.X, n.Op.Precedence())
+			n.Y = strip(n.Y, n.Op.Precedence()+1)
+		case *ast.UnaryExpr:
+			n.X = strip(n.X, primary)
+		case *ast.StarExpr:
+			n.X = strip(n.X, primary)
+		case *ast.IndexExpr:
+			n.X = strip(n.X, primary)
+			n.Index = strip(n.Index, 0)
+		case *ast.CallExpr:
+			n.Fun = strip(n.Fun, primary)
+			stripAll(n.Args)
+		case *ast.ParenExpr:
+			n.X = strip(n.X, 0)
+		case *ast.AssignStmt:
+			stripAll(n.Lhs)
+			stripAll(n.Rhs)
+		case *ast.ValueSpec:
+			stripAll(n.Values)
+		case *ast.ReturnStmt:
+			stripAll(n.Results)
+		case *ast.ExprStmt:
+			n.X = strip(n.X, 0)
+		case *ast.IncDecStmt:
+			n.X = strip(n.X, 0)
+		case *ast.IfStmt:
+			n.Cond = strip(n.Cond, 0)
+		case *ast.ForStmt:
+			n.Cond = strip(n.Cond, 0)
+		case *ast.SwitchStmt:
+			n.Tag = strip(n.Tag, 0)
+		case *ast.CaseClause:
+			stripAll(n.List)
+		}
+		return true
+	})
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, f); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Precedence of the operands of unary operators, which are kept in
+// parentheses unless they are primary expressions, and of primary ones
+const primary = token.HighestPrec + 1
+
+// Removes the parentheses around an expression binding at least as tight
+// as prec
+func strip(expr ast.Expr, prec int) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok || precedence(p.X) < prec {
+			return expr
+		}
+		expr = p.X
+	}
+}
+
+func stripAll(exprs []ast.Expr) {
+	for i, e := range exprs {
+		exprs[i] = strip(e, 0)
+	}
+}
+
+func precedence(expr ast.Expr) int {
+	switch n := expr.(type) {
+	case *ast.BinaryExpr:
+		return n.Op.Precedence()
+	case *ast.UnaryExpr, *ast.StarExpr:
+		return token.UnaryPrec
+	case *ast.ParenExpr:
+		return precedence(n.X)
+	}
+	return primary
+}
+
+// Reports whether the source of a fn ends in a terminating statement, as
+// Go requires of fns returning a value
+func returns(fnSrc string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+fnSrc, 0)
+	if err != nil || len(f.Decls) == 0 {
+		return false
+	}
+	fn, ok := f.Decls[0].(*ast.FuncDecl)
+	return ok && terminates(fn.Body, "")
+}
+
+// Reports whether a statement is terminating, label being its label
+func terminates(stmt ast.Stmt, label string) bool {
+	switch n := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return n.Tok == token.GOTO
+	case *ast.ExprStmt:
+		call, ok := n.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == "panic"
+	case *ast.BlockStmt:
+		return len(n.List) > 0 && terminates(n.List[len(n.List)-1], "")
+	case *ast.IfStmt:
+		return n.Else != nil && terminates(n.Body, "") && terminates(n.Else, "")
+	case *ast.ForStmt:
+		return n.Cond == nil && !breaks(n.Body, label, false)
+	case *ast.SwitchStmt:
+		hasDefault := false
+		for _, s := range n.Body.List {
+			cc := s.(*ast.CaseClause)
+			hasDefault = hasDefault || cc.List == nil
+			if len(cc.Body) == 0 || !terminates(cc.Body[len(cc.Body)-1], "") || breaks(&ast.BlockStmt{List: cc.Body}, label, false) {
+				return false
+			}
+		}
+		return hasDefault
+	case *ast.LabeledStmt:
+		return terminates(n.Stmt, n.Label.Name)
+	}
+	return false
+}
+
+// Reports whether node has a break leaving the statement it is the body of,
+// unlabelled ones counting unless nested in another for or switch
+func breaks(node ast.Node, label string, nested bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BranchStmt:
+			if n.Tok == token.BREAK && (n.Label == nil && !nested || n.Label != nil && n.Label.Name == label) {
+				found = true
+			}
+		case *ast.ForStmt:
+			found = found || breaks(n.Body, label, true)
+			return false
+		case *ast.SwitchStmt:
+			found = found || breaks(n.Body, label, true)
+			return false
+		case *ast.FuncLit:
+			return false
+		}
+		return true
+	})
+	return found
+}
@@ -0,0 +1,640 @@
+package gogen
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"yal/astutil"
+	"yal/consteval"
+	"yal/parser"
+)
+
+// Import path of the runtime package the generated source imports
+const Runtime = "yal/gort"
+
+// Variable or constant in scope. Go rejecting variables that are never
+// read, each variable declaration is followed by a mark, a line replaced by
+// an assignment to the blank identifier once the fn is generated if the
+// variable turns out to be unused.
+type local struct {
+	name  string
+	typ   string
+	konst *consteval.Value
+	used  bool
+	addr  bool
+	mark  string
+}
+
+// Signature of a fn, name being its Go name. The signature of an instance
+// of a generic fn binds its type parameters to the type arguments it is
+// named after.
+type signature struct {
+	name     string
+	pkg      *astutil.Package
+	decl     *parser.FnDeclStmt
+	bindings map[string]string
+	params   []*parser.VarDeclExpression
+	types    []string
+	ret      string
+}
+
+// Type defined by a package, resolved from that package
+type alias struct {
+	pkg *astutil.Package
+	def *parser.DefineTypeStatement
+}
+
+// Loop being generated, labelled when a switch of its body breaks out of
+// it, since a Go break would only leave the switch. switches is the number
+// of switches around the loop.
+type loop struct {
+	label    string
+	switches int
+}
+
+// Names are kept, except for the ones Go reserves, which get a trailing
+// underscore, and the ones of pub fns and types, which are exported by
+// upper casing their first letter. Variables redeclared in the same scope
+// or that would hide a package level name or another variable than the one
+// they shadow get a number after their name. The fns, types and constants
+// of imported packages are named after their name in the program, as
+// astutil.Ident writes it, and never exported. Generic fns are generated
+// once for each list of type arguments they are called with, as
+// astutil.Instance names them, generic signatures holding their name in
+// the program. Methods are fns named after their type and their name, as
+// astutil.MethodOf writes them. A type converted to interfaces gets a Go
+// type of its own, named after it with __methods, whose methods call them.
+// Results are instances of gort.Result.
+type generator struct {
+	env      env
+	aliases  map[string]*alias
+	typeDefs map[string]string
+	sigs     map[string]*signature
+	generics map[string]*signature
+	methods  map[string]*signature
+	impls    map[string][]string
+	wrappers map[string]string
+	fns      []*signature
+	consts   map[*astutil.Package]map[string]*local
+	pkg      *astutil.Package
+	globals  map[string]*local
+	reserved map[string]bool
+	imports  map[string]bool
+	types    strings.Builder
+	declared map[string]bool
+
+	// Go types of the types converted to interfaces and their methods
+	methodSets strings.Builder
+
+	// State of the fn being generated. names maps the Go names declared in
+	// each scope to the yal names they stand for, empty for temporaries.
+	astutil.Writer
+	bindings map[string]string
+	scopes   []map[string]*local
+	names    []map[string]string
+	addrs    map[string]bool
+	marks    []*local
+	temps    map[string]bool
+	loops    []loop
+	labels   int
+	switches int
+	ret      string
+}
+
+// Writes Go source for the fns, constants and type definitions of a checked
+// package as package pkg, importing Runtime when it prints or panics. The
+// main fn of a main package is run by the runtime, exiting with what it
+// returns. Types map to the Go types of the same size, definetype to type
+// aliases, and pointers and arrays to Go ones, which Go checks. Ints wrap
+// around as they do on the vm and operands are evaluated from left to
+// right, which Go leaves unspecified between calls and other operands.
+func Generate(w io.Writer, stmts []parser.IStatement, pkg string) error {
+	return GenerateProgram(w, []*astutil.Package{{Stmts: stmts}}, pkg)
+}
+
+// Writes Go source for the checked packages of a program as package pkg,
+// each package coming after the ones it imports. Calls to the fns of
+// imported modules are generated as calls to the fns named after their
+// name in the program.
+func GenerateProgram(w io.Writer, pkgs []*astutil.Package, pkg string) (err error) {
+	defer astutil.Catch(&err)
+
+	g := &generator{
+		aliases:  map[string]*alias{},
+		typeDefs: map[string]string{},
+		sigs:     map[string]*signature{},
+		generics: map[string]*signature{},
+		methods:  map[string]*signature{},
+		impls:    map[string][]string{},
+		wrappers: map[string]string{},
+		consts:   map[*astutil.Package]map[string]*local{},
+		reserved: map[string]bool{},
+		imports:  map[string]bool{},
+		declared: map[string]bool{},
+	}
+	g.env = env{g}
+
+	// Package level names are chosen first, as variables can't hide them
+	consts := []*local{}
+	for _, p := range pkgs {
+		g.setPackage(p)
+		for _, stmt := range p.Stmts {
+			switch n := stmt.(type) {
+			case *parser.DefineTypeStatement:
+				name := astutil.Qualify(p.Path, n.Name.Lexeme)
+				g.aliases[name] = &alias{pkg: p, def: n}
+				g.typeDefs[name] = g.packageName(n, astutil.Ident(name), n.Public && p.Path == "")
+			case *parser.FnDeclStmt:
+				name := astutil.Qualify(p.Path, n.Name.Lexeme)
+				if len(n.TypeParams) > 0 {
+					g.generics[name] = &signature{name: name, pkg: p, decl: n}
+					continue
+				}
+				g.sigs[name] = &signature{name: g.packageName(n, astutil.Ident(name), n.Public && p.Path == ""), pkg: p, decl: n}
+			case *parser.ImplStmt:
+				t := astutil.Qualify(p.Path, n.Type.Lexeme)
+				for _, m := range n.Methods {
+					if len(m.TypeParams) > 0 {
+						astutil.Fail(m, "generic methods are not supported by the Go backend")
+					}
+					name := astutil.MethodOf(t, m.Name.Lexeme)
+					g.sigs[name] = &signature{name: g.packageName(m, astutil.Ident(name), false), pkg: p, decl: m}
+					g.impls[t] = append(g.impls[t], m.Name.Lexeme)
+				}
+			case *parser.ConstDeclStmt:
+				name := astutil.Qualify(p.Path, n.Name.Lexeme)
+				g.globals[n.Name.Lexeme] = &local{name: g.packageName(n, astutil.Ident(name), false)}
+			}
+		}
+	}
+	// Constants come first as they may size the arrays of the other
+	// declarations
+	for _, p := range pkgs {
+		g.setPackage(p)
+		for _, stmt := range p.Stmts {
+			if n, ok := stmt.(*parser.ConstDeclStmt); ok {
+				l := g.constant(n, g.globals[n.Name.Lexeme].name)
+				g.globals[n.Name.Lexeme] = l
+				consts = append(consts, l)
+			}
+		}
+	}
+	for _, p := range pkgs {
+		g.setPackage(p)
+		for _, stmt := range p.Stmts {
+			switch n := stmt.(type) {
+			case *parser.DefineTypeStatement:
+				g.typedef(astutil.Qualify(p.Path, n.Name.Lexeme))
+			case *parser.FnDeclStmt:
+				if sig, ok := g.sigs[astutil.Qualify(p.Path, n.Name.Lexeme)]; ok {
+					g.signature(sig)
+					g.fns = append(g.fns, sig)
+				}
+			case *parser.ImplStmt:
+				t := astutil.Qualify(p.Path, n.Type.Lexeme)
+				for _, m := range n.Methods {
+					sig := g.sigs[astutil.MethodOf(t, m.Name.Lexeme)]
+					g.signature(sig)
+					if len(sig.params) == 0 || sig.params[0].Name.Lexeme != "self" {
+						astutil.Fail(m, "methods without self are not supported by the Go backend")
+					}
+					g.fns = append(g.fns, sig)
+				}
+			case *parser.ConstDeclStmt, *parser.ImportStmt:
+			default:
+				g.unsupported(stmt)
+			}
+		}
+	}
+
+	main, ok := g.sigs["main"]
+	if pkg == "main" {
+		switch {
+		case !ok:
+			return fmt.Errorf("no main fn")
+		case len(main.params) > 0:
+			return fmt.Errorf("main takes no params")
+		}
+	}
+
+	var out strings.Builder
+	g.W = &out
+	if len(consts) > 0 {
+		g.Line("")
+	}
+	for _, l := range consts {
+		g.Line("const %s %s = %s", l.name, g.goType(l.typ), g.constValue(l))
+	}
+	// The instances of generic fns are added to the fns as they are called
+	for i := 0; i < len(g.fns); i++ {
+		src := g.fn(g.fns[i])
+		g.W = &out
+		g.Line("")
+		out.WriteString(src)
+	}
+	out.WriteString(g.methodSets.String())
+
+	if pkg == "main" {
+		g.imports[Runtime] = true
+		g.Line("")
+		g.Line("func main() {")
+		switch u := astutil.Underlying(g.env, main.ret); u {
+		case "void":
+			g.Line("\tgort.Main(func() int64 {\n\t\t%s()\n\t\treturn 0\n\t})", main.name)
+		case "int":
+			g.Line("\tgort.Main(%s)", main.name)
+		case "uint", "char":
+			g.Line("\tgort.Main(func() int64 {\n\t\treturn int64(%s())\n\t})", main.name)
+		default:
+			return fmt.Errorf("main returns %s instead of an exit code", main.ret)
+		}
+		g.Line("}")
+	}
+
+	src := "// Code generated by yal. DO NOT EDIT.\n\npackage " + pkg + "\n"
+	imports := []string{}
+	for path := range g.imports {
+		imports = append(imports, strconv.Quote(path))
+	}
+	sort.Strings(imports)
+	switch len(imports) {
+	case 0:
+	case 1:
+		src += "\nimport " + imports[0] + "\n"
+	default:
+		src += "\nimport (\n\t" + strings.Join(imports, "\n\t") + "\n)\n"
+	}
+	if g.types.Len() > 0 {
+		src += "\n" + g.types.String()
+	}
+
+	formatted, err := tidy(src + out.String())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+func (g *generator) unsupported(node any) {
+	g.env.Unsupported(node, strings.TrimPrefix(fmt.Sprintf("%T", node), "*parser."))
+}
+
+// Identifiers Go reserves: its keywords, its predeclared identifiers, the
+// packages the generated source imports and the fns it gives a meaning to
+var goReserved = func() map[string]bool {
+	reserved := map[string]bool{}
+	for _, name := range strings.Fields(`break case chan const continue default
+		defer else fallthrough for func go goto if import interface map package
+		range return select struct switch type var any append bool byte cap
+		clear close comparable complex complex64 complex128 copy delete error
+		false float32 float64 imag int int8 int16 int32 int64 iota len make max
+		min new nil panic print println real recover rune string true uint
+		uint8 uint16 uint32 uint64 uintptr gort math main init _`) {
+		reserved[name] = true
+	}
+	return reserved
+}()
+
+// Returns the Go name of a yal name, with a trailing underscore when Go
+// reserves it
+func goName(name string) string {
+	if goReserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// Returns the Go name of a fn, type or constant, exported when public
+func (g *generator) packageName(node any, name string, public bool) string {
+	c := goName(name)
+	if public {
+		r, size := utf8.DecodeRuneInString(c)
+		c = string(unicode.ToUpper(r)) + c[size:]
+	}
+	if g.reserved[c] {
+		astutil.Fail(node, "%s has the same Go name as another declaration, %s", name, c)
+	}
+	g.reserved[c] = true
+	return c
+}
+
+// Returns the Go type of t
+func (g *generator) goType(t string) string {
+	switch t {
+	case "int":
+		return "int64"
+	case "uint":
+		return "uint64"
+	case "char":
+		return "uint8"
+	case "float":
+		return "float64"
+	case "bool", "string":
+		return t
+	}
+	switch {
+	case strings.HasPrefix(t, "*"):
+		return "*" + g.goType(t[1:])
+	case strings.HasPrefix(t, "["):
+		size, elem := astutil.ArrayOf(t)
+		return "[" + size + "]" + g.goType(elem)
+	case astutil.IsResult(t):
+		value, err := astutil.Outcomes(t)
+		g.imports[Runtime] = true
+		return "gort.Result[" + g.goType(value) + ", " + g.goType(err) + "]"
+	}
+	return g.typeDefs[t]
+}
+
+// Defines a type as an alias of the Go type it stands for, since the
+// checker lets values of either be used for the other
+func (g *generator) typedef(t string) {
+	name := g.typeDefs[t]
+	if g.declared[name] {
+		return
+	}
+	if a := g.iface(t); a != nil {
+		g.declared[name] = true
+		methods := []string{}
+		for _, m := range a.def.Interface.Methods {
+			sig, _ := g.method(t, m.Name.Lexeme)
+			methods = append(methods, "\t"+goName(m.Name.Lexeme)+g.funcType(sig)+"\n")
+		}
+		fmt.Fprintf(&g.types, "type %s interface {\n%s}\n", name, strings.Join(methods, ""))
+		return
+	}
+	u, ok := g.env.Defined(t)
+	if !ok {
+		astutil.Fail(g.aliases[t].def, "only definetype of a type is supported by the Go backend")
+	}
+	g.declared[name] = true
+	fmt.Fprintf(&g.types, "type %s = %s\n", name, g.goType(u))
+}
+
+// Returns the definition of interface t, nil if t isn't one
+func (g *generator) iface(t string) *alias {
+	if a, ok := g.aliases[t]; ok && a.def.Interface != nil {
+		return a
+	}
+	return nil
+}
+
+// Returns the signature of method name of interface t, whose self is of
+// type t
+func (g *generator) method(t string, name string) (*signature, bool) {
+	key := astutil.MethodOf(t, name)
+	if sig, ok := g.methods[key]; ok {
+		return sig, true
+	}
+	a := g.iface(t)
+	for _, m := range a.def.Interface.Methods {
+		if m.Name.Lexeme == name {
+			sig := &signature{name: goName(name), pkg: a.pkg, decl: astutil.MethodDecl(a.def, m)}
+			g.signature(sig)
+			g.methods[key] = sig
+			return sig, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the params and the result of the Go method type of a method,
+// without self
+func (g *generator) funcType(sig *signature) string {
+	params := []string{}
+	for _, t := range sig.types[1:] {
+		params = append(params, g.goType(t))
+	}
+	if sig.ret == "void" {
+		return "(" + strings.Join(params, ", ") + ")"
+	}
+	return "(" + strings.Join(params, ", ") + ") " + g.goType(sig.ret)
+}
+
+// Returns Go converting value v of type t to interface iface: a pointer to
+// a copy of it, of the Go type whose methods call the ones of t, which is
+// written the first time
+func (g *generator) convert(n any, v string, t string, iface string) string {
+	if g.iface(t) != nil {
+		astutil.Fail(n, "converting %s to %s is not supported by the Go backend", t, iface)
+	}
+	for _, m := range g.iface(iface).def.Interface.Methods {
+		if _, ok := g.sigs[astutil.MethodOf(t, m.Name.Lexeme)]; !ok {
+			astutil.Fail(n, "type %s has no method %s", t, m.Name.Lexeme)
+		}
+	}
+
+	name, ok := g.wrappers[t]
+	if !ok {
+		name = g.packageName(n, astutil.Ident(t)+"__methods", false)
+		g.wrappers[t] = name
+		fmt.Fprintf(&g.methodSets, "\ntype %s %s\n", name, g.goType(t))
+		for _, m := range g.impls[t] {
+			sig := g.sigs[astutil.MethodOf(t, m)]
+			params := []string{}
+			args := []string{g.goType(t) + "(*v)"}
+			for i, p := range sig.types[1:] {
+				params = append(params, fmt.Sprintf("a%d %s", i+1, g.goType(p)))
+				args = append(args, fmt.Sprintf("a%d", i+1))
+			}
+			ret, call := "", sig.name+"("+strings.Join(args, ", ")+")"
+			if sig.ret != "void" {
+				ret, call = " "+g.goType(sig.ret), "return "+call
+			}
+			fmt.Fprintf(&g.methodSets, "\nfunc (v *%s) %s(%s)%s {\n\t%s\n}\n", name, goName(m), strings.Join(params, ", "), ret, call)
+		}
+	}
+	g.imports[Runtime] = true
+	return "gort.Box(" + name + "(" + astutil.Unparen(v) + "))"
+}
+
+// Makes the declarations of pkg the ones in scope
+func (g *generator) setPackage(pkg *astutil.Package) {
+	if g.consts[pkg] == nil {
+		g.consts[pkg] = map[string]*local{}
+	}
+	g.pkg, g.globals = pkg, g.consts[pkg]
+}
+
+func (g *generator) lookup(name string) *local {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if l, ok := g.scopes[i][name]; ok {
+			return l
+		}
+	}
+	return g.globals[name]
+}
+
+// Reports whether name refers to a variable or a constant in scope
+func (g *generator) isLocal(name string) bool {
+	return g.lookup(name) != nil
+}
+
+// Declares a constant as name
+func (g *generator) constant(n *parser.ConstDeclStmt, name string) *local {
+	v, t := astutil.Constant(g.env, n)
+	return &local{name: name, typ: t, konst: &v, used: true}
+}
+
+func (g *generator) constValue(l *local) string {
+	if l.konst.IsBool {
+		return fmt.Sprint(l.konst.Bool)
+	}
+	return g.render(wrap(l.konst.Int, astutil.Underlying(g.env, l.typ)))
+}
+
+// Returns the value of integer type t holding v, wrapped around to the
+// width of t
+func wrap(v *big.Int, t string) any {
+	bits := new(big.Int).And(v, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	switch t {
+	case "uint":
+		return bits
+	case "char":
+		return uint8(bits)
+	case "float":
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	}
+	return int64(bits)
+}
+
+// Resolves the types of the params and of the result of a fn, from its
+// package and with its type parameters bound
+func (g *generator) signature(sig *signature) {
+	defer func(pkg *astutil.Package, bound map[string]string, scopes []map[string]*local) {
+		g.setPackage(pkg)
+		g.bindings, g.scopes = bound, scopes
+	}(g.pkg, g.bindings, g.scopes)
+	g.setPackage(sig.pkg)
+	g.bindings, g.scopes = sig.bindings, nil
+
+	sig.params, sig.ret = astutil.ParamDecls(sig.decl.Args), astutil.TypeOf(g.env, sig.decl.Type)
+	for _, p := range sig.params {
+		if _, ok := p.Type.(*parser.VariadicType); ok {
+			astutil.Fail(p, "variadic params are not supported by the Go backend")
+		}
+		sig.types = append(sig.types, astutil.TypeOf(g.env, p.Type))
+	}
+}
+
+// Returns the signature of the instance of a generic fn a call is to,
+// adding it to the fns to generate the first time it is called
+func (g *generator) instantiate(n *parser.FnCall, generic *signature) *signature {
+	types := astutil.TypeArgs(g.env, n, generic.decl)
+	name := astutil.Instance(generic.name, types)
+	if sig, ok := g.sigs[name]; ok {
+		return sig
+	}
+
+	sig := &signature{name: g.packageName(generic.decl, astutil.Ident(name), false), pkg: generic.pkg, decl: generic.decl, bindings: map[string]string{}}
+	for i, param := range generic.decl.TypeParams {
+		sig.bindings[param.Name.Lexeme] = types[i]
+	}
+	g.signature(sig)
+	g.sigs[name] = sig
+	g.fns = append(g.fns, sig)
+	return sig
+}
+
+func (g *generator) fn(sig *signature) string {
+	fn := sig.decl
+	g.setPackage(sig.pkg)
+	g.bindings = sig.bindings
+	var out strings.Builder
+	g.W = &out
+	g.ret = sig.ret
+	g.scopes = []map[string]*local{{}}
+	g.names = []map[string]string{{}}
+	g.addrs = map[string]bool{}
+	g.marks = nil
+	g.temps = map[string]bool{}
+	g.loops = nil
+	g.labels = 0
+	g.switches = 0
+	astutil.Addressed(fn.Body, g.addrs)
+
+	params := []string{}
+	for i, p := range sig.params {
+		l := g.declare(p.Name.Lexeme, sig.types[i])
+		l.used = true
+		params = append(params, l.name+" "+g.goType(l.typ))
+	}
+	ret := ""
+	if sig.ret != "void" {
+		ret = " " + g.goType(sig.ret)
+	}
+
+	g.Line("func %s(%s)%s {", sig.name, strings.Join(params, ", "), ret)
+	g.Depth = 1
+	var sink func(parser.IExpression)
+	if sig.ret != "void" {
+		sink = g.returnSink
+	}
+	if body, ok := fn.Body.(*parser.Block); ok {
+		g.stmts(body.Statements, sink)
+	} else {
+		g.stmt(fn.Body, sink)
+	}
+	g.Depth = 0
+	g.Line("}")
+
+	src := out.String()
+	for _, l := range g.marks {
+		blank := ""
+		if !l.used {
+			blank = l.mark[:strings.Index(l.mark, "\x00")] + "_ = " + l.name + "\n"
+		}
+		src = strings.Replace(src, l.mark, blank, 1)
+	}
+	if sig.ret != "void" && !returns(src) {
+		g.imports[Runtime] = true
+		src = strings.TrimSuffix(src, "}\n") + "\tpanic(gort.ErrUnreachable)\n}\n"
+	}
+	return src
+}
+
+// Returns the Go name of a variable declared in the innermost scope: its
+// yal name unless it is reserved, declared in the same scope or hides
+// something else than what it shadows
+func (g *generator) fresh(name string) string {
+	base := goName(name)
+	c := base
+	for i := 2; !g.available(c, name); i++ {
+		c = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[len(g.names)-1][c] = name
+	return c
+}
+
+func (g *generator) available(c string, name string) bool {
+	if g.reserved[c] {
+		return false
+	}
+	for i := len(g.names) - 1; i >= 0; i-- {
+		if owner, ok := g.names[i][c]; ok {
+			return i < len(g.names)-1 && owner == name && name != ""
+		}
+	}
+	return true
+}
+
+// Declares a variable in the innermost scope
+func (g *generator) declare(name string, t string) *local {
+	l := &local{name: g.fresh(name), typ: t, addr: g.addrs[name]}
+	g.scopes[len(g.scopes)-1][name] = l
+	return l
+}
+
+// Writes the mark of a variable, replaced once the fn is generated
+func (g *generator) markUse(l *local) {
+	l.mark = fmt.Sprintf("%s\x00%d\x00\n", strings.Repeat("\t", g.Depth), len(g.marks))
+	g.marks = append(g.marks, l)
+	g.W.WriteString(l.mark)
+}
@@ -0,0 +1,260 @@
+package gogen_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yal/astutil"
+	"yal/gogen"
+	"yal/internal/backendtest"
+)
+
+// Builds the Go source of src in a module using the runtime of this one,
+// returning the directory it is in
+func build(t *testing.T, files map[string]string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to build programs")
+	}
+
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files["go.mod"] = "module prog\n\ngo 1.19\n\nrequire yal v0.0.0\n\nreplace yal => " + root + "\n"
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", "main", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s\n%s", err, msg, files["main.go"])
+	}
+	return dir
+}
+
+// Compiles src with the go command and runs it, returning what it writes to
+// stdout and stderr and its exit code. Go being generated from the AST,
+// there is no level to optimize at.
+func run(t *testing.T, src string, _ int) (string, string, int) {
+	return runPackages(t, []*astutil.Package{{Stmts: backendtest.Parse(t, src)}})
+}
+
+// Builds the packages of a program with the go command and runs it like run
+func runPackages(t *testing.T, pkgs []*astutil.Package) (string, string, int) {
+	var goSrc strings.Builder
+	if err := gogen.GenerateProgram(&goSrc, pkgs, "main"); err != nil {
+		t.Fatal(err)
+	}
+	dir := build(t, map[string]string{"main.go": goSrc.String()})
+
+	var stdout, stderr strings.Builder
+	cmd := exec.Command(filepath.Join(dir, "main"))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestRun(t *testing.T) {
+	backendtest.RunPrograms(t, 0, run)
+
+	t.Run("Test floats", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Floats, 0, run)
+	})
+
+	t.Run("Test interfaces", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Interfaces, 0, run)
+	})
+
+	t.Run("Test results", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Results, 0, run)
+	})
+}
+
+func TestArrays(t *testing.T) {
+	out, _, code := run(t, backendtest.Arrays, 0)
+	if out != backendtest.ArraysOutput || code != 0 {
+		t.Errorf("expected %q and exit code 0, got %q and %d\n", backendtest.ArraysOutput, out, code)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	out, stderr, code := run(t, backendtest.Defer, 0)
+	if out != backendtest.DeferOutput || stderr != "division by zero\n" || code != 1 {
+		t.Errorf("expected %q, %q and exit code 1, got %q, %q and %d\n", backendtest.DeferOutput, "division by zero\n", out, stderr, code)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	out, _, code := runPackages(t, backendtest.ParsePackages(t, backendtest.Packages))
+	if out != backendtest.PackagesOutput || code != 0 {
+		t.Errorf("expected %q and exit code 0, got %q and %d\n", backendtest.PackagesOutput, out, code)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":            `fn main() : void { print(1); panic("oops", 2); }`,
+		"Test division by zero": `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test index":            `fn main() : int { let a: [3]int; let i = 3; return a[i]; }`,
+		"Test null pointer":     `fn main() : int { let p: *int = NULL; return *p; }`,
+		"Test null interface":   `definetype Shape = interface { fn area(self) : int; }; fn main() : int { let s: Shape; s.area() }`,
+	}
+	msgs := map[string]string{
+		"Test panic":            "panic: oops 2\n",
+		"Test division by zero": "division by zero\n",
+		"Test index":            "index 3 out of range [0, 3)\n",
+		"Test null pointer":     "line 1 column 46: null pointer dereference\n",
+		"Test null interface":   "line 1 column 89: method area of a null interface value\n",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, stderr, code := run(t, src, 0)
+			if stderr != msgs[name] || code != 1 {
+				t.Errorf("expected %q and exit code 1, got %q and %d\n", msgs[name], stderr, code)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Test source", func(t *testing.T) {
+		src := `definetype Meters = uint;
+
+pub fn scale(d: Meters, by: int = 2) : Meters {
+  let total: Meters = 0;
+  for (let i = 0; i < by; i++) {
+    total += d;
+  }
+  total
+}
+
+fn clamp(n: int) : int {
+  while (n > 0) {
+    if (n > 10) {
+      return 10;
+    }
+    return n;
+  }
+}`
+		want := `// Code generated by yal. DO NOT EDIT.
+
+package lib
+
+import "yal/gort"
+
+type Meters = uint64
+
+func Scale(d Meters, by int64) Meters {
+	var total Meters = 0
+	for i := int64(0); i < by; i++ {
+		total += d
+	}
+	return total
+}
+
+func clamp(n int64) int64 {
+	for n > 0 {
+		if n > 10 {
+			return 10
+		}
+		return n
+	}
+	panic(gort.ErrUnreachable)
+}
+`
+		var got strings.Builder
+		if err := gogen.Generate(&got, backendtest.Parse(t, src), "lib"); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("expected\n%s\ngot\n%s\n", want, got.String())
+		}
+	})
+
+	tests := map[string]string{
+		"Test no main":         `fn f() : void {}`,
+		"Test fn values":       `fn f() : void {} fn main() : void { let g = f; }`,
+		"Test unsupported":     `fn main() : void { spawn main(); }`,
+		"Test printing array":  `fn main() : void { let a: [2]int; print(a); }`,
+		"Test generic methods": `definetype N = int; impl N { fn get<T>(self) : int { 0 } } fn main() : void {}`,
+		"Test division":        `fn main() : int { let a = 1; a / 0 }`,
+		"Test index":           `fn main() : int { let a: [3]int; a[3] }`,
+		"Test recover":         `fn main() : void { recover(); }`,
+		"Test untyped result":  `fn main() : void { let r = Ok(1); }`,
+	}
+	errs := map[string]string{
+		"Test no main":         "no main fn",
+		"Test fn values":       "line 1 column 45: fn values are not supported by the Go backend",
+		"Test unsupported":     "line 1 column 24: SpawnStmt is not supported by the Go backend",
+		"Test printing array":  "line 1 column 40: printing [2]int is not supported by the Go backend",
+		"Test generic methods": "line 1 column 35: generic methods are not supported by the Go backend",
+		"Test division":        "line 1 column 32: division by zero",
+		"Test index":           "line 1 column 35: index 3 out of range [0, 3)",
+		"Test recover":         "line 1 column 27: recover is not supported by the Go backend",
+		"Test untyped result":  "line 1 column 30: Ok used where the type of its Result isn't known",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := gogen.Generate(&strings.Builder{}, backendtest.Parse(t, src), "main")
+			if err == nil || err.Error() != errs[name] {
+				t.Errorf("expected %q, got %v\n", errs[name], err)
+			}
+		})
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	var lib strings.Builder
+	if err := gogen.Generate(&lib, backendtest.Parse(t, `pub fn fib(n: int) : int {
+  let a = 0;
+  let b = 1;
+  while (n > 0) {
+    let t = a + b;
+    a = b;
+    b = t;
+    n--;
+  }
+  a
+}`), "fib"); err != nil {
+		t.Fatal(err)
+	}
+	dir := build(t, map[string]string{
+		"fib/fib.go": lib.String(),
+		"main.go": `package main
+
+import (
+	"fmt"
+	"prog/fib"
+)
+
+func main() {
+	fmt.Println(fib.Fib(10), fib.Fib(90))
+}
+`,
+	})
+
+	out, err := exec.Command(filepath.Join(dir, "main")).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "55 2880067194370816120\n" {
+		t.Errorf("expected %q, got %q\n", "55 2880067194370816120\n", out)
+	}
+}
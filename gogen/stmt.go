@@ -0,0 +1,576 @@
+package gogen
+
+import (
+	"fmt"
+	"strings"
+	"yal/astutil"
+	"yal/parser"
+)
+
+// Generates statements, passing the value the last one ends with to sink
+func (g *generator) stmts(stmts []parser.IStatement, sink func(parser.IExpression)) {
+	for i, s := range stmts {
+		if i == len(stmts)-1 {
+			g.stmt(s, sink)
+		} else {
+			g.stmt(s, nil)
+		}
+	}
+}
+
+// Generates a statement. The value of an implicit return in tail position
+// is given to sink when it is set, which is the case at the end of a fn
+// returning a value or of a branch of an if or of an arm of a match used as
+// a value.
+func (g *generator) stmt(node parser.IStatement, sink func(parser.IExpression)) {
+	switch n := node.(type) {
+	case *parser.Block:
+		g.Line("{")
+		g.body(n, sink)
+		g.Line("}")
+	case *parser.VarDeclExpression:
+		g.varDecl(n)
+	case *parser.ConstDeclStmt:
+		l := g.constant(n, g.fresh(n.Name.Lexeme))
+		g.scopes[len(g.scopes)-1][n.Name.Lexeme] = l
+		g.Line("const %s %s = %s", l.name, g.goType(l.typ), g.constValue(l))
+	case *parser.StatementExpression:
+		switch e := n.Expr.(type) {
+		case *parser.FnReturn:
+			g.stmt(e, sink)
+		case *parser.IfExpr, *parser.MatchExpr:
+			g.stmt(e, sink)
+		default:
+			g.exprStmt(e)
+		}
+	case *parser.FnReturn:
+		switch {
+		case !n.Implicit && n.Value == nil:
+			g.Line("return")
+		case !n.Implicit:
+			g.returnSink(n.Value)
+		case sink != nil:
+			sink(n.Value)
+		default:
+			g.exprStmt(n.Value)
+		}
+	case *parser.IfExpr:
+		g.ifStmt(n, sink)
+	case *parser.MatchExpr:
+		g.matchStmt(n, sink)
+	case *parser.WhileLoop:
+		g.whileLoop(n)
+	case *parser.ForLoop:
+		g.forLoop(n)
+	case *parser.SwitchStmt:
+		g.switchStmt(n, sink)
+	case *parser.BreakStmt:
+		if len(g.loops) == 0 {
+			astutil.Fail(n, "break outside of a loop")
+		}
+		if l := g.loops[len(g.loops)-1]; l.switches < g.switches {
+			g.Line("break %s", l.label)
+		} else {
+			g.Line("break")
+		}
+	case *parser.ContinueStmt:
+		g.Line("continue")
+	case *parser.DeferStmt:
+		// The expression is evaluated once the fn returns, as on the vm, by
+		// a func returning nothing
+		ret := g.ret
+		g.Line("defer func() {")
+		g.Depth++
+		g.push()
+		g.ret = "void"
+		g.exprStmt(n.Expr)
+		g.ret = ret
+		g.pop()
+		g.Depth--
+		g.Line("}()")
+	default:
+		g.unsupported(node)
+	}
+}
+
+// Generates the statements of a branch or of a loop body in a new scope,
+// one level deeper
+func (g *generator) body(stmt parser.IStatement, sink func(parser.IExpression)) {
+	g.Depth++
+	g.push()
+	if b, ok := stmt.(*parser.Block); ok {
+		g.stmts(b.Statements, sink)
+	} else if stmt != nil {
+		g.stmt(stmt, sink)
+	}
+	g.pop()
+	g.Depth--
+}
+
+func (g *generator) push() {
+	g.scopes = append(g.scopes, map[string]*local{})
+	g.names = append(g.names, map[string]string{})
+}
+
+func (g *generator) pop() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.names = g.names[:len(g.names)-1]
+}
+
+// Generates a variable declaration followed by the mark of the variable
+func (g *generator) varDecl(n *parser.VarDeclExpression) {
+	g.Line("%s", g.declaration(n))
+	g.markUse(g.lookup(n.Name.Lexeme))
+}
+
+// Returns the short declaration of the variable a for loop declares, its
+// initializer being converted to its type unless it has it
+func (g *generator) shortDecl(n *parser.VarDeclExpression) string {
+	t := astutil.DeclType(g.env, n)
+	init := g.zero(t)
+	if lit, ok := n.Initializer.(*parser.Literal); !ok || lit.Value != nil {
+		init = astutil.Unparen(g.expr(n.Initializer, t))
+	}
+	if astutil.ExprType(g.env, n.Initializer) != t || g.untyped(n.Initializer) {
+		init = g.conversion(t, init)
+	}
+	return g.declare(n.Name.Lexeme, t).name + " := " + init
+}
+
+// Returns the declaration of a variable, with its type unless it is the one
+// of its initializer, as it is for the temporaries holding values
+func (g *generator) declaration(n *parser.VarDeclExpression) string {
+	t := astutil.DeclType(g.env, n)
+
+	// The initializer is generated before the variable is declared, as it
+	// may refer to a variable it shadows
+	init := ""
+	if lit, ok := n.Initializer.(*parser.Literal); !ok || lit.Value != nil {
+		init = astutil.Unparen(g.expr(n.Initializer, t))
+	}
+
+	l := g.declare(n.Name.Lexeme, t)
+	switch {
+	case init == "":
+		return fmt.Sprintf("var %s %s", l.name, g.goType(t))
+	case g.temps[init]:
+	case astutil.ExprType(g.env, n.Initializer) != t || g.untyped(n.Initializer):
+		return fmt.Sprintf("var %s %s = %s", l.name, g.goType(t), init)
+	}
+	return l.name + " := " + init
+}
+
+// Returns v converted to type t
+func (g *generator) conversion(t string, v string) string {
+	goType := g.goType(t)
+	if strings.HasPrefix(goType, "*") {
+		goType = "(" + goType + ")"
+	}
+	return goType + "(" + astutil.Unparen(v) + ")"
+}
+
+// Returns the value of type t it holds when not initialized
+func (g *generator) zero(t string) string {
+	switch u := astutil.Underlying(g.env, t); {
+	case u == "string":
+		return `""`
+	case strings.HasPrefix(u, "[") || astutil.IsResult(u):
+		return g.goType(t) + "{}"
+	case astutil.IsPointer(u) || g.iface(u) != nil:
+		return "nil"
+	case u == "bool":
+		return "false"
+	}
+	return "0"
+}
+
+func (g *generator) exprStmt(expr parser.IExpression) {
+	switch n := expr.(type) {
+	case *parser.IfExpr:
+		g.ifStmt(n, nil)
+		return
+	case *parser.MatchExpr:
+		g.matchStmt(n, nil)
+		return
+	}
+	g.Line("%s", g.simple(expr))
+}
+
+// Returns a Go simple statement evaluating an expression whose value is
+// unused, and writes the statements it needs to run first
+func (g *generator) simple(expr parser.IExpression) string {
+	switch n := expr.(type) {
+	case *parser.Grouping:
+		return g.simple(n.Grouped)
+	case *parser.Assign:
+		s, _ := g.assign(n)
+		return s
+	case *parser.PrefixIncDec:
+		s, _ := g.incDec(n.Target, n.Operator)
+		return s
+	case *parser.PostfixIncDec:
+		s, _ := g.incDec(n.Target, n.Operator)
+		return s
+	case *parser.FnCall:
+		return astutil.Unparen(g.call(n, ""))
+	}
+	return "_ = " + astutil.Unparen(g.expr(expr, ""))
+}
+
+// Returns the value of an expression from the fn being generated
+func (g *generator) returnSink(expr parser.IExpression) {
+	switch n := expr.(type) {
+	case *parser.IfExpr:
+		g.ifStmt(n, g.returnSink)
+		return
+	case *parser.MatchExpr:
+		g.matchStmt(n, g.returnSink)
+		return
+	}
+	if g.ret == "void" || astutil.ExprType(g.env, expr) == "void" {
+		g.exprStmt(expr)
+		if g.ret == "void" {
+			g.Line("return")
+		}
+		return
+	}
+	g.Line("return %s", astutil.Unparen(g.expr(expr, g.ret)))
+}
+
+// Returns a sink assigning values to the variable name of type t
+func (g *generator) assignSink(name string, t string) func(parser.IExpression) {
+	var sink func(parser.IExpression)
+	sink = func(expr parser.IExpression) {
+		switch n := expr.(type) {
+		case *parser.IfExpr:
+			g.ifStmt(n, sink)
+			return
+		case *parser.MatchExpr:
+			g.matchStmt(n, sink)
+			return
+		}
+		if astutil.ExprType(g.env, expr) == "void" {
+			g.exprStmt(expr)
+			return
+		}
+		g.Line("%s = %s", name, astutil.Unparen(g.expr(expr, t)))
+	}
+	return sink
+}
+
+// Generates an if, chaining the ifs of its else branch with else if when
+// their condition needs no statements to be evaluated first
+func (g *generator) ifStmt(n *parser.IfExpr, sink func(parser.IExpression)) {
+	g.Line("if %s {", astutil.Unparen(g.expr(n.Condition, "bool")))
+	g.body(n.ThenBranch, sink)
+	for n.ElseBranch != nil {
+		if next, ok := n.ElseBranch.(*parser.IfExpr); ok {
+			cond, pre := g.Split(g.Depth+1, func() string { return astutil.Unparen(g.expr(next.Condition, "bool")) })
+			if pre == "" {
+				g.Line("} else if %s {", cond)
+				g.body(next.ThenBranch, sink)
+				n = next
+				continue
+			}
+		}
+		g.Line("} else {")
+		g.body(n.ElseBranch, sink)
+		break
+	}
+	g.Line("}")
+}
+
+// Generates a match on a Result as an if on the variant it holds, whose
+// arm binds its value or its error
+func (g *generator) matchStmt(n *parser.MatchExpr, sink func(parser.IExpression)) {
+	t := astutil.ExprType(g.env, n.Subject)
+	u := astutil.Underlying(g.env, t)
+	if !astutil.IsResult(u) {
+		astutil.Fail(n, "match on a value of type %s is not supported by the Go backend", t)
+	}
+	arms := map[string]*parser.MatchArm{}
+	for _, arm := range n.Arms {
+		if _, ok := arms[arm.Pattern.Variant.Lexeme]; !ok {
+			arms[arm.Pattern.Variant.Lexeme] = arm
+		}
+	}
+
+	subject := astutil.Unparen(g.expr(n.Subject, t))
+	r := g.newTemp()
+	for i, variant := range []struct{ name, field string }{{"Ok", "Value"}, {"Err", "Err"}} {
+		arm, found := arms[variant.name]
+		if !found {
+			arm, found = arms["_"]
+		}
+		if !found {
+			astutil.Fail(n, "match on a Result without an arm for %s", variant.name)
+		}
+		if i == 0 {
+			g.Line("if %s := %s; %s.Ok {", r, subject, r)
+		} else {
+			g.Line("} else {")
+		}
+		g.arm(arm, u, r+"."+variant.field, sink)
+	}
+	g.Line("}")
+}
+
+// Generates the body of a match arm on a Result of type t in a new scope,
+// declaring its bindings as v
+func (g *generator) arm(arm *parser.MatchArm, t string, v string, sink func(parser.IExpression)) {
+	g.Depth++
+	g.push()
+	for i, name := range arm.Pattern.Bindings {
+		l := g.declare(name.Lexeme, astutil.VariantType(arm.Pattern, t, i))
+		g.Line("%s := %s", l.name, v)
+		g.markUse(l)
+	}
+	switch body := arm.Body.(type) {
+	case *parser.Block:
+		g.stmts(body.Statements, sink)
+	default:
+		if sink != nil {
+			sink(body.(parser.IExpression))
+		} else {
+			g.exprStmt(body.(parser.IExpression))
+		}
+	}
+	g.pop()
+	g.Depth--
+}
+
+// Generates a while loop. A condition needing statements to be evaluated
+// first is checked at the start of the body.
+func (g *generator) whileLoop(n *parser.WhileLoop) {
+	cond, pre := g.Split(g.Depth+1, func() string { return astutil.Unparen(g.expr(n.Condition, "bool")) })
+	g.enter(n.Body)
+	switch {
+	case pre != "":
+		g.Line("for {")
+		g.W.WriteString(pre)
+		g.Depth++
+		g.Line("if !(%s) {", cond)
+		g.Line("\tbreak")
+		g.Line("}")
+		g.Depth--
+	case cond == "true":
+		g.Line("for {")
+	default:
+		g.Line("for %s {", cond)
+	}
+	g.body(n.Body, nil)
+	g.Line("}")
+	g.loops = g.loops[:len(g.loops)-1]
+}
+
+// Generates a for loop as a Go for clause, unless its initializer, its
+// condition or its apply expression need statements to be run first. The
+// loop is then written in a block declaring the initializer, checking the
+// condition at the start of the body and evaluating the apply expression
+// there as well, from the second iteration on.
+func (g *generator) forLoop(n *parser.ForLoop) {
+	g.push()
+	defer g.pop()
+
+	init, initPre := "", ""
+	var declared *local
+	if n.Initializer != nil {
+		init, initPre = g.Split(g.Depth+1, func() string {
+			if decl, ok := n.Initializer.(*parser.VarDeclExpression); ok {
+				s := g.shortDecl(decl)
+				declared = g.lookup(decl.Name.Lexeme)
+				return s
+			}
+			return g.initStmt(n.Initializer)
+		})
+	}
+	cond, condPre := "", ""
+	if n.Condition != nil {
+		cond, condPre = g.Split(g.Depth+2, func() string { return astutil.Unparen(g.expr(n.Condition, "bool")) })
+	}
+	apply, applyPre := "", ""
+	if n.Apply != nil {
+		apply, applyPre = g.Split(g.Depth+3, func() string { return g.simple(n.Apply) })
+	}
+
+	if initPre == "" && condPre == "" && applyPre == "" {
+		g.enter(n.Body)
+		switch {
+		case init != "" || apply != "":
+			g.Line("for %s; %s; %s {", init, cond, apply)
+		case cond == "" || cond == "true":
+			g.Line("for {")
+		default:
+			g.Line("for %s {", cond)
+		}
+		if declared != nil {
+			g.Depth++
+			g.markUse(declared)
+			g.Depth--
+		}
+		g.body(n.Body, nil)
+		g.Line("}")
+		g.loops = g.loops[:len(g.loops)-1]
+		return
+	}
+
+	g.Line("{")
+	g.Depth++
+	g.W.WriteString(initPre)
+	if init != "" {
+		g.Line("%s", init)
+	}
+	if declared != nil {
+		g.markUse(declared)
+	}
+	first := ""
+	if n.Apply != nil {
+		first = g.temp("true")
+	}
+	g.enter(n.Body)
+	g.Line("for {")
+	g.Depth++
+	if n.Apply != nil {
+		g.Line("if !%s {", first)
+		g.W.WriteString(applyPre)
+		g.Line("\t%s", apply)
+		g.Line("}")
+		g.Line("%s = false", first)
+	}
+	g.W.WriteString(condPre)
+	if n.Condition != nil {
+		g.Line("if !(%s) {", cond)
+		g.Line("\tbreak")
+		g.Line("}")
+	}
+	g.Depth--
+	g.body(n.Body, nil)
+	g.Line("}")
+	g.loops = g.loops[:len(g.loops)-1]
+	g.Depth--
+	g.Line("}")
+}
+
+// Returns the initializer of a for loop that doesn't declare a variable
+func (g *generator) initStmt(stmt parser.IStatement) string {
+	if s, ok := stmt.(*parser.StatementExpression); ok {
+		return g.simple(s.Expr)
+	}
+	if e, ok := stmt.(parser.IExpression); ok {
+		return g.simple(e)
+	}
+	g.unsupported(stmt)
+	return ""
+}
+
+// Starts a loop, writing a label before it when a switch of its body
+// breaks out of it. Go labels being scoped to the fn, each one is numbered.
+func (g *generator) enter(body parser.IStatement) {
+	l := loop{switches: g.switches}
+	if breaksFromSwitch(body, false) {
+		g.labels++
+		l.label = fmt.Sprintf("loop%d", g.labels)
+		g.Line("%s:", l.label)
+	}
+	g.loops = append(g.loops, l)
+}
+
+// Reports whether a break within a switch of a loop body, outside of a
+// nested loop, breaks out of the loop
+func breaksFromSwitch(node parser.IStatement, inSwitch bool) bool {
+	switch n := node.(type) {
+	case *parser.Block:
+		for _, s := range n.Statements {
+			if breaksFromSwitch(s, inSwitch) {
+				return true
+			}
+		}
+	case *parser.StatementExpression:
+		if s, ok := n.Expr.(parser.IStatement); ok {
+			return breaksFromSwitch(s, inSwitch)
+		}
+	case *parser.IfExpr:
+		return breaksFromSwitch(n.ThenBranch, inSwitch) || breaksFromSwitch(n.ElseBranch, inSwitch)
+	case *parser.MatchExpr:
+		for _, arm := range n.Arms {
+			if breaksFromSwitch(arm.Body, inSwitch) {
+				return true
+			}
+		}
+	case *parser.SwitchStmt:
+		for _, sc := range n.Cases {
+			if breaksFromSwitch(sc.Body, true) {
+				return true
+			}
+		}
+		return breaksFromSwitch(n.Default, true)
+	case *parser.BreakStmt:
+		return inSwitch
+	}
+	return false
+}
+
+// Generates a switch as a Go one, whose cases don't fall through either.
+// Go rejecting duplicate constant cases, the values matched by an earlier
+// case are left out, along with the cases left without values.
+func (g *generator) switchStmt(n *parser.SwitchStmt, sink func(parser.IExpression)) {
+	t := astutil.ExprType(g.env, n.Subject)
+	if t == "" {
+		t = "int"
+	}
+	subject := astutil.Unparen(g.expr(n.Subject, t))
+	if g.untyped(n.Subject) {
+		subject = g.conversion(t, subject)
+	}
+
+	g.Line("switch %s {", subject)
+	g.switches++
+	seen := map[any]bool{}
+	for _, sc := range n.Cases {
+		values := []string{}
+		for _, v := range sc.Values {
+			if c, ok := g.eval(v, t); ok {
+				if seen[c] {
+					continue
+				}
+				seen[c] = true
+			}
+			value, pre := g.Split(g.Depth, func() string { return astutil.Unparen(g.expr(v, t)) })
+			if pre != "" {
+				astutil.Fail(v, "case values needing statements are not supported by the Go backend")
+			}
+			values = append(values, value)
+		}
+		if len(values) > 0 {
+			g.Line("case %s:", strings.Join(values, ", "))
+			g.body(sc.Body, sink)
+		}
+	}
+	if n.Default != nil {
+		g.Line("default:")
+		g.body(n.Default, sink)
+	}
+	g.switches--
+	g.Line("}")
+}
+
+// Declares a temporary holding value and returns its name
+func (g *generator) temp(value string) string {
+	name := g.newTemp()
+	g.Line("%s := %s", name, astutil.Unparen(value))
+	return name
+}
+
+// Returns the name of a new temporary, declared in the innermost scope
+func (g *generator) newTemp() string {
+	name := ""
+	for i := len(g.temps) + 1; ; i++ {
+		name = fmt.Sprintf("tmp%d", i)
+		if g.available(name, "") {
+			break
+		}
+	}
+	g.temps[name] = true
+	g.names[len(g.names)-1][name] = ""
+	return name
+}
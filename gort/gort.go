@@ -0,0 +1,175 @@
+// Package gort is the runtime of the Go source yal compiles to. It prints
+// values as the vm does and gives a program the messages and exit code of
+// the runtime errors and panics stopping it.
+package gort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Writer print writes to, which programs embedding yal fns may replace
+var Stdout io.Writer = os.Stdout
+
+// Panicked with by fns returning a value that end without returning one
+var ErrUnreachable = errors.New("unreachable code reached")
+
+// Value a yal panic panics with, Msg being its args printed as print does
+type PanicError struct {
+	Msg string
+}
+
+func (e *PanicError) Error() string {
+	return "panic: " + e.Msg
+}
+
+// Value a runtime error found by a check of the generated code panics with,
+// Msg being prefixed with the position of the construct failing it
+type RuntimeError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Value of a yal Result, holding Value when Ok is set and Err otherwise
+type Result[T any, E any] struct {
+	Ok    bool
+	Value T
+	Err   E
+}
+
+// Formats r as print does, as Ok(value) or Err(error)
+func (r Result[T, E]) String() string {
+	if r.Ok {
+		return "Ok(" + formatValue(r.Value) + ")"
+	}
+	return "Err(" + formatValue(r.Err) + ")"
+}
+
+// Returns p, panicking with the null pointer dereference at line and column
+// when it is nil
+func NonNil[T any](p *T, line int, column int) *T {
+	if p == nil {
+		panic(&RuntimeError{Line: line, Column: column, Msg: "null pointer dereference"})
+	}
+	return p
+}
+
+// Returns v, panicking with the call of method name of a null interface
+// value at line and column when it is nil
+func Receiver[T any](v T, name string, line int, column int) T {
+	if any(v) == nil {
+		panic(&RuntimeError{Line: line, Column: column, Msg: "method " + name + " of a null interface value"})
+	}
+	return v
+}
+
+// Returns a pointer to a copy of v, which an interface value holds so that
+// it is only equal to the interface values it is copied to
+func Box[T any](v T) *T {
+	return &v
+}
+
+// Prints args separated by spaces and followed by a newline
+func Print(args ...any) {
+	_, _ = io.WriteString(Stdout, format(args)+"\n")
+}
+
+// Returns the value a yal panic with args panics with
+func Panic(args ...any) error {
+	return &PanicError{Msg: format(args)}
+}
+
+func format(args []any) string {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = formatValue(arg)
+	}
+	return strings.Join(s, " ")
+}
+
+// Formats a value of a yal type, pointers as null or ptr
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case uint8:
+		return string([]byte{v})
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	}
+	if p := reflect.ValueOf(v); p.Kind() == reflect.Pointer {
+		if p.IsNil() {
+			return "null"
+		}
+		return "ptr"
+	}
+	return fmt.Sprint(v)
+}
+
+// Runs the main fn of a program and exits with the code it returns. A
+// runtime error or a panic stopping it is written to stderr as the vm
+// reports it, and the program exits with 1.
+func Main(main func() int64) {
+	os.Exit(run(main))
+}
+
+func run(main func() int64) (code int) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		msg, ok := message(r)
+		if !ok {
+			panic(r)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+		code = 1
+	}()
+	return int(main())
+}
+
+// Returns the message of a value a yal program panicked with, false when it
+// isn't one of its errors
+func message(r any) (string, bool) {
+	var rtErr runtime.Error
+	err, ok := r.(error)
+	switch {
+	case !ok:
+		return "", false
+	case !errors.As(err, &rtErr):
+		return err.Error(), true
+	}
+
+	msg := strings.TrimPrefix(rtErr.Error(), "runtime error: ")
+	var i, n int64
+	switch {
+	case msg == "integer divide by zero":
+		return "division by zero", true
+	case strings.HasPrefix(msg, "invalid memory address or nil pointer dereference"):
+		return "null pointer dereference", true
+	}
+	if scanned, _ := fmt.Sscanf(msg, "index out of range [%d] with length %d", &i, &n); scanned == 2 {
+		return fmt.Sprintf("index %d out of range [0, %d)", i, n), true
+	}
+	return msg, true
+}
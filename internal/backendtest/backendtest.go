@@ -0,0 +1,450 @@
+// Package backendtest holds what the tests of the backends share: checking
+// that the programs a backend builds behave as they do on the vm, and the
+// programs every backend is checked with.
+package backendtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"yal/astutil"
+	"yal/ir"
+	"yal/lexer"
+	"yal/opt"
+	"yal/parser"
+	"yal/vm"
+)
+
+// Builds src with a backend and runs it, returning what it writes to stdout
+// and stderr and its exit code. Backends generating code from the IR build
+// it optimized at level, the others ignore it.
+type Runner func(t *testing.T, src string, level int) (string, string, int)
+
+func Parse(t *testing.T, src string) []parser.IStatement {
+	tokens, err := lexer.NewLexer(context.Background(), src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.NewParser(context.Background(), tokens).Run()
+}
+
+// Returns the IR of src optimized at level
+func Lower(t *testing.T, src string, level int) *ir.Module {
+	m, err := ir.Build(Parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &opt.Manager{Passes: opt.Pipeline(level), Verify: true}
+	if err := pm.Run(m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// Checks that src prints and exits as it does on the vm, at every level up
+// to maxLevel
+func ExpectSameAsVM(t *testing.T, src string, maxLevel int, run Runner) {
+	for level := 0; level <= maxLevel; level++ {
+		var want strings.Builder
+		code, err := vm.New(Lower(t, src, level), &want).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, _, got := run(t, src, level)
+		if out != want.String() || got != code&0xff {
+			t.Errorf("expected %q and exit code %d at -O%d, got %q and %d\n", want.String(), code&0xff, level, out, got)
+		}
+	}
+}
+
+// Checks that the programs every backend supports behave as they do on the
+// vm, at every level up to maxLevel
+func RunPrograms(t *testing.T, maxLevel int, run Runner) {
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			ExpectSameAsVM(t, src, maxLevel, run)
+		})
+	}
+}
+
+var programs = map[string]string{
+	"Test loops and calls": `fn fib(n: int) : int {
+  let a = 0;
+  let b = 1;
+  for (let i = 0; i < n; ++i) {
+    let t = a + b;
+    a = b;
+    b = t;
+  }
+  return a;
+}
+
+fn main() : int {
+  let k = 3;
+  let s = 0;
+  while (s < 100) {
+    s += fib(10) * k + k * k;
+  }
+  print(s, fib(20), fib(90));
+  return s % 7;
+}`,
+
+	"Test pointers": `fn swap(a: *int, b: *int) : void {
+  let t = *a;
+  *a = *b;
+  *b = t;
+}
+
+fn bump(p: *int) : int {
+  *p += 10;
+  return 1;
+}
+
+fn depth(n: int) : int {
+  let x = n;
+  let p = &x;
+  if (n == 0) { return 0; }
+  return *p + depth(n - 1);
+}
+
+fn main() : int {
+  let x = 1;
+  let y = 2;
+  let p: *int = NULL;
+  swap(&x, &y);
+  print(x, y, p, &x, depth(100));
+  print(x + bump(&x), x);
+  return x;
+}`,
+
+	"Test values": `fn id(n: int) : int { return n; }
+
+fn main() : void {
+  let u: uint = 0;
+  let c: char = 250;
+  let s = "";
+  let m = -9223372036854775807 - 1;
+  print(u - 1, -7 / 2, -7 % 2, 1 << 3, -9 >> 1, 1 << 64, 1 << id(64), -9 >> id(70), -9 >> id(-1), true && !false, "a \ b", s);
+  print(c + 10, c << 1, -c, u < u - 1, -1 < 0, 1.5 * 2.0 > 2.5, 0.1 + 0.2 == 0.3, true ^ (id(1) == 1));
+  print(m, m / id(-1), m % id(-1), m * -1, m / -1, m % -1);
+}`,
+
+	"Test ifs as values": `fn sign(n: int) : int {
+  if (n < 0) { -1 } else if (n == 0) { 0 } else { 1 }
+}
+
+fn main() : int {
+  let s = 0;
+  for (let i = -2; i <= 2; i++) {
+    let d = if (i % 2 == 0) { let h = i / 2; h * 10 } else { sign(i) };
+    s += d;
+    print(i, d, sign(i));
+  }
+  s
+}`,
+
+	"Test evaluation order": `fn trace(n: int) : int {
+  print(n);
+  n
+}
+
+fn pick(a: int, b: int = 20, c: int = 30) : int {
+  a * 100 + b * 10 + c
+}
+
+fn main() : int {
+  let x = 1;
+  let y = trace(1) - trace(2) * trace(3);
+  print(trace(4), trace(5));
+  let z = pick(c: trace(6), a: trace(7));
+  let i = 0;
+  let j = i++ + i++ * 10;
+  while (trace(x) < 3 && trace(x * 10) > 0) { x++; }
+  for (let k = trace(8); k < trace(10); k += trace(1)) {}
+  return y + z + j;
+}`,
+
+	"Test shadowing": `const Base = 5;
+
+fn main() : int {
+  let x = Base;
+  {
+    let x = x * 2;
+    let p = &x;
+    *p += 1;
+    print(x);
+  }
+  let x = x + 100;
+  let len = 3;
+  let unused = 1;
+  print(x, len);
+  x
+}`,
+
+	"Test generics": `definetype Meters = int;
+
+fn max<T: ordered>(a: T, b: T) : T {
+  if (a > b) { a } else { b }
+}
+
+fn swap<T>(a: *T, b: *T) : void {
+  let t: T = *a;
+  *a = *b;
+  *b = t;
+}
+
+fn twice<T: integer>(n: T) : T {
+  let m: T = max(n, n);
+  m * 2
+}
+
+fn main() : int {
+  let a = 3;
+  let b = 5;
+  swap(&a, &b);
+  let m: Meters = 4;
+  let c: char = 200;
+  print(a, max(a, b), max<uint>(2, 9), max(m, 1), twice(c), twice<uint>(7));
+  max(a, 1) - 1
+}`,
+
+	"Test nested loops": `fn main() : int {
+  let s = 0;
+  for (let i = 0; i < 10; ++i) {
+    for (let j = i; j < 10; ++j) {
+      if ((i + j) % 3 == 0) { continue; }
+      if (j * i > 40) { break; }
+      s += i * j;
+    }
+  }
+  print(s);
+  s % 256
+}`,
+
+	"Test switch": `fn main() : int {
+  let n = 0;
+  while (true) {
+    n++;
+    switch (n % 4) {
+      case 0:
+        continue;
+      case 1, 1:
+        print("one", n);
+      case 3:
+        if (n > 6) { break; }
+      default:
+        print(n);
+    }
+  }
+  n
+}`,
+}
+
+// Program printing floats, for the backends that can
+const Floats = `fn main() : void {
+  let x = 1.5;
+  print(0.1 + 0.2, 1.0 / 3.0, 1234567.0, 0.00001, 100.0, -(0.0), -x, x * 2.0);
+  print(1000000000000000000000.0, 123456789.125, 0.1 * 3.0, 1.0 / 0.0);
+}`
+
+// Program using arrays, which the IR doesn't support, and what it prints
+const (
+	Arrays = `const N = 4;
+
+definetype Row = [N]int;
+definetype Meters = uint;
+
+fn sum(r: Row) : int {
+  let s = 0;
+  for (let i = 0; i < N; ++i) { s += r[i]; }
+  s
+}
+
+fn fill(r: *Row, v: int) : void {
+  for (let i = 0; i < N; ++i) { (*r)[i] = v * i; }
+}
+
+fn main() : int {
+  let grid: [2]Row;
+  let row: Row;
+  let d: Meters = 7;
+  fill(&row, 3);
+  grid[1] = row;
+  let copy = grid[1];
+  copy[0] = 100;
+  grid[0][3] += 5;
+  print(sum(grid[0]), sum(grid[1]), sum(copy), d * 2);
+  switch (sum(copy)) {
+    case 0, 1:
+      return 1;
+    case 118:
+      print("matched");
+    default:
+      return 2;
+  }
+  0
+}`
+	ArraysOutput = "5 18 118 14\nmatched\n"
+)
+
+// Program deferring calls, which the backends generating code from the IR
+// don't support, and what it prints before dividing by zero
+const (
+	Defer = `fn cleanup(n: int) : int {
+  defer print("closed", n);
+  for (let i = 0; i < 2; ++i) {
+    let j = i;
+    defer print("loop", j);
+  }
+  n = 42;
+  n + 1
+}
+
+fn div(a: int, b: int) : int {
+  defer print("div");
+  a / b
+}
+
+fn main() : int {
+  print(cleanup(1));
+  div(1, 0)
+}`
+	DeferOutput = "loop 1\nloop 0\nclosed 42\n43\ndiv\n"
+)
+
+// Program calling methods and dispatching them through interface values,
+// which the backends generating code from the IR other than the vm don't
+// support, and what it prints and its exit code
+const (
+	Interfaces = `definetype Shape = interface {
+  fn area(self) : int;
+  fn scaled(self, by: int) : int;
+};
+
+definetype Square = int;
+
+impl Square {
+  fn area(self) : int { self * self }
+  fn scaled(self, by: int) : int { self.area() * by * by }
+}
+
+definetype Line = int;
+
+impl Line {
+  fn area(self) : int { 0 }
+  fn scaled(self, by: int) : int { self * by }
+}
+
+fn total(a: Shape, b: Shape) : int {
+  a.area() + b.area()
+}
+
+fn pick(big: bool) : Shape {
+  let s: Square = 4;
+  let l: Line = 7;
+  if (big) { return s; }
+  l
+}
+
+fn main() : int {
+  let s: Square = 3;
+  let l: Line = 5;
+  let none: Shape;
+  let shape: Shape = s;
+  let same = shape;
+  print(s.area(), total(s, l), shape.scaled(2));
+  shape = l;
+  print(shape.area(), shape.scaled(3), pick(true).area(), pick(false).scaled(2));
+  print(none == NULL, shape == NULL, same == shape, same != pick(true));
+  total(s, s) % 256
+}`
+	InterfacesOutput = "9 9 36\n0 15 16 14\ntrue false false true\n"
+	InterfacesExit   = 18
+)
+
+// Program returning Results, propagating their errors with ? and matching
+// on them, which the backends generating code from the IR other than the vm
+// don't support, and what it prints and its exit code
+const (
+	Results = `fn checked(a: int, b: int) : Result<int, string> {
+  if (b == 0) { return Err("division by zero"); }
+  Ok(a / b)
+}
+
+fn ratio(a: int, b: int) : Result<int, string> {
+  let q = checked(a, b)?;
+  Ok(q * 100)
+}
+
+fn show(r: Result<int, string>) : int {
+  match (r) {
+    Ok(v) => v,
+    Err(e) => {
+      print("error:", e);
+      -1
+    }
+  }
+}
+
+fn main() : int {
+  print(show(ratio(7, 2)), show(ratio(1, 0)));
+  let r = ratio(9, 3);
+  match (r) {
+    Ok(v) => print("ok", v),
+    _ => print("failed")
+  }
+  print(r, checked(1, 0));
+  show(ratio(8, 4)) / 100
+}`
+	ResultsOutput = "error: division by zero\n300 -1\nok 300\nOk(300) Err(division by zero)\n"
+	ResultsExit   = 2
+)
+
+// Sources of a program made of packages, each one coming after the ones it
+// imports and the main one, whose path is empty, last, and what it prints
+var (
+	Packages = []struct{ Path, Src string }{
+		{"lib/geo", `pub definetype Meters = int;
+
+const Scale = 2;
+
+fn scale(r: Meters) : Meters { r * Scale }
+
+pub fn area(r: Meters) : Meters { scale(r) * r }`},
+		{"mathx", `import "lib/geo";
+
+pub fn sq(n: int) : int { n * n }
+
+pub fn total(a: geo.Meters, b: geo.Meters) : int { geo.area(a) + geo.area(b) }`},
+		{"", `import "lib/geo";
+import "mathx";
+
+const Scale = 10;
+
+fn area(r: int) : int { r + Scale }
+
+fn main() : int {
+  let m: geo.Meters = 3;
+  print(mathx.sq(3), geo.area(m), area(2), mathx.total(m, 1));
+  0
+}`},
+	}
+	PackagesOutput = "9 18 12 20\n"
+)
+
+// Parses the packages of a program, as Packages lists them, binding the
+// modules each one imports to their paths
+func ParsePackages(t *testing.T, srcs []struct{ Path, Src string }) []*astutil.Package {
+	pkgs := []*astutil.Package{}
+	for _, src := range srcs {
+		pkg := &astutil.Package{Path: src.Path, Stmts: Parse(t, src.Src), Imports: map[string]string{}}
+		for _, stmt := range pkg.Stmts {
+			if n, ok := stmt.(*parser.ImportStmt); ok {
+				pkg.Imports[n.ModuleName()] = n.Path.Lexeme
+			}
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
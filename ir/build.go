@@ -0,0 +1,485 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"yal/cfg"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Variable or constant of the fn being built, constant of the package or
+// fn used as a value. Variables whose address is taken live in a stack
+// slot, those captured by lambdas in a box and the others in SSA values.
+// def is the mangled name of the type defined by definetype a variable is
+// declared with, which gives its methods.
+type local struct {
+	name  string
+	typ   Type
+	def   string
+	addr  bool
+	boxed bool
+	slot  Value
+	konst *Const
+	fn    string
+}
+
+// Package lowered along with the others of a program. Its fns and types are
+// named after Path, except for the main package whose Path is empty, and
+// Imports maps the names it imports modules as to their paths.
+type Package struct {
+	Path    string
+	Stmts   []parser.IStatement
+	Imports map[string]string
+}
+
+// Type defined by a package, resolved from that package
+type alias struct {
+	pkg *Package
+	def *parser.DefineTypeStatement
+}
+
+// Signature of a fn. Fns returning several values return void and store
+// them through pointers to the types of results passed after their params.
+// def is the mangled name of the defined type the fn returns, if any.
+type signature struct {
+	params  []*parser.VarDeclExpression
+	types   []Type
+	ret     Type
+	def     string
+	results []Type
+}
+
+// Error reported when a construct can't be lowered to the IR
+type buildError struct {
+	error
+}
+
+type builder struct {
+	sigs      map[string]*signature
+	aliases   map[string]*alias
+	generics  map[string]*generic
+	instances []*instance
+	consts    map[*Package]map[string]*local
+	pkg       *Package
+	globals   map[string]*local
+	bindings  map[string]Type
+	callees   map[*parser.FnCall]string
+	receivers map[*parser.FnCall]parser.IExpression
+	slots     map[*parser.FnCall][]*local
+	closures  map[*parser.Lambda]*closure
+	lambdas   []*lambdaScope
+	deferred  map[*parser.DeferStmt]*parser.Lambda
+
+	f           *Func
+	locals      map[*lexer.Token]*local
+	declared    []*local
+	scopes      []map[string]*local
+	blocks      map[*cfg.Block]*Block
+	cur         *Block
+	defs        map[*Block]map[*local]Value
+	sealed      map[*Block]bool
+	incomplete  map[*Block][]*Instr
+	phiVars     map[*Instr]*local
+	loc         parser.Loc
+	returned    bool
+	ret         Value
+	results     []Value
+	lambdaCount int
+}
+
+// Lowers the fns of a checked package to SSA form, going through their
+// control flow graphs. Only the scalar subset of the language is supported:
+// integers, floats, bools, string constants and pointers to variables, along
+// with calls to the fns of the package and to print and panic. Generic fns
+// are lowered once for each list of type arguments they are called with,
+// lambdas to fns named after the one they are in and methods to fns named
+// after their type, as Square.area. Values of interface types are ifaces,
+// calling their methods through the method table of the type they hold.
+// Values of Result types are results, which Ok and Err make, ? unwraps and
+// match tells apart.
+func Build(stmts []parser.IStatement) (*Module, error) {
+	return BuildProgram([]*Package{{Stmts: stmts}})
+}
+
+// Lowers the checked packages of a program to a single module, each package
+// coming after the ones it imports. Calls to the fns of imported modules
+// are lowered to calls to their mangled names.
+func BuildProgram(pkgs []*Package) (m *Module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(buildError)
+			if !ok {
+				panic(r)
+			}
+			m, err = nil, e.error
+		}
+	}()
+
+	b := &builder{
+		sigs:      map[string]*signature{},
+		aliases:   map[string]*alias{},
+		generics:  map[string]*generic{},
+		consts:    map[*Package]map[string]*local{},
+		callees:   map[*parser.FnCall]string{},
+		receivers: map[*parser.FnCall]parser.IExpression{},
+		slots:     map[*parser.FnCall][]*local{},
+		closures:  map[*parser.Lambda]*closure{},
+		deferred:  map[*parser.DeferStmt]*parser.Lambda{},
+	}
+
+	for _, pkg := range pkgs {
+		for _, stmt := range pkg.Stmts {
+			if n, ok := stmt.(*parser.DefineTypeStatement); ok {
+				b.aliases[mangle(pkg.Path, n.Name.Lexeme)] = &alias{pkg: pkg, def: n}
+			}
+		}
+	}
+	for _, pkg := range pkgs {
+		b.pkg = pkg
+		for _, stmt := range pkg.Stmts {
+			switch n := stmt.(type) {
+			case *parser.FnDeclStmt:
+				if len(n.TypeParams) > 0 {
+					b.generics[mangle(pkg.Path, n.Name.Lexeme)] = &generic{pkg: pkg, decl: n}
+				} else {
+					b.sigs[mangle(pkg.Path, n.Name.Lexeme)] = b.signature(n)
+				}
+			case *parser.ImplStmt:
+				for _, m := range n.Methods {
+					params := paramDecls(m.Args)
+					switch {
+					case len(m.TypeParams) > 0:
+						b.fail(m, "generic methods are not supported by the IR")
+					case len(params) == 0 || params[0].Name.Lexeme != "self":
+						b.fail(m, "methods without self are not supported by the IR")
+					}
+					b.sigs[mangle(pkg.Path, n.Type.Lexeme+"."+m.Name.Lexeme)] = b.signature(m)
+				}
+			}
+		}
+	}
+
+	m = &Module{}
+	for _, pkg := range pkgs {
+		// Constants can't be imported, so each package only sees its own
+		b.pkg = pkg
+		b.globals = map[string]*local{}
+		b.consts[pkg] = b.globals
+		b.scopes = nil
+		for _, stmt := range pkg.Stmts {
+			if n, ok := stmt.(*parser.ConstDeclStmt); ok {
+				b.globals[n.Name.Lexeme] = b.constant(n)
+			}
+		}
+
+		for _, g := range cfg.BuildAll(pkg.Stmts) {
+			name := mangle(pkg.Path, g.Name)
+			if generic, ok := b.generics[name]; ok {
+				generic.graph = g
+				continue
+			}
+			m.Funcs = append(m.Funcs, b.fn(g, name, nil))
+		}
+	}
+
+	// Lowering an instance or a lambda may add others
+	for len(b.instances) > 0 {
+		inst := b.instances[0]
+		b.instances = b.instances[1:]
+		b.pkg, b.globals, b.bindings = inst.pkg, b.consts[inst.pkg], inst.bindings
+		m.Funcs = append(m.Funcs, b.fn(inst.graph, inst.name, inst.captures))
+	}
+	return m, nil
+}
+
+func (b *builder) signature(n *parser.FnDeclStmt) *signature {
+	sig := &signature{params: paramDecls(n.Args)}
+	for _, p := range sig.params {
+		sig.types = append(sig.types, b.typeOf(p.Type))
+	}
+
+	tuple, ok := n.Type.(*parser.TupleType)
+	if !ok {
+		sig.ret, sig.def = b.typeOf(n.Type), b.defined(n.Type)
+		return sig
+	}
+	sig.ret = Void
+	for _, elem := range tuple.Elems {
+		sig.results = append(sig.results, b.typeOf(elem))
+	}
+	return sig
+}
+
+// Returns the name a fn or type of the package at path is lowered to: the
+// path with its separators replaced by dots, followed by the name
+func mangle(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	prefix := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '.'
+	}, path)
+	return prefix + "." + name
+}
+
+func (b *builder) fail(node any, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if tk, ok := node.(*lexer.Token); ok {
+		msg = fmt.Sprintf("line %d column %d: %s", tk.Line, tk.Column, msg)
+	} else if n, ok := node.(interface{ Pos() parser.Loc }); ok && n.Pos().Line > 0 {
+		msg = fmt.Sprintf("line %d column %d: %s", n.Pos().Line, n.Pos().Column, msg)
+	}
+	panic(buildError{fmt.Errorf("%s", msg)})
+}
+
+func (b *builder) unsupported(node any) {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*parser.")
+	b.fail(node, "%s is not supported by the IR", name)
+}
+
+func paramDecls(args *parser.FnArgs) []*parser.VarDeclExpression {
+	decls := []*parser.VarDeclExpression{}
+	if args == nil {
+		return decls
+	}
+	for _, arg := range *args {
+		if decl, ok := arg.(*parser.VarDeclExpression); ok {
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+// Returns the IR type of a type annotation, Void for a missing one
+func (b *builder) typeOf(ann parser.IExpression) Type {
+	switch t := ann.(type) {
+	case nil:
+		return Void
+	case *parser.TypeName:
+		if t.Module == nil && len(t.Args) == 0 {
+			switch name := Type(t.Name.Lexeme); name {
+			case Int, Uint, Char, Bool, Float, String, Void:
+				return name
+			}
+			if bound, ok := b.bindings[t.Name.Lexeme]; ok {
+				return bound
+			}
+		}
+		if b.isResult(t) {
+			return ResultOf(b.typeOf(t.Args[0]), b.typeOf(t.Args[1]))
+		}
+		a, ok := b.aliases[b.typeRef(t)]
+		if ok && len(t.Args) == 0 && a.def.Interface != nil {
+			return Iface
+		}
+		if ok && len(t.Args) == 0 && a.def.Type != nil && len(a.def.TypeParams) == 0 {
+			// The type it defines is resolved from its own package
+			defer func(pkg *Package) { b.pkg = pkg }(b.pkg)
+			b.pkg = a.pkg
+			return b.typeOf(a.def.Type)
+		}
+	case *parser.PointerType:
+		return PointerTo(b.typeOf(t.Elem))
+	case *parser.FnType:
+		params := []Type{}
+		for _, p := range t.Params {
+			params = append(params, b.typeOf(p))
+		}
+		return FnOf(params, b.typeOf(t.Return))
+	case *parser.ChanType:
+		return ChanOf(b.typeOf(t.Elem))
+	}
+	b.fail(ann, "type %s is not supported by the IR", typeName(ann))
+	return Void
+}
+
+// Returns whether a type name refers to the Result type every package
+// starts with, which a package may shadow
+func (b *builder) isResult(t *parser.TypeName) bool {
+	if t.Module != nil || t.Name.Lexeme != "Result" || len(t.Args) != 2 {
+		return false
+	}
+	_, shadowed := b.aliases[b.typeRef(t)]
+	return !shadowed
+}
+
+// Returns the mangled name of the type a type name refers to, an empty one
+// for a module the package doesn't import
+func (b *builder) typeRef(t *parser.TypeName) string {
+	if t.Module == nil {
+		return mangle(b.pkg.Path, t.Name.Lexeme)
+	}
+	if path, ok := b.pkg.Imports[t.Module.Lexeme]; ok {
+		return mangle(path, t.Name.Lexeme)
+	}
+	return ""
+}
+
+// Returns the mangled name of the type defined by definetype a type
+// annotation names, an empty one for the other types
+func (b *builder) defined(ann parser.IExpression) string {
+	t, ok := ann.(*parser.TypeName)
+	if !ok || len(t.Args) > 0 {
+		return ""
+	}
+	if _, ok := b.bindings[t.Name.Lexeme]; ok && t.Module == nil {
+		return ""
+	}
+	name := b.typeRef(t)
+	if _, ok := b.aliases[name]; !ok {
+		return ""
+	}
+	return name
+}
+
+func typeName(ann parser.IExpression) string {
+	if t, ok := ann.(*parser.TypeName); ok {
+		return t.Name.Lexeme
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", ann), "*parser.")
+}
+
+// Evaluates a constant declaration, whose type defaults to int or bool
+func (b *builder) constant(n *parser.ConstDeclStmt) *local {
+	v, err := consteval.Eval(n.Value, func(name *lexer.Token) (consteval.Value, bool) {
+		l := b.lookup(name.Lexeme)
+		if l == nil || l.konst == nil {
+			return consteval.Value{}, false
+		}
+		if l.konst.Typ == Bool {
+			return consteval.Value{Bool: l.konst.Int != 0, IsBool: true}, true
+		}
+		return consteval.Value{Int: bigInt(l.konst)}, true
+	})
+	if err != nil {
+		b.fail(n, "%v", err)
+	}
+
+	t := Int
+	if n.Type != nil {
+		t = b.typeOf(n.Type)
+	}
+	c := BoolConst(v.Bool)
+	if !v.IsBool {
+		c = IntConst(t, v.Int.Int64())
+		if !v.Int.IsInt64() {
+			c.Int = int64(v.Int.Uint64())
+		}
+	}
+	return &local{name: n.Name.Lexeme, typ: c.Typ, konst: c}
+}
+
+// Returns the declaration name refers to in the scopes being resolved
+func (b *builder) lookup(name string) *local {
+	l, _ := b.lookupDepth(name)
+	return l
+}
+
+// Returns the declaration name refers to and the depth of its scope, -1
+// for the constants of the package
+func (b *builder) lookupDepth(name string) (*local, int) {
+	for i := len(b.scopes) - 1; i >= 0; i-- {
+		if l, ok := b.scopes[i][name]; ok {
+			return l, i
+		}
+	}
+	return b.globals[name], -1
+}
+
+// Lowers the fn of a graph to the fn named name, whose signature is known.
+// The fn of a lambda takes pointers to the boxes of the variables it
+// captures before its params.
+func (b *builder) fn(g *cfg.Graph, name string, captures []*local) *Func {
+	fn := g.Fn
+	sig := b.sigs[name]
+	b.f = &Func{Name: name, Ret: sig.ret, Loc: fn.Loc}
+	b.loc = fn.Loc
+	b.locals = map[*lexer.Token]*local{}
+	b.declared = nil
+	b.scopes = []map[string]*local{{}}
+	b.blocks = map[*cfg.Block]*Block{}
+	b.defs = map[*Block]map[*local]Value{}
+	b.sealed = map[*Block]bool{}
+	b.incomplete = map[*Block][]*Instr{}
+	b.phiVars = map[*Instr]*local{}
+	b.lambdaCount = 0
+
+	for _, c := range captures {
+		box := &Param{Name: c.name, Typ: PointerTo(c.typ)}
+		b.scopes[0][c.name] = &local{name: c.name, typ: c.typ, addr: true, boxed: true, slot: box}
+		b.f.Params = append(b.f.Params, box)
+	}
+	params := []*local{}
+	for i, p := range sig.params {
+		if _, ok := p.Type.(*parser.VariadicType); ok {
+			b.fail(p, "variadic params are not supported by the IR")
+		}
+		l := b.declare(p.Name, sig.types[i])
+		l.def = b.defined(p.Type)
+		params = append(params, l)
+		b.f.Params = append(b.f.Params, &Param{Name: l.name, Typ: l.typ})
+	}
+	args := b.f.Params[len(captures):]
+	b.results = nil
+	for i, t := range sig.results {
+		p := &Param{Name: fmt.Sprintf("ret.%d", i), Typ: PointerTo(t)}
+		b.f.Params = append(b.f.Params, p)
+		b.results = append(b.results, p)
+	}
+	b.resolve(fn.Body)
+
+	for _, cb := range g.Blocks {
+		if cb != g.Exit {
+			b.blocks[cb] = b.f.NewBlock()
+		}
+	}
+
+	b.cur = b.f.Entry()
+	b.seal(b.cur)
+	for _, l := range b.declared {
+		if l.addr && !l.boxed {
+			slot := b.f.NewInstr(OpAlloca, PointerTo(l.typ))
+			b.cur.Append(slot)
+			l.slot = slot
+		}
+	}
+	for i, l := range params {
+		if l.boxed {
+			l.slot = b.emit(OpNew, PointerTo(l.typ))
+		}
+		b.assign(l, args[i])
+	}
+
+	preds := map[*cfg.Block]int{}
+	for _, cb := range g.Blocks {
+		if cb == g.Exit {
+			continue
+		}
+		b.cur = b.blocks[cb]
+		b.returned, b.ret = false, nil
+		for _, node := range cb.Nodes {
+			b.stmt(node)
+		}
+		b.terminate(g, cb)
+
+		for _, s := range cb.Succs {
+			preds[s]++
+			if s != g.Exit && preds[s] == len(s.Preds) {
+				b.seal(b.blocks[s])
+			}
+		}
+	}
+
+	// Blocks split off while lowering expressions come last until the
+	// blocks are put back in reverse postorder
+	b.f.Blocks = b.f.ReversePostorder()
+	b.f.Renumber()
+
+	return b.f
+}
@@ -0,0 +1,102 @@
+package ir
+
+import (
+	"fmt"
+	"yal/cfg"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Fn a lambda is lowered to, taking pointers to the variables it captures
+// before its params
+type closure struct {
+	name     string
+	captures []*local
+}
+
+// Lambda being resolved, whose body starts at scope depth
+type lambdaScope struct {
+	depth    int
+	captures []*local
+}
+
+// Resolves the body of a lambda. The variables of the enclosing fn it uses
+// are captured by reference: they live in a box allocated by new where they
+// are declared, which the closure holds a pointer to. Lambdas nested in
+// another one are only lowered along with the fn that one is lowered to.
+func (b *builder) lambda(n *parser.Lambda) {
+	scope := &lambdaScope{depth: len(b.scopes)}
+	b.lambdas = append(b.lambdas, scope)
+	declared, results := b.declared, b.results
+	b.results = nil
+	b.scopes = append(b.scopes, map[string]*local{})
+	for _, p := range paramDecls(n.Args) {
+		b.declare(p.Name, b.typeOf(p.Type)).def = b.defined(p.Type)
+	}
+	b.resolve(n.Body)
+	b.scopes = b.scopes[:len(b.scopes)-1]
+	b.declared, b.results = declared, results
+	b.lambdas = b.lambdas[:len(b.lambdas)-1]
+	if len(b.lambdas) > 0 {
+		return
+	}
+
+	name := fmt.Sprintf("%s.%d", b.f.Name, b.lambdaCount)
+	b.lambdaCount++
+	b.closures[n] = &closure{name: name, captures: scope.captures}
+	sig := &signature{params: paramDecls(n.Args), ret: b.typeOf(n.Type)}
+	for _, p := range sig.params {
+		sig.types = append(sig.types, b.typeOf(p.Type))
+	}
+	b.sigs[name] = sig
+
+	decl := &parser.FnDeclStmt{
+		Loc:  n.Loc,
+		Name: &lexer.Token{Lexeme: "lambda", Line: n.Line, Column: n.Column},
+		Type: n.Type,
+		Args: n.Args,
+		Body: n.Body,
+	}
+	b.instances = append(b.instances, &instance{
+		name:     name,
+		pkg:      b.pkg,
+		graph:    cfg.Build(decl),
+		bindings: b.bindings,
+		captures: scope.captures,
+	})
+}
+
+// Returns the lambda a deferred expression is lowered as, which takes no
+// params and returns nothing
+func (b *builder) deferredLambda(n *parser.DeferStmt) *parser.Lambda {
+	l, ok := b.deferred[n]
+	if !ok {
+		l = &parser.Lambda{Loc: n.Loc, Body: &parser.StatementExpression{Loc: n.Loc, Expr: n.Expr}}
+		b.deferred[n] = l
+	}
+	return l
+}
+
+// Captures l when it is declared outside of the lambda being resolved
+func (b *builder) capture(l *local, depth int) {
+	if len(b.lambdas) == 0 || l.konst != nil || l.fn != "" || depth >= b.lambdas[0].depth {
+		return
+	}
+	l.addr, l.boxed = true, true
+	scope := b.lambdas[0]
+	for _, c := range scope.captures {
+		if c == l {
+			return
+		}
+	}
+	scope.captures = append(scope.captures, l)
+}
+
+// Returns the type of the closure a lambda evaluates to
+func (b *builder) lambdaType(n *parser.Lambda) Type {
+	params := []Type{}
+	for _, p := range paramDecls(n.Args) {
+		params = append(params, b.typeOf(p.Type))
+	}
+	return FnOf(params, b.typeOf(n.Type))
+}
@@ -0,0 +1,68 @@
+package ir
+
+import (
+	"yal/cfg"
+)
+
+// Dominator tree of the blocks of a Func, computed by the cfg package over a
+// mirror of its blocks. It must be computed again once blocks or edges
+// change.
+type DomTree struct {
+	tree      *cfg.DomTree
+	mirror    map[*Block]*cfg.Block
+	blocks    map[*cfg.Block]*Block
+	reachable map[*Block]bool
+}
+
+func (f *Func) Dominators() *DomTree {
+	d := &DomTree{
+		mirror:    map[*Block]*cfg.Block{},
+		blocks:    map[*cfg.Block]*Block{},
+		reachable: map[*Block]bool{},
+	}
+	for _, b := range f.ReversePostorder() {
+		d.reachable[b] = true
+	}
+
+	g := &cfg.Graph{Name: f.Name}
+	for i, b := range f.Blocks {
+		m := &cfg.Block{ID: i}
+		d.mirror[b] = m
+		d.blocks[m] = b
+		g.Blocks = append(g.Blocks, m)
+	}
+	for _, b := range f.Blocks {
+		for _, s := range b.Succs {
+			d.mirror[b].Succs = append(d.mirror[b].Succs, d.mirror[s])
+			d.mirror[s].Preds = append(d.mirror[s].Preds, d.mirror[b])
+		}
+	}
+	g.Entry = d.mirror[f.Entry()]
+	d.tree = cfg.Dominators(g)
+
+	return d
+}
+
+// Returns the immediate dominator of b, nil for the entry and for the blocks
+// that can't be reached from it
+func (d *DomTree) Idom(b *Block) *Block {
+	return d.blocks[d.tree.Idom(d.mirror[b])]
+}
+
+func (d *DomTree) Children(b *Block) []*Block {
+	children := []*Block{}
+	for _, c := range d.tree.Children(d.mirror[b]) {
+		children = append(children, d.blocks[c])
+	}
+	return children
+}
+
+// Returns whether every path from the entry to b goes through a
+func (d *DomTree) Dominates(a *Block, b *Block) bool {
+	return d.tree.Dominates(d.mirror[a], d.mirror[b])
+}
+
+// Returns whether b can be reached from the entry
+func (d *DomTree) Reachable(b *Block) bool {
+	return d.reachable[b]
+}
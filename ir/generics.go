@@ -0,0 +1,118 @@
+package ir
+
+import (
+	"strings"
+	"yal/astutil"
+	"yal/cfg"
+	"yal/parser"
+)
+
+// Generic fn of a package, lowered once for each list of type arguments
+type generic struct {
+	pkg   *Package
+	decl  *parser.FnDeclStmt
+	graph *cfg.Graph
+}
+
+// Instance of a generic fn waiting to be lowered with its type parameters
+// bound to the type arguments it is named after, or lambda waiting to be
+// lowered with the variables it captures
+type instance struct {
+	name     string
+	pkg      *Package
+	graph    *cfg.Graph
+	bindings map[string]Type
+	captures []*local
+}
+
+// Returns the name of the instance of a generic fn a call is to, adding it
+// to the ones to lower the first time it is called
+func (b *builder) instantiate(n *parser.FnCall, name string, g *generic) string {
+	types := b.typeArgs(n, g)
+	syms := []string{}
+	for _, t := range types {
+		syms = append(syms, strings.ReplaceAll(string(t), "*", "ptr."))
+	}
+	inst := name + "." + strings.Join(syms, ".")
+	if _, ok := b.sigs[inst]; ok {
+		return inst
+	}
+
+	bindings := map[string]Type{}
+	for i, param := range g.decl.TypeParams {
+		bindings[param.Name.Lexeme] = types[i]
+	}
+
+	// The signature is resolved from the package of the fn
+	defer func(pkg *Package, bound map[string]Type) { b.pkg, b.bindings = pkg, bound }(b.pkg, b.bindings)
+	b.pkg, b.bindings = g.pkg, bindings
+	b.sigs[inst] = b.signature(g.decl)
+	b.instances = append(b.instances, &instance{name: inst, pkg: g.pkg, graph: g.graph, bindings: bindings})
+	return inst
+}
+
+// Returns the type arguments of a call to a generic fn: the ones the checker
+// recorded, or the ones given and inferred from the args when it didn't run
+func (b *builder) typeArgs(n *parser.FnCall, g *generic) []Type {
+	params := g.decl.TypeParams
+	types := make([]Type, len(params))
+	if len(n.Instance) == len(params) {
+		for i, t := range n.Instance {
+			types[i] = b.typeOf(astutil.Annotation(n.Loc, t))
+		}
+		return types
+	}
+
+	isParam := map[string]bool{}
+	bindings := map[string]Type{}
+	for i, param := range params {
+		isParam[param.Name.Lexeme] = true
+		if i < len(n.TypeArgs) {
+			bindings[param.Name.Lexeme] = b.typeOf(n.TypeArgs[i])
+		}
+	}
+
+	decls := paramDecls(g.decl.Args)
+	for i, arg := range n.Args {
+		if named, ok := arg.(*parser.NamedArg); ok {
+			for j, p := range decls {
+				if p.Name.Lexeme == named.Name.Lexeme {
+					i = j
+				}
+			}
+			arg = named.Value
+		}
+		if i < len(decls) {
+			bind(decls[i].Type, b.exprType(arg), isParam, bindings)
+		}
+	}
+
+	for i, param := range params {
+		t, ok := bindings[param.Name.Lexeme]
+		switch {
+		case !ok:
+			b.fail(n, "cannot infer type parameter %s of %s", param.Name.Lexeme, g.decl.Name.Lexeme)
+		case t == "":
+			// Only integer constants were passed for it
+			t = Int
+		}
+		types[i] = t
+	}
+	return types
+}
+
+// Binds the type parameters found in the annotation of a param by matching
+// it against the type of the arg passed for it, integer constants binding
+// them to an empty type that any other arg overrides
+func bind(ann parser.IExpression, t Type, isParam map[string]bool, bindings map[string]Type) {
+	switch a := ann.(type) {
+	case *parser.TypeName:
+		if a.Module == nil && isParam[a.Name.Lexeme] && bindings[a.Name.Lexeme] == "" {
+			bindings[a.Name.Lexeme] = t
+		}
+	case *parser.PointerType:
+		if t.IsPointer() {
+			bind(a.Elem, t.Elem(), isParam, bindings)
+		}
+	}
+}
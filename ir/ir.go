@@ -0,0 +1,714 @@
+package ir
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"yal/parser"
+)
+
+// Types are named as in yal: int, uint, char, bool, float, string and void,
+// with pointers written *T, fn values fn(P, ...): R and channels chan<T>. int and uint are 64
+// bits wide, char is a byte. Values of every interface type are of type
+// iface, pairing the value they hold with the method table of its type.
+// Values of Result<T, E> are of type result<T, E>, holding either a value
+// of type T or an error of type E.
+type Type string
+
+const (
+	Int    Type = "int"
+	Uint   Type = "uint"
+	Char   Type = "char"
+	Bool   Type = "bool"
+	Float  Type = "float"
+	String Type = "string"
+	Void   Type = "void"
+	Iface  Type = "iface"
+)
+
+func PointerTo(t Type) Type {
+	return "*" + t
+}
+
+func (t Type) IsPointer() bool {
+	return strings.HasPrefix(string(t), "*")
+}
+
+// Returns the type a pointer type points to, or the type of the values a
+// channel type carries
+func (t Type) Elem() Type {
+	if t.IsChan() {
+		return t[len("chan<") : len(t)-1]
+	}
+	return t[1:]
+}
+
+// Returns the type of the channels carrying values of type t
+func ChanOf(t Type) Type {
+	return "chan<" + t + ">"
+}
+
+func (t Type) IsChan() bool {
+	return strings.HasPrefix(string(t), "chan<")
+}
+
+// Returns the type of the results holding a value of type value or an error
+// of type err
+func ResultOf(value Type, err Type) Type {
+	return "result<" + value + ", " + err + ">"
+}
+
+func (t Type) IsResult() bool {
+	return strings.HasPrefix(string(t), "result<")
+}
+
+// Returns the type of the value and the type of the error a result type
+// holds
+func (t Type) Outcomes() (Type, Type) {
+	depth := 0
+	for i := len("result<"); i < len(t); i++ {
+		switch t[i] {
+		case '(', '<':
+			depth++
+		case ')', '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				return t[len("result<"):i], Type(strings.TrimSpace(string(t[i+1 : len(t)-1])))
+			}
+		}
+	}
+	return Void, Void
+}
+
+// Returns the type of the fn values taking params and returning ret
+func FnOf(params []Type, ret Type) Type {
+	s := []string{}
+	for _, p := range params {
+		s = append(s, string(p))
+	}
+	return Type("fn(" + strings.Join(s, ", ") + "): " + string(ret))
+}
+
+func (t Type) IsFn() bool {
+	return strings.HasPrefix(string(t), "fn(")
+}
+
+// Returns the param types and the return type of a fn type
+func (t Type) Signature() ([]Type, Type) {
+	params := []Type{}
+	depth, start := 0, len("fn(")
+	for i := start; i < len(t); i++ {
+		switch t[i] {
+		case '(', '<':
+			depth++
+		case '>':
+			depth--
+		case ',', ')':
+			if depth > 0 {
+				if t[i] == ')' {
+					depth--
+				}
+				continue
+			}
+			if p := strings.TrimSpace(string(t[start:i])); p != "" {
+				params = append(params, Type(p))
+			}
+			start = i + 1
+			if t[i] == ')' {
+				return params, Type(strings.TrimPrefix(string(t[i+1:]), ": "))
+			}
+		}
+	}
+	return params, Void
+}
+
+func (t Type) IsInteger() bool {
+	return t == Int || t == Uint || t == Char
+}
+
+// Returns whether the integer type t is signed
+func (t Type) IsSigned() bool {
+	return t == Int
+}
+
+// Value used as an instruction operand: a constant, a param or the result
+// of an instruction
+type Value interface {
+	Type() Type
+	String() string
+}
+
+// Constant operand. Integers and bools are held by Int, bools as 0 or 1 and
+// uints as their bits. Pointer, fn, channel and iface constants are always
+// NULL, as are result constants, which stand for the zero result: an error
+// holding the zero value of its type.
+type Const struct {
+	Typ   Type
+	Int   int64
+	Float float64
+	Str   string
+}
+
+func IntConst(t Type, v int64) *Const {
+	return &Const{Typ: t, Int: v}
+}
+
+func BoolConst(v bool) *Const {
+	if v {
+		return &Const{Typ: Bool, Int: 1}
+	}
+	return &Const{Typ: Bool}
+}
+
+// Returns the value variables of type t hold before being assigned
+func Zero(t Type) *Const {
+	return &Const{Typ: t}
+}
+
+func (c *Const) Type() Type {
+	return c.Typ
+}
+
+// Returns whether c holds the same constant as o
+func (c *Const) Equal(o *Const) bool {
+	return c.Typ == o.Typ && c.Int == o.Int && c.Str == o.Str &&
+		math.Float64bits(c.Float) == math.Float64bits(o.Float)
+}
+
+// Constants are rendered so that their type can be told from them, except
+// for NULL, whose type is given by the instruction using it
+func (c *Const) String() string {
+	switch {
+	case c.Typ == Uint:
+		return strconv.FormatUint(uint64(c.Int), 10) + "u"
+	case c.Typ == Char:
+		return strconv.FormatInt(c.Int, 10) + "c"
+	case c.Typ == Bool:
+		return strconv.FormatBool(c.Int != 0)
+	case c.Typ == Float:
+		s := strconv.FormatFloat(c.Float, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eInN") {
+			s += ".0"
+		}
+		return s
+	case c.Typ == String:
+		return strconv.Quote(c.Str)
+	case c.Typ.IsPointer() || c.Typ.IsFn() || c.Typ.IsChan() || c.Typ == Iface || c.Typ.IsResult():
+		return "null"
+	}
+	return strconv.FormatInt(c.Int, 10)
+}
+
+type Param struct {
+	Name string
+	Typ  Type
+}
+
+func (p *Param) Type() Type {
+	return p.Typ
+}
+
+func (p *Param) String() string {
+	return "%" + p.Name
+}
+
+type Op int
+
+const (
+	OpAdd Op = iota
+	OpSub
+	OpMul
+	OpDiv
+	OpRem
+	OpAnd
+	OpOr
+	OpXor
+	OpShl
+	OpShr
+	OpNeg
+	OpNot
+
+	OpEq
+	OpNe
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+
+	OpAlloca
+	OpNew
+	OpLoad
+	OpStore
+	OpCall
+	OpClosure
+	OpApply
+	OpIface
+	OpMethod
+	OpOk
+	OpErr
+	OpIsOk
+	OpValue
+	OpError
+	OpDefer
+	OpRecover
+	OpSpawn
+	OpChan
+	OpSend
+	OpRecv
+	OpPhi
+
+	OpJump
+	OpBranch
+	OpRet
+	OpUnreachable
+)
+
+var opNames = [...]string{
+	OpAdd:         "add",
+	OpSub:         "sub",
+	OpMul:         "mul",
+	OpDiv:         "div",
+	OpRem:         "rem",
+	OpAnd:         "and",
+	OpOr:          "or",
+	OpXor:         "xor",
+	OpShl:         "shl",
+	OpShr:         "shr",
+	OpNeg:         "neg",
+	OpNot:         "not",
+	OpEq:          "eq",
+	OpNe:          "ne",
+	OpLt:          "lt",
+	OpLe:          "le",
+	OpGt:          "gt",
+	OpGe:          "ge",
+	OpAlloca:      "alloca",
+	OpNew:         "new",
+	OpLoad:        "load",
+	OpStore:       "store",
+	OpCall:        "call",
+	OpClosure:     "closure",
+	OpApply:       "apply",
+	OpIface:       "iface",
+	OpMethod:      "method",
+	OpOk:          "ok",
+	OpErr:         "err",
+	OpIsOk:        "isok",
+	OpValue:       "value",
+	OpError:       "error",
+	OpRecover:     "recover",
+	OpDefer:       "defer",
+	OpSpawn:       "spawn",
+	OpChan:        "chan",
+	OpSend:        "send",
+	OpRecv:        "recv",
+	OpPhi:         "phi",
+	OpJump:        "jmp",
+	OpBranch:      "br",
+	OpRet:         "ret",
+	OpUnreachable: "unreachable",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+func (op Op) IsBinary() bool {
+	return op <= OpShr
+}
+
+func (op Op) IsUnary() bool {
+	return op == OpNeg || op == OpNot
+}
+
+func (op Op) IsCompare() bool {
+	return op >= OpEq && op <= OpGe
+}
+
+// Terminators end a block, jumping to its successors or leaving the fn
+func (op Op) IsTerminator() bool {
+	return op >= OpJump
+}
+
+// Instruction of a Block, which is a Value when its Typ isn't Void.
+//
+// Binary and unary instructions operate on Args of their own type while
+// comparisons yield a bool. alloca reserves a stack slot of type Typ.Elem(),
+// new allocates one that lives as long as it is used, load reads Args[0],
+// store writes Args[1] to Args[0] and call calls the fn named Callee. A Tail
+// call replaces the frame of the caller with the one of the callee, which is
+// only allowed when the caller returns its result right away. closure makes
+// a fn value of type Typ calling Callee with Args, the values it captures,
+// before its own args, and apply calls the fn value Args[0] with the rest of
+// its Args. iface makes an iface holding Args[0] along with the method table
+// of the type named Callee, the fns of the module named Callee.m for each of
+// its methods m, and method makes a fn value of type Typ calling the method
+// named Callee in the table of the iface Args[0] with the value it holds
+// before its own args. ok and err make a result of type Typ holding the
+// value or the error Args[0], isok tells whether the result Args[0] holds a
+// value, and value and error give the value or the error it holds, the zero
+// value of their type when it holds the other one. defer calls Callee with
+// Args once the fn returns, or once it stops on a runtime error, the calls
+// it deferred running in the reverse order. recover, run by a call deferred
+// by a fn stopping on a panic or by the fns it calls, stops the panic, the
+// fn then returning the zero value of its type: it stores the message of
+// the panic and true through Args[0] and Args[1], or an empty string and
+// false when there is none. spawn calls Callee with Args in a new task, which runs along with
+// the others. chan makes a channel of type Typ buffering up to Args[0]
+// values, send sends Args[1] to the channel Args[0], blocking while its
+// buffer is full or, when it has none, until the value is received, and
+// recv receives a value from Args[0], blocking until there is one. The Args of a phi are the values it takes when coming from each of
+// the Preds of its block, in the same order.
+//
+// br jumps to the first successor of its block when Args[0] is true and to
+// the second one otherwise, jmp to its only successor. ret returns its only
+// arg, if any.
+//
+// Loc is the position of the node an instruction was lowered from, the zero
+// Loc for the ones added by passes or parsed from text.
+type Instr struct {
+	ID     int
+	Op     Op
+	Typ    Type
+	Args   []Value
+	Callee string
+	Tail   bool
+	Block  *Block
+	Loc    parser.Loc
+}
+
+func (i *Instr) Type() Type {
+	return i.Typ
+}
+
+// Returns whether call i is directly followed by a ret of its result, or by
+// a plain ret for a call to a void fn
+func (i *Instr) InTailPosition() bool {
+	instrs := i.Block.Instrs
+	for j, instr := range instrs[:len(instrs)-1] {
+		if instr != i {
+			continue
+		}
+		ret := instrs[j+1]
+		if ret.Op != OpRet {
+			return false
+		}
+		if i.Typ == Void {
+			return len(ret.Args) == 0
+		}
+		return len(ret.Args) == 1 && ret.Args[0] == i
+	}
+	return false
+}
+
+func (i *Instr) String() string {
+	return "%" + strconv.Itoa(i.ID)
+}
+
+type Block struct {
+	ID     int
+	Instrs []*Instr
+	Preds  []*Block
+	Succs  []*Block
+}
+
+func (b *Block) String() string {
+	return "b" + strconv.Itoa(b.ID)
+}
+
+// Returns the instruction ending b, nil while it is being built
+func (b *Block) Terminator() *Instr {
+	if len(b.Instrs) == 0 || !b.Instrs[len(b.Instrs)-1].Op.IsTerminator() {
+		return nil
+	}
+	return b.Instrs[len(b.Instrs)-1]
+}
+
+// Returns the phis of b, which come before its other instructions
+func (b *Block) Phis() []*Instr {
+	n := 0
+	for n < len(b.Instrs) && b.Instrs[n].Op == OpPhi {
+		n++
+	}
+	return b.Instrs[:n]
+}
+
+func (b *Block) Append(i *Instr) {
+	i.Block = b
+	b.Instrs = append(b.Instrs, i)
+}
+
+// Inserts i before the instruction at index at
+func (b *Block) Insert(at int, i *Instr) {
+	i.Block = b
+	b.Instrs = append(b.Instrs, nil)
+	copy(b.Instrs[at+1:], b.Instrs[at:])
+	b.Instrs[at] = i
+}
+
+func (b *Block) Remove(i *Instr) {
+	for j, instr := range b.Instrs {
+		if instr == i {
+			b.Instrs = append(b.Instrs[:j], b.Instrs[j+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the index of pred in the Preds of b, which is the index of the
+// phi args coming from it
+func (b *Block) PredIndex(pred *Block) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+	return -1
+}
+
+func AddEdge(from *Block, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// Removes an edge from from to to, along with the phi args of to coming
+// through it
+func RemoveEdge(from *Block, to *Block) {
+	for i, s := range from.Succs {
+		if s == to {
+			from.Succs = append(from.Succs[:i], from.Succs[i+1:]...)
+			break
+		}
+	}
+	at := to.PredIndex(from)
+	if at < 0 {
+		return
+	}
+	to.Preds = append(to.Preds[:at], to.Preds[at+1:]...)
+	for _, phi := range to.Phis() {
+		phi.Args = append(phi.Args[:at], phi.Args[at+1:]...)
+	}
+}
+
+// Fn whose first block is its entry. Blocks and instructions are numbered
+// in creation order, their numbers being kept when others are removed.
+// Loc is the position of its declaration.
+type Func struct {
+	Name      string
+	Params    []*Param
+	Ret       Type
+	Blocks    []*Block
+	Loc       parser.Loc
+	nextID    int
+	nextBlock int
+}
+
+func (f *Func) Entry() *Block {
+	return f.Blocks[0]
+}
+
+func (f *Func) NewBlock() *Block {
+	b := &Block{ID: f.nextBlock}
+	f.nextBlock++
+	f.Blocks = append(f.Blocks, b)
+	return b
+}
+
+// Returns a new instruction, left for the caller to add to a block
+func (f *Func) NewInstr(op Op, typ Type, args ...Value) *Instr {
+	i := &Instr{ID: f.nextID, Op: op, Typ: typ, Args: args}
+	f.nextID++
+	return i
+}
+
+// Replaces every use of old by v
+func (f *Func) ReplaceUses(old Value, v Value) {
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			for j, arg := range i.Args {
+				if arg == old {
+					i.Args[j] = v
+				}
+			}
+		}
+	}
+}
+
+// Numbers the blocks of f and the values it defines in order, the
+// instructions without a value coming after them
+func (f *Func) Renumber() {
+	f.nextID, f.nextBlock = 0, len(f.Blocks)
+	for i, b := range f.Blocks {
+		b.ID = i
+		for _, i := range b.Instrs {
+			if i.Typ != Void {
+				i.ID = f.nextID
+				f.nextID++
+			}
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Typ == Void {
+				i.ID = f.nextID
+				f.nextID++
+			}
+		}
+	}
+}
+
+// Returns whether f uses fn values or allocates the variables they capture,
+// which only the vm runs so far
+func (f *Func) HasClosures() bool {
+	isFn := func(t Type) bool {
+		return strings.Contains(string(t), "fn(")
+	}
+	if isFn(f.Ret) {
+		return true
+	}
+	for _, p := range f.Params {
+		if isFn(p.Typ) {
+			return true
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == OpNew || i.Op == OpClosure || i.Op == OpApply || isFn(i.Typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether f spawns tasks or uses channels, which only the vm runs so
+// far
+func (f *Func) HasTasks() bool {
+	isChan := func(t Type) bool {
+		return strings.Contains(string(t), "chan<")
+	}
+	if isChan(f.Ret) {
+		return true
+	}
+	for _, p := range f.Params {
+		if isChan(p.Typ) {
+			return true
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == OpSpawn || i.Op == OpChan || i.Op == OpSend || i.Op == OpRecv || isChan(i.Typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether f uses interface values, which only the vm runs so far
+func (f *Func) HasInterfaces() bool {
+	isIface := func(t Type) bool {
+		return strings.TrimLeft(string(t), "*") == string(Iface)
+	}
+	if isIface(f.Ret) {
+		return true
+	}
+	for _, p := range f.Params {
+		if isIface(p.Typ) {
+			return true
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == OpIface || i.Op == OpMethod || isIface(i.Typ) {
+				return true
+			}
+			for _, arg := range i.Args {
+				if isIface(arg.Type()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether f uses results or recovers from panics, which only the vm
+// runs so far
+func (f *Func) HasResults() bool {
+	isResult := func(t Type) bool {
+		return strings.Contains(string(t), "result<")
+	}
+	if isResult(f.Ret) {
+		return true
+	}
+	for _, p := range f.Params {
+		if isResult(p.Typ) {
+			return true
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == OpRecover || isResult(i.Typ) {
+				return true
+			}
+			for _, arg := range i.Args {
+				if isResult(arg.Type()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether f defers calls, which only the vm runs so far
+func (f *Func) HasDefers() bool {
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == OpDefer {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type Module struct {
+	Funcs []*Func
+}
+
+// Returns the fn of m named name, nil if there is none
+func (m *Module) Func(name string) *Func {
+	for _, f := range m.Funcs {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the blocks of f reachable from its entry, each one before all of
+// its successors except for the ones reached through a back edge
+func (f *Func) ReversePostorder() []*Block {
+	order := []*Block{}
+	seen := map[*Block]bool{}
+
+	var visit func(*Block)
+	visit = func(b *Block) {
+		seen[b] = true
+		for i := len(b.Succs) - 1; i >= 0; i-- {
+			if !seen[b.Succs[i]] {
+				visit(b.Succs[i])
+			}
+		}
+		order = append(order, b)
+	}
+	visit(f.Entry())
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
@@ -0,0 +1,809 @@
+package ir_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"yal/ir"
+	"yal/lexer"
+	"yal/parser"
+)
+
+func parse(t *testing.T, src string) []parser.IStatement {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parser.NewParser(ctx, tokens).Run()
+}
+
+func build(t *testing.T, src string) (*ir.Module, error) {
+	return ir.Build(parse(t, src))
+}
+
+// Builds src and checks that the verified module prints as want
+func expectIR(t *testing.T, src string, want string) {
+	m, err := build(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range ir.Verify(m) {
+		t.Errorf("unexpected verifier error: %v\n", err)
+	}
+	if got := m.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s\n", want, got)
+	}
+}
+
+func expectBuildError(t *testing.T, src string, want string) {
+	_, err := build(t, src)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected an error containing %q, got %v\n", want, err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	t.Run("Test if expression", func(t *testing.T) {
+		expectIR(t, `fn max(a: int, b: int) : int { if (a > b) { a } else { b } }`, `fn max(%a: int, %b: int): int {
+b0:
+  %0 = gt int %a, %b
+  br %0, b1, b2
+b1:
+  ret int %a
+b2:
+  ret int %b
+}
+`)
+	})
+
+	t.Run("Test loop phis", func(t *testing.T) {
+		expectIR(t, `fn fib(n: int) : int {
+  let a = 0;
+  let b = 1;
+  for (let i = 0; i < n; ++i) {
+    let t = a + b;
+    a = b;
+    b = t;
+  }
+  return a;
+}`, `fn fib(%n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%5, b3]
+  %1 = phi int [0, b0], [%2, b3]
+  %2 = phi int [1, b0], [%4, b3]
+  %3 = lt int %0, %n
+  br %3, b2, b4
+b2:
+  %4 = add int %1, %2
+  jmp b3
+b3:
+  %5 = add int %0, 1
+  jmp b1
+b4:
+  ret int %1
+}
+`)
+	})
+
+	t.Run("Test shadowed variables", func(t *testing.T) {
+		expectIR(t, `fn f(a: int) : int {
+  let x = a;
+  if (a > 0) {
+    let x = 2;
+    x = x + 1;
+  }
+  return x;
+}`, `fn f(%a: int): int {
+b0:
+  %0 = gt int %a, 0
+  br %0, b1, b2
+b1:
+  %1 = add int 2, 1
+  jmp b2
+b2:
+  ret int %a
+}
+`)
+	})
+
+	t.Run("Test address taken variables", func(t *testing.T) {
+		expectIR(t, `fn f() : int {
+  let x = 1;
+  let p = &x;
+  *p = 5;
+  return x;
+}`, `fn f(): int {
+b0:
+  %0 = alloca int
+  store int %0, 1
+  store int %0, 5
+  %1 = load int %0
+  ret int %1
+}
+`)
+	})
+
+	t.Run("Test continue", func(t *testing.T) {
+		expectIR(t, `fn sum(n: int) : int {
+  let s = 0;
+  let i = 0;
+  while (i < n) {
+    if (i % 2 == 0) { i += 1; continue; }
+    s += i;
+    i++;
+  }
+  return s;
+}`, `fn sum(%n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%5, b3], [%7, b4]
+  %1 = phi int [0, b0], [%1, b3], [%6, b4]
+  %2 = lt int %0, %n
+  br %2, b2, b5
+b2:
+  %3 = rem int %0, 2
+  %4 = eq int %3, 0
+  br %4, b3, b4
+b3:
+  %5 = add int %0, 1
+  jmp b1
+b4:
+  %6 = add int %1, %0
+  %7 = add int %0, 1
+  jmp b1
+b5:
+  ret int %1
+}
+`)
+	})
+
+	t.Run("Test calls and short circuit values", func(t *testing.T) {
+		expectIR(t, `fn g() : int { return 1; }
+fn main() : void {
+  const k = 3;
+  print(k, 1.5, "hi", true && g() > 0);
+}`, `fn g(): int {
+b0:
+  ret int 1
+}
+
+fn main(): void {
+b0:
+  br true, b1, b2
+b1:
+  %0 = call int @g()
+  %1 = gt int %0, 0
+  jmp b2
+b2:
+  %2 = phi bool [false, b0], [%1, b1]
+  call void @print(3, 1.5, "hi", %2)
+  ret
+}
+`)
+	})
+
+	t.Run("Test generic fns", func(t *testing.T) {
+		expectIR(t, `fn max<T>(a: T, b: T) : T { if (a > b) { a } else { b } }
+fn main() : void {
+  let x: uint = 3;
+  print(max(x, 1), max<int>(1, 2), max(1, 2));
+}`, `fn main(): void {
+b0:
+  %0 = call uint @max.uint(3u, 1u)
+  %1 = call int @max.int(1, 2)
+  %2 = call int @max.int(1, 2)
+  call void @print(%0, %1, %2)
+  ret
+}
+
+fn max.uint(%a: uint, %b: uint): uint {
+b0:
+  %0 = gt uint %a, %b
+  br %0, b1, b2
+b1:
+  ret uint %a
+b2:
+  ret uint %b
+}
+
+fn max.int(%a: int, %b: int): int {
+b0:
+  %0 = gt int %a, %b
+  br %0, b1, b2
+b1:
+  ret int %a
+b2:
+  ret int %b
+}
+`)
+		expectBuildError(t, `fn zero<T>() : T { 0 } fn main() : void { zero(); }`, "cannot infer type parameter T of zero")
+	})
+
+	t.Run("Test multiple return values", func(t *testing.T) {
+		expectIR(t, `fn divmod(a: int, b: int) : (int, int) { return a / b, a % b; }
+fn main() : int {
+  let (q, _) = divmod(7, 2);
+  q
+}`, `fn divmod(%a: int, %b: int, %ret.0: *int, %ret.1: *int): void {
+b0:
+  %0 = div int %a, %b
+  %1 = rem int %a, %b
+  store int %ret.0, %0
+  store int %ret.1, %1
+  ret
+}
+
+fn main(): int {
+b0:
+  %0 = alloca int
+  %1 = alloca int
+  call void @divmod(7, 2, %0, %1)
+  %2 = load int %0
+  %3 = load int %1
+  ret int %2
+}
+`)
+		expectBuildError(t, `fn f() : (int, int) { return 1, 2; } fn main() : void { let (a, b, c) = f(); }`, "cannot destructure 2 values into 3 variables")
+	})
+
+	t.Run("Test closures", func(t *testing.T) {
+		expectIR(t, `fn adder(n: int) : fn(int): int {
+  (x: int) : int => x + n
+}
+fn main() : int {
+  let count = 0;
+  let inc = () : void => { count += 1; };
+  inc();
+  adder(count)(2)
+}`, `fn adder(%n: int): fn(int): int {
+b0:
+  %0 = new int
+  store int %0, %n
+  %1 = closure fn(int): int @adder.0(%0)
+  ret fn(int): int %1
+}
+
+fn main(): int {
+b0:
+  %0 = new int
+  store int %0, 0
+  %1 = closure fn(): void @main.0(%0)
+  apply void %1()
+  %2 = load int %0
+  %3 = call fn(int): int @adder(%2)
+  %4 = apply int %3(2)
+  ret int %4
+}
+
+fn adder.0(%n: *int, %x: int): int {
+b0:
+  %0 = load int %n
+  %1 = add int %x, %0
+  ret int %1
+}
+
+fn main.0(%count: *int): void {
+b0:
+  %0 = load int %count
+  %1 = add int %0, 1
+  store int %count, %1
+  ret
+}
+`)
+		expectBuildError(t, `fn id<T>(v: T) : T { v } fn main() : void { let f = id; }`, "generic fn values are not supported by the IR")
+		expectBuildError(t, `fn main() : void { let f = 1; f(); }`, "cannot call a value of type int")
+	})
+
+	t.Run("Test methods and interfaces", func(t *testing.T) {
+		expectIR(t, `definetype Shape = interface {
+  fn area(self) : int;
+};
+definetype Square = int;
+impl Square {
+  fn area(self) : int { self * self }
+}
+fn total(a: Shape, b: Shape) : int {
+  a.area() + b.area()
+}
+fn main() : int {
+  let s: Square = 3;
+  total(s, s) + s.area()
+}`, `fn Square.area(%self: int): int {
+b0:
+  %0 = mul int %self, %self
+  ret int %0
+}
+
+fn total(%a: iface, %b: iface): int {
+b0:
+  %0 = method fn(): int @area(%a)
+  %1 = apply int %0()
+  %2 = method fn(): int @area(%b)
+  %3 = apply int %2()
+  %4 = add int %1, %3
+  ret int %4
+}
+
+fn main(): int {
+b0:
+  %0 = iface int @Square(3)
+  %1 = iface int @Square(3)
+  %2 = call int @total(%0, %1)
+  %3 = call int @Square.area(3)
+  %4 = add int %2, %3
+  ret int %4
+}
+`)
+		expectBuildError(t, `definetype N = int; impl N { fn get<T>(self) : int { 0 } }`, "generic methods are not supported by the IR")
+	})
+
+	t.Run("Test defer", func(t *testing.T) {
+		expectIR(t, `fn main() : int {
+  let n = 1;
+  defer print(n);
+  n = 2;
+  n
+}`, `fn main(): int {
+b0:
+  %0 = new int
+  store int %0, 1
+  defer @main.0(%0)
+  store int %0, 2
+  %1 = load int %0
+  ret int %1
+}
+
+fn main.0(%n: *int): void {
+b0:
+  %0 = load int %n
+  call void @print(%0)
+  ret
+}
+`)
+	})
+
+	t.Run("Test channels", func(t *testing.T) {
+		expectIR(t, `fn producer(ch: chan<int>, n: int) : void {
+  ch <- n;
+}
+
+fn main() : int {
+  let ch = chan<int>(1);
+  spawn producer(ch, 2);
+  <- ch
+}`, `fn producer(%ch: chan<int>, %n: int): void {
+b0:
+  send int %ch, %n
+  ret
+}
+
+fn main(): int {
+b0:
+  %0 = chan int 1
+  spawn @producer(%0, 2)
+  %1 = recv int %0
+  ret int %1
+}
+`)
+		expectBuildError(t, `fn main() : void { spawn print(1); }`, "only fns of the package can be spawned by the IR")
+	})
+
+	t.Run("Test results", func(t *testing.T) {
+		expectIR(t, `fn checked(a: int, b: int) : Result<int, string> {
+  if (b == 0) { return Err("division by zero"); }
+  Ok(a / b)
+}
+
+fn ratio(a: int, b: int) : Result<int, string> {
+  let q = checked(a, b)?;
+  match (checked(q, 2)) {
+    Ok(h) => Ok(q + h),
+    _ => Err("odd")
+  }
+}`, `fn checked(%a: int, %b: int): result<int, string> {
+b0:
+  %0 = eq int %b, 0
+  br %0, b1, b2
+b1:
+  %1 = err result<int, string> "division by zero"
+  ret result<int, string> %1
+b2:
+  %2 = div int %a, %b
+  %3 = ok result<int, string> %2
+  ret result<int, string> %3
+}
+
+fn ratio(%a: int, %b: int): result<int, string> {
+b0:
+  %0 = call result<int, string> @checked(%a, %b)
+  %1 = isok result<int, string> %0
+  br %1, b1, b5
+b1:
+  %2 = value result<int, string> %0
+  %3 = call result<int, string> @checked(%2, 2)
+  %4 = isok result<int, string> %3
+  br %4, b2, b3
+b2:
+  %5 = value result<int, string> %3
+  %6 = add int %2, %5
+  %7 = ok result<int, string> %6
+  jmp b4
+b3:
+  %8 = err result<int, string> "odd"
+  jmp b4
+b4:
+  %9 = phi result<int, string> [%7, b2], [%8, b3]
+  ret result<int, string> %9
+b5:
+  %10 = error result<int, string> %0
+  %11 = err result<int, string> %10
+  ret result<int, string> %11
+}
+`)
+		expectBuildError(t, `fn f() : int { let r = Ok(1); 0 }`, "Ok used where the type of its Result isn't known")
+		expectBuildError(t, `fn f(r: Result<int, string>) : int { r? }`, "? used in a fn returning int instead of a Result")
+		expectBuildError(t, `fn f(n: int) : Result<int, string> { n? }`, "? applied to a value of type int instead of a Result")
+		expectBuildError(t, `fn f(r: Result<int, string>) : int { match (r) { Ok(v) => v } }`, "match on a Result without an arm for Err")
+	})
+
+	t.Run("Test recover", func(t *testing.T) {
+		expectIR(t, `fn report() : string {
+  let (msg, ok) = recover();
+  if (ok) { msg } else { "none" }
+}`, `fn report(): string {
+b0:
+  %0 = alloca string
+  %1 = alloca bool
+  recover %0, %1
+  %2 = load string %0
+  %3 = load bool %1
+  br %3, b1, b2
+b1:
+  ret string %2
+b2:
+  ret string "none"
+}
+`)
+	})
+
+	t.Run("Test unsupported constructs", func(t *testing.T) {
+		expectBuildError(t, `fn f(a: [4]int) : int { return 0; }`, "is not supported by the IR")
+		expectBuildError(t, `fn f() : string { return "a" + "b"; }`, "not supported by the IR")
+	})
+
+	t.Run("Test packages", func(t *testing.T) {
+		m, err := ir.BuildProgram([]*ir.Package{
+			{
+				Path:  "lib/geo",
+				Stmts: parse(t, `pub definetype Meters = int; pub fn area(r: Meters) : Meters { r * r }`),
+			},
+			{
+				Stmts:   parse(t, `import "lib/geo"; fn area(r: geo.Meters) : int { geo.area(r) + 1 } fn main() : int { area(2) }`),
+				Imports: map[string]string{"geo": "lib/geo"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `fn lib.geo.area(%r: int): int {
+b0:
+  %0 = mul int %r, %r
+  ret int %0
+}
+
+fn area(%r: int): int {
+b0:
+  %0 = call int @lib.geo.area(%r)
+  %1 = add int %0, 1
+  ret int %1
+}
+
+fn main(): int {
+b0:
+  %0 = call int @area(2)
+  ret int %0
+}
+`
+		if got := m.String(); got != want {
+			t.Errorf("expected\n%s\ngot\n%s\n", want, got)
+		}
+		for _, err := range ir.Verify(m) {
+			t.Errorf("unexpected verifier error: %v\n", err)
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	src := `fn count(%n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%2, b2] ; loop counter
+  %1 = lt int %0, %n
+  br %1, b2, b3
+b2:
+  %2 = add int %0, 1
+  jmp b1
+b3:
+  call void @print(%0, 2u, 3c, -1.5, "a\"b")
+  ret int %0
+}
+
+fn deref(%p: *int): int {
+b0:
+  %0 = eq *int %p, null
+  br %0, b1, b2
+b1:
+  unreachable
+b2:
+  %1 = load int %p
+  %2 = tail call int @count(%1)
+  ret int %2
+}
+
+fn area(%s: iface): int {
+b0:
+  %0 = eq iface %s, null
+  %1 = method fn(int): int @scaled(%s)
+  %2 = apply int %1(2)
+  %3 = iface int @Square(%2)
+  ret int %2
+}
+
+fn relay(%in: chan<int>, %out: chan<chan<int>>): void {
+b0:
+  %0 = eq chan<int> %in, null
+  %1 = recv int %in
+  %2 = chan int 0
+  spawn @relay(%2, %out)
+  send chan<int> %out, %2
+  send int %2, %1
+  ret
+}
+
+fn half(%n: int, %r: result<*int, string>): result<int, string> {
+b0:
+  %0 = alloca string
+  %1 = alloca bool
+  recover %0, %1
+  %2 = isok result<*int, string> %r
+  br %2, b1, b2
+b1:
+  %3 = value result<*int, string> %r
+  %4 = ok result<int, string> %n
+  ret result<int, string> %4
+b2:
+  %5 = error result<*int, string> %r
+  %6 = err result<int, string> %5
+  ret result<int, string> null
+}
+`
+
+	t.Run("Test round trip", func(t *testing.T) {
+		m, err := ir.Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, err := range ir.Verify(m) {
+			t.Errorf("unexpected verifier error: %v\n", err)
+		}
+		want := strings.Replace(src, " ; loop counter", "", 1)
+		if got := m.String(); got != want {
+			t.Errorf("expected\n%s\ngot\n%s\n", want, got)
+		}
+	})
+
+	t.Run("Test phi args follow the predecessors", func(t *testing.T) {
+		m, err := ir.Parse(`fn f(%c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  jmp b3
+b2:
+  jmp b3
+b3:
+  %0 = phi int [1, b2], [2, b1]
+  %1 = phi int [3, b1], [4, b2]
+  ret int %1
+}
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b3 := m.Funcs[0].Blocks[3]
+		if b3.Preds[0].ID != 2 || b3.Instrs[1].Args[0].String() != "4" {
+			t.Errorf("expected the args of both phis to follow the order of the first one, got %s\n", m)
+		}
+	})
+
+	t.Run("Test errors", func(t *testing.T) {
+		tests := map[string]string{
+			"fn f(): int {\n  ret int 0\n}\n":                           "outside of a block",
+			"fn f(): int {\nb0:\n  jmp b1\n}\n":                         "unknown block b1",
+			"fn f(): int {\nb0:\n  ret int %0\n}\n":                     "unknown value %0",
+			"fn f(): int {\nb0:\n  %0 = frob int 1\n}\n":                "unknown instruction frob",
+			"fn f(): list {\nb0:\n  ret\n}\n":                           "unknown type list",
+			"fn f(): int {\nb0:\n  add int 1, 2\n}\n":                   "must be named",
+			"fn f(): void {\nb0:\n  ret\n":                              "missing }",
+			"fn f(): void {\nb0:\n  ret\n  ret\n}\n":                    "after the terminator",
+			"fn f(): void {\nb0:\n  call void @print(null)\n  ret\n}\n": "line 3: null used",
+		}
+		for src, want := range tests {
+			_, err := ir.Parse(src)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("expected an error containing %q for\n%s\ngot %v\n", want, src, err)
+			}
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	tests := map[string]string{
+		"Test missing terminator": `fn f(): int {
+b0:
+  %0 = add int 1, 2
+}
+`,
+		"Test use before definition": `fn f(): int {
+b0:
+  %0 = add int %1, 2
+  %1 = add int 1, 2
+  ret int %0
+}
+`,
+		"Test definition not dominating": `fn f(%c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  %0 = add int 1, 2
+  jmp b2
+b2:
+  ret int %0
+}
+`,
+		"Test phi arg not dominating its predecessor": `fn f(%c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  %0 = add int 1, 2
+  jmp b2
+b2:
+  %1 = phi int [%0, b0], [0, b1]
+  ret int %1
+}
+`,
+		"Test operand types": `fn f(%a: int, %b: float): int {
+b0:
+  %0 = add int %a, %b
+  ret int %0
+}
+`,
+		"Test return type": `fn f(): int {
+b0:
+  ret bool true
+}
+`,
+		"Test call args": `fn g(%a: int): int {
+b0:
+  ret int %a
+}
+
+fn f(): int {
+b0:
+  %0 = call int @g(true)
+  ret int %0
+}
+`,
+		"Test branch on int": `fn f(): void {
+b0:
+  br 1, b1, b1
+b1:
+  ret
+}
+`,
+		"Test tail call not returned": `fn f(%n: int): int {
+b0:
+  %0 = tail call int @f(%n)
+  %1 = add int %0, 1
+  ret int %1
+}
+`,
+		"Test closure captures": `fn g(%n: *int, %x: int): int {
+b0:
+  ret int %x
+}
+
+fn f(): fn(int): int {
+b0:
+  %0 = alloca uint
+  %1 = closure fn(int): int @g(%0)
+  ret fn(int): int %1
+}
+`,
+		"Test apply args": `fn f(%g: fn(int): int): int {
+b0:
+  %0 = apply int %g(true)
+  ret int %0
+}
+`,
+		"Test tail call deferring calls": `fn g(): void {
+b0:
+  ret
+}
+
+fn f(): void {
+b0:
+  defer @g()
+  tail call void @g()
+  ret
+}
+`,
+		"Test method of a value": `fn f(%n: int): int {
+b0:
+  %0 = method fn(): int @area(%n)
+  %1 = apply int %0()
+  ret int %1
+}
+`,
+		"Test send type": `fn f(%ch: chan<int>): void {
+b0:
+  send bool %ch, true
+  ret
+}
+`,
+		"Test spawned builtin": `fn f(): void {
+b0:
+  spawn @print(1)
+  ret
+}
+`,
+		"Test result value type": `fn f(%r: result<int, string>): bool {
+b0:
+  %0 = value result<int, string> %r
+  ret bool %0
+}
+`,
+		"Test recover slots": `fn f(%s: *string): void {
+b0:
+  recover %s, %s
+  ret
+}
+`,
+		"Test entry with predecessors": `fn f(): void {
+b0:
+  jmp b0
+}
+`,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := ir.Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errs := ir.Verify(m); len(errs) == 0 {
+				t.Errorf("expected a verifier error for\n%s\n", src)
+			}
+		})
+	}
+
+	t.Run("Test error message", func(t *testing.T) {
+		m, err := ir.Parse("fn f(): int {\nb0:\n  ret bool true\n}\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := ir.Verify(m)
+		want := "fn f: b0: ret bool true: operand true of type bool instead of int"
+		if len(errs) != 1 || errs[0].Error() != want {
+			t.Errorf("expected [%s], got %v\n", want, errs)
+		}
+	})
+}
@@ -0,0 +1,763 @@
+package ir
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"yal/cfg"
+	"yal/consteval"
+	"yal/lexer"
+	"yal/parser"
+)
+
+var binaryOps = map[lexer.TokenType]Op{
+	lexer.Plus:            OpAdd,
+	lexer.Minus:           OpSub,
+	lexer.Star:            OpMul,
+	lexer.Slash:           OpDiv,
+	lexer.Rem:             OpRem,
+	lexer.Ampersand:       OpAnd,
+	lexer.Pipe:            OpOr,
+	lexer.Xor:             OpXor,
+	lexer.Shl:             OpShl,
+	lexer.Shr:             OpShr,
+	lexer.EqualEqual:      OpEq,
+	lexer.BangEqual:       OpNe,
+	lexer.Lesser:          OpLt,
+	lexer.LesserEqual:     OpLe,
+	lexer.Greater:         OpGt,
+	lexer.GreaterEqual:    OpGe,
+	lexer.PlusEqual:       OpAdd,
+	lexer.MinusEqual:      OpSub,
+	lexer.StarEqual:       OpMul,
+	lexer.SlashEqual:      OpDiv,
+	lexer.RemEqual:        OpRem,
+	lexer.AmpersandEqual:  OpAnd,
+	lexer.PipeEqual:       OpOr,
+	lexer.XorEqual:        OpXor,
+	lexer.ShlEqual:        OpShl,
+	lexer.ShrEqual:        OpShr,
+	lexer.Inc:             OpAdd,
+	lexer.Dec:             OpSub,
+	lexer.DoubleAmpersand: OpAnd,
+	lexer.DoublePipe:      OpOr,
+}
+
+func (b *builder) emit(op Op, t Type, args ...Value) *Instr {
+	i := b.f.NewInstr(op, t, args...)
+	i.Loc = b.loc
+	b.cur.Append(i)
+	return i
+}
+
+func (b *builder) jump(to *Block) {
+	b.emit(OpJump, Void)
+	AddEdge(b.cur, to)
+}
+
+func (b *builder) branch(cond Value, t *Block, f *Block) {
+	b.emit(OpBranch, Void, cond)
+	AddEdge(b.cur, t)
+	AddEdge(b.cur, f)
+}
+
+func (b *builder) read(l *local) Value {
+	switch {
+	case l.konst != nil:
+		return l.konst
+	case l.fn != "":
+		c := b.emit(OpClosure, l.typ)
+		c.Callee = l.fn
+		return c
+	case l.addr:
+		return b.emit(OpLoad, l.typ, l.slot)
+	}
+	return b.readVar(l, b.cur)
+}
+
+// Allocates the box of a variable captured by lambdas where it is declared,
+// so that each time the declaration runs gives a new variable
+func (b *builder) box(l *local) {
+	if l.boxed {
+		l.slot = b.emit(OpNew, PointerTo(l.typ))
+	}
+}
+
+func (b *builder) assign(l *local, v Value) {
+	if l.addr {
+		b.emit(OpStore, Void, l.slot, v)
+		return
+	}
+	b.writeVar(l, b.cur, v)
+}
+
+func (b *builder) stmt(node parser.IStatement) {
+	b.locate(node)
+	switch n := node.(type) {
+	case *parser.VarDeclExpression:
+		l := b.locals[n.Name]
+		b.box(l)
+		var v Value = Zero(l.typ)
+		if lit, ok := n.Initializer.(*parser.Literal); !ok || lit.Value != nil {
+			v = b.expr(n.Initializer, l.typ)
+		}
+		b.assign(l, v)
+	case *parser.ConstDeclStmt:
+		// Evaluated once resolved
+	case *parser.StatementExpression:
+		b.expr(n.Expr, "")
+	case *parser.FnReturn:
+		b.returned = true
+		if n.Implicit {
+			b.locate(n.Value)
+		}
+		switch {
+		case b.results != nil:
+			types := []Type{}
+			for _, p := range b.results {
+				types = append(types, p.Type().Elem())
+			}
+			for i, v := range b.tupleValues(n.Value, types) {
+				b.emit(OpStore, Void, b.results[i], v)
+			}
+		case n.Value != nil:
+			b.ret = b.expr(n.Value, b.f.Ret)
+		}
+	case *parser.DeferStmt:
+		c := b.closures[b.deferred[n]]
+		boxes := []Value{}
+		for _, l := range c.captures {
+			boxes = append(boxes, l.slot)
+		}
+		b.emit(OpDefer, Void, boxes...).Callee = c.name
+	case *parser.SpawnStmt:
+		name := b.callees[n.Call]
+		b.emit(OpSpawn, Void, b.args(n.Call, b.sigs[name])...).Callee = name
+	case *parser.TupleDecl:
+		types := []Type{}
+		for _, name := range n.Names {
+			types = append(types, b.locals[name].typ)
+		}
+		for i, v := range b.tupleValues(n.Initializer, types) {
+			l := b.locals[n.Names[i]]
+			b.box(l)
+			b.assign(l, v)
+		}
+	default:
+		b.unsupported(node)
+	}
+}
+
+// Lowers a tuple or a call to a fn returning several values to its values,
+// integer constants taking the types given
+func (b *builder) tupleValues(expr parser.IExpression, types []Type) []Value {
+	values := []Value{}
+	switch n := expr.(type) {
+	case *parser.Grouping:
+		return b.tupleValues(n.Grouped, types)
+	case *parser.Tuple:
+		for i, elem := range n.Elems {
+			values = append(values, b.expr(elem, types[i]))
+		}
+	case *parser.FnCall:
+		b.expr(n, "")
+		for _, l := range b.slots[n] {
+			values = append(values, b.read(l))
+		}
+	}
+	return values
+}
+
+// Ends the block lowering cb with a jump to the blocks lowering its
+// successors. Jumping to the exit of the fn returns from it instead.
+func (b *builder) terminate(g *cfg.Graph, cb *cfg.Block) {
+	switch {
+	case cb.Cases != nil:
+		subject := b.expr(cb.Cond, "")
+		for i, values := range cb.Cases {
+			var match Value
+			for _, v := range values {
+				eq := b.emit(OpEq, Bool, subject, b.expr(v, subject.Type()))
+				if match == nil {
+					match = eq
+				} else {
+					match = b.emit(OpOr, Bool, match, eq)
+				}
+			}
+			next := b.f.NewBlock()
+			b.branch(match, b.blocks[cb.Succs[i]], next)
+			b.seal(next)
+			b.cur = next
+		}
+		b.jump(b.blocks[cb.Succs[len(cb.Cases)]])
+	case cb.Cond != nil:
+		cond := b.expr(cb.Cond, Bool)
+		b.locate(cb.Cond)
+		b.branch(cond, b.blocks[cb.Succs[0]], b.blocks[cb.Succs[1]])
+	case len(cb.Succs) == 1 && cb.Succs[0] != g.Exit:
+		b.jump(b.blocks[cb.Succs[0]])
+	case len(cb.Succs) == 1 && endsWithPanic(cb):
+		b.emit(OpUnreachable, Void)
+	case b.ret != nil && b.ret.Type() != Void:
+		b.emit(OpRet, Void, b.ret)
+	case b.returned || b.f.Ret == Void:
+		b.emit(OpRet, Void)
+	default:
+		b.emit(OpUnreachable, Void)
+	}
+}
+
+func endsWithPanic(cb *cfg.Block) bool {
+	if len(cb.Nodes) == 0 {
+		return false
+	}
+	s, ok := cb.Nodes[len(cb.Nodes)-1].(*parser.StatementExpression)
+	if !ok {
+		return false
+	}
+	call, ok := s.Expr.(*parser.FnCall)
+	return ok && call.Name != nil && call.Name.Lexeme == "panic"
+}
+
+// Lowers an expression, integer constants taking the type hint when it is
+// numeric
+func (b *builder) expr(expr parser.IExpression, hint Type) Value {
+	// Instructions lowering the rest of the enclosing node keep its Loc
+	defer func(loc parser.Loc) { b.loc = loc }(b.loc)
+	b.locate(expr)
+	if hint == Iface && b.exprType(expr) != Iface && !isNull(expr) {
+		return b.toIface(expr)
+	}
+
+	switch n := expr.(type) {
+	case *parser.Literal:
+		return b.literal(n, hint)
+	case *parser.Variable:
+		return b.read(b.locals[n.Name])
+	case *parser.Grouping:
+		return b.expr(n.Grouped, hint)
+	case *parser.Binary:
+		return b.binary(n, n.Left, n.Operator, n.Right, hint)
+	case *parser.Logical:
+		return b.binary(n, n.Left, n.Operator, n.Right, hint)
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			return b.emit(OpNot, Bool, b.expr(n.Right, Bool))
+		}
+		v := b.expr(n.Right, b.operandType(hint, n.Right))
+		return b.emit(OpNeg, v.Type(), v)
+	case *parser.Assign:
+		return b.update(n.Name, n.Target, n.Operator, func(t Type) Value {
+			return b.expr(n.Expr, t)
+		})
+	case *parser.PrefixIncDec:
+		return b.incDec(n.Target, n.Operator, true)
+	case *parser.PostfixIncDec:
+		return b.incDec(n.Target, n.Operator, false)
+	case *parser.AddressOf:
+		return b.locals[n.Operand.(*parser.Variable).Name].slot
+	case *parser.Deref:
+		p := b.expr(n.Operand, "")
+		return b.emit(OpLoad, p.Type().Elem(), p)
+	case *parser.FnCall:
+		return b.call(n, hint)
+	case *parser.Field:
+		return b.method(n)
+	case *parser.IfExpr:
+		return b.ifValue(n, hint)
+	case *parser.Try:
+		return b.try(n)
+	case *parser.MatchExpr:
+		return b.match(n, hint)
+	case *parser.Lambda:
+		c := b.closures[n]
+		boxes := []Value{}
+		for _, l := range c.captures {
+			boxes = append(boxes, l.slot)
+		}
+		i := b.emit(OpClosure, b.lambdaType(n), boxes...)
+		i.Callee = c.name
+		return i
+	case *parser.MakeChan:
+		var size Value = IntConst(Int, 0)
+		if n.Size != nil {
+			size = b.expr(n.Size, Int)
+		}
+		if size.Type() != Int {
+			b.fail(n, "channel size of type %s instead of int", size.Type())
+		}
+		return b.emit(OpChan, b.typeOf(n.Type), size)
+	case *parser.Send:
+		ch := b.expr(n.Channel, "")
+		return b.emit(OpSend, Void, ch, b.expr(n.Value, ch.Type().Elem()))
+	case *parser.Receive:
+		ch := b.expr(n.Channel, "")
+		return b.emit(OpRecv, ch.Type().Elem(), ch)
+	}
+	b.unsupported(expr)
+	return nil
+}
+
+// Lowers a value used as an interface value to an iface holding it along
+// with the method table of its type
+func (b *builder) toIface(expr parser.IExpression) Value {
+	def := b.exprDefined(expr)
+	if def == "" {
+		b.fail(expr, "value of type %s used as an interface value without a defined type", b.exprType(expr))
+	}
+	i := b.emit(OpIface, Iface, b.expr(expr, ""))
+	i.Callee = def
+	return i
+}
+
+// Lowers a method of a value to a fn value calling it with that value: the
+// fn of the method bound to the value for a type, or the one found in the
+// method table of an iface
+func (b *builder) method(n *parser.Field) Value {
+	t := b.methodType(n)
+	v := b.expr(n.Object, "")
+	if v.Type() == Iface {
+		i := b.emit(OpMethod, t, v)
+		i.Callee = n.Name.Lexeme
+		return i
+	}
+	i := b.emit(OpClosure, t, v)
+	i.Callee = b.exprDefined(n.Object) + "." + n.Name.Lexeme
+	return i
+}
+
+func isNull(expr parser.IExpression) bool {
+	lit, ok := expr.(*parser.Literal)
+	return ok && lit.Value != nil && lit.Value.TokenType == lexer.Null
+}
+
+// Makes node the one instructions are lowered from, when it has a Loc
+func (b *builder) locate(node any) {
+	if n, ok := node.(interface{ Pos() parser.Loc }); ok && n.Pos().Line > 0 {
+		b.loc = n.Pos()
+	}
+}
+
+func (b *builder) literal(n *parser.Literal, hint Type) Value {
+	tk := n.Value
+	switch {
+	case tk == nil:
+		return Zero(hint)
+	case tk.TokenType == lexer.True || tk.TokenType == lexer.False:
+		return BoolConst(tk.TokenType == lexer.True)
+	case tk.TokenType == lexer.String:
+		return &Const{Typ: String, Str: tk.Lexeme}
+	case tk.TokenType == lexer.Null:
+		if !hint.IsPointer() && !hint.IsFn() && hint != Iface {
+			b.fail(n, "NULL is only supported by the IR where a pointer is expected")
+		}
+		return Zero(hint)
+	case isNumber(tk) && strings.Contains(tk.Lexeme, "."):
+		f, err := strconv.ParseFloat(tk.Lexeme, 64)
+		if err != nil {
+			b.fail(n, "invalid float literal %s", tk.Lexeme)
+		}
+		return &Const{Typ: Float, Float: f}
+	case isNumber(tk):
+		v, err := consteval.Eval(n, nil)
+		if err != nil {
+			b.fail(n, "%v", err)
+		}
+		if hint == Float {
+			f, _ := new(big.Float).SetInt(v.Int).Float64()
+			return &Const{Typ: Float, Float: f}
+		}
+		t := hint
+		if !t.IsInteger() {
+			t = Int
+		}
+		c := IntConst(t, v.Int.Int64())
+		if !v.Int.IsInt64() {
+			c.Int = int64(v.Int.Uint64())
+		}
+		return c
+	}
+	b.unsupported(n)
+	return nil
+}
+
+// Returns the type the operands of an arithmetic expression are converted
+// to: the one of the first typed operand, else the numeric hint, else int
+func (b *builder) operandType(hint Type, operands ...parser.IExpression) Type {
+	for _, o := range operands {
+		if t := b.exprType(o); t != "" {
+			return t
+		}
+	}
+	if hint.IsInteger() || hint == Float {
+		return hint
+	}
+	return Int
+}
+
+func (b *builder) binary(n any, left parser.IExpression, op *lexer.Token, right parser.IExpression, hint Type) Value {
+	if isLogical(op.TokenType) {
+		return b.shortCircuit(left, op.TokenType, right)
+	}
+
+	t := b.operandType(hint, left, right)
+	if isShift(op.TokenType) {
+		t = b.operandType(hint, left)
+	}
+	if t == String {
+		b.fail(n, "string operators are not supported by the IR")
+	}
+	if t.IsResult() {
+		b.fail(n, "Result operators are not supported by the IR")
+	}
+
+	l := b.expr(left, t)
+	r := b.expr(right, t)
+	if isCompare(op.TokenType) {
+		return b.emit(binaryOps[op.TokenType], Bool, l, r)
+	}
+	return b.emit(binaryOps[op.TokenType], t, l, r)
+}
+
+// Lowers && and || to a branch evaluating the right operand only when the
+// left one doesn't decide the result, joined by a phi
+func (b *builder) shortCircuit(left parser.IExpression, op lexer.TokenType, right parser.IExpression) Value {
+	l := b.expr(left, Bool)
+	rhs := b.f.NewBlock()
+	join := b.f.NewBlock()
+	if op == lexer.DoubleAmpersand {
+		b.branch(l, rhs, join)
+	} else {
+		b.branch(l, join, rhs)
+	}
+	b.seal(rhs)
+
+	b.cur = rhs
+	r := b.expr(right, Bool)
+	b.jump(join)
+	b.seal(join)
+
+	b.cur = join
+	phi := b.newPhi(join, Bool)
+	phi.Args = []Value{BoolConst(op == lexer.DoublePipe), r}
+	return phi
+}
+
+// Lowers an if used as a value to a phi joining the values of its branches
+func (b *builder) ifValue(n *parser.IfExpr, hint Type) Value {
+	if n.ElseBranch == nil {
+		b.fail(n, "if without else used as a value")
+	}
+	t := b.joinType(b.exprType(n), hint)
+
+	cond := b.expr(n.Condition, Bool)
+	then := b.f.NewBlock()
+	els := b.f.NewBlock()
+	join := b.f.NewBlock()
+	b.branch(cond, then, els)
+	b.seal(then)
+	b.seal(els)
+
+	b.cur = then
+	tv := b.branchValue(n.ThenBranch, t)
+	b.jump(join)
+	b.cur = els
+	ev := b.branchValue(n.ElseBranch, t)
+	b.jump(join)
+	b.seal(join)
+
+	b.cur = join
+	phi := b.newPhi(join, t)
+	phi.Args = []Value{tv, ev}
+	return phi
+}
+
+// Returns the type of a value joining branches whose first one is of type t,
+// which is given by the hint when it is an integer constant or a variant of
+// Result
+func (b *builder) joinType(t Type, hint Type) Type {
+	switch {
+	case t != "":
+		return t
+	case hint.IsResult():
+		return hint
+	}
+	return b.operandType(hint)
+}
+
+// Lowers ? to a branch returning the error of a result holding one, as a
+// result of the type the fn returns, and going on with the value it holds
+// otherwise
+func (b *builder) try(n *parser.Try) Value {
+	r := b.expr(n.Operand, "")
+	if !b.f.Ret.IsResult() || b.results != nil {
+		b.fail(n, "? used in a fn returning %s instead of a Result", b.f.Ret)
+	}
+	value, err := r.Type().Outcomes()
+	if _, want := b.f.Ret.Outcomes(); err != want {
+		b.fail(n, "? propagates %s errors from a fn returning %s errors", err, want)
+	}
+
+	ok := b.f.NewBlock()
+	failed := b.f.NewBlock()
+	b.branch(b.emit(OpIsOk, Bool, r), ok, failed)
+	b.seal(ok)
+	b.seal(failed)
+
+	b.cur = failed
+	b.emit(OpRet, Void, b.emit(OpErr, b.f.Ret, b.emit(OpError, err, r)))
+	b.cur = ok
+	return b.emit(OpValue, value, r)
+}
+
+// Lowers a match on a result to a branch to the arm of the variant it
+// holds, which binds its value or its error. The values of the arms are
+// joined by a phi, unless they are of type void.
+func (b *builder) match(n *parser.MatchExpr, hint Type) Value {
+	r := b.expr(n.Subject, "")
+	value, err := r.Type().Outcomes()
+	arms := map[string]*parser.MatchArm{}
+	for _, arm := range n.Arms {
+		if _, ok := arms[arm.Pattern.Variant.Lexeme]; !ok {
+			arms[arm.Pattern.Variant.Lexeme] = arm
+		}
+	}
+	t := b.joinType(b.exprType(n), hint)
+
+	ok := b.f.NewBlock()
+	failed := b.f.NewBlock()
+	join := b.f.NewBlock()
+	b.branch(b.emit(OpIsOk, Bool, r), ok, failed)
+	b.seal(ok)
+	b.seal(failed)
+
+	values := []Value{}
+	for _, variant := range []struct {
+		name  string
+		block *Block
+		op    Op
+		typ   Type
+	}{{"Ok", ok, OpValue, value}, {"Err", failed, OpError, err}} {
+		b.cur = variant.block
+		arm, found := arms[variant.name]
+		if !found {
+			arm, found = arms["_"]
+		}
+		if !found {
+			b.fail(n, "match on a Result without an arm for %s", variant.name)
+		}
+		for _, binding := range arm.Pattern.Bindings {
+			l := b.locals[binding]
+			b.box(l)
+			b.assign(l, b.emit(variant.op, variant.typ, r))
+		}
+		values = append(values, b.armValue(arm.Body, t))
+		b.jump(join)
+	}
+	b.seal(join)
+
+	b.cur = join
+	if t == Void {
+		return nil
+	}
+	phi := b.newPhi(join, t)
+	phi.Args = values
+	return phi
+}
+
+// Lowers the body of a match arm, returning its value, nil for a block of
+// type void
+func (b *builder) armValue(body parser.IStatement, t Type) Value {
+	block, ok := body.(*parser.Block)
+	switch {
+	case !ok:
+		return b.expr(body.(parser.IExpression), t)
+	case t != Void:
+		return b.branchValue(body, t)
+	}
+	for _, s := range block.Statements {
+		ret, ok := s.(*parser.FnReturn)
+		switch {
+		case ok && !ret.Implicit:
+			b.fail(s, "return in a match arm is not supported by the IR")
+		case ok:
+			b.expr(ret.Value, t)
+		default:
+			b.stmt(s)
+		}
+	}
+	return nil
+}
+
+func (b *builder) branchValue(stmt parser.IStatement, t Type) Value {
+	switch n := stmt.(type) {
+	case *parser.Block:
+		for i, s := range n.Statements {
+			if i == len(n.Statements)-1 {
+				return b.branchValue(s, t)
+			}
+			b.stmt(s)
+		}
+	case *parser.FnReturn:
+		if n.Implicit {
+			return b.expr(n.Value, t)
+		}
+	case *parser.IfExpr:
+		return b.ifValue(n, t)
+	}
+	b.fail(stmt, "branch without a value")
+	return nil
+}
+
+// Lowers an assignment to a variable or through a pointer, which evaluates
+// to the assigned value. Compound assignments apply their operator to the
+// value held before.
+func (b *builder) update(name *lexer.Token, target parser.IExpression, op *lexer.Token, value func(Type) Value) Value {
+	var t Type
+	var ptr Value
+	var l *local
+	switch target := target.(type) {
+	case nil:
+		l = b.locals[name]
+		t = l.typ
+	case *parser.Variable:
+		l = b.locals[target.Name]
+		t = l.typ
+	case *parser.Deref:
+		ptr = b.expr(target.Operand, "")
+		t = ptr.Type().Elem()
+	default:
+		b.unsupported(target)
+	}
+
+	v := value(t)
+	if op.TokenType != lexer.Equal {
+		var old Value
+		if ptr != nil {
+			old = b.emit(OpLoad, t, ptr)
+		} else {
+			old = b.read(l)
+		}
+		v = b.emit(binaryOps[op.TokenType], t, old, v)
+	}
+
+	if ptr != nil {
+		b.emit(OpStore, Void, ptr, v)
+	} else {
+		b.assign(l, v)
+	}
+	return v
+}
+
+// Lowers ++ and --, which evaluate to the updated value when prefixed and
+// to the value held before otherwise
+func (b *builder) incDec(target parser.IExpression, op *lexer.Token, prefix bool) Value {
+	v := b.update(nil, target, op, func(t Type) Value {
+		one := IntConst(t, 1)
+		if t == Float {
+			one = &Const{Typ: Float, Float: 1}
+		}
+		return one
+	})
+	if prefix {
+		return v
+	}
+	return v.(*Instr).Args[0]
+}
+
+// Lowers a call to a fn of the module or to a builtin, the type of the
+// result Ok and Err make being given by the hint
+func (b *builder) call(n *parser.FnCall, hint Type) Value {
+	name := b.callees[n]
+	if name == "" {
+		return b.apply(n)
+	}
+	sig, ok := b.sigs[name]
+	switch {
+	case !ok && (name == "Ok" || name == "Err"):
+		return b.variant(n, hint)
+	case !ok && name == "recover":
+		slots := b.slots[n]
+		return b.emit(OpRecover, Void, slots[0].slot, slots[1].slot)
+	case !ok:
+		args := []Value{}
+		for _, arg := range n.Args {
+			args = append(args, b.expr(arg, ""))
+		}
+		call := b.emit(OpCall, Void, args...)
+		call.Callee = name
+		return call
+	}
+
+	call := b.emit(OpCall, sig.ret, b.args(n, sig)...)
+	call.Callee = name
+	return call
+}
+
+// Lowers the args of a call to a fn of the module in the order of its
+// params, after the receiver of a method, followed by the slots it stores
+// the values it returns into
+func (b *builder) args(n *parser.FnCall, sig *signature) []Value {
+	args := make([]Value, len(sig.params))
+	first := 0
+	if recv, ok := b.receivers[n]; ok {
+		args[0] = b.expr(recv, sig.types[0])
+		first = 1
+	}
+	for i, arg := range n.Args {
+		i += first
+		if named, ok := arg.(*parser.NamedArg); ok {
+			for j, p := range sig.params {
+				if p.Name.Lexeme == named.Name.Lexeme {
+					i = j
+				}
+			}
+			arg = named.Value
+		}
+		args[i] = b.expr(arg, sig.types[i])
+	}
+	for i, p := range sig.params {
+		if args[i] == nil {
+			args[i] = b.expr(p.Initializer, sig.types[i])
+		}
+	}
+
+	for _, l := range b.slots[n] {
+		args = append(args, l.slot)
+	}
+	return args
+}
+
+// Lowers a call to the Ok or Err variant of Result to a result of the type
+// expected where it is used
+func (b *builder) variant(n *parser.FnCall, hint Type) Value {
+	name := n.Name.Lexeme
+	if !hint.IsResult() {
+		b.fail(n, "%s used where the type of its Result isn't known", name)
+	}
+	if len(n.Args) != 1 {
+		b.fail(n, "variant %s has 1 field, got %d arguments", name, len(n.Args))
+	}
+	value, err := hint.Outcomes()
+	if name == "Err" {
+		return b.emit(OpErr, hint, b.expr(n.Args[0], err))
+	}
+	return b.emit(OpOk, hint, b.expr(n.Args[0], value))
+}
+
+// Lowers a call to a fn value, whose args are all given by position
+func (b *builder) apply(n *parser.FnCall) Value {
+	fn := b.expr(callee(n), "")
+	params, ret := fn.Type().Signature()
+	if len(n.Args) != len(params) {
+		b.fail(n, "fn value takes %d args, got %d", len(params), len(n.Args))
+	}
+	args := []Value{fn}
+	for i, arg := range n.Args {
+		if _, ok := arg.(*parser.NamedArg); ok {
+			b.fail(arg, "named args to fn values are not supported by the IR")
+		}
+		args = append(args, b.expr(arg, params[i]))
+	}
+	return b.emit(OpApply, ret, args...)
+}
@@ -0,0 +1,641 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error reported for malformed text
+type parseError struct {
+	error
+}
+
+// Instruction whose operands are resolved once every fn is parsed, since
+// they may refer to instructions defined further down and the types of null
+// call args are given by the callee
+type pending struct {
+	line     int
+	instr    *Instr
+	operands []string
+	types    []Type
+	labels   []string
+}
+
+type irParser struct {
+	module  *Module
+	line    int
+	tokens  []string
+	f       *Func
+	labels  map[string]*Block
+	values  map[string]Value
+	pending []*pending
+}
+
+// Reads a module in the text format String renders, so that tests can start
+// from hand written IR. Comments run from ; to the end of the line.
+func Parse(src string) (m *Module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			m, err = nil, e.error
+		}
+	}()
+
+	m = &Module{}
+	p := &irParser{module: m}
+	fns := []func(){}
+	for n, line := range strings.Split(src, "\n") {
+		p.line = n + 1
+		p.tokens = p.tokenize(line)
+		switch {
+		case len(p.tokens) == 0:
+		case p.f == nil:
+			p.header()
+			if m.Func(p.f.Name) != nil {
+				p.fail("fn %s defined twice", p.f.Name)
+			}
+			m.Funcs = append(m.Funcs, p.f)
+		case p.tokens[0] == "}":
+			p.expectEnd(1)
+			fns = append(fns, p.end())
+		case len(p.tokens) == 2 && p.tokens[1] == ":":
+			p.label()
+		default:
+			p.instr()
+		}
+	}
+	if p.f != nil {
+		p.fail("missing } at the end of fn %s", p.f.Name)
+	}
+
+	for _, resolve := range fns {
+		resolve()
+	}
+	return m, nil
+}
+
+func (p *irParser) fail(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	panic(parseError{fmt.Errorf("line %d: %s", p.line, msg)})
+}
+
+func (p *irParser) tokenize(line string) []string {
+	tokens := []string{}
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ';':
+			return tokens
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.IndexByte("=,:()[]{}", c) >= 0:
+			tokens = append(tokens, line[i:i+1])
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				p.fail("unterminated string")
+			}
+			tokens = append(tokens, line[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r;=,:()[]{}\"", rune(line[j])) {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func (p *irParser) next() string {
+	if len(p.tokens) == 0 {
+		p.fail("unexpected end of line")
+	}
+	tk := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return tk
+}
+
+// Reads the name of a fn, type or method, which starts with @
+func (p *irParser) name() string {
+	tk := p.next()
+	if !strings.HasPrefix(tk, "@") || len(tk) == 1 {
+		p.fail("expected a name starting with @ instead of %s", tk)
+	}
+	return tk[1:]
+}
+
+func (p *irParser) expect(tk string) {
+	if got := p.next(); got != tk {
+		p.fail("expected %s instead of %s", tk, got)
+	}
+}
+
+// Checks that only n tokens are left on the line and consumes them
+func (p *irParser) expectEnd(n int) {
+	if len(p.tokens) > n {
+		p.fail("unexpected %s", p.tokens[n])
+	}
+	p.tokens = nil
+}
+
+// Parses the type starting with tk, reading the rest of a fn or result type
+// from the line. Channels of fn values and results whose error is a fn
+// value or a result can't be read back.
+func (p *irParser) parseType(tk string) Type {
+	t := Type(tk)
+	base := Type(strings.TrimLeft(tk, "*"))
+	if base.IsChan() && strings.HasSuffix(tk, ">") {
+		elem := p.parseType(string(base.Elem()))
+		return Type(strings.Repeat("*", len(t)-len(base))) + ChanOf(elem)
+	}
+	if base.IsResult() {
+		value := p.parseType(strings.TrimPrefix(string(base), "result<"))
+		p.expect(",")
+		last := p.next()
+		if !strings.HasSuffix(last, ">") {
+			p.fail("unknown type %s", tk)
+		}
+		err := p.parseType(last[:len(last)-1])
+		return Type(strings.Repeat("*", len(t)-len(base))) + ResultOf(value, err)
+	}
+	switch base {
+	case Int, Uint, Char, Bool, Float, String, Iface:
+		return t
+	case Void:
+		if t == Void {
+			return t
+		}
+	case "fn":
+		params := []Type{}
+		p.expect("(")
+		for len(p.tokens) > 0 && p.tokens[0] != ")" {
+			if len(params) > 0 {
+				p.expect(",")
+			}
+			params = append(params, p.parseType(p.next()))
+		}
+		p.expect(")")
+		p.expect(":")
+		return Type(strings.Repeat("*", len(t)-len(base))) + FnOf(params, p.parseType(p.next()))
+	}
+	p.fail("unknown type %s", tk)
+	return Void
+}
+
+// Parses fn name(%a: int, ...): int {
+func (p *irParser) header() {
+	p.expect("fn")
+	p.f = &Func{Name: p.next()}
+	p.labels = map[string]*Block{}
+	p.values = map[string]Value{}
+	p.pending = nil
+
+	p.expect("(")
+	for len(p.tokens) > 0 && p.tokens[0] != ")" {
+		if len(p.f.Params) > 0 {
+			p.expect(",")
+		}
+		name := p.next()
+		if !strings.HasPrefix(name, "%") || len(name) == 1 {
+			p.fail("expected a param instead of %s", name)
+		}
+		p.expect(":")
+		param := &Param{Name: name[1:], Typ: p.parseType(p.next())}
+		if p.values[name] != nil {
+			p.fail("param %s declared twice", name)
+		}
+		p.values[name] = param
+		p.f.Params = append(p.f.Params, param)
+	}
+	p.expect(")")
+	p.expect(":")
+	p.f.Ret = p.parseType(p.next())
+	p.expect("{")
+	p.expectEnd(0)
+}
+
+func (p *irParser) blockID(label string) int {
+	id, err := strconv.Atoi(strings.TrimPrefix(label, "b"))
+	if !strings.HasPrefix(label, "b") || err != nil || id < 0 {
+		p.fail("invalid label %s", label)
+	}
+	return id
+}
+
+func (p *irParser) label() {
+	label := p.next()
+	id := p.blockID(label)
+	if p.labels[label] != nil {
+		p.fail("block %s defined twice", label)
+	}
+	b := &Block{ID: id}
+	p.labels[label] = b
+	p.f.Blocks = append(p.f.Blocks, b)
+	if id >= p.f.nextBlock {
+		p.f.nextBlock = id + 1
+	}
+}
+
+var opsByName = map[string]Op{}
+
+func init() {
+	for op, name := range opNames {
+		opsByName[name] = Op(op)
+	}
+}
+
+func (p *irParser) instr() {
+	if len(p.f.Blocks) == 0 {
+		p.fail("instruction outside of a block")
+	}
+	b := p.f.Blocks[len(p.f.Blocks)-1]
+	if t := b.Terminator(); t != nil {
+		p.fail("instruction after the terminator of %s", b)
+	}
+
+	name := ""
+	if len(p.tokens) > 1 && p.tokens[1] == "=" {
+		name = p.next()
+		p.next()
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "%"))
+		if !strings.HasPrefix(name, "%") || err != nil || id < 0 {
+			p.fail("invalid instruction name %s", name)
+		}
+		if p.values[name] != nil {
+			p.fail("%s defined twice", name)
+		}
+	}
+
+	tk := p.next()
+	tail := tk == "tail"
+	if tail {
+		tk = p.next()
+	}
+	op, ok := opsByName[tk]
+	if !ok || tail && op != OpCall {
+		p.fail("unknown instruction %s", tk)
+	}
+	i := &Instr{Op: op, Tail: tail}
+	pd := &pending{line: p.line, instr: i}
+
+	// Parses comma separated operands of type t
+	operands := func(n int, t Type) {
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				p.expect(",")
+			}
+			pd.operands = append(pd.operands, p.next())
+			pd.types = append(pd.types, t)
+		}
+	}
+
+	switch {
+	case op.IsBinary():
+		i.Typ = p.parseType(p.next())
+		operands(2, i.Typ)
+	case op.IsUnary():
+		i.Typ = p.parseType(p.next())
+		operands(1, i.Typ)
+	case op.IsCompare():
+		i.Typ = Bool
+		operands(2, p.parseType(p.next()))
+	case op == OpAlloca || op == OpNew:
+		i.Typ = PointerTo(p.parseType(p.next()))
+	case op == OpLoad:
+		i.Typ = p.parseType(p.next())
+		operands(1, PointerTo(i.Typ))
+	case op == OpStore:
+		t := p.parseType(p.next())
+		operands(1, PointerTo(t))
+		p.expect(",")
+		operands(1, t)
+		i.Typ = Void
+	case op == OpChan:
+		i.Typ = ChanOf(p.parseType(p.next()))
+		operands(1, Int)
+	case op == OpSend:
+		t := p.parseType(p.next())
+		operands(1, ChanOf(t))
+		p.expect(",")
+		operands(1, t)
+		i.Typ = Void
+	case op == OpRecv:
+		i.Typ = p.parseType(p.next())
+		operands(1, ChanOf(i.Typ))
+	case op == OpCall || op == OpClosure || op == OpDefer || op == OpSpawn:
+		i.Typ = Void
+		if op != OpDefer && op != OpSpawn {
+			i.Typ = p.parseType(p.next())
+		}
+		i.Callee = p.name()
+		p.expect("(")
+		for len(p.tokens) > 0 && p.tokens[0] != ")" {
+			if len(pd.operands) > 0 {
+				p.expect(",")
+			}
+			// Types of the args are given by the callee
+			operands(1, "")
+		}
+		p.expect(")")
+	case op == OpIface:
+		t := p.parseType(p.next())
+		i.Typ = Iface
+		i.Callee = p.name()
+		p.expect("(")
+		operands(1, t)
+		p.expect(")")
+	case op == OpMethod:
+		i.Typ = p.parseType(p.next())
+		i.Callee = p.name()
+		p.expect("(")
+		operands(1, Iface)
+		p.expect(")")
+	case op == OpOk || op == OpErr:
+		i.Typ = p.parseType(p.next())
+		if !i.Typ.IsResult() {
+			p.fail("%s of type %s instead of a result", op, i.Typ)
+		}
+		value, err := i.Typ.Outcomes()
+		if op == OpErr {
+			value = err
+		}
+		operands(1, value)
+	case op == OpIsOk || op == OpValue || op == OpError:
+		t := p.parseType(p.next())
+		if !t.IsResult() {
+			p.fail("%s of %s instead of a result", op, t)
+		}
+		value, err := t.Outcomes()
+		switch op {
+		case OpIsOk:
+			i.Typ = Bool
+		case OpValue:
+			i.Typ = value
+		default:
+			i.Typ = err
+		}
+		operands(1, t)
+	case op == OpRecover:
+		i.Typ = Void
+		operands(1, PointerTo(String))
+		p.expect(",")
+		operands(1, PointerTo(Bool))
+	case op == OpApply:
+		i.Typ = p.parseType(p.next())
+		operands(1, "")
+		p.expect("(")
+		for len(p.tokens) > 0 && p.tokens[0] != ")" {
+			if len(pd.operands) > 1 {
+				p.expect(",")
+			}
+			operands(1, "")
+		}
+		p.expect(")")
+	case op == OpPhi:
+		i.Typ = p.parseType(p.next())
+		for len(p.tokens) > 0 {
+			if len(pd.labels) > 0 {
+				p.expect(",")
+			}
+			p.expect("[")
+			operands(1, i.Typ)
+			p.expect(",")
+			pd.labels = append(pd.labels, p.next())
+			p.expect("]")
+		}
+	case op == OpJump:
+		i.Typ = Void
+		pd.labels = append(pd.labels, p.next())
+	case op == OpBranch:
+		i.Typ = Void
+		operands(1, Bool)
+		p.expect(",")
+		pd.labels = append(pd.labels, p.next())
+		p.expect(",")
+		pd.labels = append(pd.labels, p.next())
+	case op == OpRet && len(p.tokens) > 0:
+		i.Typ = Void
+		operands(1, p.parseType(p.next()))
+	default:
+		i.Typ = Void
+	}
+	p.expectEnd(0)
+
+	if (name == "") != (i.Typ == Void) {
+		if name == "" {
+			p.fail("%s of type %s must be named", op, i.Typ)
+		}
+		p.fail("%s has no value to name", op)
+	}
+	if name != "" {
+		i.ID, _ = strconv.Atoi(name[1:])
+		p.values[name] = i
+		if i.ID >= p.f.nextID {
+			p.f.nextID = i.ID + 1
+		}
+	}
+	b.Append(i)
+	p.pending = append(p.pending, pd)
+}
+
+// Ends the fn being parsed, adding the edges given by its terminators.
+// Returns a func resolving its operands once every fn is known.
+func (p *irParser) end() func() {
+	f, labels, values, instrs := p.f, p.labels, p.values, p.pending
+	p.f = nil
+	if len(f.Blocks) == 0 {
+		p.fail("fn %s has no blocks", f.Name)
+	}
+
+	block := func(pd *pending, label string) *Block {
+		b := labels[label]
+		if b == nil {
+			p.line = pd.line
+			p.fail("unknown block %s", label)
+		}
+		return b
+	}
+	for _, pd := range instrs {
+		if pd.instr.Op.IsTerminator() {
+			for _, label := range pd.labels {
+				AddEdge(pd.instr.Block, block(pd, label))
+			}
+		}
+	}
+
+	// The incoming blocks of the first phi give the order of the Preds,
+	// which the other phis follow
+	for _, pd := range instrs {
+		b := pd.instr.Block
+		if pd.instr.Op != OpPhi || len(pd.labels) != len(b.Preds) || pd.instr != b.Instrs[0] {
+			continue
+		}
+		preds := []*Block{}
+		for _, label := range pd.labels {
+			preds = append(preds, block(pd, label))
+		}
+		if sameBlocks(preds, b.Preds) {
+			b.Preds = preds
+		}
+	}
+
+	return func() {
+		// Void instructions are numbered after the others
+		for _, b := range f.Blocks {
+			for _, i := range b.Instrs {
+				if i.Typ == Void {
+					i.ID = f.nextID
+					f.nextID++
+				}
+			}
+		}
+
+		for _, pd := range instrs {
+			p.line = pd.line
+			i := pd.instr
+			types := pd.types
+			switch i.Op {
+			case OpCall, OpClosure, OpDefer, OpSpawn:
+				types = p.argTypes(i, len(pd.operands))
+			case OpApply:
+				types = p.applyTypes(values, pd.operands)
+			}
+			for j, operand := range pd.operands {
+				i.Args = append(i.Args, p.value(values, operand, types[j]))
+			}
+			if i.Op == OpPhi {
+				p.orderPhi(i, pd, labels)
+			}
+		}
+	}
+}
+
+// Returns whether a and b hold the same blocks, in any order
+func sameBlocks(a []*Block, b []*Block) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, block := range a {
+		if count(a, block) != count(b, block) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the param types of the fn called by i, which are only needed for
+// null args
+func (p *irParser) argTypes(i *Instr, n int) []Type {
+	types := make([]Type, n)
+	if callee := p.module.Func(i.Callee); callee != nil && len(callee.Params) == n {
+		for j, param := range callee.Params {
+			types[j] = param.Typ
+		}
+	}
+	return types
+}
+
+// Returns the types of the operands of an apply, the args being typed by
+// the params of the fn value
+func (p *irParser) applyTypes(values map[string]Value, operands []string) []Type {
+	types := make([]Type, len(operands))
+	if fn := values[operands[0]]; fn != nil && fn.Type().IsFn() {
+		params, _ := fn.Type().Signature()
+		for j := range params {
+			if j+1 < len(types) {
+				types[j+1] = params[j]
+			}
+		}
+	}
+	return types
+}
+
+// Puts the args of phi i in the order of the Preds of its block
+func (p *irParser) orderPhi(i *Instr, pd *pending, labels map[string]*Block) {
+	b := i.Block
+	if len(pd.labels) != len(b.Preds) {
+		p.fail("phi has %d args for %d predecessors", len(pd.labels), len(b.Preds))
+	}
+	args := make([]Value, len(b.Preds))
+	used := make([]bool, len(pd.labels))
+	for j, pred := range b.Preds {
+		for k, label := range pd.labels {
+			if !used[k] && labels[label] == pred {
+				used[k] = true
+				args[j] = i.Args[k]
+				break
+			}
+		}
+	}
+	for k, label := range pd.labels {
+		if !used[k] {
+			p.fail("%s is not a predecessor of %s", label, b)
+		}
+	}
+	i.Args = args
+}
+
+// Returns the value an operand refers to, t being the type expected for it
+// or an empty type when it is unknown
+func (p *irParser) value(values map[string]Value, tk string, t Type) Value {
+	if strings.HasPrefix(tk, "%") {
+		v := values[tk]
+		if v == nil {
+			p.fail("unknown value %s", tk)
+		}
+		return v
+	}
+
+	switch {
+	case tk == "true" || tk == "false":
+		return BoolConst(tk == "true")
+	case tk == "null":
+		if !t.IsPointer() && !t.IsFn() && !t.IsChan() && t != Iface && !t.IsResult() {
+			p.fail("null used where its type isn't known")
+		}
+		return Zero(t)
+	case strings.HasPrefix(tk, `"`):
+		s, err := strconv.Unquote(tk)
+		if err != nil {
+			p.fail("invalid string %s", tk)
+		}
+		return &Const{Typ: String, Str: s}
+	case strings.HasSuffix(tk, "u"):
+		v, err := strconv.ParseUint(tk[:len(tk)-1], 10, 64)
+		if err != nil {
+			p.fail("invalid uint %s", tk)
+		}
+		return IntConst(Uint, int64(v))
+	case strings.HasSuffix(tk, "c"):
+		v, err := strconv.ParseInt(tk[:len(tk)-1], 10, 64)
+		if err != nil {
+			p.fail("invalid char %s", tk)
+		}
+		return IntConst(Char, v)
+	case strings.ContainsAny(tk, ".eInN"):
+		v, err := strconv.ParseFloat(tk, 64)
+		if err != nil {
+			p.fail("invalid float %s", tk)
+		}
+		return &Const{Typ: Float, Float: v}
+	}
+	v, err := strconv.ParseInt(tk, 10, 64)
+	if err != nil {
+		p.fail("invalid operand %s", tk)
+	}
+	return IntConst(Int, v)
+}
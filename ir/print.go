@@ -0,0 +1,113 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Renders m in the text format read by Parse, fns separated by blank lines
+func (m *Module) String() string {
+	fns := []string{}
+	for _, f := range m.Funcs {
+		fns = append(fns, f.String())
+	}
+	return strings.Join(fns, "\n")
+}
+
+// Renders f as
+//
+//	fn max(%a: int, %b: int): int {
+//	b0:
+//	  %0 = gt int %a, %b
+//	  br %0, b1, b2
+//	...
+//	}
+func (f *Func) String() string {
+	var sb strings.Builder
+
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, fmt.Sprintf("%s: %s", p, p.Typ))
+	}
+	fmt.Fprintf(&sb, "fn %s(%s): %s {\n", f.Name, strings.Join(params, ", "), f.Ret)
+	for _, b := range f.Blocks {
+		fmt.Fprintf(&sb, "%s:\n", b)
+		for _, i := range b.Instrs {
+			fmt.Fprintf(&sb, "  %s\n", i.Format())
+		}
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// Renders i as a line of the text format, whereas String renders the value
+// it defines
+func (i *Instr) Format() string {
+	args := []string{}
+	for _, arg := range i.Args {
+		args = append(args, arg.String())
+	}
+
+	s := ""
+	switch {
+	case i.Op.IsBinary():
+		s = fmt.Sprintf("%s %s %s", i.Op, i.Typ, strings.Join(args, ", "))
+	case i.Op.IsUnary():
+		s = fmt.Sprintf("%s %s %s", i.Op, i.Typ, args[0])
+	case i.Op.IsCompare():
+		s = fmt.Sprintf("%s %s %s", i.Op, i.Args[0].Type(), strings.Join(args, ", "))
+	case i.Op == OpAlloca || i.Op == OpNew:
+		s = fmt.Sprintf("%s %s", i.Op, i.Typ.Elem())
+	case i.Op == OpLoad:
+		s = fmt.Sprintf("load %s %s", i.Typ, args[0])
+	case i.Op == OpStore:
+		s = fmt.Sprintf("store %s %s", i.Args[1].Type(), strings.Join(args, ", "))
+	case i.Op == OpCall:
+		s = fmt.Sprintf("call %s @%s(%s)", i.Typ, i.Callee, strings.Join(args, ", "))
+		if i.Tail {
+			s = "tail " + s
+		}
+	case i.Op == OpDefer || i.Op == OpSpawn:
+		s = fmt.Sprintf("%s @%s(%s)", i.Op, i.Callee, strings.Join(args, ", "))
+	case i.Op == OpChan:
+		s = fmt.Sprintf("chan %s %s", i.Typ.Elem(), args[0])
+	case i.Op == OpSend:
+		s = fmt.Sprintf("send %s %s", i.Args[1].Type(), strings.Join(args, ", "))
+	case i.Op == OpRecv:
+		s = fmt.Sprintf("recv %s %s", i.Typ, args[0])
+	case i.Op == OpClosure:
+		s = fmt.Sprintf("closure %s @%s(%s)", i.Typ, i.Callee, strings.Join(args, ", "))
+	case i.Op == OpApply:
+		s = fmt.Sprintf("apply %s %s(%s)", i.Typ, args[0], strings.Join(args[1:], ", "))
+	case i.Op == OpIface:
+		s = fmt.Sprintf("iface %s @%s(%s)", i.Args[0].Type(), i.Callee, args[0])
+	case i.Op == OpMethod:
+		s = fmt.Sprintf("method %s @%s(%s)", i.Typ, i.Callee, args[0])
+	case i.Op == OpOk || i.Op == OpErr:
+		s = fmt.Sprintf("%s %s %s", i.Op, i.Typ, args[0])
+	case i.Op == OpIsOk || i.Op == OpValue || i.Op == OpError:
+		s = fmt.Sprintf("%s %s %s", i.Op, i.Args[0].Type(), args[0])
+	case i.Op == OpRecover:
+		s = fmt.Sprintf("recover %s", strings.Join(args, ", "))
+	case i.Op == OpPhi:
+		incoming := []string{}
+		for j, arg := range args {
+			incoming = append(incoming, fmt.Sprintf("[%s, %s]", arg, i.Block.Preds[j]))
+		}
+		s = fmt.Sprintf("phi %s %s", i.Typ, strings.Join(incoming, ", "))
+	case i.Op == OpJump:
+		s = fmt.Sprintf("jmp %s", i.Block.Succs[0])
+	case i.Op == OpBranch:
+		s = fmt.Sprintf("br %s, %s, %s", args[0], i.Block.Succs[0], i.Block.Succs[1])
+	case i.Op == OpRet && len(i.Args) > 0:
+		s = fmt.Sprintf("ret %s %s", i.Args[0].Type(), args[0])
+	default:
+		s = i.Op.String()
+	}
+
+	if i.Typ != Void {
+		s = fmt.Sprintf("%s = %s", i, s)
+	}
+	return s
+}
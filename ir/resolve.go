@@ -0,0 +1,537 @@
+package ir
+
+import (
+	"math/big"
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+func bigInt(c *Const) *big.Int {
+	if c.Typ == Uint {
+		return new(big.Int).SetUint64(uint64(c.Int))
+	}
+	return big.NewInt(c.Int)
+}
+
+// Declares a variable in the innermost scope being resolved
+func (b *builder) declare(name *lexer.Token, t Type) *local {
+	l := &local{name: name.Lexeme, typ: t}
+	b.scopes[len(b.scopes)-1][name.Lexeme] = l
+	b.locals[name] = l
+	b.declared = append(b.declared, l)
+	return l
+}
+
+// Binds every name of an fn body to the variable or constant it refers to,
+// so that variables shadowing others are told apart once the body is
+// flattened into blocks, and finds the variables whose address is taken
+func (b *builder) resolve(node any) {
+	switch n := node.(type) {
+	case nil, *parser.Literal, *parser.BreakStmt, *parser.ContinueStmt,
+		*parser.GotoStmt, *parser.LabelStmt:
+	case *parser.Block:
+		b.scopes = append(b.scopes, map[string]*local{})
+		for _, s := range n.Statements {
+			b.resolve(s)
+		}
+		b.scopes = b.scopes[:len(b.scopes)-1]
+	case *parser.VarDeclExpression:
+		b.resolve(n.Initializer)
+		t := b.exprType(n.Initializer)
+		def := b.exprDefined(n.Initializer)
+		if n.Type != nil {
+			t, def = b.typeOf(n.Type), b.defined(n.Type)
+		} else if t == "" {
+			t = Int
+		}
+		b.declare(n.Name, t).def = def
+	case *parser.ConstDeclStmt:
+		l := b.constant(n)
+		b.scopes[len(b.scopes)-1][n.Name.Lexeme] = l
+		b.locals[n.Name] = l
+	case *parser.StatementExpression:
+		b.resolve(n.Expr)
+	case *parser.FnReturn:
+		b.resolve(n.Value)
+		if b.results != nil {
+			if got := len(b.tupleTypes(n.Value)); got != len(b.results) {
+				b.fail(n, "fn returns %d values, got %d", len(b.results), got)
+			}
+		}
+	case *parser.TupleDecl:
+		b.resolve(n.Initializer)
+		types := b.tupleTypes(n.Initializer)
+		if len(types) != len(n.Names) {
+			b.fail(n, "cannot destructure %d values into %d variables", len(types), len(n.Names))
+		}
+		for i, name := range n.Names {
+			b.declare(name, types[i])
+		}
+	case *parser.Tuple:
+		for _, elem := range n.Elems {
+			b.resolve(elem)
+		}
+	case *parser.IfExpr:
+		b.resolve(n.Condition)
+		b.resolve(n.ThenBranch)
+		b.resolve(n.ElseBranch)
+	case *parser.WhileLoop:
+		b.resolve(n.Condition)
+		b.resolve(n.Body)
+	case *parser.ForLoop:
+		b.scopes = append(b.scopes, map[string]*local{})
+		b.resolve(n.Initializer)
+		b.resolve(n.Condition)
+		b.resolve(n.Apply)
+		b.resolve(n.Body)
+		b.scopes = b.scopes[:len(b.scopes)-1]
+	case *parser.SwitchStmt:
+		b.resolve(n.Subject)
+		for _, sc := range n.Cases {
+			for _, v := range sc.Values {
+				b.resolve(v)
+			}
+			b.resolve(sc.Body)
+		}
+		b.resolve(n.Default)
+	case *parser.Variable:
+		b.resolveName(n.Name)
+	case *parser.Grouping:
+		b.resolve(n.Grouped)
+	case *parser.Binary:
+		b.resolve(n.Left)
+		b.resolve(n.Right)
+	case *parser.Logical:
+		b.resolve(n.Left)
+		b.resolve(n.Right)
+	case *parser.UnaryRight:
+		b.resolve(n.Right)
+	case *parser.Assign:
+		if n.Target != nil {
+			b.resolve(n.Target)
+		} else if l := b.resolveName(n.Name); l.konst != nil {
+			b.fail(n, "cannot assign to constant %s", n.Name.Lexeme)
+		} else if l.fn != "" {
+			b.fail(n, "cannot assign to fn %s", n.Name.Lexeme)
+		}
+		b.resolve(n.Expr)
+	case *parser.PrefixIncDec:
+		b.resolve(n.Target)
+	case *parser.PostfixIncDec:
+		b.resolve(n.Target)
+	case *parser.AddressOf:
+		v, ok := n.Operand.(*parser.Variable)
+		if !ok {
+			b.fail(n, "only the address of variables is supported by the IR")
+		}
+		l := b.resolveName(v.Name)
+		if l.konst != nil {
+			b.fail(n, "cannot take the address of constant %s", v.Name.Lexeme)
+		}
+		if l.fn != "" {
+			b.fail(n, "cannot take the address of fn %s", v.Name.Lexeme)
+		}
+		l.addr = true
+	case *parser.Deref:
+		b.resolve(n.Operand)
+	case *parser.Field:
+		b.resolve(n.Object)
+		if b.methodType(n) == "" {
+			b.fail(n, "value of type %s has no method %s", b.exprType(n.Object), n.Name.Lexeme)
+		}
+	case *parser.FnCall:
+		for _, arg := range n.Args {
+			if named, ok := arg.(*parser.NamedArg); ok {
+				arg = named.Value
+			}
+			b.resolve(arg)
+		}
+		// The args are resolved first for inferring the type arguments
+		name := b.resolveCallee(n)
+		if name == "" {
+			// Call to a fn value
+			if t := b.exprType(callee(n)); !t.IsFn() {
+				b.fail(n, "cannot call a value of type %s", t)
+			}
+			b.callees[n] = name
+			break
+		}
+		if g, ok := b.generics[name]; ok {
+			name = b.instantiate(n, name, g)
+		} else if len(n.TypeArgs) > 0 {
+			b.unsupported(n)
+		}
+		if _, ok := b.sigs[name]; !ok && !isBuiltin(name) {
+			b.fail(n, "unknown fn %s", name)
+		}
+		b.callees[n] = name
+		if results := b.resultTypes(name); results != nil {
+			// Slots the values the fn returns are stored into, the body of
+			// a lambda being resolved again when it is lowered
+			b.slots[n] = nil
+			for _, t := range results {
+				l := &local{name: "ret", typ: t, addr: true}
+				b.declared = append(b.declared, l)
+				b.slots[n] = append(b.slots[n], l)
+			}
+		}
+	case *parser.Try:
+		b.resolve(n.Operand)
+		if t := b.exprType(n.Operand); !t.IsResult() {
+			b.fail(n, "? applied to a value of type %s instead of a Result", t)
+		}
+	case *parser.MatchExpr:
+		b.resolve(n.Subject)
+		t := b.exprType(n.Subject)
+		if !t.IsResult() {
+			b.fail(n, "match on a value of type %s is not supported by the IR", t)
+		}
+		for _, arm := range n.Arms {
+			b.scopes = append(b.scopes, map[string]*local{})
+			for i, binding := range arm.Pattern.Bindings {
+				b.declare(binding, b.variantType(arm.Pattern, t, i))
+			}
+			b.resolve(arm.Body)
+			b.scopes = b.scopes[:len(b.scopes)-1]
+		}
+	case *parser.Lambda:
+		b.lambda(n)
+	case *parser.DeferStmt:
+		b.lambda(b.deferredLambda(n))
+	case *parser.SpawnStmt:
+		b.resolve(n.Call)
+		if _, ok := b.sigs[b.callees[n.Call]]; !ok {
+			b.fail(n, "only fns of the package can be spawned by the IR")
+		}
+	case *parser.MakeChan:
+		b.resolve(n.Size)
+	case *parser.Send:
+		b.resolve(n.Channel)
+		b.resolve(n.Value)
+	case *parser.Receive:
+		b.resolve(n.Channel)
+	default:
+		b.unsupported(node)
+	}
+}
+
+// Returns the mangled name of the fn a call is to, fns of the package
+// shadowing the builtins, or an empty name for a call to a fn value. Calls
+// to the methods of a type are calls to the fns they are lowered to, with
+// the value they are called on as receiver, while those of interface
+// values go through a fn value.
+func (b *builder) resolveCallee(n *parser.FnCall) string {
+	if n.Callee == nil {
+		if b.lookup(n.Name.Lexeme) != nil {
+			b.resolveName(n.Name)
+			return ""
+		}
+		name := mangle(b.pkg.Path, n.Name.Lexeme)
+		if _, ok := b.sigs[name]; !ok && b.generics[name] == nil && isBuiltin(n.Name.Lexeme) {
+			return n.Name.Lexeme
+		}
+		return name
+	}
+
+	if field, ok := n.Callee.(*parser.Field); ok {
+		if v, ok := field.Object.(*parser.Variable); ok && b.lookup(v.Name.Lexeme) == nil {
+			if path, ok := b.pkg.Imports[v.Name.Lexeme]; ok {
+				return mangle(path, field.Name.Lexeme)
+			}
+		}
+		b.resolve(field)
+		if b.exprType(field.Object) != Iface {
+			b.receivers[n] = field.Object
+			return b.exprDefined(field.Object) + "." + field.Name.Lexeme
+		}
+		return ""
+	}
+	b.resolve(n.Callee)
+	return ""
+}
+
+// Returns the type of the fn value a method of a value evaluates to, which
+// is bound to that value, or an empty type when it has no such method. The
+// methods of interfaces are resolved from the package declaring them.
+func (b *builder) methodType(n *parser.Field) Type {
+	def := b.exprDefined(n.Object)
+	if sig, ok := b.sigs[def+"."+n.Name.Lexeme]; ok && b.exprType(n.Object) != Iface {
+		return FnOf(sig.types[1:], sig.ret)
+	}
+	a, ok := b.aliases[def]
+	if !ok || a.def.Interface == nil {
+		return ""
+	}
+	defer func(pkg *Package) { b.pkg = pkg }(b.pkg)
+	b.pkg = a.pkg
+	for _, m := range a.def.Interface.Methods {
+		if m.Name.Lexeme != n.Name.Lexeme {
+			continue
+		}
+		params := []Type{}
+		for _, p := range paramDecls(m.Args) {
+			if p.Name.Lexeme != "self" {
+				params = append(params, b.typeOf(p.Type))
+			}
+		}
+		return FnOf(params, b.typeOf(m.Type))
+	}
+	return ""
+}
+
+// Returns the mangled name of the type defined by definetype of a resolved
+// expression, an empty one when it isn't known to have one
+func (b *builder) exprDefined(expr parser.IExpression) string {
+	switch n := expr.(type) {
+	case *parser.Variable:
+		return b.locals[n.Name].def
+	case *parser.Grouping:
+		return b.exprDefined(n.Grouped)
+	case *parser.Assign:
+		if n.Target == nil {
+			return b.locals[n.Name].def
+		}
+	case *parser.FnCall:
+		if sig, ok := b.sigs[b.callees[n]]; ok {
+			return sig.def
+		}
+	}
+	return ""
+}
+
+// Binds a name to the variable or constant it refers to, capturing the
+// variable when a lambda is being resolved, or to the fn of the package it
+// names when there is none
+func (b *builder) resolveName(name *lexer.Token) *local {
+	l, depth := b.lookupDepth(name.Lexeme)
+	if l == nil {
+		l = b.fnValue(name)
+	}
+	b.capture(l, depth)
+	b.locals[name] = l
+	return l
+}
+
+// Returns the fn of the package name refers to as a value
+func (b *builder) fnValue(name *lexer.Token) *local {
+	fn := mangle(b.pkg.Path, name.Lexeme)
+	sig, ok := b.sigs[fn]
+	switch {
+	case b.generics[fn] != nil:
+		b.fail(name, "generic fn values are not supported by the IR")
+	case !ok:
+		b.fail(name, "unknown variable %s", name.Lexeme)
+	case sig.results != nil:
+		b.fail(name, "values of fns returning several values are not supported by the IR")
+	}
+	return &local{name: name.Lexeme, typ: FnOf(sig.types, sig.ret), fn: fn}
+}
+
+// Returns the expression giving the fn value a call is to
+func callee(n *parser.FnCall) parser.IExpression {
+	if n.Callee != nil {
+		return n.Callee
+	}
+	return &parser.Variable{Loc: n.Loc, Name: n.Name}
+}
+
+// Builtins lowered to calls to the runtime, to the instruction recovering
+// from a panic or to results
+func isBuiltin(name string) bool {
+	switch name {
+	case "print", "panic", "recover", "Ok", "Err":
+		return true
+	}
+	return false
+}
+
+// Returns the types of the values a fn returning several of them returns,
+// nil for the other fns
+func (b *builder) resultTypes(name string) []Type {
+	if sig, ok := b.sigs[name]; ok {
+		return sig.results
+	}
+	if name == "recover" {
+		return []Type{String, Bool}
+	}
+	return nil
+}
+
+// Returns the type of binding i of a pattern matching a result of type t:
+// the one of its value for Ok and of its error for Err
+func (b *builder) variantType(p *parser.VariantPattern, t Type, i int) Type {
+	value, err := t.Outcomes()
+	switch {
+	case i > 0:
+	case p.Variant.Lexeme == "Ok":
+		return value
+	case p.Variant.Lexeme == "Err":
+		return err
+	}
+	b.fail(p, "pattern %s binds %d values of a Result", p.Variant.Lexeme, len(p.Bindings))
+	return Void
+}
+
+// Returns the type of a resolved expression, or an empty type for integer
+// constants whose type is given by where they are used
+func (b *builder) exprType(expr parser.IExpression) Type {
+	switch n := expr.(type) {
+	case *parser.Literal:
+		switch {
+		case n.Value == nil:
+		case n.Value.TokenType == lexer.True || n.Value.TokenType == lexer.False:
+			return Bool
+		case n.Value.TokenType == lexer.String:
+			return String
+		case isNumber(n.Value) && strings.Contains(n.Value.Lexeme, "."):
+			return Float
+		}
+	case *parser.Variable:
+		return b.locals[n.Name].typ
+	case *parser.Grouping:
+		return b.exprType(n.Grouped)
+	case *parser.Binary:
+		if isCompare(n.Operator.TokenType) || isLogical(n.Operator.TokenType) {
+			return Bool
+		}
+		if t := b.exprType(n.Left); t != "" || isShift(n.Operator.TokenType) {
+			return t
+		}
+		return b.exprType(n.Right)
+	case *parser.Logical:
+		return Bool
+	case *parser.UnaryRight:
+		if n.Operator.TokenType == lexer.Bang {
+			return Bool
+		}
+		return b.exprType(n.Right)
+	case *parser.Assign:
+		if n.Target != nil {
+			return b.exprType(n.Target)
+		}
+		return b.locals[n.Name].typ
+	case *parser.PrefixIncDec:
+		return b.exprType(n.Target)
+	case *parser.PostfixIncDec:
+		return b.exprType(n.Target)
+	case *parser.AddressOf:
+		return PointerTo(b.exprType(n.Operand))
+	case *parser.Deref:
+		if t := b.exprType(n.Operand); t.IsPointer() {
+			return t.Elem()
+		}
+	case *parser.FnCall:
+		if sig, ok := b.sigs[b.callees[n]]; ok {
+			return sig.ret
+		}
+		switch b.callees[n] {
+		case "":
+			_, ret := b.exprType(callee(n)).Signature()
+			return ret
+		case "Ok", "Err":
+			// Given by the hint
+			return ""
+		}
+		return Void
+	case *parser.Field:
+		return b.methodType(n)
+	case *parser.Lambda:
+		return b.lambdaType(n)
+	case *parser.IfExpr:
+		return b.exprType(branchValue(n.ThenBranch))
+	case *parser.Try:
+		if t := b.exprType(n.Operand); t.IsResult() {
+			value, _ := t.Outcomes()
+			return value
+		}
+	case *parser.MatchExpr:
+		for _, arm := range n.Arms {
+			if t := b.exprType(armValue(arm.Body)); t != "" {
+				return t
+			}
+		}
+	case *parser.MakeChan:
+		return b.typeOf(n.Type)
+	case *parser.Send:
+		return Void
+	case *parser.Receive:
+		if t := b.exprType(n.Channel); t.IsChan() {
+			return t.Elem()
+		}
+	}
+	return ""
+}
+
+// Returns the types of the values of a tuple or of a call to a fn returning
+// several values, nil for other expressions
+func (b *builder) tupleTypes(expr parser.IExpression) []Type {
+	switch n := expr.(type) {
+	case *parser.Grouping:
+		return b.tupleTypes(n.Grouped)
+	case *parser.Tuple:
+		types := []Type{}
+		for _, elem := range n.Elems {
+			t := b.exprType(elem)
+			if t == "" {
+				t = Int
+			}
+			types = append(types, t)
+		}
+		return types
+	case *parser.FnCall:
+		return b.resultTypes(b.callees[n])
+	}
+	return nil
+}
+
+// Returns the expression the body of a match arm evaluates to, nil if it
+// has none
+func armValue(body parser.IStatement) parser.IExpression {
+	if _, ok := body.(*parser.Block); ok {
+		return branchValue(body)
+	}
+	return body.(parser.IExpression)
+}
+
+// Returns the trailing expression a branch evaluates to, nil if it has none
+func branchValue(stmt parser.IStatement) parser.IExpression {
+	switch n := stmt.(type) {
+	case *parser.Block:
+		if len(n.Statements) > 0 {
+			return branchValue(n.Statements[len(n.Statements)-1])
+		}
+	case *parser.FnReturn:
+		if n.Implicit {
+			return n.Value
+		}
+	case *parser.IfExpr:
+		return n
+	}
+	return nil
+}
+
+func isNumber(tk *lexer.Token) bool {
+	switch tk.TokenType {
+	case lexer.Number2, lexer.Number8, lexer.Number10, lexer.Number16:
+		return true
+	}
+	return false
+}
+
+func isCompare(op lexer.TokenType) bool {
+	switch op {
+	case lexer.EqualEqual, lexer.BangEqual, lexer.Lesser, lexer.LesserEqual,
+		lexer.Greater, lexer.GreaterEqual:
+		return true
+	}
+	return false
+}
+
+func isLogical(op lexer.TokenType) bool {
+	return op == lexer.DoubleAmpersand || op == lexer.DoublePipe
+}
+
+func isShift(op lexer.TokenType) bool {
+	return op == lexer.Shl || op == lexer.Shr
+}
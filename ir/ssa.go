@@ -0,0 +1,124 @@
+package ir
+
+// SSA construction following "Simple and Efficient Construction of Static
+// Single Assignment Form" by Braun et al. Each block records the value of
+// the variables assigned in it, and reading a variable in a block that
+// doesn't assign it looks it up in its predecessors, placing a phi where
+// they join. A block is sealed once all of its predecessors are known;
+// until then the phis it needs are left without args.
+
+func (b *builder) writeVar(l *local, block *Block, v Value) {
+	if b.defs[block] == nil {
+		b.defs[block] = map[*local]Value{}
+	}
+	b.defs[block][l] = v
+}
+
+func (b *builder) readVar(l *local, block *Block) Value {
+	if v, ok := b.defs[block][l]; ok {
+		return v
+	}
+
+	var v Value
+	switch {
+	case !b.sealed[block]:
+		phi := b.newPhi(block, l.typ)
+		b.incomplete[block] = append(b.incomplete[block], phi)
+		b.phiVars[phi] = l
+		v = phi
+	case len(block.Preds) == 0:
+		// Only reached through a goto skipping the declaration
+		v = Zero(l.typ)
+	case len(block.Preds) == 1:
+		v = b.readVar(l, block.Preds[0])
+	default:
+		phi := b.newPhi(block, l.typ)
+		b.writeVar(l, block, phi)
+		v = b.addPhiArgs(l, phi)
+	}
+	b.writeVar(l, block, v)
+	return v
+}
+
+func (b *builder) newPhi(block *Block, t Type) *Instr {
+	phi := b.f.NewInstr(OpPhi, t)
+	block.Insert(len(block.Phis()), phi)
+	return phi
+}
+
+func (b *builder) addPhiArgs(l *local, phi *Instr) Value {
+	for _, pred := range phi.Block.Preds {
+		phi.Args = append(phi.Args, b.readVar(l, pred))
+	}
+	return b.removeTrivialPhi(phi)
+}
+
+// Replaces a phi whose args are all the same value, or the phi itself, by
+// that value. Phis using the removed one may become trivial in turn.
+func (b *builder) removeTrivialPhi(phi *Instr) Value {
+	var same Value
+	for _, arg := range phi.Args {
+		if arg == same || arg == phi {
+			continue
+		}
+		if same != nil {
+			return phi
+		}
+		same = arg
+	}
+	if same == nil {
+		same = Zero(phi.Typ)
+	}
+
+	users := []*Instr{}
+	for _, block := range b.f.Blocks {
+		for _, i := range block.Phis() {
+			if i != phi && uses(i, phi) {
+				users = append(users, i)
+			}
+		}
+	}
+
+	phi.Block.Remove(phi)
+	b.f.ReplaceUses(phi, same)
+	for _, defs := range b.defs {
+		for l, v := range defs {
+			if v == phi {
+				defs[l] = same
+			}
+		}
+	}
+
+	for _, u := range users {
+		if contains(u.Block.Instrs, u) {
+			b.removeTrivialPhi(u)
+		}
+	}
+	return same
+}
+
+func uses(i *Instr, v Value) bool {
+	for _, arg := range i.Args {
+		if arg == v {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(instrs []*Instr, i *Instr) bool {
+	for _, instr := range instrs {
+		if instr == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Marks block as having all of its predecessors, completing its phis
+func (b *builder) seal(block *Block) {
+	for _, phi := range b.incomplete[block] {
+		b.addPhiArgs(b.phiVars[phi], phi)
+	}
+	b.sealed[block] = true
+}
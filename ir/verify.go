@@ -0,0 +1,384 @@
+package ir
+
+import (
+	"fmt"
+)
+
+type verifier struct {
+	m    *Module
+	f    *Func
+	errs []error
+}
+
+// Checks that the fns of m are well formed: blocks end with a single
+// terminator matching their successors, phis come first and have an arg for
+// each predecessor, every value is defined before it is used on all paths
+// and instructions get operands of the types they expect. Returns every
+// problem found.
+func Verify(m *Module) []error {
+	v := &verifier{m: m}
+	for _, f := range m.Funcs {
+		v.f = f
+		v.fn()
+	}
+	return v.errs
+}
+
+func (v *verifier) errorf(b *Block, i *Instr, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	switch {
+	case i != nil:
+		msg = fmt.Sprintf("fn %s: %s: %s: %s", v.f.Name, b, i.Format(), msg)
+	case b != nil:
+		msg = fmt.Sprintf("fn %s: %s: %s", v.f.Name, b, msg)
+	default:
+		msg = fmt.Sprintf("fn %s: %s", v.f.Name, msg)
+	}
+	v.errs = append(v.errs, fmt.Errorf("%s", msg))
+}
+
+func (v *verifier) fn() {
+	f := v.f
+	if len(f.Blocks) == 0 {
+		v.errorf(nil, nil, "no blocks")
+		return
+	}
+	if len(f.Entry().Preds) > 0 {
+		v.errorf(f.Entry(), nil, "entry block has predecessors")
+	}
+
+	blocks := map[*Block]bool{}
+	defs := map[Value]*Block{}
+	index := map[*Instr]int{}
+	for _, p := range f.Params {
+		defs[p] = nil
+	}
+	for _, b := range f.Blocks {
+		blocks[b] = true
+		for n, i := range b.Instrs {
+			if _, ok := defs[i]; ok {
+				v.errorf(b, i, "instruction defined twice")
+			}
+			defs[i] = b
+			index[i] = n
+		}
+	}
+
+	for _, b := range f.Blocks {
+		v.edges(b, blocks)
+	}
+	if len(v.errs) > 0 {
+		return
+	}
+
+	dom := f.Dominators()
+	for _, b := range f.Blocks {
+		for n, i := range b.Instrs {
+			if i.Block != b {
+				v.errorf(b, i, "instruction not owned by its block")
+			}
+			if i.Op == OpPhi && n > len(b.Phis()) {
+				v.errorf(b, i, "phi after other instructions")
+			}
+			v.types(b, i)
+
+			if !dom.Reachable(b) {
+				continue
+			}
+			for j, arg := range i.Args {
+				switch arg := arg.(type) {
+				case *Const:
+					continue
+				case *Instr:
+					if arg.Typ == Void {
+						v.errorf(b, i, "%s has no value", arg)
+						continue
+					}
+				}
+				d, ok := defs[arg]
+				switch {
+				case !ok:
+					v.errorf(b, i, "%s is not defined in the fn", arg)
+				case d == nil:
+					// Params are defined on entry
+				case i.Op == OpPhi && j < len(b.Preds):
+					pred := b.Preds[j]
+					if !dom.Dominates(d, pred) {
+						v.errorf(b, i, "%s does not dominate the end of %s", arg, pred)
+					}
+				case d == b && index[arg.(*Instr)] >= n:
+					v.errorf(b, i, "%s is used before its definition", arg)
+				case !dom.Dominates(d, b):
+					v.errorf(b, i, "%s does not dominate its use", arg)
+				}
+			}
+		}
+	}
+}
+
+// Checks the terminator of b against its successors, and that its edges
+// are recorded on both ends
+func (v *verifier) edges(b *Block, blocks map[*Block]bool) {
+	t := b.Terminator()
+	if t == nil {
+		v.errorf(b, nil, "missing terminator")
+		return
+	}
+	for _, i := range b.Instrs[:len(b.Instrs)-1] {
+		if i.Op.IsTerminator() {
+			v.errorf(b, i, "terminator in the middle of the block")
+		}
+	}
+
+	succs := 0
+	switch t.Op {
+	case OpJump:
+		succs = 1
+	case OpBranch:
+		succs = 2
+	}
+	if len(b.Succs) != succs {
+		v.errorf(b, t, "%d successors instead of %d", len(b.Succs), succs)
+	}
+
+	for _, s := range b.Succs {
+		if !blocks[s] {
+			v.errorf(b, nil, "successor %s is not a block of the fn", s)
+		} else if count(s.Preds, b) != count(b.Succs, s) {
+			v.errorf(b, nil, "successor %s does not list it as a predecessor", s)
+		}
+	}
+	for _, p := range b.Preds {
+		if !blocks[p] {
+			v.errorf(b, nil, "predecessor %s is not a block of the fn", p)
+		} else if count(p.Succs, b) != count(b.Preds, p) {
+			v.errorf(b, nil, "predecessor %s does not list it as a successor", p)
+		}
+	}
+}
+
+func count(blocks []*Block, b *Block) int {
+	n := 0
+	for _, block := range blocks {
+		if block == b {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *verifier) types(b *Block, i *Instr) {
+	args := func(n int) bool {
+		if len(i.Args) != n {
+			v.errorf(b, i, "%d operands instead of %d", len(i.Args), n)
+			return false
+		}
+		return true
+	}
+	sameTypes := func(t Type) {
+		for _, arg := range i.Args {
+			if arg.Type() != t {
+				v.errorf(b, i, "operand %s of type %s instead of %s", arg, arg.Type(), t)
+			}
+		}
+	}
+
+	switch {
+	case i.Op.IsBinary() && args(2):
+		sameTypes(i.Typ)
+		if !binaryAllowed(i.Op, i.Typ) {
+			v.errorf(b, i, "%s does not apply to %s", i.Op, i.Typ)
+		}
+	case i.Op.IsUnary() && args(1):
+		sameTypes(i.Typ)
+		if (i.Op == OpNot) != (i.Typ == Bool) || (i.Op == OpNeg && !isNumeric(i.Typ)) {
+			v.errorf(b, i, "%s does not apply to %s", i.Op, i.Typ)
+		}
+	case i.Op.IsCompare() && args(2):
+		t := i.Args[0].Type()
+		sameTypes(t)
+		if i.Typ != Bool {
+			v.errorf(b, i, "comparison of type %s instead of bool", i.Typ)
+		}
+		if i.Op != OpEq && i.Op != OpNe && !isNumeric(t) || t.IsResult() {
+			v.errorf(b, i, "%s does not apply to %s", i.Op, t)
+		}
+	case (i.Op == OpAlloca || i.Op == OpNew) && args(0):
+		if !i.Typ.IsPointer() {
+			v.errorf(b, i, "%s of type %s instead of a pointer", i.Op, i.Typ)
+		}
+	case i.Op == OpLoad && args(1):
+		if i.Args[0].Type() != PointerTo(i.Typ) {
+			v.errorf(b, i, "load of %s through %s", i.Typ, i.Args[0].Type())
+		}
+	case i.Op == OpStore && args(2):
+		if i.Args[0].Type() != PointerTo(i.Args[1].Type()) {
+			v.errorf(b, i, "store of %s through %s", i.Args[1].Type(), i.Args[0].Type())
+		}
+	case i.Op == OpChan && args(1):
+		sameTypes(Int)
+		if !i.Typ.IsChan() {
+			v.errorf(b, i, "chan of type %s instead of a channel", i.Typ)
+		}
+	case i.Op == OpSend && args(2):
+		if i.Args[0].Type() != ChanOf(i.Args[1].Type()) {
+			v.errorf(b, i, "send of %s to %s", i.Args[1].Type(), i.Args[0].Type())
+		}
+	case i.Op == OpRecv && args(1):
+		if i.Args[0].Type() != ChanOf(i.Typ) {
+			v.errorf(b, i, "recv of %s from %s", i.Typ, i.Args[0].Type())
+		}
+	case i.Op == OpCall || i.Op == OpDefer || i.Op == OpSpawn:
+		v.call(b, i)
+	case i.Op == OpClosure:
+		v.closure(b, i)
+	case i.Op == OpApply:
+		v.apply(b, i)
+	case i.Op == OpIface && args(1):
+		if i.Typ != Iface || i.Callee == "" {
+			v.errorf(b, i, "iface of type %s instead of an iface of a named type", i.Typ)
+		}
+	case i.Op == OpMethod && args(1):
+		sameTypes(Iface)
+		if !i.Typ.IsFn() || i.Callee == "" {
+			v.errorf(b, i, "method of type %s instead of a named fn", i.Typ)
+		}
+	case (i.Op == OpOk || i.Op == OpErr) && args(1):
+		if !i.Typ.IsResult() {
+			v.errorf(b, i, "%s of type %s instead of a result", i.Op, i.Typ)
+			break
+		}
+		value, err := i.Typ.Outcomes()
+		if i.Op == OpErr {
+			value = err
+		}
+		sameTypes(value)
+	case (i.Op == OpIsOk || i.Op == OpValue || i.Op == OpError) && args(1):
+		t := i.Args[0].Type()
+		if !t.IsResult() {
+			v.errorf(b, i, "%s of %s instead of a result", i.Op, t)
+			break
+		}
+		value, err := t.Outcomes()
+		want := map[Op]Type{OpIsOk: Bool, OpValue: value, OpError: err}[i.Op]
+		if i.Typ != want {
+			v.errorf(b, i, "%s of type %s instead of %s", i.Op, i.Typ, want)
+		}
+	case i.Op == OpRecover && args(2):
+		if i.Args[0].Type() != PointerTo(String) || i.Args[1].Type() != PointerTo(Bool) {
+			v.errorf(b, i, "recover through %s and %s instead of *string and *bool", i.Args[0].Type(), i.Args[1].Type())
+		}
+	case i.Op == OpPhi:
+		if len(i.Args) != len(b.Preds) {
+			v.errorf(b, i, "%d args for %d predecessors", len(i.Args), len(b.Preds))
+		}
+		sameTypes(i.Typ)
+	case i.Op == OpBranch && args(1):
+		sameTypes(Bool)
+	case i.Op == OpRet && v.f.Ret == Void:
+		args(0)
+	case i.Op == OpRet && args(1):
+		sameTypes(v.f.Ret)
+	}
+
+	if i.Typ != Void && (i.Op == OpStore || i.Op == OpSend || i.Op == OpRecover || i.Op.IsTerminator()) {
+		v.errorf(b, i, "%s of type %s instead of void", i.Op, i.Typ)
+	}
+}
+
+func (v *verifier) call(b *Block, i *Instr) {
+	callee := v.m.Func(i.Callee)
+	if i.Tail && (callee == nil || !i.InTailPosition()) {
+		v.errorf(b, i, "tail call not returning its result to a fn of the module")
+	}
+	if i.Tail && v.f.HasDefers() {
+		v.errorf(b, i, "tail call from a fn deferring calls, which run after it")
+	}
+	if callee == nil {
+		if i.Callee != "print" && i.Callee != "panic" || i.Op != OpCall {
+			v.errorf(b, i, "unknown fn %s", i.Callee)
+		} else if i.Typ != Void {
+			v.errorf(b, i, "%s returns void", i.Callee)
+		}
+		return
+	}
+
+	if len(i.Args) != len(callee.Params) {
+		v.errorf(b, i, "%d args instead of %d", len(i.Args), len(callee.Params))
+		return
+	}
+	for j, arg := range i.Args {
+		if arg.Type() != callee.Params[j].Typ {
+			v.errorf(b, i, "arg %s of type %s instead of %s", arg, arg.Type(), callee.Params[j].Typ)
+		}
+	}
+	if i.Op == OpCall && i.Typ != callee.Ret {
+		v.errorf(b, i, "call of type %s instead of %s", i.Typ, callee.Ret)
+	}
+}
+
+// Checks that a closure captures values of the types of the first params
+// of its fn, the others and its return type giving the type of the closure
+func (v *verifier) closure(b *Block, i *Instr) {
+	callee := v.m.Func(i.Callee)
+	if callee == nil {
+		v.errorf(b, i, "unknown fn %s", i.Callee)
+		return
+	}
+	if !i.Typ.IsFn() {
+		v.errorf(b, i, "closure of type %s instead of a fn", i.Typ)
+		return
+	}
+
+	if len(i.Args) > len(callee.Params) {
+		v.errorf(b, i, "%d captures for %d params", len(i.Args), len(callee.Params))
+		return
+	}
+	for j, arg := range i.Args {
+		if arg.Type() != callee.Params[j].Typ {
+			v.errorf(b, i, "capture %s of type %s instead of %s", arg, arg.Type(), callee.Params[j].Typ)
+		}
+	}
+	params := []Type{}
+	for _, param := range callee.Params[len(i.Args):] {
+		params = append(params, param.Typ)
+	}
+	if t := FnOf(params, callee.Ret); i.Typ != t {
+		v.errorf(b, i, "closure of type %s instead of %s", i.Typ, t)
+	}
+}
+
+func (v *verifier) apply(b *Block, i *Instr) {
+	if len(i.Args) == 0 || !i.Args[0].Type().IsFn() {
+		v.errorf(b, i, "apply of a value that isn't a fn")
+		return
+	}
+
+	params, ret := i.Args[0].Type().Signature()
+	if len(i.Args)-1 != len(params) {
+		v.errorf(b, i, "%d args instead of %d", len(i.Args)-1, len(params))
+		return
+	}
+	for j, arg := range i.Args[1:] {
+		if arg.Type() != params[j] {
+			v.errorf(b, i, "arg %s of type %s instead of %s", arg, arg.Type(), params[j])
+		}
+	}
+	if i.Typ != ret {
+		v.errorf(b, i, "apply of type %s instead of %s", i.Typ, ret)
+	}
+}
+
+func isNumeric(t Type) bool {
+	return t.IsInteger() || t == Float
+}
+
+func binaryAllowed(op Op, t Type) bool {
+	switch op {
+	case OpAdd, OpSub, OpMul, OpDiv:
+		return isNumeric(t)
+	case OpAnd, OpOr, OpXor:
+		return t.IsInteger() || t == Bool
+	}
+	return t.IsInteger()
+}
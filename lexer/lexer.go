@@ -32,6 +32,20 @@ func NewLexer(ctx context.Context, source string) *Lexer {
 	keywords["switch"] = Switch
 	keywords["goto"] = Goto
 	keywords["definetype"] = DefineType
+	keywords["enum"] = Enum
+	keywords["match"] = Match
+	keywords["spawn"] = Spawn
+	keywords["chan"] = Chan
+	keywords["import"] = Import
+	keywords["pub"] = Pub
+	keywords["const"] = Const
+	keywords["case"] = Case
+	keywords["default"] = Default
+	keywords["impl"] = Impl
+	keywords["interface"] = Interface
+	keywords["defer"] = Defer
+	keywords["break"] = Break
+	keywords["continue"] = Continue
 
 	return &Lexer{
 		source:   source,
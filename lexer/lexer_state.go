@@ -52,8 +52,10 @@ func numberState(l *Lexer) stateFn {
 
 func stringState(l *Lexer) stateFn {
 	l.ignore()
-	l.advance()
 	for l.peek() != '"' {
+		if l.isEof() {
+			panic(fmt.Sprintf("error: unterminated string at line %d", l.line))
+		}
 		l.advance()
 	}
 	l.emit(String)
@@ -93,11 +95,19 @@ func simpleTokenState(l *Lexer) stateFn {
 	case ';':
 		l.emit(Semicolon)
 	case '.':
-		l.emit(Dot)
+		if l.peek() == '.' && l.peekNext() == '.' {
+			l.advance()
+			l.advance()
+			l.emit(Ellipsis)
+		} else {
+			l.emit(Dot)
+		}
 	case ']':
 		l.emit(RightBracket)
 	case '[':
 		l.emit(LeftBracket)
+	case '?':
+		l.emit(Question)
 	}
 
 	return stateMatch
@@ -134,7 +144,12 @@ func compoundTokenState(l *Lexer) stateFn {
 			l.emit(GreaterEqual)
 		case '>':
 			l.advance()
-			l.emit(Shr)
+			if l.peek() == '=' {
+				l.advance()
+				l.emit(ShrEqual)
+			} else {
+				l.emit(Shr)
+			}
 		default:
 			l.emit(Greater)
 		}
@@ -149,7 +164,12 @@ func compoundTokenState(l *Lexer) stateFn {
 			l.emit(RightArrow)
 		case '<':
 			l.advance()
-			l.emit(Shl)
+			if l.peek() == '=' {
+				l.advance()
+				l.emit(ShlEqual)
+			} else {
+				l.emit(Shl)
+			}
 		default:
 			l.emit(Lesser)
 		}
@@ -213,6 +233,9 @@ func compoundTokenState(l *Lexer) stateFn {
 		case '|':
 			l.advance()
 			l.emit(DoublePipe)
+		case '=':
+			l.advance()
+			l.emit(PipeEqual)
 		default:
 			l.emit(Pipe)
 		}
@@ -221,9 +244,20 @@ func compoundTokenState(l *Lexer) stateFn {
 		case '&':
 			l.advance()
 			l.emit(DoubleAmpersand)
+		case '=':
+			l.advance()
+			l.emit(AmpersandEqual)
 		default:
 			l.emit(Ampersand)
 		}
+	case '%':
+		switch l.peek() {
+		case '=':
+			l.advance()
+			l.emit(RemEqual)
+		default:
+			l.emit(Rem)
+		}
 	}
 
 	return stateMatch
@@ -241,6 +275,7 @@ func numberWithBaseState(l *Lexer) stateFn {
 	case 'b':
 		readBase2(l)
 	case 'o':
+		l.advance()
 		readBase8(l)
 	default:
 		readBase8(l)
@@ -311,10 +346,10 @@ func stateMatch(l *Lexer) stateFn {
 	}
 	c := l.advance()
 	switch c {
-	case ')', '(', '}', '{', ',', ':', ';', '.', '[', ']':
+	case ')', '(', '}', '{', ',', ':', ';', '.', '[', ']', '?':
 		return simpleTokenState
 
-	case '!', '=', '>', '<', '-', '*', '/', '+', '|', '&':
+	case '!', '=', '>', '<', '-', '*', '/', '+', '|', '&', '^', '%':
 		return compoundTokenState
 
 	case ' ', '\t', '\r':
@@ -42,3 +42,69 @@ func TestComments(t *testing.T) {
 		}
 	})
 }
+
+func TestCompoundAssignment(t *testing.T) {
+	src := `+= -= *= /= ^= %= <<= >>= &= |= % ^ << >>`
+	expected := []lexer.TokenType{
+		lexer.PlusEqual, lexer.MinusEqual, lexer.StarEqual, lexer.SlashEqual,
+		lexer.XorEqual, lexer.RemEqual, lexer.ShlEqual, lexer.ShrEqual,
+		lexer.AmpersandEqual, lexer.PipeEqual, lexer.Rem, lexer.Xor,
+		lexer.Shl, lexer.Shr, lexer.Eof,
+	}
+
+	l := lexer.NewLexer(context.Background(), src)
+
+	tokens, err := l.Scan()
+	if err != nil {
+		panic(err)
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %+v\n", len(expected), len(tokens), tokens)
+	}
+
+	for i, token := range tokens {
+		if token.TokenType != expected[i] {
+			t.Errorf("token %d: expected %s, got %s\n", i, expected[i], token.TokenType)
+		}
+	}
+}
+
+func TestQuestionMark(t *testing.T) {
+	tokens, err := lexer.NewLexer(context.Background(), `parse(s)?;`).Scan()
+	if err != nil {
+		panic(err)
+	}
+
+	if len(tokens) != 7 || tokens[4].TokenType != lexer.Question {
+		t.Errorf("expected a question mark after the call, got %+v\n", tokens)
+	}
+}
+
+func TestEmptyString(t *testing.T) {
+	tokens, err := lexer.NewLexer(context.Background(), `"" "a"`).Scan()
+	if err != nil {
+		panic(err)
+	}
+
+	if len(tokens) != 3 || tokens[0].Lexeme != "" || tokens[1].Lexeme != "a" {
+		t.Errorf("expected an empty and a one letter string, got %+v\n", tokens)
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	tokens, err := lexer.NewLexer(context.Background(), `...int a.b`).Scan()
+	if err != nil {
+		panic(err)
+	}
+
+	expected := []lexer.TokenType{lexer.Ellipsis, lexer.Identifier, lexer.Identifier, lexer.Dot, lexer.Identifier, lexer.Eof}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %+v\n", len(expected), len(tokens), tokens)
+	}
+	for i, token := range tokens {
+		if token.TokenType != expected[i] {
+			t.Errorf("token %d: expected %s, got %s\n", i, expected[i], token.TokenType)
+		}
+	}
+}
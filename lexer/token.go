@@ -35,6 +35,8 @@ const (
 	Colon
 	Semicolon
 	Dot
+	Question
+	Ellipsis
 
 	Star
 	Minus
@@ -64,6 +66,11 @@ const (
 	Rem
 	Shl
 	Shr
+	RemEqual
+	ShlEqual
+	ShrEqual
+	AmpersandEqual
+	PipeEqual
 
 	LeftArrow
 	RightArrow
@@ -81,6 +88,20 @@ const (
 	Null
 	Switch
 	Goto
+	Enum
+	Match
+	Spawn
+	Chan
+	Import
+	Pub
+	Const
+	Case
+	Default
+	Impl
+	Interface
+	Defer
+	Break
+	Continue
 
 	Identifier
 	String
@@ -120,6 +141,10 @@ func (t TokenType) String() string {
 		return "semicolon"
 	case Dot:
 		return "dot"
+	case Question:
+		return "question mark"
+	case Ellipsis:
+		return "ellipsis"
 
 	case Star:
 		return "star"
@@ -176,6 +201,16 @@ func (t TokenType) String() string {
 		return "shift left"
 	case Shr:
 		return "shift right"
+	case RemEqual:
+		return "rem assign"
+	case ShlEqual:
+		return "shift left assign"
+	case ShrEqual:
+		return "shift right assign"
+	case AmpersandEqual:
+		return "ampersand assign"
+	case PipeEqual:
+		return "pipe assign"
 
 	case LeftArrow:
 		return "left arrow"
@@ -204,6 +239,38 @@ func (t TokenType) String() string {
 		return "false"
 	case Null:
 		return "NULL"
+	case Switch:
+		return "switch"
+	case Goto:
+		return "goto"
+	case Enum:
+		return "enum"
+	case Match:
+		return "match"
+	case Spawn:
+		return "spawn"
+	case Chan:
+		return "chan"
+	case Import:
+		return "import"
+	case Pub:
+		return "pub"
+	case Const:
+		return "const"
+	case Case:
+		return "case"
+	case Default:
+		return "default"
+	case Impl:
+		return "impl"
+	case Interface:
+		return "interface"
+	case Defer:
+		return "defer"
+	case Break:
+		return "break"
+	case Continue:
+		return "continue"
 
 	case Identifier:
 		return "identifier"
@@ -239,6 +306,34 @@ const (
 	HighestPrec = 7
 )
 
+// Returns the binary operator applied by a compound assignment operator, or
+// Eof when op isn't one
+func (op TokenType) CompoundOperator() TokenType {
+	switch op {
+	case PlusEqual:
+		return Plus
+	case MinusEqual:
+		return Minus
+	case StarEqual:
+		return Star
+	case SlashEqual:
+		return Slash
+	case XorEqual:
+		return Xor
+	case RemEqual:
+		return Rem
+	case ShlEqual:
+		return Shl
+	case ShrEqual:
+		return Shr
+	case AmpersandEqual:
+		return Ampersand
+	case PipeEqual:
+		return Pipe
+	}
+	return Eof
+}
+
 func (op TokenType) Precedence() int {
 	switch op {
 	case DoublePipe:
@@ -0,0 +1,485 @@
+package llvm
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"yal/ir"
+	"yal/parser"
+)
+
+type genError struct {
+	error
+}
+
+type generator struct {
+	m       *ir.Module
+	w       *strings.Builder
+	strs    map[string]string
+	strList []string
+	used    map[string]bool
+
+	// Metadata nodes, !N being meta[N], along with the nodes of the files
+	// and locations already described
+	meta  []string
+	files map[string]int
+	locs  map[[3]uint64]int
+
+	// State of the fn being generated
+	f     *ir.Func
+	scope int
+	loc   int
+}
+
+// Metadata nodes every module starts with
+const (
+	unitNode = iota
+	debugVersionNode
+	dwarfVersionNode
+	fnTypeNode
+	fnTypesNode
+)
+
+// Writes the LLVM IR text of a valid module to w, along with the runtime
+// it calls and a C main exiting with what main returns, or 0 when it returns
+// nothing. The module only depends on libc and uses opaque pointers. Debug
+// info gives the position of every instruction lowered from a node, in the
+// file files maps the name of its fn to.
+func Generate(w io.Writer, m *ir.Module, files map[string]string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(genError)
+			if !ok {
+				panic(r)
+			}
+			err = e.error
+		}
+	}()
+
+	main := m.Func("main")
+	if main == nil {
+		return fmt.Errorf("no main fn")
+	}
+	if len(main.Params) > 0 {
+		return fmt.Errorf("main takes no params")
+	}
+
+	g := &generator{
+		m:     m,
+		w:     &strings.Builder{},
+		strs:  map[string]string{},
+		used:  map[string]bool{},
+		meta:  make([]string, fnTypesNode+1),
+		files: map[string]int{},
+		locs:  map[[3]uint64]int{},
+	}
+	for _, f := range m.Funcs {
+		g.genFunc(f, files[f.Name])
+	}
+
+	g.emit("\ndefine i32 @main() {")
+	if main.Ret == ir.Void {
+		g.emit("  call void @%s()\n  ret i32 0", symbol("main"))
+	} else {
+		g.emit("  %%ret = call %s @%s()", typeOf(main.Ret), symbol("main"))
+		g.emit("  %%code = trunc %s %%ret to i32\n  ret i32 %%code", typeOf(main.Ret))
+	}
+	g.emit("}")
+	for _, h := range helpers {
+		if g.used[h.name] {
+			g.emit("\n%s", h.text)
+		}
+	}
+
+	// The compile unit is described as C, DWARF having no code for yal
+	cuFile := g.file(files[main.Name])
+	g.meta[unitNode] = fmt.Sprintf(`distinct !DICompileUnit(language: DW_LANG_C99, file: !%d, producer: "yal", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug)`, cuFile)
+	g.meta[debugVersionNode] = `!{i32 2, !"Debug Info Version", i32 3}`
+	g.meta[dwarfVersionNode] = `!{i32 7, !"Dwarf Version", i32 4}`
+	g.meta[fnTypeNode] = fmt.Sprintf("!DISubroutineType(types: !%d)", fnTypesNode)
+	g.meta[fnTypesNode] = "!{}"
+	g.emit("\n!llvm.dbg.cu = !{!%d}", unitNode)
+	g.emit("!llvm.module.flags = !{!%d, !%d}", debugVersionNode, dwarfVersionNode)
+	for n, node := range g.meta {
+		g.emit("!%d = %s", n, node)
+	}
+
+	var b strings.Builder
+	b.WriteString("; ModuleID = 'yal'\nsource_filename = \"yal\"\n")
+	if len(g.strList) > 0 {
+		b.WriteString("\n")
+	}
+	for _, s := range g.strList {
+		fmt.Fprintf(&b, "%s = private unnamed_addr constant %s %s\n", g.strs[s], strType(s), strValue(s))
+	}
+	b.WriteString(g.w.String())
+	b.WriteString(runtime)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func symbol(fn string) string {
+	return "yal." + fn
+}
+
+func (g *generator) emit(format string, args ...any) {
+	fmt.Fprintf(g.w, format+"\n", args...)
+}
+
+// Adds a metadata node, returning its number
+func (g *generator) node(format string, args ...any) int {
+	g.meta = append(g.meta, fmt.Sprintf(format, args...))
+	return len(g.meta) - 1
+}
+
+// Returns the node describing the file at path
+func (g *generator) file(path string) int {
+	if path == "" {
+		path = "<unknown>"
+	}
+	n, ok := g.files[path]
+	if !ok {
+		n = g.node("!DIFile(filename: %s, directory: %s)", strconv.Quote(filepath.Base(path)), strconv.Quote(filepath.Dir(path)))
+		g.files[path] = n
+	}
+	return n
+}
+
+// Returns the debug attachment of i, at its Loc or at the last one seen in
+// the fn for instructions added by passes, the Loc of the fn at first
+func (g *generator) dbg(i *ir.Instr) string {
+	switch {
+	case i.Loc.Line > 0:
+		g.loc = g.location(i.Loc)
+	case g.loc < 0:
+		g.loc = g.location(g.f.Loc)
+	}
+	return fmt.Sprintf(", !dbg !%d", g.loc)
+}
+
+func (g *generator) location(loc parser.Loc) int {
+	key := [3]uint64{uint64(g.scope), loc.Line, loc.Column}
+	n, ok := g.locs[key]
+	if !ok {
+		n = g.node("!DILocation(line: %d, column: %d, scope: !%d)", loc.Line, loc.Column, g.scope)
+		g.locs[key] = n
+	}
+	return n
+}
+
+// Types are mapped to the LLVM type of their size, with pointers and
+// strings as opaque pointers
+func typeOf(t ir.Type) string {
+	switch {
+	case t == ir.Int || t == ir.Uint:
+		return "i64"
+	case t == ir.Char:
+		return "i8"
+	case t == ir.Bool:
+		return "i1"
+	case t == ir.Float:
+		return "double"
+	case t == ir.Void:
+		return "void"
+	}
+	return "ptr"
+}
+
+// Returns the global holding string s: its length as an i64 followed by
+// its bytes
+func (g *generator) str(s string) string {
+	name, ok := g.strs[s]
+	if !ok {
+		name = fmt.Sprintf("@yal.str.%d", len(g.strList))
+		g.strs[s] = name
+		g.strList = append(g.strList, s)
+	}
+	return name
+}
+
+func strType(s string) string {
+	return fmt.Sprintf("{ i64, [%d x i8] }", len(s))
+}
+
+func strValue(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return fmt.Sprintf("{ i64 %d, [%d x i8] c\"%s\" }", len(s), len(s), b.String())
+}
+
+// Returns the operand text of v
+func (g *generator) value(v ir.Value) string {
+	switch v := v.(type) {
+	case *ir.Param:
+		return "%" + v.Name
+	case *ir.Instr:
+		return "%v." + strconv.Itoa(v.ID)
+	}
+
+	c := v.(*ir.Const)
+	switch {
+	case c.Typ == ir.Char:
+		return strconv.Itoa(int(int8(c.Int)))
+	case c.Typ == ir.Bool:
+		return strconv.FormatBool(c.Int != 0)
+	case c.Typ == ir.Float:
+		// Hexadecimal floats are exact
+		return fmt.Sprintf("0x%016X", math.Float64bits(c.Float))
+	case c.Typ == ir.String:
+		return g.str(c.Str)
+	case c.Typ.IsPointer():
+		return "null"
+	}
+	return strconv.FormatInt(c.Int, 10)
+}
+
+// Returns the typed operand text of v
+func (g *generator) operand(v ir.Value) string {
+	return typeOf(v.Type()) + " " + g.value(v)
+}
+
+func label(b *ir.Block) string {
+	return "b." + strconv.Itoa(b.ID)
+}
+
+func (g *generator) genFunc(f *ir.Func, path string) {
+	g.f = f
+	if f.HasDefers() {
+		panic(genError{fmt.Errorf("fn %s: defer is not supported by LLVM IR", f.Name)})
+	}
+	if f.HasInterfaces() {
+		panic(genError{fmt.Errorf("fn %s: interfaces are not supported by LLVM IR", f.Name)})
+	}
+	if f.HasResults() {
+		panic(genError{fmt.Errorf("fn %s: results and recover are not supported by LLVM IR", f.Name)})
+	}
+	if f.HasClosures() {
+		panic(genError{fmt.Errorf("fn %s: closures are not supported by LLVM IR", f.Name)})
+	}
+	if f.HasTasks() {
+		panic(genError{fmt.Errorf("fn %s: tasks and channels are not supported by LLVM IR", f.Name)})
+	}
+	file := g.file(path)
+	g.scope = g.node(`distinct !DISubprogram(name: %s, linkageName: "%s", scope: !%d, file: !%d, line: %d, type: !%d, scopeLine: %d, spFlags: DISPFlagDefinition, unit: !%d)`,
+		strconv.Quote(f.Name), symbol(f.Name), file, file, f.Loc.Line, fnTypeNode, f.Loc.Line, unitNode)
+	g.loc = -1
+
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, typeOf(p.Typ)+" %"+p.Name)
+	}
+	g.emit("\ndefine internal %s @%s(%s) !dbg !%d {", typeOf(f.Ret), symbol(f.Name), strings.Join(params, ", "), g.scope)
+
+	// The entry block of an LLVM fn can't be jumped to
+	if len(f.Entry().Preds) > 0 {
+		g.emit("entry:\n  br label %%%s", label(f.Entry()))
+	}
+	for _, b := range f.Blocks {
+		g.emit("%s:", label(b))
+		for _, i := range b.Instrs {
+			g.genInstr(i)
+		}
+	}
+	g.emit("}")
+}
+
+var (
+	intOps = map[ir.Op]string{
+		ir.OpAdd: "add", ir.OpSub: "sub", ir.OpMul: "mul",
+		ir.OpAnd: "and", ir.OpOr: "or", ir.OpXor: "xor",
+	}
+	floatOps = map[ir.Op]string{
+		ir.OpAdd: "fadd", ir.OpSub: "fsub", ir.OpMul: "fmul", ir.OpDiv: "fdiv",
+		// Comparisons with NaN are false, except for ne
+		ir.OpEq: "fcmp oeq", ir.OpNe: "fcmp une", ir.OpLt: "fcmp olt", ir.OpLe: "fcmp ole", ir.OpGt: "fcmp ogt", ir.OpGe: "fcmp oge",
+	}
+	signedOps = map[ir.Op]string{
+		ir.OpDiv: "sdiv", ir.OpRem: "srem", ir.OpShl: "shl", ir.OpShr: "ashr",
+		ir.OpEq: "icmp eq", ir.OpNe: "icmp ne", ir.OpLt: "icmp slt", ir.OpLe: "icmp sle", ir.OpGt: "icmp sgt", ir.OpGe: "icmp sge",
+	}
+	unsignedOps = map[ir.Op]string{
+		ir.OpDiv: "udiv", ir.OpRem: "urem", ir.OpShl: "shl", ir.OpShr: "lshr",
+		ir.OpEq: "icmp eq", ir.OpNe: "icmp ne", ir.OpLt: "icmp ult", ir.OpLe: "icmp ule", ir.OpGt: "icmp ugt", ir.OpGe: "icmp uge",
+	}
+)
+
+func (g *generator) genInstr(i *ir.Instr) {
+	dbg := g.dbg(i)
+	def := "%v." + strconv.Itoa(i.ID)
+	t := typeOf(i.Typ)
+
+	switch {
+	case i.Op.IsBinary():
+		a, b := g.value(i.Args[0]), g.value(i.Args[1])
+		if op := g.binaryOp(i); op != "" {
+			g.emit("  %s = %s %s %s, %s%s", def, op, t, a, b, dbg)
+		} else {
+			g.emit("  %s = call %s @%s(%s %s, %s %s)%s", def, t, g.helper(i), t, a, t, b, dbg)
+		}
+	case i.Op == ir.OpNot:
+		g.emit("  %s = xor i1 %s, true%s", def, g.value(i.Args[0]), dbg)
+	case i.Op == ir.OpNeg && i.Typ == ir.Float:
+		g.emit("  %s = fneg double %s%s", def, g.value(i.Args[0]), dbg)
+	case i.Op == ir.OpNeg:
+		g.emit("  %s = sub %s 0, %s%s", def, t, g.value(i.Args[0]), dbg)
+	case i.Op.IsCompare():
+		g.emit("  %s = %s %s, %s%s", def, g.compareOp(i), g.operand(i.Args[0]), g.value(i.Args[1]), dbg)
+	case i.Op == ir.OpAlloca:
+		elem := i.Typ.Elem()
+		g.emit("  %s = alloca %s%s", def, typeOf(elem), dbg)
+		g.emit("  store %s, ptr %s%s", g.operand(ir.Zero(elem)), def, dbg)
+	case i.Op == ir.OpLoad:
+		g.checkNonNull(i, dbg)
+		g.emit("  %s = load %s, ptr %s%s", def, t, g.value(i.Args[0]), dbg)
+	case i.Op == ir.OpStore:
+		g.checkNonNull(i, dbg)
+		g.emit("  store %s, ptr %s%s", g.operand(i.Args[1]), g.value(i.Args[0]), dbg)
+	case i.Op == ir.OpCall:
+		g.genCall(i, def, dbg)
+	case i.Op == ir.OpPhi:
+		args := []string{}
+		for j, arg := range i.Args {
+			args = append(args, fmt.Sprintf("[ %s, %%%s ]", g.value(arg), label(i.Block.Preds[j])))
+		}
+		g.emit("  %s = phi %s %s%s", def, t, strings.Join(args, ", "), dbg)
+	case i.Op == ir.OpJump:
+		g.emit("  br label %%%s%s", label(i.Block.Succs[0]), dbg)
+	case i.Op == ir.OpBranch:
+		g.emit("  br i1 %s, label %%%s, label %%%s%s", g.value(i.Args[0]), label(i.Block.Succs[0]), label(i.Block.Succs[1]), dbg)
+	case i.Op == ir.OpRet && len(i.Args) > 0:
+		g.emit("  ret %s%s", g.operand(i.Args[0]), dbg)
+	case i.Op == ir.OpRet:
+		g.emit("  ret void%s", dbg)
+	case i.Op == ir.OpUnreachable:
+		g.emit("  call void @yal.rt.fail(ptr @yal.rt.unreachable)%s\n  unreachable", dbg)
+	}
+}
+
+// Returns the instruction computing binary i, or "" when it needs the
+// runtime to check its divisor or shift count
+func (g *generator) binaryOp(i *ir.Instr) string {
+	switch {
+	case i.Typ == ir.Float:
+		return floatOps[i.Op]
+	case i.Op != ir.OpDiv && i.Op != ir.OpRem && i.Op != ir.OpShl && i.Op != ir.OpShr:
+		return intOps[i.Op]
+	}
+
+	ops := unsignedOps
+	if i.Typ.IsSigned() {
+		ops = signedOps
+	}
+	c, ok := i.Args[1].(*ir.Const)
+	if !ok {
+		return ""
+	}
+	switch {
+	case i.Op == ir.OpShl || i.Op == ir.OpShr:
+		if uint64(c.Int) < width(i.Typ) {
+			return ops[i.Op]
+		}
+	case c.Int != 0 && (c.Int != -1 || !i.Typ.IsSigned()):
+		return ops[i.Op]
+	}
+	return ""
+}
+
+// Returns the number of bits of the integer type t
+func width(t ir.Type) uint64 {
+	if t == ir.Char {
+		return 8
+	}
+	return 64
+}
+
+// Returns the fn of the runtime computing binary i
+func (g *generator) helper(i *ir.Instr) string {
+	ops := unsignedOps
+	if i.Typ.IsSigned() {
+		ops = signedOps
+	}
+	name := fmt.Sprintf("yal.rt.%s.%s", ops[i.Op], typeOf(i.Typ))
+	g.used[name] = true
+	return name
+}
+
+func (g *generator) compareOp(i *ir.Instr) string {
+	t := i.Args[0].Type()
+	switch {
+	case t == ir.Float:
+		return floatOps[i.Op]
+	case t.IsSigned():
+		return signedOps[i.Op]
+	case t.IsInteger() || t == ir.Bool || t.IsPointer():
+		if t.IsInteger() || i.Op == ir.OpEq || i.Op == ir.OpNe {
+			return unsignedOps[i.Op]
+		}
+	}
+	panic(genError{fmt.Errorf("fn %s: comparing %s values with %s is not supported by LLVM IR", g.f.Name, t, i.Op)})
+}
+
+// Checks that the pointer the load or store i goes through isn't NULL,
+// unless it is a slot, passing the position of i to report
+func (g *generator) checkNonNull(i *ir.Instr, dbg string) {
+	p := i.Args[0]
+	if a, ok := p.(*ir.Instr); ok && a.Op == ir.OpAlloca {
+		return
+	}
+	g.emit("  call void @yal.rt.nonnull(ptr %s, i64 %d, i64 %d)%s", g.value(p), i.Loc.Line, i.Loc.Column, dbg)
+}
+
+func (g *generator) genCall(i *ir.Instr, def string, dbg string) {
+	callee := g.m.Func(i.Callee)
+	if callee == nil {
+		g.genBuiltin(i, dbg)
+		return
+	}
+
+	args := []string{}
+	for _, arg := range i.Args {
+		args = append(args, g.operand(arg))
+	}
+	call := "call"
+	if i.Tail {
+		call = "tail call"
+	}
+	if i.Typ == ir.Void {
+		g.emit("  %s void @%s(%s)%s", call, symbol(callee.Name), strings.Join(args, ", "), dbg)
+		return
+	}
+	g.emit("  %s = %s %s @%s(%s)%s", def, call, typeOf(i.Typ), symbol(callee.Name), strings.Join(args, ", "), dbg)
+}
+
+// Prints the args of a call to print or panic with the fns of the runtime
+func (g *generator) genBuiltin(i *ir.Instr, dbg string) {
+	if i.Callee == "panic" {
+		g.emit("  call void @yal.rt.panic()%s", dbg)
+	}
+	for j, arg := range i.Args {
+		if j > 0 {
+			g.emit("  call void @yal.rt.print_space()%s", dbg)
+		}
+
+		t := arg.Type()
+		name := "print_" + string(t)
+		if t.IsPointer() {
+			name = "print_ptr"
+		}
+		g.emit("  call void @yal.rt.%s(%s)%s", name, g.operand(arg), dbg)
+	}
+	g.emit("  call void @yal.rt.print_newline()%s", dbg)
+
+	if i.Callee == "panic" {
+		g.emit("  call void @exit(i32 1)%s", dbg)
+	}
+}
@@ -0,0 +1,186 @@
+package llvm_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"yal/internal/backendtest"
+	"yal/ir"
+	"yal/llvm"
+)
+
+// Returns the LLVM IR of m, without the runtime
+func generate(t *testing.T, m *ir.Module) string {
+	var ll strings.Builder
+	files := map[string]string{}
+	for _, f := range m.Funcs {
+		files[f.Name] = "/src/main.yal"
+	}
+	if err := llvm.Generate(&ll, m, files); err != nil {
+		t.Fatal(err)
+	}
+	program, _, _ := strings.Cut(ll.String(), "\n; Runtime\n")
+	return program
+}
+
+// Compiles the LLVM IR of src optimized at level with llc and runs it,
+// returning what it writes to stdout and stderr and its exit code
+func run(t *testing.T, src string, level int) (string, string, int) {
+	for _, tool := range []string{"llc", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to compile programs", tool)
+		}
+	}
+
+	var ll strings.Builder
+	if err := llvm.Generate(&ll, backendtest.Lower(t, src, level), nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.ll"), []byte(ll.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opaque pointers are the default from LLVM 15 on
+	args := []string{"-relocation-model=pic", "-filetype=obj", "-o", "main.o", "main.ll"}
+	version, err := exec.Command("llc", "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(version); m != nil {
+		if major, _ := strconv.Atoi(string(m[1])); major < 15 {
+			args = append([]string{"-opaque-pointers"}, args...)
+		}
+	}
+	for _, cmd := range []*exec.Cmd{
+		exec.Command("llc", args...),
+		exec.Command("cc", "-o", "main", "main.o"),
+	} {
+		cmd.Dir = dir
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s\n%s", err, msg, ll.String())
+		}
+	}
+
+	var stdout, stderr strings.Builder
+	cmd := exec.Command(filepath.Join(dir, "main"))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Test loop", func(t *testing.T) {
+		src := `fn sum(n: int) : int {
+  let s = 0;
+  for (let i = 0; i < n; ++i) {
+    s += i / 2;
+  }
+  s
+}
+
+fn main() : int {
+  print("sum", sum(10));
+  0
+}`
+		want := `; ModuleID = 'yal'
+source_filename = "yal"
+
+@yal.str.0 = private unnamed_addr constant { i64, [3 x i8] } { i64 3, [3 x i8] c"sum" }
+
+define internal i64 @yal.sum(i64 %n) !dbg !6 {
+b.0:
+  br label %b.1, !dbg !7
+b.1:
+  %v.0 = phi i64 [ 0, %b.0 ], [ %v.5, %b.3 ], !dbg !7
+  %v.1 = phi i64 [ 0, %b.0 ], [ %v.4, %b.3 ], !dbg !7
+  %v.2 = icmp slt i64 %v.0, %n, !dbg !7
+  br i1 %v.2, label %b.2, label %b.4, !dbg !7
+b.2:
+  %v.3 = sdiv i64 %v.0, 2, !dbg !8
+  %v.4 = add i64 %v.1, %v.3, !dbg !8
+  br label %b.3, !dbg !7
+b.3:
+  %v.5 = add i64 %v.0, 1, !dbg !9
+  br label %b.1, !dbg !9
+b.4:
+  ret i64 %v.1, !dbg !9
+}
+
+define internal i64 @yal.main() !dbg !10 {
+b.0:
+  %v.0 = call i64 @yal.sum(i64 10), !dbg !11
+  call void @yal.rt.print_string(ptr @yal.str.0), !dbg !12
+  call void @yal.rt.print_space(), !dbg !12
+  call void @yal.rt.print_int(i64 %v.0), !dbg !12
+  call void @yal.rt.print_newline(), !dbg !12
+  ret i64 0, !dbg !13
+}
+
+define i32 @main() {
+  %ret = call i64 @yal.main()
+  %code = trunc i64 %ret to i32
+  ret i32 %code
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!1, !2}
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !5, producer: "yal", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug)
+!1 = !{i32 2, !"Debug Info Version", i32 3}
+!2 = !{i32 7, !"Dwarf Version", i32 4}
+!3 = !DISubroutineType(types: !4)
+!4 = !{}
+!5 = !DIFile(filename: "main.yal", directory: "/src")
+!6 = distinct !DISubprogram(name: "sum", linkageName: "yal.sum", scope: !5, file: !5, line: 1, type: !3, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !0)
+!7 = !DILocation(line: 3, column: 13, scope: !6)
+!8 = !DILocation(line: 4, column: 9, scope: !6)
+!9 = !DILocation(line: 3, column: 28, scope: !6)
+!10 = distinct !DISubprogram(name: "main", linkageName: "yal.main", scope: !5, file: !5, line: 9, type: !3, scopeLine: 9, spFlags: DISPFlagDefinition, unit: !0)
+!11 = !DILocation(line: 10, column: 20, scope: !10)
+!12 = !DILocation(line: 10, column: 9, scope: !10)
+!13 = !DILocation(line: 9, column: 8, scope: !10)
+`
+		if got := generate(t, backendtest.Lower(t, src, 0)); got != want {
+			t.Errorf("expected\n%s\ngot\n%s\n", want, got)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	backendtest.RunPrograms(t, 2, run)
+
+	t.Run("Test floats", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Floats, 2, run)
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":            `fn main() : void { print(1); panic("oops", 2); }`,
+		"Test division by zero": `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test null pointer":     `fn main() : int { let p: *int = NULL; return *p; }`,
+	}
+	msgs := map[string]string{
+		"Test panic":            "panic: oops 2\n",
+		"Test division by zero": "division by zero\n",
+		"Test null pointer":     "line 1 column 46: null pointer dereference\n",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, stderr, code := run(t, src, 0)
+			if stderr != msgs[name] || code != 1 {
+				t.Errorf("expected %q and exit code 1, got %q and %d\n", msgs[name], stderr, code)
+			}
+		})
+	}
+}
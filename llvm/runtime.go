@@ -0,0 +1,233 @@
+package llvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fn of the runtime added to the modules calling it
+type helper struct {
+	name string
+	text string
+}
+
+// Divisions checking their divisor and shifts checking their count, for
+// each integer type. Dividing the smallest int by -1 overflows back to it,
+// and shifting by the width of the type or more gives what shifting by one
+// bit less twice would.
+var helpers = func() []helper {
+	helpers := []helper{}
+	for _, h := range []struct{ op, typ string }{
+		{"sdiv", "i64"}, {"srem", "i64"}, {"udiv", "i64"}, {"urem", "i64"}, {"udiv", "i8"}, {"urem", "i8"},
+	} {
+		name := fmt.Sprintf("yal.rt.%s.%s", h.op, h.typ)
+		var b strings.Builder
+		fmt.Fprintf(&b, "define internal %s @%s(%s %%a, %s %%b) {\n", h.typ, name, h.typ, h.typ)
+		fmt.Fprintf(&b, "  %%zero = icmp eq %s %%b, 0\n  br i1 %%zero, label %%fail, label %%check\n", h.typ)
+		b.WriteString("fail:\n  call void @yal.rt.fail(ptr @yal.rt.divzero)\n  unreachable\ncheck:\n")
+		switch h.op {
+		case "sdiv":
+			fmt.Fprintf(&b, "  %%minus = icmp eq %s %%b, -1\n  br i1 %%minus, label %%overflow, label %%div\n", h.typ)
+			fmt.Fprintf(&b, "overflow:\n  %%neg = sub %s 0, %%a\n  ret %s %%neg\ndiv:\n", h.typ, h.typ)
+		case "srem":
+			fmt.Fprintf(&b, "  %%minus = icmp eq %s %%b, -1\n  br i1 %%minus, label %%overflow, label %%div\n", h.typ)
+			fmt.Fprintf(&b, "overflow:\n  ret %s 0\ndiv:\n", h.typ)
+		}
+		fmt.Fprintf(&b, "  %%r = %s %s %%a, %%b\n  ret %s %%r\n}", h.op, h.typ, h.typ)
+		helpers = append(helpers, helper{name, b.String()})
+	}
+
+	for _, h := range []struct {
+		op, typ string
+		width   int
+	}{
+		{"shl", "i64", 64}, {"ashr", "i64", 64}, {"lshr", "i64", 64}, {"shl", "i8", 8}, {"lshr", "i8", 8},
+	} {
+		name := fmt.Sprintf("yal.rt.%s.%s", h.op, h.typ)
+		var b strings.Builder
+		fmt.Fprintf(&b, "define internal %s @%s(%s %%a, %s %%b) {\n", h.typ, name, h.typ, h.typ)
+		fmt.Fprintf(&b, "  %%in = icmp ult %s %%b, %d\n", h.typ, h.width)
+		fmt.Fprintf(&b, "  %%r = %s %s %%a, %%b\n", h.op, h.typ)
+		out := "0"
+		if h.op == "ashr" {
+			fmt.Fprintf(&b, "  %%sign = ashr %s %%a, %d\n", h.typ, h.width-1)
+			out = "%sign"
+		}
+		fmt.Fprintf(&b, "  %%s = select i1 %%in, %s %%r, %s %s\n  ret %s %%s\n}", h.typ, h.typ, out, h.typ)
+		helpers = append(helpers, helper{name, b.String()})
+	}
+	return helpers
+}()
+
+// Runtime added to every module, printing values through the file
+// descriptor in yal.rt.fd, which panics switch to stderr. Floats are
+// printed in the shortest form that reads back the same, as the vm does:
+// the precision is raised until strtod gives the float back.
+const runtime = `
+; Runtime
+@yal.rt.fd = internal global i32 1
+@yal.rt.int = private unnamed_addr constant [5 x i8] c"%lld\00"
+@yal.rt.uint = private unnamed_addr constant [5 x i8] c"%llu\00"
+@yal.rt.exp = private unnamed_addr constant [5 x i8] c"%.*e\00"
+@yal.rt.fixed = private unnamed_addr constant [5 x i8] c"%.*f\00"
+@yal.rt.true = private unnamed_addr constant [4 x i8] c"true"
+@yal.rt.false = private unnamed_addr constant [5 x i8] c"false"
+@yal.rt.null = private unnamed_addr constant [4 x i8] c"null"
+@yal.rt.ptr = private unnamed_addr constant [3 x i8] c"ptr"
+@yal.rt.nan = private unnamed_addr constant [3 x i8] c"NaN"
+@yal.rt.inf = private unnamed_addr constant [4 x i8] c"+Inf"
+@yal.rt.ninf = private unnamed_addr constant [4 x i8] c"-Inf"
+@yal.rt.space = private unnamed_addr constant [1 x i8] c" "
+@yal.rt.newline = private unnamed_addr constant [1 x i8] c"\0A"
+@yal.rt.panic_msg = private unnamed_addr constant [7 x i8] c"panic: "
+@yal.rt.divzero = private unnamed_addr constant { i64, [16 x i8] } { i64 16, [16 x i8] c"division by zero" }
+@yal.rt.position = private unnamed_addr constant [24 x i8] c"line %lld column %lld: \00"
+@yal.rt.nullderef = private unnamed_addr constant { i64, [24 x i8] } { i64 24, [24 x i8] c"null pointer dereference" }
+@yal.rt.unreachable = private unnamed_addr constant { i64, [24 x i8] } { i64 24, [24 x i8] c"unreachable code reached" }
+
+declare i64 @write(i32, ptr, i64)
+declare i32 @dprintf(i32, ptr, ...)
+declare i32 @snprintf(ptr, i64, ptr, ...)
+declare double @strtod(ptr, ptr)
+declare ptr @strchr(ptr, i32)
+declare i32 @atoi(ptr)
+declare i64 @strlen(ptr)
+declare void @exit(i32) noreturn
+
+define internal void @yal.rt.write(ptr %s, i64 %n) {
+  %fd = load i32, ptr @yal.rt.fd
+  %r = call i64 @write(i32 %fd, ptr %s, i64 %n)
+  ret void
+}
+
+define internal void @yal.rt.print_int(i64 %v) {
+  %fd = load i32, ptr @yal.rt.fd
+  %r = call i32 (i32, ptr, ...) @dprintf(i32 %fd, ptr @yal.rt.int, i64 %v)
+  ret void
+}
+
+define internal void @yal.rt.print_uint(i64 %v) {
+  %fd = load i32, ptr @yal.rt.fd
+  %r = call i32 (i32, ptr, ...) @dprintf(i32 %fd, ptr @yal.rt.uint, i64 %v)
+  ret void
+}
+
+define internal void @yal.rt.print_char(i8 %c) {
+  %b = alloca i8
+  store i8 %c, ptr %b
+  call void @yal.rt.write(ptr %b, i64 1)
+  ret void
+}
+
+define internal void @yal.rt.print_bool(i1 %v) {
+  %s = select i1 %v, ptr @yal.rt.true, ptr @yal.rt.false
+  %n = select i1 %v, i64 4, i64 5
+  call void @yal.rt.write(ptr %s, i64 %n)
+  ret void
+}
+
+define internal void @yal.rt.print_ptr(ptr %p) {
+  %null = icmp eq ptr %p, null
+  %s = select i1 %null, ptr @yal.rt.null, ptr @yal.rt.ptr
+  %n = select i1 %null, i64 4, i64 3
+  call void @yal.rt.write(ptr %s, i64 %n)
+  ret void
+}
+
+define internal void @yal.rt.print_string(ptr %s) {
+  %n = load i64, ptr %s
+  %data = getelementptr i8, ptr %s, i64 8
+  call void @yal.rt.write(ptr %data, i64 %n)
+  ret void
+}
+
+define internal void @yal.rt.print_float(double %v) {
+  %buf = alloca [40 x i8]
+  %nan = fcmp uno double %v, %v
+  br i1 %nan, label %isnan, label %notnan
+isnan:
+  call void @yal.rt.write(ptr @yal.rt.nan, i64 3)
+  ret void
+notnan:
+  %inf = fcmp oeq double %v, 0x7FF0000000000000
+  br i1 %inf, label %isinf, label %notinf
+isinf:
+  call void @yal.rt.write(ptr @yal.rt.inf, i64 4)
+  ret void
+notinf:
+  %ninf = fcmp oeq double %v, 0xFFF0000000000000
+  br i1 %ninf, label %isninf, label %digits
+isninf:
+  call void @yal.rt.write(ptr @yal.rt.ninf, i64 4)
+  ret void
+digits:
+  %p = phi i32 [ 0, %notinf ], [ %next, %digits ]
+  %r1 = call i32 (ptr, i64, ptr, ...) @snprintf(ptr %buf, i64 40, ptr @yal.rt.exp, i32 %p, double %v)
+  %back = call double @strtod(ptr %buf, ptr null)
+  %same = fcmp oeq double %back, %v
+  %next = add i32 %p, 1
+  %last = icmp eq i32 %p, 16
+  %found = or i1 %same, %last
+  br i1 %found, label %format, label %digits
+format:
+  %e = call ptr @strchr(ptr %buf, i32 101)
+  %digits.exp = getelementptr i8, ptr %e, i64 1
+  %exp = call i32 @atoi(ptr %digits.exp)
+  %small = icmp slt i32 %exp, -4
+  %large = icmp sge i32 %exp, 6
+  %sci = or i1 %small, %large
+  br i1 %sci, label %print, label %fixed
+fixed:
+  %decimals = sub i32 %p, %exp
+  %whole = icmp slt i32 %decimals, 0
+  %prec = select i1 %whole, i32 0, i32 %decimals
+  %r2 = call i32 (ptr, i64, ptr, ...) @snprintf(ptr %buf, i64 40, ptr @yal.rt.fixed, i32 %prec, double %v)
+  br label %print
+print:
+  %n = call i64 @strlen(ptr %buf)
+  call void @yal.rt.write(ptr %buf, i64 %n)
+  ret void
+}
+
+define internal void @yal.rt.print_space() {
+  call void @yal.rt.write(ptr @yal.rt.space, i64 1)
+  ret void
+}
+
+define internal void @yal.rt.print_newline() {
+  call void @yal.rt.write(ptr @yal.rt.newline, i64 1)
+  ret void
+}
+
+define internal void @yal.rt.panic() {
+  store i32 2, ptr @yal.rt.fd
+  call void @yal.rt.write(ptr @yal.rt.panic_msg, i64 7)
+  ret void
+}
+
+define internal void @yal.rt.fail(ptr %msg) noreturn {
+  store i32 2, ptr @yal.rt.fd
+  call void @yal.rt.print_string(ptr %msg)
+  call void @yal.rt.print_newline()
+  call void @exit(i32 1)
+  unreachable
+}
+
+; Stops the program when p is null, at the line and column given unless
+; they are 0
+define internal void @yal.rt.nonnull(ptr %p, i64 %line, i64 %column) {
+  %null = icmp eq ptr %p, null
+  br i1 %null, label %fail, label %ok
+fail:
+  %known = icmp ne i64 %line, 0
+  br i1 %known, label %position, label %message
+position:
+  %r = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @yal.rt.position, i64 %line, i64 %column)
+  br label %message
+message:
+  call void @yal.rt.fail(ptr @yal.rt.nullderef)
+  unreachable
+ok:
+  ret void
+}
+`
@@ -0,0 +1,231 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"yal/lexer"
+	"yal/parser"
+)
+
+// Extension of yal source files
+const Ext = ".yal"
+
+// Loader resolves import paths and loads the packages they refer to.
+// Imports are looked up relative to the project root first and then to each
+// directory listed in YALPATH.
+type Loader struct {
+	root    string
+	paths   []string
+	loaded  map[string]*Package
+	loading []*Package
+	ctx     context.Context
+}
+
+// Returns a new Loader resolving imports from root and from YALPATH
+func NewLoader(ctx context.Context, root string) *Loader {
+	paths := []string{}
+	for _, path := range filepath.SplitList(os.Getenv("YALPATH")) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return &Loader{
+		root:    root,
+		paths:   paths,
+		loaded:  make(map[string]*Package),
+		loading: []*Package{},
+		ctx:     ctx,
+	}
+}
+
+// Loads the package at path, which is either a directory of .yal files or a
+// single file, along with everything it imports
+func (l *Loader) Load(path string) (*Package, error) {
+	name := strings.TrimSuffix(filepath.Base(path), Ext)
+	return l.load(name, path)
+}
+
+// Loads a single file package from an already read source
+func (l *Loader) LoadSource(name string, src string) (*Package, error) {
+	stmts, err := l.parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{
+		Name:    name,
+		Path:    name,
+		Dir:     l.root,
+		Files:   []*File{{Name: name, Stmts: stmts}},
+		Imports: make(map[string]*Package),
+	}
+
+	return pkg, l.loadImports(pkg)
+}
+
+// Returns the directory or file an import path refers to
+func (l *Loader) Resolve(importPath string) (string, error) {
+	for _, dir := range append([]string{l.root}, l.paths...) {
+		candidate := filepath.Join(dir, filepath.FromSlash(importPath))
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+		if info, err := os.Stat(candidate + Ext); err == nil && !info.IsDir() {
+			return candidate + Ext, nil
+		}
+	}
+
+	return "", fmt.Errorf("module %q not found in %s", importPath, strings.Join(append([]string{l.root}, l.paths...), ", "))
+}
+
+func (l *Loader) load(importPath string, path string) (*Package, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, loading := range l.loading {
+		if loading.Dir == abs {
+			chain := []string{}
+			for _, pkg := range l.loading[i:] {
+				chain = append(chain, pkg.Path)
+			}
+			chain = append(chain, importPath)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	if pkg, ok := l.loaded[abs]; ok {
+		return pkg, nil
+	}
+
+	pkg := &Package{
+		Name:    strings.TrimSuffix(filepath.Base(abs), Ext),
+		Path:    importPath,
+		Dir:     abs,
+		Imports: make(map[string]*Package),
+	}
+
+	l.loading = append(l.loading, pkg)
+	defer func() {
+		l.loading = l.loading[:len(l.loading)-1]
+	}()
+
+	files, err := sourceFiles(abs)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		stmts, err := l.parse(file, string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		pkg.Files = append(pkg.Files, &File{
+			Name:  file,
+			Stmts: stmts,
+		})
+	}
+
+	if err := l.loadImports(pkg); err != nil {
+		return nil, err
+	}
+
+	l.loaded[abs] = pkg
+
+	return pkg, nil
+}
+
+func (l *Loader) loadImports(pkg *Package) error {
+	// Import statements by the module name they bind, for reporting the
+	// ones binding the same name to different modules
+	seen := map[string]*parser.ImportStmt{}
+
+	for _, imp := range pkg.imports() {
+		name := imp.ModuleName()
+
+		path, err := l.Resolve(imp.Path.Lexeme)
+		if err != nil {
+			return fmt.Errorf("%s: line %d column %d: %w", pkg.Path, imp.Line, imp.Column, err)
+		}
+
+		if prev, ok := seen[name]; ok {
+			if prevPath, _ := l.Resolve(prev.Path.Lexeme); prevPath == path {
+				continue
+			}
+			return fmt.Errorf("%s: line %d column %d: module %s imported twice, as %q and %q", pkg.Path, imp.Line, imp.Column, name, prev.Path.Lexeme, imp.Path.Lexeme)
+		}
+		seen[name] = imp
+
+		dep, err := l.load(imp.Path.Lexeme, path)
+		if err != nil {
+			return err
+		}
+		pkg.Imports[name] = dep
+	}
+
+	return nil
+}
+
+// Lexes and parses a source file, turning parser panics into errors
+func (l *Loader) parse(file string, src string) (stmts []parser.IStatement, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", file, r)
+		}
+	}()
+
+	tokens, err := lexer.NewLexer(l.ctx, src).Scan()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return parser.NewParser(l.ctx, tokens).Run(), nil
+}
+
+// Returns the .yal files making a package, sorted by name
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == Ext {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files in %s", Ext, path)
+	}
+
+	return files, nil
+}
+
+func sortedKeys(m map[string]*Package) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
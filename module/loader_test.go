@@ -0,0 +1,125 @@
+package module_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yal/module"
+)
+
+// Writes files, keyed by their slash separated path, under a new directory
+func writeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, src := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Test multi file package and imports", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"app/a.yal":           `import "lib/geo"; fn main() : int { geo.area(2) }`,
+			"app/b.yal":           `fn helper() : int { 1 }`,
+			"app/lib/geo/geo.yal": `pub fn area(r: int) : int { r * r }`,
+			"app/lib/geo/sq.yal":  `pub fn square(r: int) : int { r * r }`,
+		})
+
+		pkg, err := module.NewLoader(context.Background(), filepath.Join(root, "app")).Load(filepath.Join(root, "app"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(pkg.Files) != 2 || len(pkg.Stmts()) != 3 {
+			t.Errorf("expected 2 files with 3 statements, got %d files with %d statements\n", len(pkg.Files), len(pkg.Stmts()))
+		}
+
+		geo, ok := pkg.Imports["geo"]
+		if !ok {
+			t.Fatalf("expected geo to be imported, got %+v\n", pkg.Imports)
+		}
+		if geo.Path != "lib/geo" || len(geo.Files) != 2 {
+			t.Errorf("expected lib/geo with 2 files, got %s with %d files\n", geo.Path, len(geo.Files))
+		}
+
+		deps := pkg.Deps()
+		if len(deps) != 2 || deps[0] != geo || deps[1] != pkg {
+			t.Errorf("expected geo to come before the main package, got %+v\n", deps)
+		}
+	})
+
+	t.Run("Test YALPATH", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"app/main.yal":    `import "util"; fn main() : int { util.one() }`,
+			"shared/util.yal": `pub fn one() : int { 1 }`,
+		})
+		t.Setenv("YALPATH", filepath.Join(root, "shared"))
+
+		pkg, err := module.NewLoader(context.Background(), filepath.Join(root, "app")).Load(filepath.Join(root, "app", "main.yal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pkg.Imports["util"]; !ok {
+			t.Errorf("expected util to be imported, got %+v\n", pkg.Imports)
+		}
+	})
+
+	t.Run("Test import cycle", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"main.yal": `import "a"; fn main() : int { 0 }`,
+			"a.yal":    `import "b";`,
+			"b.yal":    `import "a";`,
+		})
+
+		_, err := module.NewLoader(context.Background(), root).Load(filepath.Join(root, "main.yal"))
+		if err == nil || err.Error() != "import cycle: a -> b -> a" {
+			t.Errorf("expected import cycle error, got %v\n", err)
+		}
+	})
+
+	t.Run("Test module imported twice", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"main.yal":   "import \"a/util\";\nimport \"a/util\";\nimport \"b/util\";",
+			"a/util.yal": `pub fn one() : int { 1 }`,
+			"b/util.yal": `pub fn two() : int { 2 }`,
+		})
+
+		_, err := module.NewLoader(context.Background(), root).Load(filepath.Join(root, "main.yal"))
+		want := `main: line 3 column 7: module util imported twice, as "a/util" and "b/util"`
+		if err == nil || err.Error() != want {
+			t.Errorf("expected %q, got %v\n", want, err)
+		}
+	})
+
+	t.Run("Test truncated enum", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"main.yal": `definetype S = enum { A(x: int`,
+		})
+
+		_, err := module.NewLoader(context.Background(), root).Load(filepath.Join(root, "main.yal"))
+		if err == nil || !strings.Contains(err.Error(), "Expected ')' after variant fields") {
+			t.Errorf("expected an error on the missing ')', got %v\n", err)
+		}
+	})
+
+	t.Run("Test missing module", func(t *testing.T) {
+		root := writeTree(t, map[string]string{
+			"main.yal": `import "missing";`,
+		})
+
+		_, err := module.NewLoader(context.Background(), root).Load(filepath.Join(root, "main.yal"))
+		if err == nil || !strings.Contains(err.Error(), `module "missing" not found`) {
+			t.Errorf("expected missing module error, got %v\n", err)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package module
+
+import (
+	"yal/parser"
+)
+
+// Source file of a Package along with its parsed statements
+type File struct {
+	Name  string
+	Stmts []parser.IStatement
+}
+
+// Package made of every .yal file in a directory, or of a single file. Dir
+// holds that directory, or the file itself for a single file package.
+type Package struct {
+	Name    string
+	Path    string
+	Dir     string
+	Files   []*File
+	Imports map[string]*Package
+}
+
+// Returns the statements of every file of the package, in file name order
+func (p *Package) Stmts() []parser.IStatement {
+	stmts := []parser.IStatement{}
+	for _, f := range p.Files {
+		stmts = append(stmts, f.Stmts...)
+	}
+	return stmts
+}
+
+// Returns the package and every package it depends on, each one coming
+// after all of its dependencies
+func (p *Package) Deps() []*Package {
+	deps := []*Package{}
+	seen := map[*Package]bool{}
+
+	var visit func(*Package)
+	visit = func(pkg *Package) {
+		if seen[pkg] {
+			return
+		}
+		seen[pkg] = true
+		for _, name := range sortedKeys(pkg.Imports) {
+			visit(pkg.Imports[name])
+		}
+		deps = append(deps, pkg)
+	}
+	visit(p)
+
+	return deps
+}
+
+func (p *Package) imports() []*parser.ImportStmt {
+	imports := []*parser.ImportStmt{}
+	for _, f := range p.Files {
+		for _, stmt := range f.Stmts {
+			if imp, ok := stmt.(*parser.ImportStmt); ok {
+				imports = append(imports, imp)
+			}
+		}
+	}
+	return imports
+}
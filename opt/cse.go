@@ -0,0 +1,79 @@
+package opt
+
+import (
+	"yal/ir"
+)
+
+type exprKey struct {
+	op   ir.Op
+	typ  ir.Type
+	args [2]string
+}
+
+// Walks the dominator tree with the expressions computed by the blocks
+// dominating the current one in scope, replacing the instructions
+// computing one of them again
+func cse(f *ir.Func) int {
+	dom := f.Dominators()
+	avail := map[exprKey]*ir.Instr{}
+	removed := 0
+
+	var walk func(b *ir.Block)
+	walk = func(b *ir.Block) {
+		added := []exprKey{}
+		for _, i := range append([]*ir.Instr{}, b.Instrs...) {
+			if !i.Op.IsBinary() && !i.Op.IsUnary() && !i.Op.IsCompare() {
+				continue
+			}
+			key := keyOf(i)
+			if same, ok := avail[key]; ok {
+				f.ReplaceUses(i, same)
+				b.Remove(i)
+				removed++
+				continue
+			}
+			avail[key] = i
+			added = append(added, key)
+		}
+
+		for _, c := range dom.Children(b) {
+			walk(c)
+		}
+		for _, key := range added {
+			delete(avail, key)
+		}
+	}
+	walk(f.Entry())
+
+	return removed
+}
+
+func keyOf(i *ir.Instr) exprKey {
+	key := exprKey{op: i.Op, typ: i.Args[0].Type()}
+	if i.Op.IsBinary() || i.Op.IsUnary() {
+		key.typ = i.Typ
+	}
+	for j, arg := range i.Args {
+		key.args[j] = valueKey(arg)
+	}
+	if isCommutative(i.Op) && key.args[0] > key.args[1] {
+		key.args[0], key.args[1] = key.args[1], key.args[0]
+	}
+	return key
+}
+
+// Identifies a value within a fn, constants by their type and value
+func valueKey(v ir.Value) string {
+	if c, ok := v.(*ir.Const); ok {
+		return string(c.Typ) + " " + c.String()
+	}
+	return v.String()
+}
+
+func isCommutative(op ir.Op) bool {
+	switch op {
+	case ir.OpAdd, ir.OpMul, ir.OpAnd, ir.OpOr, ir.OpXor, ir.OpEq, ir.OpNe:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package opt
+
+import (
+	"yal/ir"
+)
+
+// Marks the instructions the program needs, starting from the ones with
+// side effects, and removes the others. Stores to a stack slot, or to one
+// allocated by new, are only needed when the slot is used by something else
+// than stores.
+func dce(f *ir.Func) int {
+	live := map[*ir.Instr]bool{}
+	stores := map[*ir.Instr][]*ir.Instr{}
+	work := []*ir.Instr{}
+
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			switch {
+			case i.Op == ir.OpStore:
+				if slot, ok := i.Args[0].(*ir.Instr); ok && isSlot(slot) {
+					stores[slot] = append(stores[slot], i)
+					continue
+				}
+				work = append(work, i)
+			case i.Op == ir.OpCall, i.Op == ir.OpApply, i.Op == ir.OpDefer, i.Op == ir.OpRecover, i.Op == ir.OpSpawn, i.Op == ir.OpChan,
+				i.Op == ir.OpSend, i.Op == ir.OpRecv, i.Op.IsTerminator(), i.Op.IsBinary() && !isPure(i):
+				work = append(work, i)
+			}
+		}
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if live[i] {
+			continue
+		}
+		live[i] = true
+		for j, arg := range i.Args {
+			// Storing to a slot doesn't make it live, storing its address
+			// does
+			if arg, ok := arg.(*ir.Instr); ok && !(i.Op == ir.OpStore && j == 0 && isSlot(arg)) {
+				work = append(work, arg)
+			}
+		}
+		if isSlot(i) {
+			work = append(work, stores[i]...)
+		}
+	}
+
+	removed := 0
+	for _, b := range f.Blocks {
+		instrs := b.Instrs[:0]
+		for _, i := range b.Instrs {
+			if live[i] {
+				instrs = append(instrs, i)
+			} else {
+				removed++
+			}
+		}
+		b.Instrs = instrs
+	}
+	return removed
+}
+
+func isSlot(i *ir.Instr) bool {
+	return i.Op == ir.OpAlloca || i.Op == ir.OpNew
+}
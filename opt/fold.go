@@ -0,0 +1,264 @@
+package opt
+
+import (
+	"math"
+	"yal/ir"
+)
+
+func fold(f *ir.Func) int {
+	changes := 0
+	for changed := true; changed; {
+		changed = false
+		for _, b := range f.Blocks {
+			for _, i := range append([]*ir.Instr{}, b.Instrs...) {
+				if v := foldInstr(i); v != nil {
+					f.ReplaceUses(i, v)
+					b.Remove(i)
+					changed = true
+					changes++
+				}
+			}
+
+			t := b.Terminator()
+			if t == nil || t.Op != ir.OpBranch {
+				continue
+			}
+			if c, ok := t.Args[0].(*ir.Const); ok {
+				// Dropping the edge not taken leaves the other one as the
+				// only successor
+				other := b.Succs[1]
+				if c.Int == 0 {
+					other = b.Succs[0]
+				}
+				ir.RemoveEdge(b, other)
+				t.Op, t.Args = ir.OpJump, nil
+				changed = true
+				changes++
+			}
+		}
+		if n := removeUnreachable(f) + mergeBlocks(f); n > 0 {
+			changed = true
+			changes += n
+		}
+	}
+	return changes
+}
+
+// Merges the blocks whose only predecessor jumps to them into it, returning
+// how many were merged
+func mergeBlocks(f *ir.Func) int {
+	merged := map[*ir.Block]bool{}
+	for _, b := range f.Blocks {
+		for !merged[b] && len(b.Succs) == 1 {
+			s := b.Succs[0]
+			if len(s.Preds) != 1 || s == b || s == f.Entry() {
+				break
+			}
+
+			for _, phi := range s.Phis() {
+				f.ReplaceUses(phi, phi.Args[0])
+				s.Remove(phi)
+			}
+			b.Remove(b.Terminator())
+			for _, i := range s.Instrs {
+				b.Append(i)
+			}
+			b.Succs = s.Succs
+			for _, succ := range s.Succs {
+				for j, p := range succ.Preds {
+					if p == s {
+						succ.Preds[j] = b
+					}
+				}
+			}
+			merged[s] = true
+		}
+	}
+
+	blocks := []*ir.Block{}
+	for _, b := range f.Blocks {
+		if !merged[b] {
+			blocks = append(blocks, b)
+		}
+	}
+	f.Blocks = blocks
+	return len(merged)
+}
+
+// Returns the value i always takes, nil if it isn't known
+func foldInstr(i *ir.Instr) ir.Value {
+	if i.Op == ir.OpPhi {
+		return samePhiArgs(i)
+	}
+
+	consts := []*ir.Const{}
+	for _, arg := range i.Args {
+		c, ok := arg.(*ir.Const)
+		if !ok {
+			return nil
+		}
+		consts = append(consts, c)
+	}
+
+	var c *ir.Const
+	switch {
+	case i.Op.IsBinary():
+		c = foldBinary(i.Op, i.Typ, consts[0], consts[1])
+	case i.Op.IsUnary():
+		c = foldUnary(i.Op, consts[0])
+	case i.Op.IsCompare():
+		c = foldCompare(i.Op, consts[0], consts[1])
+	}
+	if c == nil {
+		return nil
+	}
+	return c
+}
+
+// Returns the only value a phi takes apart from itself, nil if it takes
+// several ones
+func samePhiArgs(phi *ir.Instr) ir.Value {
+	var same ir.Value
+	for _, arg := range phi.Args {
+		if arg == phi || arg == same {
+			continue
+		}
+		if c, ok := arg.(*ir.Const); ok {
+			if s, ok := same.(*ir.Const); ok && c.Equal(s) {
+				continue
+			}
+		}
+		if same != nil {
+			return nil
+		}
+		same = arg
+	}
+	return same
+}
+
+// Integer operations wrap around, on 64 bits for int and uint and on 8 bits
+// for char. Divisions by zero and shifts by the width of the type or more
+// are left for the program to run into.
+func foldBinary(op ir.Op, t ir.Type, a *ir.Const, b *ir.Const) *ir.Const {
+	switch {
+	case t == ir.Float:
+		switch op {
+		case ir.OpAdd:
+			return &ir.Const{Typ: t, Float: a.Float + b.Float}
+		case ir.OpSub:
+			return &ir.Const{Typ: t, Float: a.Float - b.Float}
+		case ir.OpMul:
+			return &ir.Const{Typ: t, Float: a.Float * b.Float}
+		case ir.OpDiv:
+			return &ir.Const{Typ: t, Float: a.Float / b.Float}
+		}
+	case t == ir.Bool:
+		switch op {
+		case ir.OpAnd:
+			return ir.BoolConst(a.Int&b.Int != 0)
+		case ir.OpOr:
+			return ir.BoolConst(a.Int|b.Int != 0)
+		case ir.OpXor:
+			return ir.BoolConst(a.Int^b.Int != 0)
+		}
+	case t.IsInteger():
+		x, y := uint64(a.Int), uint64(b.Int)
+		r := uint64(0)
+		switch op {
+		case ir.OpAdd:
+			r = x + y
+		case ir.OpSub:
+			r = x - y
+		case ir.OpMul:
+			r = x * y
+		case ir.OpDiv, ir.OpRem:
+			if y == 0 || t == ir.Int && a.Int == math.MinInt64 && b.Int == -1 {
+				return nil
+			}
+			switch {
+			case t == ir.Int && op == ir.OpDiv:
+				r = uint64(a.Int / b.Int)
+			case t == ir.Int:
+				r = uint64(a.Int % b.Int)
+			case op == ir.OpDiv:
+				r = x / y
+			default:
+				r = x % y
+			}
+		case ir.OpAnd:
+			r = x & y
+		case ir.OpOr:
+			r = x | y
+		case ir.OpXor:
+			r = x ^ y
+		case ir.OpShl, ir.OpShr:
+			if y >= width(t) {
+				return nil
+			}
+			switch {
+			case op == ir.OpShl:
+				r = x << y
+			case t.IsSigned():
+				r = uint64(a.Int >> y)
+			default:
+				r = x >> y
+			}
+		}
+		return intConst(t, r)
+	}
+	return nil
+}
+
+func foldUnary(op ir.Op, a *ir.Const) *ir.Const {
+	switch {
+	case op == ir.OpNot:
+		return ir.BoolConst(a.Int == 0)
+	case a.Typ == ir.Float:
+		return &ir.Const{Typ: a.Typ, Float: -a.Float}
+	}
+	return intConst(a.Typ, -uint64(a.Int))
+}
+
+func foldCompare(op ir.Op, a *ir.Const, b *ir.Const) *ir.Const {
+	lt, eq, gt := false, false, false
+	switch t := a.Typ; {
+	case t == ir.Float:
+		lt, eq, gt = a.Float < b.Float, a.Float == b.Float, a.Float > b.Float
+	case t.IsSigned():
+		lt, eq, gt = a.Int < b.Int, a.Int == b.Int, a.Int > b.Int
+	case t.IsInteger():
+		x, y := uint64(a.Int), uint64(b.Int)
+		lt, eq, gt = x < y, x == y, x > y
+	default:
+		eq = a.Equal(b)
+	}
+
+	switch op {
+	case ir.OpEq:
+		return ir.BoolConst(eq)
+	case ir.OpNe:
+		return ir.BoolConst(!eq)
+	case ir.OpLt:
+		return ir.BoolConst(lt)
+	case ir.OpLe:
+		return ir.BoolConst(lt || eq)
+	case ir.OpGt:
+		return ir.BoolConst(gt)
+	}
+	return ir.BoolConst(gt || eq)
+}
+
+func width(t ir.Type) uint64 {
+	if t == ir.Char {
+		return 8
+	}
+	return 64
+}
+
+// Returns the constant of integer type t holding the low bits of v
+func intConst(t ir.Type, v uint64) *ir.Const {
+	if t == ir.Char {
+		v = uint64(uint8(v))
+	}
+	return ir.IntConst(t, int64(v))
+}
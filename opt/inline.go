@@ -0,0 +1,185 @@
+package opt
+
+import (
+	"yal/ir"
+)
+
+const (
+	// Instructions a fn may have to be inlined
+	inlineThreshold = 30
+	// Instructions beyond which a fn no longer gets calls inlined into it
+	inlineBudget = 1000
+)
+
+// Inlines the calls of f to fns small enough and not calling themselves,
+// directly or not, so that inlining ends. Fns with stack slots aren't
+// inlined since their slots would be shared between calls, nor are fns
+// deferring calls, which would only run once the caller returns.
+func inline(m *ir.Module, f *ir.Func) int {
+	recursive := recursiveFns(m)
+	inlined := 0
+	for size(f) < inlineBudget {
+		call, callee := inlineCandidate(m, f, recursive)
+		if call == nil {
+			break
+		}
+		inlineCall(f, call, callee)
+		inlined++
+	}
+	if inlined > 0 {
+		removeUnreachable(f)
+	}
+	return inlined
+}
+
+func inlineCandidate(m *ir.Module, f *ir.Func, recursive map[*ir.Func]bool) (*ir.Instr, *ir.Func) {
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op != ir.OpCall {
+				continue
+			}
+			callee := m.Func(i.Callee)
+			if callee == nil || callee == f || recursive[callee] || size(callee) > inlineThreshold {
+				continue
+			}
+			if !hasSlots(callee) && !callee.HasDefers() {
+				return i, callee
+			}
+		}
+	}
+	return nil, nil
+}
+
+func size(f *ir.Func) int {
+	n := 0
+	for _, b := range f.Blocks {
+		n += len(b.Instrs)
+	}
+	return n
+}
+
+func hasSlots(f *ir.Func) bool {
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if i.Op == ir.OpAlloca {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the fns of m that can call themselves
+func recursiveFns(m *ir.Module) map[*ir.Func]bool {
+	calls := map[*ir.Func][]*ir.Func{}
+	for _, f := range m.Funcs {
+		for _, b := range f.Blocks {
+			for _, i := range b.Instrs {
+				if callee := m.Func(i.Callee); i.Op == ir.OpCall && callee != nil {
+					calls[f] = append(calls[f], callee)
+				}
+			}
+		}
+	}
+
+	recursive := map[*ir.Func]bool{}
+	for _, f := range m.Funcs {
+		seen := map[*ir.Func]bool{}
+		work := append([]*ir.Func{}, calls[f]...)
+		for len(work) > 0 && !recursive[f] {
+			g := work[len(work)-1]
+			work = work[:len(work)-1]
+			if g == f {
+				recursive[f] = true
+			}
+			if !seen[g] {
+				seen[g] = true
+				work = append(work, calls[g]...)
+			}
+		}
+	}
+	return recursive
+}
+
+// Replaces call by a copy of the blocks of callee. The block of the call is
+// split in two: its first half jumps to the copy of the entry and the
+// copies of the rets jump to the second half, where a phi merges the values
+// they return.
+func inlineCall(f *ir.Func, call *ir.Instr, callee *ir.Func) {
+	b := call.Block
+	at := 0
+	for b.Instrs[at] != call {
+		at++
+	}
+
+	after := f.NewBlock()
+	for _, i := range b.Instrs[at+1:] {
+		after.Append(i)
+	}
+	b.Instrs = b.Instrs[:at]
+	after.Succs, b.Succs = b.Succs, nil
+	for _, s := range after.Succs {
+		for j, p := range s.Preds {
+			if p == b {
+				s.Preds[j] = after
+			}
+		}
+	}
+
+	blocks := map[*ir.Block]*ir.Block{}
+	values := map[ir.Value]ir.Value{}
+	for j, p := range callee.Params {
+		values[p] = call.Args[j]
+	}
+	for _, cb := range callee.Blocks {
+		nb := f.NewBlock()
+		blocks[cb] = nb
+		for _, i := range cb.Instrs {
+			copied := f.NewInstr(i.Op, i.Typ)
+			copied.Callee, copied.Loc = i.Callee, i.Loc
+			nb.Append(copied)
+			values[i] = copied
+		}
+	}
+
+	returned := []ir.Value{}
+	for _, cb := range callee.Blocks {
+		nb := blocks[cb]
+		for _, p := range cb.Preds {
+			nb.Preds = append(nb.Preds, blocks[p])
+		}
+		for _, s := range cb.Succs {
+			nb.Succs = append(nb.Succs, blocks[s])
+		}
+		for j, i := range cb.Instrs {
+			copied := nb.Instrs[j]
+			for _, arg := range i.Args {
+				if v, ok := values[arg]; ok {
+					arg = v
+				}
+				copied.Args = append(copied.Args, arg)
+			}
+			if i.Op == ir.OpRet {
+				if len(copied.Args) > 0 {
+					returned = append(returned, copied.Args[0])
+				}
+				copied.Op, copied.Args = ir.OpJump, nil
+				ir.AddEdge(nb, after)
+			}
+		}
+	}
+
+	b.Append(f.NewInstr(ir.OpJump, ir.Void))
+	ir.AddEdge(b, blocks[callee.Entry()])
+
+	switch {
+	case call.Typ == ir.Void:
+	case len(returned) == 1:
+		f.ReplaceUses(call, returned[0])
+	default:
+		// Without any ret, the uses of the call can no longer be reached
+		phi := f.NewInstr(ir.OpPhi, call.Typ, returned...)
+		after.Insert(0, phi)
+		f.ReplaceUses(call, phi)
+	}
+}
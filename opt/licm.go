@@ -0,0 +1,166 @@
+package opt
+
+import (
+	"sort"
+	"yal/ir"
+)
+
+// Natural loop: the blocks from which the back edges to header can be
+// reached without going through it
+type loop struct {
+	header *ir.Block
+	body   map[*ir.Block]bool
+}
+
+// Returns the natural loops of f, innermost ones first
+func loops(f *ir.Func) []*loop {
+	dom := f.Dominators()
+	byHeader := map[*ir.Block]*loop{}
+	found := []*loop{}
+
+	for _, b := range f.ReversePostorder() {
+		for _, h := range b.Succs {
+			if !dom.Dominates(h, b) {
+				continue
+			}
+			l := byHeader[h]
+			if l == nil {
+				l = &loop{header: h, body: map[*ir.Block]bool{h: true}}
+				byHeader[h] = l
+				found = append(found, l)
+			}
+			work := []*ir.Block{b}
+			for len(work) > 0 {
+				n := work[len(work)-1]
+				work = work[:len(work)-1]
+				if l.body[n] || !dom.Reachable(n) {
+					continue
+				}
+				l.body[n] = true
+				work = append(work, n.Preds...)
+			}
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return len(found[i].body) < len(found[j].body)
+	})
+	return found
+}
+
+// Returns the block before the header of l that only jumps to it, nil if
+// there is none
+func (l *loop) preheader() *ir.Block {
+	var pre *ir.Block
+	for _, p := range l.header.Preds {
+		if l.body[p] {
+			continue
+		}
+		if pre != nil {
+			return nil
+		}
+		pre = p
+	}
+	if pre == nil || len(pre.Succs) != 1 {
+		return nil
+	}
+	return pre
+}
+
+// Adds a block through which every edge entering l from outside goes,
+// merging the values of the phis of the header coming from outside in phis
+// of the new block when there are several such edges
+func (l *loop) addPreheader(f *ir.Func) *ir.Block {
+	h := l.header
+	pre := f.NewBlock()
+
+	preds := []*ir.Block{pre}
+	outside := []int{}
+	for j, p := range h.Preds {
+		if l.body[p] {
+			preds = append(preds, p)
+			continue
+		}
+		outside = append(outside, j)
+		for k, s := range p.Succs {
+			if s == h {
+				p.Succs[k] = pre
+				break
+			}
+		}
+		pre.Preds = append(pre.Preds, p)
+	}
+
+	for _, phi := range h.Phis() {
+		args := []ir.Value{}
+		for _, j := range outside {
+			args = append(args, phi.Args[j])
+		}
+		in := args[0]
+		if len(args) > 1 {
+			merged := f.NewInstr(ir.OpPhi, phi.Typ, args...)
+			pre.Append(merged)
+			in = merged
+		}
+
+		inside := []ir.Value{in}
+		for j, p := range h.Preds {
+			if l.body[p] {
+				inside = append(inside, phi.Args[j])
+			}
+		}
+		phi.Args = inside
+	}
+	h.Preds = preds
+
+	pre.Append(f.NewInstr(ir.OpJump, ir.Void))
+	pre.Succs = []*ir.Block{h}
+	return pre
+}
+
+// Hoists the pure instructions of each loop whose operands are defined
+// outside of it to its preheader, innermost loops first so that what they
+// hoist can be hoisted again out of the loops around them
+func licm(f *ir.Func) int {
+	// Adding a preheader inside a loop adds a block to it, so loops are
+	// found again once they all have one
+	for _, l := range loops(f) {
+		if l.preheader() == nil {
+			l.addPreheader(f)
+		}
+	}
+
+	hoisted := 0
+	order := f.ReversePostorder()
+	for _, l := range loops(f) {
+		pre := l.preheader()
+		for changed := true; changed; {
+			changed = false
+			for _, b := range order {
+				if !l.body[b] {
+					continue
+				}
+				for _, i := range append([]*ir.Instr{}, b.Instrs...) {
+					if !isPure(i) || !l.invariant(i) {
+						continue
+					}
+					b.Remove(i)
+					pre.Insert(len(pre.Instrs)-1, i)
+					changed = true
+					hoisted++
+				}
+			}
+		}
+	}
+	return hoisted
+}
+
+// Returns whether the operands of i are defined outside of l
+func (l *loop) invariant(i *ir.Instr) bool {
+	for _, arg := range i.Args {
+		if def, ok := arg.(*ir.Instr); ok && l.body[def.Block] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package opt
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"yal/ir"
+)
+
+// Transformation of a fn of a module, returning the number of changes it
+// made
+type Pass struct {
+	Name string
+	Run  func(m *ir.Module, f *ir.Func) int
+}
+
+// Returns a pass only looking at the fn it transforms
+func fnPass(name string, run func(f *ir.Func) int) Pass {
+	return Pass{Name: name, Run: func(_ *ir.Module, f *ir.Func) int { return run(f) }}
+}
+
+var (
+	// Folds instructions whose operands are constants and branches on
+	// constants, dropping the blocks that can no longer be reached
+	Fold = fnPass("fold", fold)
+	// Removes instructions whose values are never used and stack slots
+	// that are never read
+	DCE = fnPass("dce", dce)
+	// Replaces instructions computing the same value as one dominating them
+	CSE = fnPass("cse", cse)
+	// Moves loop invariant computations out of loops
+	LICM = fnPass("licm", licm)
+	// Inlines the calls to small fns that aren't recursive
+	Inline = Pass{Name: "inline", Run: inline}
+	// Turns the calls to the fn itself whose result is returned right away
+	// into jumps, and marks the other ones as tail calls
+	TCO = Pass{Name: "tco", Run: tco}
+)
+
+// Returns the passes run at an optimization level: none at 0, folding, dead
+// code elimination and tail calls at 1 and every pass at 2
+func Pipeline(level int) []Pass {
+	switch {
+	case level <= 0:
+		return nil
+	case level == 1:
+		return []Pass{Fold, DCE, TCO}
+	}
+	return []Pass{Inline, Fold, CSE, LICM, Fold, DCE, TCO}
+}
+
+type Stats struct {
+	Pass    string
+	Changes int
+	Time    time.Duration
+}
+
+type Manager struct {
+	Passes []Pass
+	// Verifies the module after each pass, so that a pass breaking it is
+	// caught right away
+	Verify bool
+	// Changes and time of each pass over the last module run
+	Stats []Stats
+}
+
+func NewManager(level int) *Manager {
+	return &Manager{Passes: Pipeline(level)}
+}
+
+// Runs the passes in order over every fn of m, then renumbers its blocks
+// and values
+func (pm *Manager) Run(m *ir.Module) error {
+	pm.Stats = nil
+	for _, p := range pm.Passes {
+		s := Stats{Pass: p.Name}
+		start := time.Now()
+		for _, f := range m.Funcs {
+			s.Changes += p.Run(m, f)
+		}
+		s.Time = time.Since(start)
+		pm.Stats = append(pm.Stats, s)
+
+		if pm.Verify {
+			if errs := ir.Verify(m); len(errs) > 0 {
+				return fmt.Errorf("after %s: %v", p.Name, errs[0])
+			}
+		}
+	}
+
+	for _, f := range m.Funcs {
+		f.Blocks = f.ReversePostorder()
+		f.Renumber()
+	}
+	return nil
+}
+
+// Writes a table of the changes and time of each pass of the last run
+func (pm *Manager) WriteStats(w io.Writer) error {
+	total := Stats{Pass: "total"}
+	if _, err := fmt.Fprintf(w, "%-8s %8s %12s\n", "pass", "changes", "time"); err != nil {
+		return err
+	}
+	for _, s := range pm.Stats {
+		if _, err := fmt.Fprintf(w, "%-8s %8d %12s\n", s.Pass, s.Changes, s.Time); err != nil {
+			return err
+		}
+		total.Changes += s.Changes
+		total.Time += s.Time
+	}
+	_, err := fmt.Fprintf(w, "%-8s %8d %12s\n", total.Pass, total.Changes, total.Time)
+	return err
+}
+
+// Returns whether i can be removed or moved without changing what the
+// program does, provided its operands are still available
+func isPure(i *ir.Instr) bool {
+	switch {
+	case i.Op == ir.OpDiv || i.Op == ir.OpRem:
+		// Dividing by zero traps, as does dividing the smallest int by -1
+		c, ok := i.Args[1].(*ir.Const)
+		return ok && (c.Typ == ir.Float || c.Int != 0 && !(c.Typ == ir.Int && c.Int == -1))
+	case i.Op.IsBinary(), i.Op.IsUnary(), i.Op.IsCompare():
+		return true
+	}
+	return false
+}
+
+// Removes the blocks that can't be reached from the entry of f, returning
+// how many there were
+func removeUnreachable(f *ir.Func) int {
+	reachable := map[*ir.Block]bool{}
+	for _, b := range f.ReversePostorder() {
+		reachable[b] = true
+	}
+
+	blocks := []*ir.Block{}
+	for _, b := range f.Blocks {
+		if reachable[b] {
+			blocks = append(blocks, b)
+			continue
+		}
+		for len(b.Succs) > 0 {
+			ir.RemoveEdge(b, b.Succs[0])
+		}
+	}
+	removed := len(f.Blocks) - len(blocks)
+	f.Blocks = blocks
+	return removed
+}
@@ -0,0 +1,684 @@
+package opt_test
+
+import (
+	"strings"
+	"testing"
+	"yal/ir"
+	"yal/opt"
+)
+
+// Runs passes over the module src and checks that it then prints as want
+func expectOpt(t *testing.T, src string, want string, passes ...opt.Pass) *opt.Manager {
+	m, err := ir.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm := &opt.Manager{Passes: passes, Verify: true}
+	if err := pm.Run(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s\n", want, got)
+	}
+	return pm
+}
+
+func TestFold(t *testing.T) {
+	t.Run("Test arithmetic", func(t *testing.T) {
+		expectOpt(t, `fn f(): int {
+b0:
+  %0 = add int 2, 3
+  %1 = mul int %0, -4
+  %2 = shr int %1, 1
+  ret int %2
+}
+`, `fn f(): int {
+b0:
+  ret int -10
+}
+`, opt.Fold)
+	})
+
+	t.Run("Test wrapping", func(t *testing.T) {
+		expectOpt(t, `fn f(): bool {
+b0:
+  %0 = add char 250c, 10c
+  %1 = sub uint 0u, 1u
+  %2 = shr uint %1, 60u
+  %3 = lt uint 1u, %1
+  %4 = eq char %0, 4c
+  %5 = and bool %3, %4
+  %6 = eq uint %2, 15u
+  %7 = and bool %5, %6
+  ret bool %7
+}
+`, `fn f(): bool {
+b0:
+  ret bool true
+}
+`, opt.Fold)
+	})
+
+	t.Run("Test floats", func(t *testing.T) {
+		expectOpt(t, `fn f(): float {
+b0:
+  %0 = div float 1.0, 4.0
+  %1 = neg float %0
+  ret float %1
+}
+`, `fn f(): float {
+b0:
+  ret float -0.25
+}
+`, opt.Fold)
+	})
+
+	t.Run("Test traps are kept", func(t *testing.T) {
+		src := `fn f(): int {
+b0:
+  %0 = div int 1, 0
+  %1 = shl int 1, 64
+  %2 = add int %0, %1
+  ret int %2
+}
+`
+		expectOpt(t, src, src, opt.Fold)
+	})
+
+	t.Run("Test branches", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int): int {
+b0:
+  %0 = gt int 2, 1
+  br %0, b1, b2
+b1:
+  %1 = add int %a, 1
+  jmp b3
+b2:
+  %2 = add int %a, 2
+  jmp b3
+b3:
+  %3 = phi int [%1, b1], [%2, b2]
+  ret int %3
+}
+`, `fn f(%a: int): int {
+b0:
+  %0 = add int %a, 1
+  ret int %0
+}
+`, opt.Fold)
+	})
+
+	t.Run("Test constants through phis", func(t *testing.T) {
+		expectOpt(t, `fn f(%c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  jmp b3
+b2:
+  jmp b3
+b3:
+  %0 = phi int [7, b1], [7, b2]
+  %1 = mul int %0, 2
+  ret int %1
+}
+`, `fn f(%c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  jmp b3
+b2:
+  jmp b3
+b3:
+  ret int 14
+}
+`, opt.Fold)
+	})
+}
+
+func TestDCE(t *testing.T) {
+	t.Run("Test unused values", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int, %b: int): int {
+b0:
+  %0 = add int %a, %b
+  %1 = mul int %0, 2
+  %2 = div int %a, %b
+  %3 = call int @f(%a, %b)
+  ret int %a
+}
+`, `fn f(%a: int, %b: int): int {
+b0:
+  %0 = div int %a, %b
+  %1 = call int @f(%a, %b)
+  ret int %a
+}
+`, opt.DCE)
+	})
+
+	t.Run("Test slots never read", func(t *testing.T) {
+		expectOpt(t, `fn f(%p: *int): int {
+b0:
+  %0 = alloca int
+  store int %0, 1
+  %1 = alloca int
+  store int %1, 2
+  %2 = load int %1
+  %3 = alloca int
+  %4 = alloca *int
+  store *int %4, %3
+  store int %p, 3
+  ret int %2
+}
+`, `fn f(%p: *int): int {
+b0:
+  %0 = alloca int
+  store int %0, 2
+  %1 = load int %0
+  store int %p, 3
+  ret int %1
+}
+`, opt.DCE)
+	})
+
+	t.Run("Test dead loop values", func(t *testing.T) {
+		expectOpt(t, `fn f(%n: int): void {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%2, b1]
+  %1 = phi int [0, b0], [%3, b1]
+  %2 = add int %0, 1
+  %3 = add int %1, %2
+  %4 = lt int %2, %n
+  br %4, b1, b2
+b2:
+  ret
+}
+`, `fn f(%n: int): void {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%1, b1]
+  %1 = add int %0, 1
+  %2 = lt int %1, %n
+  br %2, b1, b2
+b2:
+  ret
+}
+`, opt.DCE)
+	})
+}
+
+func TestCSE(t *testing.T) {
+	t.Run("Test dominated duplicates", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int, %b: int): int {
+b0:
+  %0 = add int %a, %b
+  %1 = gt int %a, 0
+  br %1, b1, b2
+b1:
+  %2 = add int %b, %a
+  ret int %2
+b2:
+  %3 = mul int %a, %b
+  %4 = gt int %a, 0
+  br %4, b3, b4
+b3:
+  ret int %3
+b4:
+  %5 = mul int %b, %a
+  %6 = sub int %a, %b
+  %7 = sub int %b, %a
+  %8 = add int %5, %6
+  %9 = add int %8, %7
+  ret int %9
+}
+`, `fn f(%a: int, %b: int): int {
+b0:
+  %0 = add int %a, %b
+  %1 = gt int %a, 0
+  br %1, b1, b2
+b1:
+  ret int %0
+b2:
+  %2 = mul int %a, %b
+  br %1, b3, b4
+b3:
+  ret int %2
+b4:
+  %3 = sub int %a, %b
+  %4 = sub int %b, %a
+  %5 = add int %2, %3
+  %6 = add int %5, %4
+  ret int %6
+}
+`, opt.CSE)
+	})
+
+	t.Run("Test branches don't share values", func(t *testing.T) {
+		src := `fn f(%a: int, %c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  %0 = add int %a, 1
+  jmp b3
+b2:
+  %1 = add int %a, 1
+  jmp b3
+b3:
+  %2 = phi int [%0, b1], [%1, b2]
+  ret int %2
+}
+`
+		expectOpt(t, src, src, opt.CSE)
+	})
+}
+
+func TestLICM(t *testing.T) {
+	t.Run("Test invariants are hoisted", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int, %n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%4, b2]
+  %1 = phi int [0, b0], [%5, b2]
+  %2 = lt int %0, %n
+  br %2, b2, b3
+b2:
+  %3 = mul int %a, %a
+  %6 = add int %3, 1
+  %7 = div int %a, %n
+  %4 = add int %0, 1
+  %8 = add int %6, %7
+  %5 = add int %1, %8
+  jmp b1
+b3:
+  ret int %1
+}
+`, `fn f(%a: int, %n: int): int {
+b0:
+  %0 = mul int %a, %a
+  %1 = add int %0, 1
+  jmp b1
+b1:
+  %2 = phi int [0, b0], [%6, b2]
+  %3 = phi int [0, b0], [%8, b2]
+  %4 = lt int %2, %n
+  br %4, b2, b3
+b2:
+  %5 = div int %a, %n
+  %6 = add int %2, 1
+  %7 = add int %1, %5
+  %8 = add int %3, %7
+  jmp b1
+b3:
+  ret int %3
+}
+`, opt.LICM)
+	})
+
+	t.Run("Test preheaders are added", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int, %c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  jmp b3
+b2:
+  jmp b3
+b3:
+  %0 = phi int [1, b1], [2, b2], [%2, b4]
+  %1 = lt int %0, 100
+  br %1, b4, b5
+b4:
+  %3 = shl int %a, 2
+  %2 = add int %0, %3
+  jmp b3
+b5:
+  ret int %0
+}
+`, `fn f(%a: int, %c: bool): int {
+b0:
+  br %c, b1, b2
+b1:
+  jmp b3
+b2:
+  jmp b3
+b3:
+  %0 = phi int [1, b1], [2, b2]
+  %1 = shl int %a, 2
+  jmp b4
+b4:
+  %2 = phi int [%0, b3], [%4, b5]
+  %3 = lt int %2, 100
+  br %3, b5, b6
+b5:
+  %4 = add int %2, %1
+  jmp b4
+b6:
+  ret int %2
+}
+`, opt.LICM)
+	})
+
+	t.Run("Test nested loops", func(t *testing.T) {
+		expectOpt(t, `fn f(%a: int, %n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%3, b4]
+  %1 = lt int %0, %n
+  br %1, b2, b5
+b2:
+  jmp b3
+b3:
+  %2 = phi int [%0, b2], [%4, b3]
+  %5 = mul int %a, 3
+  %4 = add int %2, %5
+  %6 = lt int %4, %n
+  br %6, b3, b4
+b4:
+  %3 = add int %0, 1
+  jmp b1
+b5:
+  ret int %0
+}
+`, `fn f(%a: int, %n: int): int {
+b0:
+  %0 = mul int %a, 3
+  jmp b1
+b1:
+  %1 = phi int [0, b0], [%6, b4]
+  %2 = lt int %1, %n
+  br %2, b2, b5
+b2:
+  jmp b3
+b3:
+  %3 = phi int [%1, b2], [%4, b3]
+  %4 = add int %3, %0
+  %5 = lt int %4, %n
+  br %5, b3, b4
+b4:
+  %6 = add int %1, 1
+  jmp b1
+b5:
+  ret int %1
+}
+`, opt.LICM)
+	})
+}
+
+func TestManager(t *testing.T) {
+	src := `fn f(%n: int): int {
+b0:
+  %0 = add int 1, 1
+  jmp b1
+b1:
+  %1 = phi int [0, b0], [%6, b2]
+  %2 = lt int %1, %n
+  br %2, b2, b3
+b2:
+  %3 = mul int %n, %0
+  %4 = mul int %0, %n
+  %5 = add int %3, %4
+  %6 = add int %1, %5
+  jmp b1
+b3:
+  %7 = sub int %n, %n
+  ret int %1
+}
+`
+
+	t.Run("Test levels", func(t *testing.T) {
+		if len(opt.Pipeline(0)) != 0 || len(opt.Pipeline(1)) >= len(opt.Pipeline(2)) {
+			t.Errorf("expected more passes at higher levels\n")
+		}
+
+		expectOpt(t, src, src, opt.Pipeline(0)...)
+		expectOpt(t, src, `fn f(%n: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [0, b0], [%5, b2]
+  %1 = lt int %0, %n
+  br %1, b2, b3
+b2:
+  %2 = mul int %n, 2
+  %3 = mul int 2, %n
+  %4 = add int %2, %3
+  %5 = add int %0, %4
+  jmp b1
+b3:
+  ret int %0
+}
+`, opt.Pipeline(1)...)
+	})
+
+	t.Run("Test stats", func(t *testing.T) {
+		pm := expectOpt(t, src, `fn f(%n: int): int {
+b0:
+  %0 = mul int %n, 2
+  %1 = add int %0, %0
+  jmp b1
+b1:
+  %2 = phi int [0, b0], [%4, b2]
+  %3 = lt int %2, %n
+  br %3, b2, b3
+b2:
+  %4 = add int %2, %1
+  jmp b1
+b3:
+  ret int %2
+}
+`, opt.Pipeline(2)...)
+
+		var sb strings.Builder
+		if err := pm.WriteStats(&sb); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+		if len(lines) != len(pm.Passes)+2 || !strings.HasPrefix(lines[1], pm.Passes[0].Name) ||
+			!strings.HasPrefix(lines[len(lines)-1], "total") {
+			t.Errorf("expected a line per pass and a total, got\n%s\n", sb.String())
+		}
+		if s := pm.Stats[1]; s.Pass != "fold" || s.Changes != 1 {
+			t.Errorf("expected fold to fold 1 instruction first, got %d by %s\n", s.Changes, s.Pass)
+		}
+	})
+}
+
+func TestTCO(t *testing.T) {
+	t.Run("Test self calls become loops", func(t *testing.T) {
+		expectOpt(t, `fn sum(%n: int, %acc: int): int {
+b0:
+  %0 = eq int %n, 0
+  br %0, b1, b2
+b1:
+  ret int %acc
+b2:
+  %1 = sub int %n, 1
+  %2 = add int %acc, %n
+  %3 = call int @sum(%1, %2)
+  ret int %3
+}
+`, `fn sum(%n: int, %acc: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [%n, b0], [%3, b3]
+  %1 = phi int [%acc, b0], [%4, b3]
+  %2 = eq int %0, 0
+  br %2, b2, b3
+b2:
+  ret int %1
+b3:
+  %3 = sub int %0, 1
+  %4 = add int %1, %0
+  jmp b1
+}
+`, opt.TCO)
+	})
+
+	t.Run("Test tail calls", func(t *testing.T) {
+		expectOpt(t, `fn even(%n: int): bool {
+b0:
+  %0 = eq int %n, 0
+  br %0, b1, b2
+b1:
+  ret bool true
+b2:
+  %1 = sub int %n, 1
+  %2 = call bool @odd(%1)
+  ret bool %2
+}
+
+fn odd(%n: int): bool {
+b0:
+  %0 = eq int %n, 0
+  br %0, b1, b2
+b1:
+  ret bool false
+b2:
+  %1 = sub int %n, 1
+  %2 = call bool @even(%1)
+  %3 = not bool %2
+  %4 = not bool %3
+  ret bool %4
+}
+`, `fn even(%n: int): bool {
+b0:
+  %0 = eq int %n, 0
+  br %0, b1, b2
+b1:
+  ret bool true
+b2:
+  %1 = sub int %n, 1
+  %2 = tail call bool @odd(%1)
+  ret bool %2
+}
+
+fn odd(%n: int): bool {
+b0:
+  %0 = eq int %n, 0
+  br %0, b1, b2
+b1:
+  ret bool false
+b2:
+  %1 = sub int %n, 1
+  %2 = call bool @even(%1)
+  %3 = not bool %2
+  %4 = not bool %3
+  ret bool %4
+}
+`, opt.TCO)
+	})
+
+	t.Run("Test fns with slots are left alone", func(t *testing.T) {
+		src := `fn f(%p: *int): int {
+b0:
+  %0 = alloca int
+  %1 = call int @f(%0)
+  ret int %1
+}
+`
+		expectOpt(t, src, src, opt.TCO)
+	})
+}
+
+func TestInline(t *testing.T) {
+	t.Run("Test small fns", func(t *testing.T) {
+		expectOpt(t, `fn abs(%x: int): int {
+b0:
+  %0 = lt int %x, 0
+  br %0, b1, b2
+b1:
+  %1 = neg int %x
+  ret int %1
+b2:
+  ret int %x
+}
+
+fn f(%a: int): int {
+b0:
+  %0 = call int @abs(%a)
+  %1 = add int %0, 1
+  ret int %1
+}
+`, `fn abs(%x: int): int {
+b0:
+  %0 = lt int %x, 0
+  br %0, b1, b2
+b1:
+  %1 = neg int %x
+  ret int %1
+b2:
+  ret int %x
+}
+
+fn f(%a: int): int {
+b0:
+  jmp b1
+b1:
+  %0 = lt int %a, 0
+  br %0, b2, b3
+b2:
+  %1 = neg int %a
+  jmp b4
+b3:
+  jmp b4
+b4:
+  %2 = phi int [%1, b2], [%a, b3]
+  %3 = add int %2, 1
+  ret int %3
+}
+`, opt.Inline)
+	})
+
+	t.Run("Test recursive fns", func(t *testing.T) {
+		src := `fn f(%n: int): int {
+b0:
+  %0 = call int @g(%n)
+  ret int %0
+}
+
+fn g(%n: int): int {
+b0:
+  %0 = call int @f(%n)
+  ret int %0
+}
+
+fn h(%n: int): int {
+b0:
+  %0 = call int @f(%n)
+  ret int %0
+}
+`
+		expectOpt(t, src, src, opt.Inline)
+	})
+
+	t.Run("Test inlined calls fold", func(t *testing.T) {
+		expectOpt(t, `fn sq(%x: int): int {
+b0:
+  %0 = mul int %x, %x
+  ret int %0
+}
+
+fn main(): void {
+b0:
+  %0 = call int @sq(7)
+  call void @print(%0)
+  ret
+}
+`, `fn sq(%x: int): int {
+b0:
+  %0 = mul int %x, %x
+  ret int %0
+}
+
+fn main(): void {
+b0:
+  call void @print(49)
+  ret
+}
+`, opt.Inline, opt.Fold)
+	})
+}
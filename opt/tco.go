@@ -0,0 +1,60 @@
+package opt
+
+import (
+	"yal/ir"
+)
+
+// Calls of f to itself are turned into jumps back to its entry, which gets
+// a phi for each param, while calls to other fns are marked for the caller
+// frame to be reused. Fns with stack slots are left alone since their
+// address may be passed on to the callee, as are fns deferring calls, which
+// run once the callee returns.
+func tco(m *ir.Module, f *ir.Func) int {
+	self := []*ir.Instr{}
+	changes := 0
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			switch {
+			case i.Op == ir.OpAlloca || i.Op == ir.OpDefer:
+				return 0
+			case i.Op != ir.OpCall || i.Tail || m.Func(i.Callee) == nil || !i.InTailPosition():
+			case i.Callee == f.Name:
+				self = append(self, i)
+			default:
+				i.Tail = true
+				changes++
+			}
+		}
+	}
+	if len(self) == 0 {
+		return changes
+	}
+
+	// The entry becomes the head of the loop, entered from a new block
+	header := f.Entry()
+	entry := f.NewBlock()
+	f.Blocks = append([]*ir.Block{entry}, f.Blocks[:len(f.Blocks)-1]...)
+	entry.Append(f.NewInstr(ir.OpJump, ir.Void))
+	ir.AddEdge(entry, header)
+
+	phis := []*ir.Instr{}
+	for j, p := range f.Params {
+		phi := f.NewInstr(ir.OpPhi, p.Typ)
+		f.ReplaceUses(p, phi)
+		phi.Args = []ir.Value{p}
+		header.Insert(j, phi)
+		phis = append(phis, phi)
+	}
+
+	for _, call := range self {
+		b := call.Block
+		b.Remove(b.Terminator())
+		b.Remove(call)
+		b.Append(f.NewInstr(ir.OpJump, ir.Void))
+		ir.AddEdge(b, header)
+		for j, phi := range phis {
+			phi.Args = append(phi.Args, call.Args[j])
+		}
+	}
+	return changes + len(self)
+}
@@ -35,7 +35,7 @@ func (p *Parser) Run() []IStatement {
 
 func (p *Parser) declaration() IStatement {
 	// TODO: perhaps we can use switches instead of 'if' blocks
-	ok, v := p.match(DefineType, Let)
+	ok, v := p.match(DefineType, Let, Import, Pub, Const, Impl)
 	if !ok {
 		return p.statement()
 	}
@@ -44,17 +44,67 @@ func (p *Parser) declaration() IStatement {
 	case DefineType:
 		return p.defineTypeStatement()
 	case Let:
+		if p.checkNT(LeftParen) {
+			return p.tupleDeclaration()
+		}
 		return p.varDeclaration()
+	case Import:
+		return p.importStatement()
+	case Pub:
+		return p.pubDeclaration()
+	case Const:
+		return p.constDeclaration()
+	case Impl:
+		return p.implStatement()
 	default:
 		p.panicReason("It's not supposed to reach here\n")
 		return nil
 	}
 }
 
+func (p *Parser) importStatement() IStatement {
+	tk := p.previous()
+	path := p.consume(String, "Expect module path after 'import'.")
+	if path == nil {
+		p.panicReason("Expected module path after 'import' at line %d column %d\n", tk.Line, tk.Column)
+	}
+	p.consume(Semicolon, "Expect ';' after import.")
+
+	return &ImportStmt{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Path: path,
+	}
+}
+
+// Parses a top level fn or type definition exported by its module
+func (p *Parser) pubDeclaration() IStatement {
+	if p.matchNT(Fn) {
+		fn := p.fnStatement().(*FnDeclStmt)
+		fn.Public = true
+		return fn
+	}
+
+	if p.matchNT(DefineType) {
+		dt := p.defineTypeStatement().(*DefineTypeStatement)
+		dt.Public = true
+		return dt
+	}
+
+	p.panicReason("Expected 'fn' or 'definetype' after 'pub' at line %d column %d\n", p.peek().Line, p.peek().Column)
+	return nil
+}
+
 func (p *Parser) statement() IStatement {
 	// TODO: perhaps we can use switches instead of 'if' blocks
 
-	ok, v := p.match(Fn, For, While, LeftBrace)
+	if p.checkNT(Identifier) && p.checkNextNT(Colon) {
+		return p.labelStatement()
+	}
+
+	ok, v := p.match(Fn, For, While, LeftBrace, Spawn, Switch, Defer, Break, Continue, Goto)
 	if !ok {
 		return p.expressionStatement()
 	}
@@ -62,6 +112,14 @@ func (p *Parser) statement() IStatement {
 	switch v.TokenType {
 	case Fn:
 		return p.fnStatement()
+	case Spawn:
+		return p.spawnStatement()
+	case Defer:
+		return p.deferStatement()
+	case Break, Continue, Goto:
+		return p.jumpStatement()
+	case Switch:
+		return p.switchStatement()
 	case For:
 		return p.forStatement()
 	case While:
@@ -76,29 +134,275 @@ func (p *Parser) statement() IStatement {
 }
 
 func (p *Parser) fnReturn() IExpression {
-	p.consume(Return, "Expected return keyword (???)")
+	tk := p.consume(Return, "Expected return keyword (???)")
+	loc := Loc{
+		Line:   tk.Line,
+		Column: tk.Column,
+	}
+
+	if p.checkNT(Semicolon) {
+		return &FnReturn{
+			Loc: loc,
+		}
+	}
+
+	value := p.expression()
+	if p.checkNT(Comma) {
+		elems := []IExpression{value}
+		for p.matchNT(Comma) {
+			elems = append(elems, p.expression())
+		}
+		value = &Tuple{
+			Loc:   loc,
+			Elems: elems,
+		}
+	}
 
 	return &FnReturn{
-		Value: p.expression(),
+		Loc:   loc,
+		Value: value,
+	}
+}
+
+func (p *Parser) tupleDeclaration() IStatement {
+	tk := p.consume(LeftParen, "Expect '(' before destructured names.")
+
+	names := []*Token{}
+	for !p.isEof() && !p.checkNT(RightParen) {
+		name := p.consume(Identifier, "Expect variable name.")
+		if name == nil {
+			p.panicReason("Expected variable name at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		names = append(names, name)
+		if !p.matchNT(Comma) {
+			break
+		}
+	}
+	p.consume(RightParen, "Expect ')' after destructured names.")
+	if !p.matchNT(Equal) {
+		p.panicReason("Expected '=' after destructured names at line %d column %d\n", p.peek().Line, p.peek().Column)
+	}
+	initializer := p.expression()
+	p.consume(Semicolon, "Expect ';' after variable declaration.")
+
+	return &TupleDecl{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Names:       names,
+		Initializer: initializer,
+	}
+}
+
+func (p *Parser) spawnStatement() IStatement {
+	tk := p.previous()
+	call, ok := p.expression().(*FnCall)
+	if !ok {
+		p.panicReason("Expected fn call after 'spawn' at line %d column %d\n", tk.Line, tk.Column)
+	}
+	p.consume(Semicolon, "Expect ';' after spawn statement.")
+
+	return &SpawnStmt{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Call: call,
+	}
+}
+
+func (p *Parser) jumpStatement() IStatement {
+	tk := p.previous()
+	loc := Loc{
+		Line:   tk.Line,
+		Column: tk.Column,
+	}
+
+	var stmt IStatement
+	switch tk.TokenType {
+	case Break:
+		stmt = &BreakStmt{Loc: loc}
+	case Continue:
+		stmt = &ContinueStmt{Loc: loc}
+	default:
+		label := p.consume(Identifier, "Expect label after 'goto'.")
+		if label == nil {
+			p.panicReason("Expected label after 'goto' at line %d column %d\n", tk.Line, tk.Column)
+		}
+		stmt = &GotoStmt{Loc: loc, Label: label}
+	}
+	p.consume(Semicolon, "Expect ';' after jump statement.")
+
+	return stmt
+}
+
+func (p *Parser) labelStatement() IStatement {
+	name := p.advance()
+	p.consume(Colon, "Expect ':' after label.")
+
+	return &LabelStmt{
+		Loc: Loc{
+			Line:   name.Line,
+			Column: name.Column,
+		},
+		Name: name,
+	}
+}
+
+func (p *Parser) deferStatement() IStatement {
+	tk := p.previous()
+	expr := p.expression()
+	p.consume(Semicolon, "Expect ';' after defer statement.")
+
+	return &DeferStmt{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Expr: expr,
+	}
+}
+
+func (p *Parser) constDeclaration() IStatement {
+	name := p.consume(Identifier, "Expect constant name.")
+	if name == nil {
+		p.panicReason("Expected constant name at line %d column %d\n", p.peek().Line, p.peek().Column)
+	}
+
+	var type_ann IExpression
+	if p.matchNT(Colon) {
+		type_ann = p.typeAnnotation()
+	}
+	if !p.matchNT(Equal) {
+		p.panicReason("Expected '=' after constant %s at line %d column %d\n", name.Lexeme, name.Line, name.Column)
+	}
+	value := p.expression()
+	p.consume(Semicolon, "Expect ';' after constant declaration.")
+
+	return &ConstDeclStmt{
+		Loc: Loc{
+			Line:   name.Line,
+			Column: name.Column,
+		},
+		Name:  name,
+		Type:  type_ann,
+		Value: value,
 	}
 }
 
+func (p *Parser) switchStatement() IStatement {
+	tk := p.previous()
+	p.consume(LeftParen, "Expect '(' after 'switch'.")
+	subject := p.expression()
+	p.consume(RightParen, "Expect ')' after switch subject.")
+	p.consume(LeftBrace, "Expect '{' before switch cases.")
+
+	stmt := &SwitchStmt{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Subject: subject,
+		Cases:   []*SwitchCase{},
+	}
+
+	for !p.isEof() && !p.checkNT(RightBrace) {
+		if p.matchNT(Default) {
+			def := p.previous()
+			if stmt.Default != nil {
+				p.panicReason("Duplicated default case at line %d column %d\n", def.Line, def.Column)
+			}
+			p.consume(Colon, "Expect ':' after 'default'.")
+			stmt.Default = p.caseBody(def)
+			continue
+		}
+
+		if !p.matchNT(Case) {
+			p.panicReason("Expected 'case' or 'default' at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		c := p.previous()
+		values := []IExpression{p.expression()}
+		for p.matchNT(Comma) {
+			values = append(values, p.expression())
+		}
+		p.consume(Colon, "Expect ':' after case values.")
+
+		stmt.Cases = append(stmt.Cases, &SwitchCase{
+			Loc: Loc{
+				Line:   c.Line,
+				Column: c.Column,
+			},
+			Values: values,
+			Body:   p.caseBody(c),
+		})
+	}
+	p.consume(RightBrace, "Expect '}' after switch cases.")
+
+	return stmt
+}
+
+// Parses the statements of a switch case up to the next case
+func (p *Parser) caseBody(tk *Token) IStatement {
+	statements := []IStatement{}
+	for !p.isEof() && !p.checkNT(Case) && !p.checkNT(Default) && !p.checkNT(RightBrace) {
+		statements = append(statements, p.declaration())
+	}
+
+	return &Block{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Statements: statements,
+	}
+}
+
+// Parses the declarations up to the ')' closing a list of args, failing on
+// one that doesn't start with a name rather than making no progress
+func (p *Parser) params(what string) FnArgs {
+	args := FnArgs{}
+	for !p.isEof() && !p.checkNT(RightParen) {
+		if !p.checkNT(Identifier) {
+			p.panicReason("Expected %s name at line %d column %d\n", what, p.peek().Line, p.peek().Column)
+		}
+		args = append(args, p.varDeclaration())
+	}
+	if p.consume(RightParen, "Expect ')' after args.") == nil {
+		p.panicReason("Expected ')' after %ss at line %d column %d\n", what, p.peek().Line, p.peek().Column)
+	}
+	return args
+}
+
 func (p *Parser) varDeclaration() IStatement {
 	name := p.consume(Identifier, "Expect variable name.")
+	loc := Loc{}
+	if name != nil {
+		loc = Loc{
+			Line:   name.Line,
+			Column: name.Column,
+		}
+	}
 
-	var type_ann *Token
+	var type_ann IExpression
 	var initializer IExpression = &Literal{Value: nil}
 	if p.matchNT(Colon) {
-		if p.peek().TokenType == Identifier {
-			type_ann = p.advance()
-		} else {
-			type_ann = nil
-		}
+		type_ann = p.typeAnnotation()
 	}
 	if p.matchNT(Equal) {
 		initializer = p.expression()
+		// Default value of an fn param
+		if p.matchNT(Comma) || p.peek().TokenType == RightParen {
+			return &VarDeclExpression{
+				Loc:         loc,
+				Name:        name,
+				Initializer: initializer,
+				Type:        type_ann,
+			}
+		}
 	} else if p.matchNT(Comma) || p.peek().TokenType == RightParen {
 		return &VarDeclExpression{
+			Loc:  loc,
 			Name: name,
 			Initializer: &Literal{
 				Value: nil,
@@ -110,6 +414,7 @@ func (p *Parser) varDeclaration() IStatement {
 	p.consume(Semicolon, "Expect ';' after variable declaration.")
 
 	return &VarDeclExpression{
+		Loc:         loc,
 		Name:        name,
 		Initializer: initializer,
 		Type:        type_ann,
@@ -118,13 +423,180 @@ func (p *Parser) varDeclaration() IStatement {
 
 func (p *Parser) defineTypeStatement() IStatement {
 	name := p.consume(Identifier, "Expected type name for type definition")
+	typeParams := p.typeParams()
 	p.consume(Equal, "Expected = after type definition name.")
-	tokenType := p.consume(Identifier, "Expected a type after =")
+
+	if p.matchNT(Interface) {
+		iface := p.interfaceType()
+		p.consume(Semicolon, "Expected ';' after type definition")
+
+		return &DefineTypeStatement{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name:       name,
+			TypeParams: typeParams,
+			Interface:  iface,
+		}
+	}
+
+	if p.matchNT(Enum) {
+		enum := p.enumType()
+		p.consume(Semicolon, "Expected ';' after type definition")
+
+		return &DefineTypeStatement{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name:       name,
+			TypeParams: typeParams,
+			Enum:       enum,
+		}
+	}
+
+	tokenType := p.typeAnnotation()
+	if tokenType == nil {
+		p.panicReason("Expected a type after = at line %d column %d\n", p.peek().Line, p.peek().Column)
+	}
 	p.consume(Semicolon, "Expected ';' after type definition")
 
 	return &DefineTypeStatement{
-		Name: name,
-		Type: tokenType,
+		Loc: Loc{
+			Line:   name.Line,
+			Column: name.Column,
+		},
+		Name:       name,
+		TypeParams: typeParams,
+		Type:       tokenType,
+	}
+}
+
+func (p *Parser) interfaceType() *InterfaceType {
+	tk := p.previous()
+	p.consume(LeftBrace, "Expect '{' after 'interface'.")
+
+	methods := []*MethodSig{}
+	for !p.isEof() && !p.checkNT(RightBrace) {
+		if !p.matchNT(Fn) {
+			p.panicReason("Expected 'fn' in interface at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		name := p.consume(Identifier, "Expect method name.")
+		p.consume(LeftParen, "Expect '(' after method name.")
+		args := FnArgs{}
+		for !p.isEof() && p.peek().TokenType != RightParen {
+			args = append(args, p.varDeclaration())
+		}
+		p.consume(RightParen, "Expect ')' after method args.")
+
+		var ret IExpression
+		if p.matchNT(Colon) {
+			ret = p.typeAnnotation()
+		}
+		p.consume(Semicolon, "Expect ';' after method signature.")
+
+		methods = append(methods, &MethodSig{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name: name,
+			Args: &args,
+			Type: ret,
+		})
+	}
+	p.consume(RightBrace, "Expect '}' after interface methods.")
+
+	return &InterfaceType{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Methods: methods,
+	}
+}
+
+func (p *Parser) implStatement() IStatement {
+	tk := p.previous()
+	name := p.consume(Identifier, "Expect type name after 'impl'.")
+	if name == nil {
+		p.panicReason("Expected type name after 'impl' at line %d column %d\n", tk.Line, tk.Column)
+	}
+	p.consume(LeftBrace, "Expect '{' after impl type name.")
+
+	methods := []*FnDeclStmt{}
+	for !p.isEof() && !p.checkNT(RightBrace) {
+		public := p.matchNT(Pub)
+		if !p.matchNT(Fn) {
+			p.panicReason("Expected 'fn' in impl block at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		fn := p.fnStatement().(*FnDeclStmt)
+		fn.Public = public
+
+		if len(*fn.Args) > 0 {
+			self := (*fn.Args)[0].(*VarDeclExpression)
+			if self.Name.Lexeme == "self" && self.Type == nil {
+				self.Type = &TypeName{
+					Loc: Loc{
+						Line:   self.Name.Line,
+						Column: self.Name.Column,
+					},
+					Name: name,
+				}
+			}
+		}
+		methods = append(methods, fn)
+	}
+	p.consume(RightBrace, "Expect '}' after impl block.")
+
+	return &ImplStmt{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Type:    name,
+		Methods: methods,
+	}
+}
+
+func (p *Parser) enumType() *EnumType {
+	tk := p.previous()
+	p.consume(LeftBrace, "Expect '{' after 'enum'.")
+
+	variants := []*EnumVariant{}
+	for !p.isEof() && !p.checkNT(RightBrace) {
+		name := p.consume(Identifier, "Expect variant name.")
+		if name == nil {
+			p.panicReason("Expected variant name at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+
+		fields := FnArgs{}
+		if p.matchNT(LeftParen) {
+			fields = p.params("variant field")
+		}
+
+		variants = append(variants, &EnumVariant{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name:   name,
+			Fields: fields,
+		})
+
+		if !p.matchNT(Comma) {
+			break
+		}
+	}
+	p.consume(RightBrace, "Expect '}' after enum variants.")
+
+	return &EnumType{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Variants: variants,
 	}
 }
 
@@ -137,7 +609,8 @@ func (p *Parser) expressionStatement() IExpression {
 	expr := p.expression()
 	if p.peek().TokenType == RightBrace {
 		return &FnReturn{
-			Value: expr,
+			Value:    expr,
+			Implicit: true,
 		}
 	}
 
@@ -147,44 +620,144 @@ func (p *Parser) expressionStatement() IExpression {
 	}
 }
 
-func (p *Parser) fnCall() IExpression {
-	fnName := p.consume(Identifier, "there's not a valid identifier for the fn call")
-	p.consume(LeftParen, "missing ( after fn identifier")
-	fnArgs := FnCallArgs{}
-	for p.peek().TokenType != RightParen {
-		fnArgs = append(fnArgs, p.fnCallArg())
-	}
-	p.consume(RightParen, "missing ) after fn args")
+// Parses any number of call, index and field suffixes after a primary
+// expression, so the called value can be an fn name as well as any
+// expression yielding an fn
+func (p *Parser) call() IExpression {
+	expr := p.primary()
+
+	for {
+		var typeArgs []IExpression
+		if p.isTypeArgs(expr) {
+			typeArgs = p.typeArgs()
+		}
+		if !p.matchNT(LeftParen, LeftBracket, Dot, Question) {
+			break
+		}
+		paren := p.previous()
+
+		if paren.TokenType == Question {
+			expr = &Try{
+				Loc: Loc{
+					Line:   paren.Line,
+					Column: paren.Column,
+				},
+				Operand: expr,
+			}
+			continue
+		}
+
+		if paren.TokenType == LeftBracket {
+			index := p.expression()
+			p.consume(RightBracket, "Expect ']' after index.")
+			expr = &Index{
+				Loc: Loc{
+					Line:   paren.Line,
+					Column: paren.Column,
+				},
+				Object: expr,
+				Index:  index,
+			}
+			continue
+		}
 
-	return &FnCall{
-		Name: fnName,
-		Args: fnArgs,
-		Type: nil,
+		if paren.TokenType == Dot {
+			name := p.consume(Identifier, "Expect field name after '.'.")
+			if name == nil {
+				p.panicReason("Expected field name at line %d column %d\n", paren.Line, paren.Column)
+			}
+			expr = &Field{
+				Loc: Loc{
+					Line:   paren.Line,
+					Column: paren.Column,
+				},
+				Object: expr,
+				Name:   name,
+			}
+			continue
+		}
+
+		fnArgs := FnCallArgs{}
+		for !p.isEof() && p.peek().TokenType != RightParen {
+			fnArgs = append(fnArgs, p.fnCallArg())
+		}
+		p.consume(RightParen, "missing ) after fn args")
+
+		fnCall := &FnCall{
+			Loc: Loc{
+				Line:   paren.Line,
+				Column: paren.Column,
+			},
+			TypeArgs: typeArgs,
+			Args:     fnArgs,
+			Type:     nil,
+		}
+		if v, ok := expr.(*Variable); ok {
+			fnCall.Name = v.Name
+		} else {
+			fnCall.Callee = expr
+		}
+		expr = fnCall
 	}
+
+	return expr
 }
 
 func (p *Parser) fnCallArg() IExpression {
 	p.match(Comma)
+	if p.checkNT(Identifier) && p.checkNextNT(Colon) {
+		name := p.advance()
+		p.advance()
+		return &NamedArg{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name:  name,
+			Value: p.expression(),
+		}
+	}
 	return p.expression()
 }
 
 func (p *Parser) assignment() IExpression {
 	expr := p.or()
 
-	if p.matchNT(Equal) {
-		p.previous()
+	if p.matchNT(RightArrow) {
+		tk := p.previous()
+		return &Send{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Channel: expr,
+			Value:   p.assignment(),
+		}
+	}
+
+	if p.matchNT(Equal, PlusEqual, MinusEqual, StarEqual, SlashEqual, XorEqual, RemEqual, ShlEqual, ShrEqual, AmpersandEqual, PipeEqual) {
+		operator := p.previous()
 		value := p.assignment()
 
-		v, ok := expr.(*Variable)
-		if ok {
-			name := v.Name
-			return &Assign{
-				Name: name,
-				Expr: value,
-			}
+		assign := &Assign{
+			Loc: Loc{
+				Line:   operator.Line,
+				Column: operator.Column,
+			},
+			Operator: operator,
+			Expr:     value,
 		}
 
-		p.panicReason("Error at line %d column %d\n", v.Line, v.Column)
+		switch target := ungroup(expr).(type) {
+		case *Variable:
+			assign.Name = target.Name
+		case *Index, *Field, *Deref:
+			assign.Target = target
+		default:
+			p.panicReason("Invalid assignment target at line %d column %d\n", operator.Line, operator.Column)
+		}
+
+		return assign
 	}
 
 	return expr
@@ -192,12 +765,6 @@ func (p *Parser) assignment() IExpression {
 
 func (p *Parser) expression() IExpression {
 	// fmt.Println("curr ", p.Tokens[p.current].Type.String(), p.Tokens[p.current].Lexeme, p.peek().Type.String(), p.peek().Lexeme, p.peekNext().Type.String(), p.peekNext().Lexeme)
-	if p.peek().TokenType == Identifier && p.peekNext().TokenType == LeftParen {
-		return p.fnCall()
-	}
-	if p.peek().TokenType == Identifier && p.matchNextNT(Dec, Inc) {
-		return p.unaryLeft()
-	}
 	if p.peek().TokenType == Return {
 		return p.fnReturn()
 	}
@@ -260,7 +827,7 @@ func (p *Parser) comparison() IExpression {
 func (p *Parser) term() IExpression {
 	expr := p.factor()
 
-	for p.matchNT(Minus, Plus) {
+	for p.matchNT(Minus, Plus, Pipe, Xor) {
 		operator := p.previous()
 		right := p.factor()
 		expr = &Binary{
@@ -276,7 +843,7 @@ func (p *Parser) term() IExpression {
 func (p *Parser) factor() IExpression {
 	expr := p.unaryRight()
 
-	for p.matchNT(Slash, Star) {
+	for p.matchNT(Slash, Star, Rem, Shl, Shr, Ampersand) {
 		operator := p.previous()
 		right := p.unaryRight()
 		expr = &Binary{
@@ -290,7 +857,52 @@ func (p *Parser) factor() IExpression {
 }
 
 func (p *Parser) unaryRight() IExpression {
-	if p.matchNT(Bang, Minus, Inc, Dec) {
+	if p.matchNT(RightArrow) {
+		tk := p.previous()
+		return &Receive{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Channel: p.unaryRight(),
+		}
+	}
+
+	if p.matchNT(Inc, Dec) {
+		operator := p.previous()
+		return &PrefixIncDec{
+			Loc: Loc{
+				Line:   operator.Line,
+				Column: operator.Column,
+			},
+			Operator: operator,
+			Target:   p.incDecTarget(operator, p.unaryRight()),
+		}
+	}
+
+	if p.matchNT(Ampersand) {
+		tk := p.previous()
+		return &AddressOf{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Operand: p.unaryRight(),
+		}
+	}
+
+	if p.matchNT(Star) {
+		tk := p.previous()
+		return &Deref{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Operand: p.unaryRight(),
+		}
+	}
+
+	if p.matchNT(Bang, Minus) {
 		operator := p.previous()
 		right := p.unaryRight()
 		return &UnaryRight{
@@ -299,20 +911,47 @@ func (p *Parser) unaryRight() IExpression {
 		}
 	}
 
-	return p.primary()
+	return p.postfix()
 }
 
-func (p *Parser) unaryLeft() IExpression {
-	if p.matchNT(Inc, Dec) {
+func (p *Parser) postfix() IExpression {
+	expr := p.call()
+
+	for p.matchNT(Inc, Dec) {
 		operator := p.previous()
-		left := p.unaryLeft()
-		return &UnaryLeft{
+		expr = &PostfixIncDec{
+			Loc: Loc{
+				Line:   operator.Line,
+				Column: operator.Column,
+			},
 			Operator: operator,
-			Left:     left,
+			Target:   p.incDecTarget(operator, expr),
 		}
 	}
 
-	return p.primary()
+	return expr
+}
+
+func (p *Parser) incDecTarget(operator *Token, target IExpression) IExpression {
+	target = ungroup(target)
+	switch target.(type) {
+	case *Variable, *Index, *Field, *Deref:
+		return target
+	}
+
+	p.panicReason("Invalid %s target at line %d column %d\n", operator.TokenType, operator.Line, operator.Column)
+	return nil
+}
+
+// Returns the expression parentheses hold, for it to be assigned to
+func ungroup(expr IExpression) IExpression {
+	for {
+		g, ok := expr.(*Grouping)
+		if !ok {
+			return expr
+		}
+		expr = g.Grouped
+	}
 }
 
 func (p *Parser) primary() IExpression {
@@ -331,14 +970,57 @@ func (p *Parser) primary() IExpression {
 		}
 	}
 
+	if p.isLambda() {
+		return p.lambda()
+	}
+
 	if p.matchNT(LeftParen) {
+		tk := p.previous()
 		expr := p.expression()
+		if p.checkNT(Comma) {
+			elems := []IExpression{expr}
+			for p.matchNT(Comma) {
+				elems = append(elems, p.expression())
+			}
+			p.consume(RightParen, "Expect ')' after tuple elements.")
+			return &Tuple{
+				Loc: Loc{
+					Line:   tk.Line,
+					Column: tk.Column,
+				},
+				Elems: elems,
+			}
+		}
 		p.consume(RightParen, "")
 		return &Grouping{
 			Grouped: expr,
 		}
 	}
 
+	if p.matchNT(Match) {
+		return p.matchExpr()
+	}
+
+	if p.matchNT(If) {
+		return p.ifStatement()
+	}
+
+	if p.checkNT(Chan) {
+		chanType := p.typeAnnotation().(*ChanType)
+		p.consume(LeftParen, "Expect '(' after channel type.")
+		var size IExpression
+		if !p.checkNT(RightParen) {
+			size = p.expression()
+		}
+		p.consume(RightParen, "Expect ')' after channel size.")
+
+		return &MakeChan{
+			Loc:  chanType.Loc,
+			Type: chanType,
+			Size: size,
+		}
+	}
+
 	p.panicReason("Error on primary(): Line %d Column %d\nToken: %+v\nPrevious: %+v\nNext: %+v\n", p.peek().Line, p.peek().Column, p.peek(), p.previous(), p.peekNext())
 
 	return nil
@@ -366,6 +1048,7 @@ func (p *Parser) block() IStatement {
 }
 
 func (p *Parser) ifStatement() IStatement {
+	tk := p.previous()
 	p.consume(LeftParen, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(RightParen, "Expect ')' after if condition.")
@@ -373,39 +1056,425 @@ func (p *Parser) ifStatement() IStatement {
 	thenBranch := p.statement()
 	var elseBranch IStatement = nil
 	if p.matchNT(Else) {
-		elseBranch = p.statement()
+		if p.matchNT(If) {
+			elseBranch = p.ifStatement()
+		} else {
+			elseBranch = p.statement()
+		}
 	}
 
 	return &IfExpr{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
 		Condition:  condition,
 		ThenBranch: thenBranch,
 		ElseBranch: elseBranch,
 	}
 }
 
+func (p *Parser) matchExpr() IExpression {
+	tk := p.previous()
+	p.consume(LeftParen, "Expect '(' after 'match'.")
+	subject := p.expression()
+	p.consume(RightParen, "Expect ')' after match subject.")
+	p.consume(LeftBrace, "Expect '{' before match arms.")
+
+	arms := []*MatchArm{}
+	for !p.isEof() && !p.checkNT(RightBrace) {
+		arms = append(arms, p.matchArm())
+		p.matchNT(Comma)
+	}
+	p.consume(RightBrace, "Expect '}' after match arms.")
+
+	return &MatchExpr{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
+		Subject: subject,
+		Arms:    arms,
+	}
+}
+
+func (p *Parser) matchArm() *MatchArm {
+	variant := p.consume(Identifier, "Expect variant name in match arm.")
+	if variant == nil {
+		p.panicReason("Expected variant pattern at line %d column %d\n", p.peek().Line, p.peek().Column)
+	}
+
+	bindings := []*Token{}
+	if p.matchNT(LeftParen) {
+		for !p.isEof() && !p.checkNT(RightParen) {
+			bindings = append(bindings, p.consume(Identifier, "Expect binding name in pattern."))
+			if !p.matchNT(Comma) {
+				break
+			}
+		}
+		p.consume(RightParen, "Expect ')' after pattern bindings.")
+	}
+
+	p.consume(FuncArrow, "Expect '=>' after match pattern.")
+
+	var body IStatement
+	if p.matchNT(LeftBrace) {
+		body = p.block()
+	} else {
+		body = p.expression()
+	}
+
+	return &MatchArm{
+		Loc: Loc{
+			Line:   variant.Line,
+			Column: variant.Column,
+		},
+		Pattern: &VariantPattern{
+			Loc: Loc{
+				Line:   variant.Line,
+				Column: variant.Column,
+			},
+			Variant:  variant,
+			Bindings: bindings,
+		},
+		Body: body,
+	}
+}
+
 func (p *Parser) fnStatement() IStatement {
 	fnName := p.consume(Identifier, "Expect 'fn' name.")
+	typeParams := p.typeParams()
 	p.consume(LeftParen, "Expect '(' after 'fn' name.")
-	fnArgs := FnArgs{}
-	for p.peek().TokenType != RightParen {
-		fnArgs = append(fnArgs, p.varDeclaration())
-	}
-	p.consume(RightParen, "Expect ')' fn args.")
+	fnArgs := p.params("fn arg")
 
-	var fnType *Token
+	var fnType IExpression
 
 	if p.matchNT(Colon) {
-		fnType = p.consume(Identifier, "Expect identifier after : in fn decl")
+		fnType = p.typeAnnotation()
 	}
 
 	fnBody := p.statement()
 
 	return &FnDeclStmt{
-		Name: fnName,
-		Body: fnBody,
-		Type: fnType,
+		Loc: Loc{
+			Line:   fnName.Line,
+			Column: fnName.Column,
+		},
+		Name:       fnName,
+		TypeParams: typeParams,
+		Body:       fnBody,
+		Type:       fnType,
+		Args:       &fnArgs,
+	}
+}
+
+// Lambdas are told apart from groupings by their args, none or a name
+// followed by its type or by the next arg, and by what follows the closing
+// parenthesis: either the return type or the '=>'. A single arg without a
+// type must be followed by the '=>', `case (x):` being a grouping.
+func (p *Parser) isLambda() bool {
+	if !p.checkNT(LeftParen) {
+		return false
+	}
+	switch p.peekNext().TokenType {
+	case RightParen:
+	case Identifier:
+		switch p.Tokens[p.current+2].TokenType {
+		case Colon, Comma:
+		case RightParen:
+			return p.Tokens[p.current+3].TokenType == FuncArrow
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+
+	depth := 0
+	for i := p.current; i < uint64(len(p.Tokens)); i++ {
+		switch p.Tokens[i].TokenType {
+		case LeftParen:
+			depth++
+		case RightParen:
+			depth--
+			if depth == 0 {
+				next := p.Tokens[i+1].TokenType
+				return next == FuncArrow || next == Colon
+			}
+		case Eof:
+			return false
+		}
+	}
+
+	return false
+}
+
+func (p *Parser) lambda() IExpression {
+	tk := p.consume(LeftParen, "Expect '(' before lambda args.")
+	fnArgs := p.params("lambda arg")
+
+	var fnType IExpression
+	if p.matchNT(Colon) {
+		fnType = p.typeAnnotation()
+	}
+	p.consume(FuncArrow, "Expect '=>' before lambda body.")
+
+	var body IStatement
+	if p.matchNT(LeftBrace) {
+		body = p.block()
+	} else {
+		body = &FnReturn{
+			Value:    p.expression(),
+			Implicit: true,
+		}
+	}
+
+	return &Lambda{
+		Loc: Loc{
+			Line:   tk.Line,
+			Column: tk.Column,
+		},
 		Args: &fnArgs,
+		Type: fnType,
+		Body: body,
+	}
+}
+
+// Parses a type annotation such as `int` or `fn(int, int): int`, returning
+// nil when there's none
+func (p *Parser) typeAnnotation() IExpression {
+	if p.matchNT(Fn) {
+		tk := p.previous()
+		p.consume(LeftParen, "Expect '(' after 'fn' in type.")
+		params := []IExpression{}
+		for !p.isEof() && !p.checkNT(RightParen) {
+			params = append(params, p.typeAnnotation())
+			if !p.matchNT(Comma) {
+				break
+			}
+		}
+		p.consume(RightParen, "Expect ')' after fn type params.")
+
+		var ret IExpression
+		if p.matchNT(Colon) {
+			ret = p.typeAnnotation()
+		}
+
+		return &FnType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Params: params,
+			Return: ret,
+		}
+	}
+
+	if p.matchNT(Ellipsis) {
+		tk := p.previous()
+		return &VariadicType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Elem: p.typeAnnotation(),
+		}
+	}
+
+	if p.matchNT(LeftParen) {
+		tk := p.previous()
+		elems := []IExpression{}
+		for !p.isEof() && !p.checkNT(RightParen) {
+			elems = append(elems, p.typeAnnotation())
+			if !p.matchNT(Comma) {
+				break
+			}
+		}
+		p.consume(RightParen, "Expect ')' after tuple element types.")
+		if len(elems) < 2 {
+			p.panicReason("Expected at least two tuple element types at line %d column %d\n", tk.Line, tk.Column)
+		}
+
+		return &TupleType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Elems: elems,
+		}
+	}
+
+	if p.matchNT(Star) {
+		tk := p.previous()
+		return &PointerType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Elem: p.typeAnnotation(),
+		}
+	}
+
+	if p.matchNT(LeftBracket) {
+		tk := p.previous()
+		size := p.expression()
+		p.consume(RightBracket, "Expect ']' after array size.")
+
+		return &ArrayType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Size: size,
+			Elem: p.typeAnnotation(),
+		}
+	}
+
+	if p.matchNT(Chan) {
+		tk := p.previous()
+		p.consume(Lesser, "Expect '<' after 'chan'.")
+		elem := p.typeAnnotation()
+		p.closeAngle()
+
+		return &ChanType{
+			Loc: Loc{
+				Line:   tk.Line,
+				Column: tk.Column,
+			},
+			Elem: elem,
+		}
+	}
+
+	if p.checkNT(Identifier) {
+		name := p.advance()
+		typeName := &TypeName{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name: name,
+		}
+		if p.matchNT(Dot) {
+			typeName.Module = name
+			typeName.Name = p.consume(Identifier, "Expect type name after module name.")
+		}
+		if p.checkNT(Lesser) {
+			typeName.Args = p.typeArgs()
+		}
+		return typeName
+	}
+
+	return nil
+}
+
+// Parses the optional `<T, U: constraint>` type parameters of a generic fn
+// or type definition
+func (p *Parser) typeParams() []*TypeParam {
+	if !p.matchNT(Lesser) {
+		return nil
+	}
+
+	params := []*TypeParam{}
+	for !p.isEof() && !p.checkNT(Greater) && !p.checkNT(Shr) {
+		name := p.consume(Identifier, "Expect type parameter name.")
+		if name == nil {
+			p.panicReason("Expected type parameter name at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		param := &TypeParam{
+			Loc: Loc{
+				Line:   name.Line,
+				Column: name.Column,
+			},
+			Name: name,
+		}
+		if p.matchNT(Colon) {
+			param.Constraint = p.typeAnnotation()
+		}
+		params = append(params, param)
+
+		if !p.matchNT(Comma) {
+			break
+		}
+	}
+	p.closeAngle()
+
+	return params
+}
+
+// Parses a `<int, bool>` type argument list
+func (p *Parser) typeArgs() []IExpression {
+	p.consume(Lesser, "Expect '<' before type arguments.")
+	args := []IExpression{}
+	for !p.isEof() && !p.checkNT(Greater) && !p.checkNT(Shr) {
+		arg := p.typeAnnotation()
+		if arg == nil {
+			p.panicReason("Expected a type argument at line %d column %d\n", p.peek().Line, p.peek().Column)
+		}
+		args = append(args, arg)
+		if !p.matchNT(Comma) {
+			break
+		}
+	}
+	p.closeAngle()
+
+	return args
+}
+
+// Explicit type arguments of a call are told apart from a comparison by
+// looking for a balanced list of type tokens followed by the call's '('
+func (p *Parser) isTypeArgs(callee IExpression) bool {
+	switch callee.(type) {
+	case *Variable, *Field:
+	default:
+		return false
+	}
+	if !p.checkNT(Lesser) {
+		return false
+	}
+
+	depth, parens := 0, 0
+	for i := p.current; i < uint64(len(p.Tokens)); i++ {
+		switch p.Tokens[i].TokenType {
+		case Lesser:
+			depth++
+		case Greater:
+			depth--
+		case Shr:
+			depth -= 2
+		case LeftParen:
+			parens++
+		case RightParen:
+			parens--
+			if parens < 0 {
+				return false
+			}
+		case Identifier, Comma, Dot, Star, Colon, LeftBracket, RightBracket,
+			Number2, Number8, Number10, Number16, Fn, Chan:
+		default:
+			return false
+		}
+
+		if depth < 0 {
+			return false
+		}
+		if depth == 0 {
+			return parens == 0 && p.Tokens[i+1].TokenType == LeftParen
+		}
+	}
+
+	return false
+}
+
+// Consumes the '>' closing a type argument list. As the lexer emits '>>' as a
+// single shift token, nested lists close by splitting it in two.
+func (p *Parser) closeAngle() {
+	if p.checkNT(Shr) {
+		tk := p.peek()
+		tk.TokenType = Greater
+		tk.Lexeme = ">"
+		return
 	}
+	p.consume(Greater, "Expect '>' after type arguments.")
 }
 
 func (p *Parser) or() IExpression {
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	. "yal/lexer"
 )
 
@@ -21,6 +22,11 @@ type Loc struct {
 	Column uint64
 }
 
+// Returns the position of the node embedding the Loc
+func (l Loc) Pos() Loc {
+	return l
+}
+
 type Binary struct {
 	Loc
 	IExpression
@@ -53,17 +59,35 @@ func (b *UnaryRight) GetType() any {
 	return nil
 }
 
-type UnaryLeft struct {
+// PrefixIncDec increments or decrements Target by one, evaluating to the new
+// value
+type PrefixIncDec struct {
 	Loc
 	IExpression
 	Operator *Token
-	Left     IExpression
+	Target   IExpression
+}
+
+func (b *PrefixIncDec) exprNode() IExpression {
+	return nil
+}
+func (b *PrefixIncDec) GetType() any {
+	return nil
+}
+
+// PostfixIncDec increments or decrements Target by one, evaluating to the
+// value it held before
+type PostfixIncDec struct {
+	Loc
+	IExpression
+	Operator *Token
+	Target   IExpression
 }
 
-func (b *UnaryLeft) exprNode() IExpression {
+func (b *PostfixIncDec) exprNode() IExpression {
 	return nil
 }
-func (b *UnaryLeft) GetType() any {
+func (b *PostfixIncDec) GetType() any {
 	return nil
 }
 
@@ -80,10 +104,14 @@ func (b *Literal) GetType() any {
 	return nil
 }
 
+// Implicit is set for the trailing expression of a block, which is the value
+// of that block rather than a return from the enclosing fn when the block is
+// nested in an if or a match
 type FnReturn struct {
 	Loc
 	IStatement
-	Value IExpression
+	Value    IExpression
+	Implicit bool
 }
 
 func (b *FnReturn) stmtNode() {}
@@ -120,11 +148,16 @@ func (b *Variable) GetType() any {
 	return nil
 }
 
+// Name is set when assigning to a variable, Target otherwise. Operator is
+// either '=' or a compound assignment operator such as '+=', in which case
+// Target is evaluated only once.
 type Assign struct {
 	Loc
 	IExpression
-	Name *Token
-	Expr IExpression
+	Name     *Token
+	Target   IExpression
+	Operator *Token
+	Expr     IExpression
 }
 
 func (b *Assign) exprNode() IExpression {
@@ -134,6 +167,34 @@ func (b *Assign) GetType() any {
 	return nil
 }
 
+type Index struct {
+	Loc
+	IExpression
+	Object IExpression
+	Index  IExpression
+}
+
+func (b *Index) exprNode() IExpression {
+	return nil
+}
+func (b *Index) GetType() any {
+	return nil
+}
+
+type Field struct {
+	Loc
+	IExpression
+	Object IExpression
+	Name   *Token
+}
+
+func (b *Field) exprNode() IExpression {
+	return nil
+}
+func (b *Field) GetType() any {
+	return nil
+}
+
 type StatementExpression struct {
 	Loc
 	IExpression
@@ -153,7 +214,7 @@ type VarDeclExpression struct {
 	IExpression
 	Name        *Token
 	Initializer IExpression
-	Type        *Token
+	Type        IExpression
 }
 
 func (b *VarDeclExpression) stmtNode() {}
@@ -167,12 +228,64 @@ func (b *VarDeclExpression) GetType() any {
 type DefineTypeStatement struct {
 	Loc
 	IStatement
-	Name *Token
-	Type *Token
+	Name       *Token
+	TypeParams []*TypeParam
+	Type       IExpression
+	Enum       *EnumType
+	Interface  *InterfaceType
+	Public     bool
 }
 
 func (b *DefineTypeStatement) stmtNode() {}
 
+// Interface is set for an interface type definition, in which case Type and
+// Enum are nil
+type InterfaceType struct {
+	Loc
+	IExpression
+	Methods []*MethodSig
+}
+
+func (b *InterfaceType) exprNode() IExpression {
+	return nil
+}
+func (b *InterfaceType) GetType() any {
+	return nil
+}
+
+// Method declared by an interface, its first arg being the untyped `self`
+type MethodSig struct {
+	Loc
+	IExpression
+	Name *Token
+	Args *FnArgs
+	Type IExpression
+}
+
+func (b *MethodSig) exprNode() IExpression {
+	return nil
+}
+func (b *MethodSig) GetType() any {
+	return nil
+}
+
+type EnumType struct {
+	Loc
+	IStatement
+	Variants []*EnumVariant
+}
+
+func (b *EnumType) stmtNode() {}
+
+type EnumVariant struct {
+	Loc
+	IStatement
+	Name   *Token
+	Fields FnArgs
+}
+
+func (b *EnumVariant) stmtNode() {}
+
 type Block struct {
 	Loc
 	IStatement
@@ -206,10 +319,12 @@ func (b *IfExpr) GetType() any {
 type FnDeclStmt struct {
 	Loc
 	IStatement
-	Name *Token
-	Type *Token
-	Args *FnArgs
-	Body IStatement
+	Name       *Token
+	TypeParams []*TypeParam
+	Type       IExpression
+	Args       *FnArgs
+	Body       IStatement
+	Public     bool
 }
 
 func (b *FnDeclStmt) stmtNode() {}
@@ -220,12 +335,49 @@ func (b *FnArgs) stmtNode() {}
 
 type FnCallArgs []IExpression
 
+// Argument passed by the name of the param it is for, as in `f(b: 2)`
+type NamedArg struct {
+	Loc
+	IExpression
+	Name  *Token
+	Value IExpression
+}
+
+func (b *NamedArg) exprNode() IExpression {
+	return nil
+}
+func (b *NamedArg) GetType() any {
+	return nil
+}
+
+// Type of a variadic param collecting the remaining arguments of a call,
+// only allowed for the last param of an fn
+type VariadicType struct {
+	Loc
+	IExpression
+	Elem IExpression
+}
+
+func (b *VariadicType) exprNode() IExpression {
+	return nil
+}
+func (b *VariadicType) GetType() any {
+	return nil
+}
+
+// Callee is only set when the called value is not a plain identifier,
+// otherwise Name holds it. TypeArgs are the explicit type arguments of a
+// generic fn call, and Instance the ones it is instantiated with once
+// inferred by the checker.
 type FnCall struct {
 	Loc
 	IExpression
-	Name *Token
-	Args FnCallArgs
-	Type *Token
+	Name     *Token
+	Callee   IExpression
+	TypeArgs []IExpression
+	Instance []string
+	Args     FnCallArgs
+	Type     *Token
 }
 
 func (b *FnCall) exprNode() IExpression {
@@ -269,3 +421,377 @@ type ForLoop struct {
 }
 
 func (b *ForLoop) stmtNode() {}
+
+type MatchExpr struct {
+	Loc
+	IExpression
+	Subject IExpression
+	Arms    []*MatchArm
+}
+
+func (b *MatchExpr) exprNode() IExpression {
+	return nil
+}
+func (b *MatchExpr) GetType() any {
+	return nil
+}
+
+type MatchArm struct {
+	Loc
+	IExpression
+	Pattern *VariantPattern
+	Body    IStatement
+}
+
+func (b *MatchArm) exprNode() IExpression {
+	return nil
+}
+func (b *MatchArm) GetType() any {
+	return nil
+}
+
+// A Variant of "_" with no Bindings is the wildcard pattern
+type VariantPattern struct {
+	Loc
+	IExpression
+	Variant  *Token
+	Bindings []*Token
+}
+
+func (b *VariantPattern) exprNode() IExpression {
+	return nil
+}
+func (b *VariantPattern) GetType() any {
+	return nil
+}
+
+// Captures lists the enclosing fn variables referenced by the Body, filled
+// in by the checker. Those variables must outlive the frame declaring them.
+type Lambda struct {
+	Loc
+	IExpression
+	Args     *FnArgs
+	Type     IExpression
+	Body     IStatement
+	Captures []*Token
+}
+
+func (b *Lambda) exprNode() IExpression {
+	return nil
+}
+func (b *Lambda) GetType() any {
+	return nil
+}
+
+// Module is set for a type exported by an imported module, as in `mod.Type`
+type TypeName struct {
+	Loc
+	IExpression
+	Module *Token
+	Name   *Token
+	Args   []IExpression
+}
+
+func (b *TypeName) exprNode() IExpression {
+	return nil
+}
+func (b *TypeName) GetType() any {
+	return nil
+}
+
+type FnType struct {
+	Loc
+	IExpression
+	Params []IExpression
+	Return IExpression
+}
+
+func (b *FnType) exprNode() IExpression {
+	return nil
+}
+func (b *FnType) GetType() any {
+	return nil
+}
+
+type BreakStmt struct {
+	Loc
+	IStatement
+}
+
+func (b *BreakStmt) stmtNode() {}
+
+type ContinueStmt struct {
+	Loc
+	IStatement
+}
+
+func (b *ContinueStmt) stmtNode() {}
+
+type GotoStmt struct {
+	Loc
+	IStatement
+	Label *Token
+}
+
+func (b *GotoStmt) stmtNode() {}
+
+// Target of the gotos naming it within the same fn, written `name:`
+type LabelStmt struct {
+	Loc
+	IStatement
+	Name *Token
+}
+
+func (b *LabelStmt) stmtNode() {}
+
+// Expr is evaluated when the enclosing fn exits, after the ones deferred
+// later
+type DeferStmt struct {
+	Loc
+	IStatement
+	Expr IExpression
+}
+
+func (b *DeferStmt) stmtNode() {}
+
+type SpawnStmt struct {
+	Loc
+	IStatement
+	Call *FnCall
+}
+
+func (b *SpawnStmt) stmtNode() {}
+
+type ChanType struct {
+	Loc
+	IExpression
+	Elem IExpression
+}
+
+func (b *ChanType) exprNode() IExpression {
+	return nil
+}
+func (b *ChanType) GetType() any {
+	return nil
+}
+
+// MakeChan creates a channel, unbuffered when Size is nil
+type MakeChan struct {
+	Loc
+	IExpression
+	Type *ChanType
+	Size IExpression
+}
+
+func (b *MakeChan) exprNode() IExpression {
+	return nil
+}
+func (b *MakeChan) GetType() any {
+	return nil
+}
+
+type Send struct {
+	Loc
+	IExpression
+	Channel IExpression
+	Value   IExpression
+}
+
+func (b *Send) exprNode() IExpression {
+	return nil
+}
+func (b *Send) GetType() any {
+	return nil
+}
+
+type Receive struct {
+	Loc
+	IExpression
+	Channel IExpression
+}
+
+func (b *Receive) exprNode() IExpression {
+	return nil
+}
+func (b *Receive) GetType() any {
+	return nil
+}
+
+type ImportStmt struct {
+	Loc
+	IStatement
+	Path *Token
+}
+
+func (b *ImportStmt) stmtNode() {}
+
+// Returns the name the imported module is bound to, the last element of its
+// path
+func (b *ImportStmt) ModuleName() string {
+	path := b.Path.Lexeme
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+type ConstDeclStmt struct {
+	Loc
+	IStatement
+	Name  *Token
+	Type  IExpression
+	Value IExpression
+}
+
+func (b *ConstDeclStmt) stmtNode() {}
+
+// Size must be a constant expression
+type ArrayType struct {
+	Loc
+	IExpression
+	Size IExpression
+	Elem IExpression
+}
+
+func (b *ArrayType) exprNode() IExpression {
+	return nil
+}
+func (b *ArrayType) GetType() any {
+	return nil
+}
+
+// Default is nil when the switch has no default case
+type SwitchStmt struct {
+	Loc
+	IStatement
+	Subject IExpression
+	Cases   []*SwitchCase
+	Default IStatement
+}
+
+func (b *SwitchStmt) stmtNode() {}
+
+// Values must be constant expressions
+type SwitchCase struct {
+	Loc
+	IStatement
+	Values []IExpression
+	Body   IStatement
+}
+
+func (b *SwitchCase) stmtNode() {}
+
+type AddressOf struct {
+	Loc
+	IExpression
+	Operand IExpression
+}
+
+func (b *AddressOf) exprNode() IExpression {
+	return nil
+}
+func (b *AddressOf) GetType() any {
+	return nil
+}
+
+// Dereferencing a NULL pointer is a runtime error reported at Loc
+type Deref struct {
+	Loc
+	IExpression
+	Operand IExpression
+}
+
+func (b *Deref) exprNode() IExpression {
+	return nil
+}
+func (b *Deref) GetType() any {
+	return nil
+}
+
+type PointerType struct {
+	Loc
+	IExpression
+	Elem IExpression
+}
+
+func (b *PointerType) exprNode() IExpression {
+	return nil
+}
+func (b *PointerType) GetType() any {
+	return nil
+}
+
+// Constraint is nil for a type parameter accepting any type
+type TypeParam struct {
+	Loc
+	IExpression
+	Name       *Token
+	Constraint IExpression
+}
+
+func (b *TypeParam) exprNode() IExpression {
+	return nil
+}
+func (b *TypeParam) GetType() any {
+	return nil
+}
+
+// Methods of Type, whose `self` arg gets Type as its type annotation
+type ImplStmt struct {
+	Loc
+	IStatement
+	Type    *Token
+	Methods []*FnDeclStmt
+}
+
+func (b *ImplStmt) stmtNode() {}
+
+// Tuple of two or more values, as built by `(a, b)` or `return a, b;`
+type Tuple struct {
+	Loc
+	IExpression
+	Elems []IExpression
+}
+
+func (b *Tuple) exprNode() IExpression {
+	return nil
+}
+func (b *Tuple) GetType() any {
+	return nil
+}
+
+type TupleType struct {
+	Loc
+	IExpression
+	Elems []IExpression
+}
+
+func (b *TupleType) exprNode() IExpression {
+	return nil
+}
+func (b *TupleType) GetType() any {
+	return nil
+}
+
+// TupleDecl destructures the tuple Initializer evaluates to, as in
+// `let (q, r) = divmod(7, 2);`. Elements bound to "_" are discarded.
+type TupleDecl struct {
+	Loc
+	IStatement
+	Names       []*Token
+	Initializer IExpression
+}
+
+func (b *TupleDecl) stmtNode() {}
+
+// Try evaluates to the value held by the Ok variant of the Result Operand
+// evaluates to, returning the Err variant from the enclosing fn otherwise
+type Try struct {
+	Loc
+	IExpression
+	Operand IExpression
+}
+
+func (b *Try) exprNode() IExpression {
+	return nil
+}
+func (b *Try) GetType() any {
+	return nil
+}
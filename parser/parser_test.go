@@ -1,3 +1,618 @@
-package parser
+package parser_test
 
-// TODO: write actual tests
+import (
+	"context"
+	"testing"
+	"yal/lexer"
+	"yal/parser"
+)
+
+func parse(t *testing.T, src string) []parser.IStatement {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parser.NewParser(ctx, tokens).Run()
+}
+
+// Returns the initializer of the single let statement in src
+func initializer(t *testing.T, src string) parser.IExpression {
+	tree := parse(t, src)
+	if len(tree) != 1 {
+		t.Fatalf("expected 1 statement, got %d: %+v\n", len(tree), tree)
+	}
+
+	decl, ok := tree[0].(*parser.VarDeclExpression)
+	if !ok {
+		t.Fatalf("expected *parser.VarDeclExpression, got %T\n", tree[0])
+	}
+
+	return decl.Initializer
+}
+
+func TestLambda(t *testing.T) {
+	t.Run("Test expression bodied lambda", func(t *testing.T) {
+		expr := initializer(t, `let add = (a: int, b: int) : int => a + b;`)
+
+		lambda, ok := expr.(*parser.Lambda)
+		if !ok {
+			t.Fatalf("expected *parser.Lambda, got %T\n", expr)
+		}
+		if len(*lambda.Args) != 2 {
+			t.Errorf("expected 2 args, got %d\n", len(*lambda.Args))
+		}
+		if ret, ok := lambda.Type.(*parser.TypeName); !ok || ret.Name.Lexeme != "int" {
+			t.Errorf("expected int return type, got %+v\n", lambda.Type)
+		}
+		ret, ok := lambda.Body.(*parser.FnReturn)
+		if !ok {
+			t.Fatalf("expected *parser.FnReturn body, got %T\n", lambda.Body)
+		}
+		if _, ok := ret.Value.(*parser.Binary); !ok {
+			t.Errorf("expected *parser.Binary return value, got %T\n", ret.Value)
+		}
+	})
+
+	t.Run("Test block bodied lambda", func(t *testing.T) {
+		expr := initializer(t, `let f = () => { let a = 1; a };`)
+
+		lambda, ok := expr.(*parser.Lambda)
+		if !ok {
+			t.Fatalf("expected *parser.Lambda, got %T\n", expr)
+		}
+		if _, ok := lambda.Body.(*parser.Block); !ok {
+			t.Errorf("expected *parser.Block body, got %T\n", lambda.Body)
+		}
+	})
+
+	t.Run("Test grouping is not a lambda", func(t *testing.T) {
+		expr := initializer(t, `let a = (1 + 2) * 3;`)
+
+		if _, ok := expr.(*parser.Binary); !ok {
+			t.Errorf("expected *parser.Binary, got %T\n", expr)
+		}
+	})
+
+	t.Run("Test untyped arg", func(t *testing.T) {
+		expr := initializer(t, `let f = (x) => x;`)
+
+		if lambda, ok := expr.(*parser.Lambda); !ok || len(*lambda.Args) != 1 {
+			t.Errorf("expected a lambda taking 1 arg, got %+v\n", expr)
+		}
+	})
+
+	t.Run("Test invalid args", func(t *testing.T) {
+		for _, src := range []string{`let f = (1) => 2;`, `let f = (a: int, 1) => 2;`, `fn f(1) : void {}`} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("expected %s to be rejected\n", src)
+					}
+				}()
+				parse(t, src)
+			}()
+		}
+	})
+}
+
+func TestFnType(t *testing.T) {
+	tree := parse(t, `let f: fn(int, int): int = add;`)
+
+	decl := tree[0].(*parser.VarDeclExpression)
+	fnType, ok := decl.Type.(*parser.FnType)
+	if !ok {
+		t.Fatalf("expected *parser.FnType, got %T\n", decl.Type)
+	}
+	if len(fnType.Params) != 2 {
+		t.Errorf("expected 2 params, got %d\n", len(fnType.Params))
+	}
+	if ret, ok := fnType.Return.(*parser.TypeName); !ok || ret.Name.Lexeme != "int" {
+		t.Errorf("expected int return type, got %+v\n", fnType.Return)
+	}
+}
+
+func TestFnCall(t *testing.T) {
+	t.Run("Test call inside binary expression", func(t *testing.T) {
+		expr := initializer(t, `let a = f(1) + 2;`)
+
+		bin, ok := expr.(*parser.Binary)
+		if !ok {
+			t.Fatalf("expected *parser.Binary, got %T\n", expr)
+		}
+		call, ok := bin.Left.(*parser.FnCall)
+		if !ok || call.Name.Lexeme != "f" {
+			t.Errorf("expected call to f, got %+v\n", bin.Left)
+		}
+	})
+
+	t.Run("Test calling a returned fn", func(t *testing.T) {
+		expr := initializer(t, `let a = adder(1)(2);`)
+
+		call, ok := expr.(*parser.FnCall)
+		if !ok {
+			t.Fatalf("expected *parser.FnCall, got %T\n", expr)
+		}
+		if call.Name != nil {
+			t.Errorf("expected no name, got %+v\n", call.Name)
+		}
+		if inner, ok := call.Callee.(*parser.FnCall); !ok || inner.Name.Lexeme != "adder" {
+			t.Errorf("expected callee to be a call to adder, got %+v\n", call.Callee)
+		}
+	})
+
+	t.Run("Test lambda as argument", func(t *testing.T) {
+		expr := initializer(t, `let a = apply((x: int) : int => x * 2, 5);`)
+
+		call := expr.(*parser.FnCall)
+		if len(call.Args) != 2 {
+			t.Fatalf("expected 2 args, got %d\n", len(call.Args))
+		}
+		if _, ok := call.Args[0].(*parser.Lambda); !ok {
+			t.Errorf("expected *parser.Lambda argument, got %T\n", call.Args[0])
+		}
+	})
+}
+
+func TestChannels(t *testing.T) {
+	t.Run("Test nested channel type", func(t *testing.T) {
+		expr := initializer(t, `let ch = chan<chan<int>>(4);`)
+
+		mk, ok := expr.(*parser.MakeChan)
+		if !ok {
+			t.Fatalf("expected *parser.MakeChan, got %T\n", expr)
+		}
+		inner, ok := mk.Type.Elem.(*parser.ChanType)
+		if !ok {
+			t.Fatalf("expected *parser.ChanType element, got %T\n", mk.Type.Elem)
+		}
+		if elem, ok := inner.Elem.(*parser.TypeName); !ok || elem.Name.Lexeme != "int" {
+			t.Errorf("expected int element, got %+v\n", inner.Elem)
+		}
+		if mk.Size == nil {
+			t.Errorf("expected a buffer size\n")
+		}
+	})
+
+	t.Run("Test spawn, send and receive", func(t *testing.T) {
+		tree := parse(t, `
+fn main() : void {
+  let ch = chan<int>();
+  spawn worker(ch, 1);
+  ch <- 2 + 3;
+  let v = <- ch;
+}`)
+		body := tree[0].(*parser.FnDeclStmt).Body.(*parser.Block)
+
+		spawn, ok := body.Statements[1].(*parser.SpawnStmt)
+		if !ok || spawn.Call.Name.Lexeme != "worker" {
+			t.Errorf("expected spawn of worker, got %+v\n", body.Statements[1])
+		}
+
+		stmt := body.Statements[2].(*parser.StatementExpression)
+		send, ok := stmt.Expr.(*parser.Send)
+		if !ok {
+			t.Fatalf("expected *parser.Send, got %T\n", stmt.Expr)
+		}
+		if _, ok := send.Value.(*parser.Binary); !ok {
+			t.Errorf("expected *parser.Binary sent value, got %T\n", send.Value)
+		}
+
+		decl := body.Statements[3].(*parser.VarDeclExpression)
+		if _, ok := decl.Initializer.(*parser.Receive); !ok {
+			t.Errorf("expected *parser.Receive, got %T\n", decl.Initializer)
+		}
+	})
+}
+
+func TestIfExpression(t *testing.T) {
+	expr := initializer(t, `let a = 1 + if (b) { 2 } else if (c) { 3 } else { 4 };`)
+
+	bin, ok := expr.(*parser.Binary)
+	if !ok {
+		t.Fatalf("expected *parser.Binary, got %T\n", expr)
+	}
+	ifExpr, ok := bin.Right.(*parser.IfExpr)
+	if !ok {
+		t.Fatalf("expected *parser.IfExpr, got %T\n", bin.Right)
+	}
+
+	then := ifExpr.ThenBranch.(*parser.Block)
+	if ret, ok := then.Statements[0].(*parser.FnReturn); !ok || !ret.Implicit {
+		t.Errorf("expected implicit block value, got %+v\n", then.Statements[0])
+	}
+	if _, ok := ifExpr.ElseBranch.(*parser.IfExpr); !ok {
+		t.Errorf("expected else if, got %T\n", ifExpr.ElseBranch)
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tree := parse(t, `
+x += 1;
+a[i] <<= 2;
+p.count %= 3 + 4;
+`)
+	if len(tree) != 3 {
+		t.Fatalf("expected 3 statements, got %d\n", len(tree))
+	}
+
+	assigns := []*parser.Assign{}
+	for _, stmt := range tree {
+		assign, ok := stmt.(*parser.StatementExpression).Expr.(*parser.Assign)
+		if !ok {
+			t.Fatalf("expected *parser.Assign, got %T\n", stmt.(*parser.StatementExpression).Expr)
+		}
+		assigns = append(assigns, assign)
+	}
+
+	if assigns[0].Name.Lexeme != "x" || assigns[0].Operator.TokenType != lexer.PlusEqual {
+		t.Errorf("expected x += ..., got %+v\n", assigns[0])
+	}
+	if _, ok := assigns[1].Target.(*parser.Index); !ok || assigns[1].Operator.TokenType != lexer.ShlEqual {
+		t.Errorf("expected index <<= ..., got %+v\n", assigns[1])
+	}
+	field, ok := assigns[2].Target.(*parser.Field)
+	if !ok || field.Name.Lexeme != "count" || assigns[2].Operator.TokenType != lexer.RemEqual {
+		t.Errorf("expected field %%= ..., got %+v\n", assigns[2])
+	}
+	if _, ok := assigns[2].Expr.(*parser.Binary); !ok {
+		t.Errorf("expected *parser.Binary value, got %T\n", assigns[2].Expr)
+	}
+}
+
+func TestIncDec(t *testing.T) {
+	t.Run("Test prefix and postfix", func(t *testing.T) {
+		expr := initializer(t, `let a = -x++ + --a[0];`)
+
+		bin := expr.(*parser.Binary)
+		neg, ok := bin.Left.(*parser.UnaryRight)
+		if !ok {
+			t.Fatalf("expected *parser.UnaryRight, got %T\n", bin.Left)
+		}
+		post, ok := neg.Right.(*parser.PostfixIncDec)
+		if !ok || post.Operator.TokenType != lexer.Inc {
+			t.Fatalf("expected postfix ++, got %+v\n", neg.Right)
+		}
+		if _, ok := post.Target.(*parser.Variable); !ok {
+			t.Errorf("expected *parser.Variable target, got %T\n", post.Target)
+		}
+
+		pre, ok := bin.Right.(*parser.PrefixIncDec)
+		if !ok || pre.Operator.TokenType != lexer.Dec {
+			t.Fatalf("expected prefix --, got %+v\n", bin.Right)
+		}
+		if _, ok := pre.Target.(*parser.Index); !ok {
+			t.Errorf("expected *parser.Index target, got %T\n", pre.Target)
+		}
+	})
+
+	t.Run("Test statement", func(t *testing.T) {
+		tree := parse(t, `x--;`)
+
+		stmt := tree[0].(*parser.StatementExpression)
+		if _, ok := stmt.Expr.(*parser.PostfixIncDec); !ok {
+			t.Errorf("expected *parser.PostfixIncDec, got %T\n", stmt.Expr)
+		}
+	})
+
+	t.Run("Test non assignable target", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected --1 to be rejected\n")
+			}
+		}()
+		parse(t, `let a = --1;`)
+	})
+
+	t.Run("Test parenthesized targets", func(t *testing.T) {
+		tree := parse(t, `(*p)++; (x) = 1; ((x))--;`)
+
+		post := tree[0].(*parser.StatementExpression).Expr.(*parser.PostfixIncDec)
+		if _, ok := post.Target.(*parser.Deref); !ok {
+			t.Errorf("expected *parser.Deref target, got %T\n", post.Target)
+		}
+		assign := tree[1].(*parser.StatementExpression).Expr.(*parser.Assign)
+		if assign.Name == nil || assign.Name.Lexeme != "x" {
+			t.Errorf("expected an assignment to x, got %+v\n", assign)
+		}
+		dec := tree[2].(*parser.StatementExpression).Expr.(*parser.PostfixIncDec)
+		if _, ok := dec.Target.(*parser.Variable); !ok {
+			t.Errorf("expected *parser.Variable target, got %T\n", dec.Target)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	tree := parse(t, `
+import "lib/geo";
+pub fn area(s: geo.Shape) : int { 0 }
+pub definetype Id = int;
+fn hidden() : void {}
+`)
+
+	imp, ok := tree[0].(*parser.ImportStmt)
+	if !ok || imp.Path.Lexeme != "lib/geo" || imp.ModuleName() != "geo" {
+		t.Errorf("expected import of lib/geo, got %+v\n", tree[0])
+	}
+
+	fn := tree[1].(*parser.FnDeclStmt)
+	if !fn.Public {
+		t.Errorf("expected area to be public\n")
+	}
+	arg := (*fn.Args)[0].(*parser.VarDeclExpression).Type.(*parser.TypeName)
+	if arg.Module == nil || arg.Module.Lexeme != "geo" || arg.Name.Lexeme != "Shape" {
+		t.Errorf("expected geo.Shape, got %+v\n", arg)
+	}
+
+	if dt := tree[2].(*parser.DefineTypeStatement); !dt.Public {
+		t.Errorf("expected Id to be public\n")
+	}
+	if fn := tree[3].(*parser.FnDeclStmt); fn.Public {
+		t.Errorf("expected hidden to be private\n")
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tree := parse(t, `
+const N: int = 4;
+switch (x) {
+  case 1, N:
+    let a = 1;
+    a += 1;
+  default:
+    print("none");
+}`)
+
+	if c, ok := tree[0].(*parser.ConstDeclStmt); !ok || c.Name.Lexeme != "N" {
+		t.Errorf("expected constant N, got %+v\n", tree[0])
+	}
+
+	sw, ok := tree[1].(*parser.SwitchStmt)
+	if !ok {
+		t.Fatalf("expected *parser.SwitchStmt, got %T\n", tree[1])
+	}
+	if len(sw.Cases) != 1 || len(sw.Cases[0].Values) != 2 {
+		t.Fatalf("expected 1 case with 2 values, got %+v\n", sw.Cases)
+	}
+	if body := sw.Cases[0].Body.(*parser.Block); len(body.Statements) != 2 {
+		t.Errorf("expected 2 statements in case, got %d\n", len(body.Statements))
+	}
+	if sw.Default == nil {
+		t.Errorf("expected a default case\n")
+	}
+
+	t.Run("Test parenthesized case labels", func(t *testing.T) {
+		tree := parse(t, `switch (op) { case (1): print(1); case (N), 2: print(2); }`)
+
+		sw := tree[0].(*parser.SwitchStmt)
+		if len(sw.Cases) != 2 || len(sw.Cases[1].Values) != 2 {
+			t.Fatalf("expected 2 cases, the second one with 2 values, got %+v\n", sw.Cases)
+		}
+		if _, ok := sw.Cases[0].Values[0].(*parser.Grouping); !ok {
+			t.Errorf("expected *parser.Grouping case value, got %T\n", sw.Cases[0].Values[0])
+		}
+	})
+}
+
+func TestPointers(t *testing.T) {
+	tree := parse(t, `
+let p: **int = NULL;
+*p = &x;
+let y = a * *q;`)
+
+	decl := tree[0].(*parser.VarDeclExpression)
+	ptr, ok := decl.Type.(*parser.PointerType)
+	if !ok {
+		t.Fatalf("expected *parser.PointerType, got %T\n", decl.Type)
+	}
+	if _, ok := ptr.Elem.(*parser.PointerType); !ok {
+		t.Errorf("expected pointer to pointer, got %T\n", ptr.Elem)
+	}
+
+	assign := tree[1].(*parser.StatementExpression).Expr.(*parser.Assign)
+	if _, ok := assign.Target.(*parser.Deref); !ok {
+		t.Errorf("expected *parser.Deref target, got %T\n", assign.Target)
+	}
+	if _, ok := assign.Expr.(*parser.AddressOf); !ok {
+		t.Errorf("expected *parser.AddressOf, got %T\n", assign.Expr)
+	}
+
+	bin := tree[2].(*parser.VarDeclExpression).Initializer.(*parser.Binary)
+	if d, ok := bin.Right.(*parser.Deref); !ok || d.Line != 4 {
+		t.Errorf("expected *parser.Deref on line 4, got %+v\n", bin.Right)
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	tree := parse(t, `
+definetype Option<T> = enum { Some(v: T), None };
+fn max<T: ordered>(a: T, b: T) : T { if (a > b) { a } else { b } }
+let m = max<Option<int>>(x, y);
+let lt = a < b;`)
+
+	dt := tree[0].(*parser.DefineTypeStatement)
+	if len(dt.TypeParams) != 1 || dt.TypeParams[0].Name.Lexeme != "T" {
+		t.Errorf("expected type parameter T, got %+v\n", dt.TypeParams)
+	}
+
+	fn := tree[1].(*parser.FnDeclStmt)
+	if len(fn.TypeParams) != 1 || fn.TypeParams[0].Constraint.(*parser.TypeName).Name.Lexeme != "ordered" {
+		t.Errorf("expected type parameter T: ordered, got %+v\n", fn.TypeParams)
+	}
+
+	call, ok := tree[2].(*parser.VarDeclExpression).Initializer.(*parser.FnCall)
+	if !ok {
+		t.Fatalf("expected *parser.FnCall, got %T\n", tree[2].(*parser.VarDeclExpression).Initializer)
+	}
+	if len(call.TypeArgs) != 1 {
+		t.Fatalf("expected 1 type argument, got %d\n", len(call.TypeArgs))
+	}
+	if arg := call.TypeArgs[0].(*parser.TypeName); arg.Name.Lexeme != "Option" || len(arg.Args) != 1 {
+		t.Errorf("expected Option<int>, got %+v\n", arg)
+	}
+
+	if _, ok := tree[3].(*parser.VarDeclExpression).Initializer.(*parser.Binary); !ok {
+		t.Errorf("expected a comparison, got %T\n", tree[3].(*parser.VarDeclExpression).Initializer)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tree := parse(t, `
+definetype Shape = interface { fn area(self) : int; fn scale(self, k: int) : Shape; };
+impl Square {
+  pub fn area(self) : int { self * self }
+}
+let a = sq.area();`)
+
+	dt := tree[0].(*parser.DefineTypeStatement)
+	if dt.Interface == nil || len(dt.Interface.Methods) != 2 {
+		t.Fatalf("expected an interface with 2 methods, got %+v\n", dt)
+	}
+	if args := *dt.Interface.Methods[1].Args; len(args) != 2 {
+		t.Errorf("expected 2 args for scale, got %d\n", len(args))
+	}
+
+	impl, ok := tree[1].(*parser.ImplStmt)
+	if !ok {
+		t.Fatalf("expected *parser.ImplStmt, got %T\n", tree[1])
+	}
+	area := impl.Methods[0]
+	if !area.Public {
+		t.Errorf("expected area to be public\n")
+	}
+	self := (*area.Args)[0].(*parser.VarDeclExpression)
+	if typ, ok := self.Type.(*parser.TypeName); !ok || typ.Name.Lexeme != "Square" {
+		t.Errorf("expected self to be typed Square, got %+v\n", self.Type)
+	}
+
+	call := tree[2].(*parser.VarDeclExpression).Initializer.(*parser.FnCall)
+	if field, ok := call.Callee.(*parser.Field); !ok || field.Name.Lexeme != "area" {
+		t.Errorf("expected a call to the area method, got %+v\n", call.Callee)
+	}
+}
+
+func TestTuples(t *testing.T) {
+	tree := parse(t, `
+fn divmod(a: int, b: int) : (int, int) {
+  return a / b, a % b;
+}
+let (q, _) = divmod(7, 2);
+let pair = (1, true);`)
+
+	fn := tree[0].(*parser.FnDeclStmt)
+	if tt, ok := fn.Type.(*parser.TupleType); !ok || len(tt.Elems) != 2 {
+		t.Errorf("expected a tuple return type, got %+v\n", fn.Type)
+	}
+	ret := fn.Body.(*parser.Block).Statements[0].(*parser.StatementExpression).Expr.(*parser.FnReturn)
+	if tuple, ok := ret.Value.(*parser.Tuple); !ok || len(tuple.Elems) != 2 {
+		t.Errorf("expected 2 returned values, got %+v\n", ret.Value)
+	}
+
+	decl, ok := tree[1].(*parser.TupleDecl)
+	if !ok {
+		t.Fatalf("expected *parser.TupleDecl, got %T\n", tree[1])
+	}
+	if len(decl.Names) != 2 || decl.Names[1].Lexeme != "_" {
+		t.Errorf("expected names q and _, got %+v\n", decl.Names)
+	}
+
+	if _, ok := tree[2].(*parser.VarDeclExpression).Initializer.(*parser.Tuple); !ok {
+		t.Errorf("expected *parser.Tuple, got %T\n", tree[2].(*parser.VarDeclExpression).Initializer)
+	}
+}
+
+func TestTry(t *testing.T) {
+	tree := parse(t, `let n = parse(s)?.abs();`)
+
+	call := tree[0].(*parser.VarDeclExpression).Initializer.(*parser.FnCall)
+	field, ok := call.Callee.(*parser.Field)
+	if !ok {
+		t.Fatalf("expected a method call, got %+v\n", call.Callee)
+	}
+	try, ok := field.Object.(*parser.Try)
+	if !ok {
+		t.Fatalf("expected *parser.Try, got %T\n", field.Object)
+	}
+	if _, ok := try.Operand.(*parser.FnCall); !ok || try.Column != 17 {
+		t.Errorf("expected ? applied to a call at column 17, got %+v\n", try)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tree := parse(t, `
+fn run() : void {
+  defer close(f);
+  defer n--;
+}`)
+
+	body := tree[0].(*parser.FnDeclStmt).Body.(*parser.Block)
+	if len(body.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d\n", len(body.Statements))
+	}
+	d, ok := body.Statements[0].(*parser.DeferStmt)
+	if !ok {
+		t.Fatalf("expected *parser.DeferStmt, got %T\n", body.Statements[0])
+	}
+	if _, ok := d.Expr.(*parser.FnCall); !ok || d.Line != 3 {
+		t.Errorf("expected a deferred call on line 3, got %+v\n", d)
+	}
+	if _, ok := body.Statements[1].(*parser.DeferStmt).Expr.(*parser.PostfixIncDec); !ok {
+		t.Errorf("expected a deferred decrement, got %+v\n", body.Statements[1])
+	}
+}
+
+func TestFnArgs(t *testing.T) {
+	tree := parse(t, `
+fn log(level: int = 1, prefix: string = "", parts: ...string) : void {}
+log(prefix: "yal", level: 2);`)
+
+	args := *tree[0].(*parser.FnDeclStmt).Args
+	if len(args) != 3 {
+		t.Fatalf("expected 3 params, got %d\n", len(args))
+	}
+	if lit, ok := args[0].(*parser.VarDeclExpression).Initializer.(*parser.Literal); !ok || lit.Value.Lexeme != "1" {
+		t.Errorf("expected a default value of 1, got %+v\n", args[0])
+	}
+	if _, ok := args[2].(*parser.VarDeclExpression).Type.(*parser.VariadicType); !ok {
+		t.Errorf("expected a variadic param, got %+v\n", args[2])
+	}
+
+	call := tree[1].(*parser.StatementExpression).Expr.(*parser.FnCall)
+	if named, ok := call.Args[0].(*parser.NamedArg); !ok || named.Name.Lexeme != "prefix" {
+		t.Errorf("expected a named argument, got %+v\n", call.Args[0])
+	}
+}
+
+func TestJumps(t *testing.T) {
+	tree := parse(t, `
+fn run() : void {
+  while (true) {
+    break;
+    continue;
+  }
+again:
+  goto again;
+  return;
+}`)
+
+	body := tree[0].(*parser.FnDeclStmt).Body.(*parser.Block).Statements
+	loop := body[0].(*parser.WhileLoop).Body.(*parser.Block).Statements
+	if _, ok := loop[0].(*parser.BreakStmt); !ok {
+		t.Errorf("expected *parser.BreakStmt, got %T\n", loop[0])
+	}
+	if _, ok := loop[1].(*parser.ContinueStmt); !ok {
+		t.Errorf("expected *parser.ContinueStmt, got %T\n", loop[1])
+	}
+	if label, ok := body[1].(*parser.LabelStmt); !ok || label.Name.Lexeme != "again" {
+		t.Errorf("expected label again, got %+v\n", body[1])
+	}
+	if g, ok := body[2].(*parser.GotoStmt); !ok || g.Label.Lexeme != "again" || g.Line != 8 {
+		t.Errorf("expected goto again on line 8, got %+v\n", body[2])
+	}
+	ret := body[3].(*parser.StatementExpression).Expr.(*parser.FnReturn)
+	if ret.Value != nil {
+		t.Errorf("expected a return without value, got %+v\n", ret.Value)
+	}
+}
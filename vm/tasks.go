@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"errors"
+	"yal/ir"
+)
+
+// Error a blocked task is woken with when no task can run anymore
+var errDeadlock = errors.New("all tasks are blocked")
+
+// Error the tasks still running when the program stops are woken with, for
+// them to return without running their deferred calls
+var errStopped = errors.New("program stopped")
+
+// Task of the program: main or a fn call it spawned. Each task runs on its
+// own goroutine, but only the one holding the baton runs at a time: it
+// passes the baton to the next ready task when it blocks or returns, so that
+// the program runs as it would on a single thread.
+type task struct {
+	wake      chan error
+	exited    chan struct{}
+	depth     int
+	panicking *RuntimeError
+}
+
+// Channel of the interpreted program. An unbuffered channel buffers the
+// value being sent until it is received.
+type Chan struct {
+	size     int
+	buf      []Value
+	sent     int
+	received int
+	waiting  []*task
+}
+
+// What the program ended with: what main returned, or the error stopping it
+type outcome struct {
+	v   Value
+	err error
+}
+
+// Starts a task calling f with args, which runs once the tasks ready before
+// it have blocked or returned. The main task ends the program when it
+// returns, as does a task stopping on an error.
+func (vm *VM) spawn(f *ir.Func, args []Value) *task {
+	t := &task{wake: make(chan error), exited: make(chan struct{})}
+	vm.tasks[t] = true
+	vm.ready = append(vm.ready, t)
+	go func() {
+		defer close(t.exited)
+		if err := <-t.wake; err != nil {
+			return
+		}
+		vm.cur, vm.depth, vm.panicking = t, 0, nil
+		v, err := vm.Call(f, args...)
+		if err == errStopped {
+			return
+		}
+		delete(vm.tasks, t)
+		if err != nil || t == vm.main {
+			vm.done <- outcome{v, err}
+			return
+		}
+		vm.resume()
+	}()
+	return t
+}
+
+// Passes the baton to the first ready task. When there is none, every task
+// left is blocked, and the main one is woken to fail where it blocked.
+func (vm *VM) resume() {
+	if len(vm.ready) == 0 {
+		vm.main.wake <- errDeadlock
+		return
+	}
+	next := vm.ready[0]
+	vm.ready = vm.ready[1:]
+	next.wake <- nil
+}
+
+// Blocks the running task until another one changes ch, running the ready
+// tasks meanwhile
+func (vm *VM) block(ch *Chan) error {
+	t := vm.cur
+	if t == vm.main && len(vm.ready) == 0 {
+		return errDeadlock
+	}
+	ch.waiting = append(ch.waiting, t)
+	t.depth, t.panicking = vm.depth, vm.panicking
+	vm.resume()
+	err := <-t.wake
+	vm.cur, vm.depth, vm.panicking = t, t.depth, t.panicking
+	if err != nil {
+		for i, w := range ch.waiting {
+			if w == t {
+				ch.waiting = append(ch.waiting[:i], ch.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+	return err
+}
+
+// Makes the tasks blocked on ch ready, for them to check it again
+func (vm *VM) wakeAll(ch *Chan) {
+	vm.ready = append(vm.ready, ch.waiting...)
+	ch.waiting = nil
+}
+
+// Sends v to ch, blocking while its buffer is full and, when it has none,
+// until v is received
+func (vm *VM) send(ch *Chan, v Value) error {
+	limit := ch.size
+	if limit == 0 {
+		limit = 1
+	}
+	for len(ch.buf) >= limit {
+		if err := vm.block(ch); err != nil {
+			return err
+		}
+	}
+	ch.buf = append(ch.buf, v)
+	ch.sent++
+	n := ch.sent
+	vm.wakeAll(ch)
+	for ch.size == 0 && ch.received < n {
+		if err := vm.block(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receives a value from ch, blocking until there is one
+func (vm *VM) receive(ch *Chan) (Value, error) {
+	for len(ch.buf) == 0 {
+		if err := vm.block(ch); err != nil {
+			return Value{}, err
+		}
+	}
+	v := ch.buf[0]
+	ch.buf = ch.buf[1:]
+	ch.received++
+	vm.wakeAll(ch)
+	return v, nil
+}
+
+// Stops the tasks left once the program ended, one at a time
+func (vm *VM) stop() {
+	for t := range vm.tasks {
+		t.wake <- errStopped
+		<-t.exited
+	}
+}
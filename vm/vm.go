@@ -0,0 +1,603 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"yal/ir"
+	"yal/parser"
+)
+
+// Frames a program may have at once before it is stopped, tail calls
+// reusing the frame of their caller
+const DefaultMaxDepth = 10000
+
+// Frames kept in the trace of a RuntimeError, the outermost ones being
+// dropped past it
+const maxTrace = 100
+
+// Value of the interpreted program. Integers and bools are held by Int as
+// ir.Const does, pointers by Ptr, fn values by Fn, channels by Ch, interface
+// values by Iface and results by Res, the zero result being nil.
+type Value struct {
+	Int   int64
+	Float float64
+	Str   string
+	Ptr   *Value
+	Fn    *Closure
+	Ch    *Chan
+	Iface *Iface
+	Res   *Result
+}
+
+// Fn value: a fn of the module along with the pointers to the variables it
+// captured, which are passed before its args
+type Closure struct {
+	Fn       *ir.Func
+	Captures []Value
+}
+
+// Interface value: the value it holds along with the method table of its
+// type, which maps the names of the methods to the fns they are lowered to
+type Iface struct {
+	Data  Value
+	Type  string
+	Table map[string]*ir.Func
+}
+
+// Result value: the value it holds when Ok is set, its error otherwise
+type Result struct {
+	Ok    bool
+	Value Value
+}
+
+// Fn being run when a program stopped, and the position of the operation
+// it was at: the one failing for the innermost frame and a call for the
+// others
+type Frame struct {
+	Fn  string
+	Loc parser.Loc
+}
+
+// Error stopping the program: a panic, a division by zero, too deep a
+// recursion or every task being blocked. Trace holds the frames of the fns being run, the innermost
+// one first, those of tail callers having been replaced by their callee.
+// Panic is set for a panic, which recover stops.
+type RuntimeError struct {
+	Fn      string
+	Msg     string
+	Trace   []Frame
+	Dropped int
+	Panic   bool
+}
+
+// Gives the position of the failing operation along with the message, when
+// it is known
+func (e *RuntimeError) Error() string {
+	if len(e.Trace) > 0 && e.Trace[0].Loc.Line > 0 {
+		loc := e.Trace[0].Loc
+		return fmt.Sprintf("fn %s: line %d column %d: %s", e.Fn, loc.Line, loc.Column, e.Msg)
+	}
+	return fmt.Sprintf("fn %s: %s", e.Fn, e.Msg)
+}
+
+// Returns the trace of the error, a line per frame
+func (e *RuntimeError) Stack() string {
+	var s strings.Builder
+	for _, frame := range e.Trace {
+		fmt.Fprintf(&s, "\tin %s", frame.Fn)
+		if frame.Loc.Line > 0 {
+			fmt.Fprintf(&s, " at line %d column %d", frame.Loc.Line, frame.Loc.Column)
+		}
+		s.WriteString("\n")
+	}
+	if e.Dropped > 0 {
+		fmt.Fprintf(&s, "\t...and %d more frames\n", e.Dropped)
+	}
+	return s.String()
+}
+
+// Adds the frame of a caller to the trace of err, when it is a RuntimeError
+func addFrame(err error, frame Frame) error {
+	if re, ok := err.(*RuntimeError); ok {
+		if len(re.Trace) < maxTrace {
+			re.Trace = append(re.Trace, frame)
+		} else {
+			re.Dropped++
+		}
+	}
+	return err
+}
+
+// Interpreter of the IR, which needs to be valid. depth counts the frames
+// of the running task and panicking is the panic its deferred calls may
+// recover from, if any.
+type VM struct {
+	Module    *ir.Module
+	Out       io.Writer
+	MaxDepth  int
+	depth     int
+	panicking *RuntimeError
+	tables    map[string]map[string]*ir.Func
+	main      *task
+	cur       *task
+	tasks     map[*task]bool
+	ready     []*task
+	done      chan outcome
+}
+
+func New(m *ir.Module, out io.Writer) *VM {
+	return &VM{Module: m, Out: out, MaxDepth: DefaultMaxDepth}
+}
+
+// Runs the main fn of the module, returning the exit code of the program:
+// what main returns, or 0 when it returns nothing. The tasks main spawned
+// are stopped once it returns.
+func (vm *VM) Run() (int, error) {
+	main := vm.Module.Func("main")
+	if main == nil {
+		return 0, fmt.Errorf("no main fn")
+	}
+	if len(main.Params) > 0 {
+		return 0, fmt.Errorf("main takes no params")
+	}
+
+	vm.tasks, vm.ready, vm.done = map[*task]bool{}, nil, make(chan outcome, 1)
+	vm.main = vm.spawn(main, nil)
+	vm.resume()
+	end := <-vm.done
+	vm.stop()
+	if end.err != nil {
+		return 0, end.err
+	}
+	return int(end.v.Int), nil
+}
+
+// Returns the method table of the type named name, built from the fns of
+// the module named name.m the first time it is needed
+func (vm *VM) table(name string) map[string]*ir.Func {
+	if t, ok := vm.tables[name]; ok {
+		return t
+	}
+	t := map[string]*ir.Func{}
+	for _, f := range vm.Module.Funcs {
+		m := strings.TrimPrefix(f.Name, name+".")
+		if m != f.Name && !strings.Contains(m, ".") {
+			t[m] = f
+		}
+	}
+	if vm.tables == nil {
+		vm.tables = map[string]map[string]*ir.Func{}
+	}
+	vm.tables[name] = t
+	return t
+}
+
+// Calls f with args, running the fns it tail calls in the same frame
+func (vm *VM) Call(f *ir.Func, args ...Value) (Value, error) {
+	vm.depth++
+	defer func() { vm.depth-- }()
+	if vm.depth > vm.MaxDepth {
+		return Value{}, &RuntimeError{Fn: f.Name, Msg: "stack overflow", Trace: []Frame{{Fn: f.Name}}}
+	}
+
+	for {
+		callee, v, err := vm.run(f, args)
+		if err != nil || callee == nil {
+			return v, err
+		}
+		f, args = callee.f, callee.args
+	}
+}
+
+type tailCall struct {
+	f    *ir.Func
+	args []Value
+}
+
+// Call deferred by a fn, made once it returns or stops on an error
+type deferredCall struct {
+	f    *ir.Func
+	args []Value
+	loc  parser.Loc
+}
+
+// Runs f until it returns, or until it tail calls another fn, which is then
+// returned for Call to run in its place. The calls f deferred are then made
+// in the reverse order, an error one of them stops on replacing the one f
+// stopped on, unless the program is stopping. When f stops on a panic, they
+// may recover from it, f then returning the zero value.
+func (vm *VM) run(f *ir.Func, args []Value) (*tailCall, Value, error) {
+	deferred := []deferredCall{}
+	callee, v, err := vm.exec(f, args, &deferred)
+	if err == errStopped {
+		return nil, v, err
+	}
+	for i := len(deferred) - 1; i >= 0; i-- {
+		d := deferred[i]
+		var panicking *RuntimeError
+		if re, ok := err.(*RuntimeError); ok && re.Panic {
+			panicking = re
+		}
+		outer := vm.panicking
+		vm.panicking = panicking
+		_, derr := vm.Call(d.f, d.args...)
+		recovered := panicking != nil && vm.panicking == nil
+		vm.panicking = outer
+		switch {
+		case derr == errStopped:
+			return nil, v, derr
+		case derr != nil:
+			callee, err = nil, addFrame(derr, Frame{Fn: f.Name, Loc: d.loc})
+		case recovered:
+			err = nil
+		}
+	}
+	return callee, v, err
+}
+
+// Runs the instructions of f, adding the calls it defers to deferred
+func (vm *VM) exec(f *ir.Func, args []Value, deferred *[]deferredCall) (*tailCall, Value, error) {
+	env := map[ir.Value]Value{}
+	for i, p := range f.Params {
+		env[p] = args[i]
+	}
+	get := func(v ir.Value) Value {
+		if c, ok := v.(*ir.Const); ok {
+			return Value{Int: c.Int, Float: c.Float, Str: c.Str}
+		}
+		return env[v]
+	}
+	fail := func(i *ir.Instr, format string, args ...any) (*tailCall, Value, error) {
+		return nil, Value{}, &RuntimeError{Fn: f.Name, Msg: fmt.Sprintf(format, args...), Trace: []Frame{{Fn: f.Name, Loc: i.Loc}}}
+	}
+	// Stops on the error a blocked task is woken with
+	blocked := func(i *ir.Instr, err error) (*tailCall, Value, error) {
+		if err == errStopped {
+			return nil, Value{}, err
+		}
+		return fail(i, "%v", err)
+	}
+
+	var prev *ir.Block
+	b := f.Entry()
+	for {
+		// The phis of a block all read the values of the predecessor
+		phis := b.Phis()
+		values := []Value{}
+		for _, phi := range phis {
+			values = append(values, get(phi.Args[b.PredIndex(prev)]))
+		}
+		for j, phi := range phis {
+			env[phi] = values[j]
+		}
+
+		for _, i := range b.Instrs[len(phis):] {
+			switch {
+			case i.Op.IsBinary():
+				v, err := binary(i.Op, i.Typ, get(i.Args[0]), get(i.Args[1]))
+				if err != nil {
+					return fail(i, "%v", err)
+				}
+				env[i] = v
+			case i.Op.IsUnary():
+				env[i] = unary(i.Op, i.Typ, get(i.Args[0]))
+			case i.Op.IsCompare():
+				env[i] = compare(i.Op, i.Args[0].Type(), get(i.Args[0]), get(i.Args[1]))
+			case i.Op == ir.OpAlloca || i.Op == ir.OpNew:
+				env[i] = Value{Ptr: &Value{}}
+			case i.Op == ir.OpLoad:
+				p := get(i.Args[0]).Ptr
+				if p == nil {
+					return fail(i, "null pointer dereference")
+				}
+				env[i] = *p
+			case i.Op == ir.OpStore:
+				p := get(i.Args[0]).Ptr
+				if p == nil {
+					return fail(i, "null pointer dereference")
+				}
+				*p = get(i.Args[1])
+			case i.Op == ir.OpCall:
+				args := []Value{}
+				for _, arg := range i.Args {
+					args = append(args, get(arg))
+				}
+				callee := vm.Module.Func(i.Callee)
+				switch {
+				case callee == nil && i.Callee == "panic":
+					msgs := []string{}
+					for j, arg := range args {
+						msgs = append(msgs, format(i.Args[j].Type(), arg))
+					}
+					msg := "panic: " + strings.Join(msgs, " ")
+					return nil, Value{}, &RuntimeError{Fn: f.Name, Msg: msg, Trace: []Frame{{Fn: f.Name, Loc: i.Loc}}, Panic: true}
+				case callee == nil:
+					if err := vm.print(i, args); err != nil {
+						return nil, Value{}, err
+					}
+				case i.Tail:
+					return &tailCall{f: callee, args: args}, Value{}, nil
+				default:
+					v, err := vm.Call(callee, args...)
+					if err != nil {
+						return nil, Value{}, addFrame(err, Frame{Fn: f.Name, Loc: i.Loc})
+					}
+					env[i] = v
+				}
+			case i.Op == ir.OpDefer:
+				args := []Value{}
+				for _, arg := range i.Args {
+					args = append(args, get(arg))
+				}
+				*deferred = append(*deferred, deferredCall{f: vm.Module.Func(i.Callee), args: args, loc: i.Loc})
+			case i.Op == ir.OpRecover:
+				msg, ok := Value{}, Value{}
+				if p := vm.panicking; p != nil {
+					msg, ok = Value{Str: strings.TrimPrefix(p.Msg, "panic: ")}, Value{Int: 1}
+					vm.panicking = nil
+				}
+				*get(i.Args[0]).Ptr = msg
+				*get(i.Args[1]).Ptr = ok
+			case i.Op == ir.OpSpawn:
+				args := []Value{}
+				for _, arg := range i.Args {
+					args = append(args, get(arg))
+				}
+				vm.spawn(vm.Module.Func(i.Callee), args)
+			case i.Op == ir.OpChan:
+				size := get(i.Args[0]).Int
+				if size < 0 {
+					return fail(i, "negative channel size %d", size)
+				}
+				env[i] = Value{Ch: &Chan{size: int(size)}}
+			case i.Op == ir.OpSend:
+				ch := get(i.Args[0]).Ch
+				if ch == nil {
+					return fail(i, "send to a null channel")
+				}
+				if err := vm.send(ch, get(i.Args[1])); err != nil {
+					return blocked(i, err)
+				}
+			case i.Op == ir.OpRecv:
+				ch := get(i.Args[0]).Ch
+				if ch == nil {
+					return fail(i, "receive from a null channel")
+				}
+				v, err := vm.receive(ch)
+				if err != nil {
+					return blocked(i, err)
+				}
+				env[i] = v
+			case i.Op == ir.OpClosure:
+				c := &Closure{Fn: vm.Module.Func(i.Callee)}
+				for _, arg := range i.Args {
+					c.Captures = append(c.Captures, get(arg))
+				}
+				env[i] = Value{Fn: c}
+			case i.Op == ir.OpIface:
+				env[i] = Value{Iface: &Iface{Data: get(i.Args[0]), Type: i.Callee, Table: vm.table(i.Callee)}}
+			case i.Op == ir.OpMethod:
+				v := get(i.Args[0]).Iface
+				if v == nil {
+					return fail(i, "method %s of a null interface value", i.Callee)
+				}
+				m := v.Table[i.Callee]
+				if m == nil {
+					return fail(i, "type %s has no method %s", v.Type, i.Callee)
+				}
+				env[i] = Value{Fn: &Closure{Fn: m, Captures: []Value{v.Data}}}
+			case i.Op == ir.OpOk || i.Op == ir.OpErr:
+				env[i] = Value{Res: &Result{Ok: i.Op == ir.OpOk, Value: get(i.Args[0])}}
+			case i.Op == ir.OpIsOk:
+				if r := get(i.Args[0]).Res; r != nil && r.Ok {
+					env[i] = Value{Int: 1}
+				} else {
+					env[i] = Value{}
+				}
+			case i.Op == ir.OpValue || i.Op == ir.OpError:
+				if r := get(i.Args[0]).Res; r != nil && r.Ok == (i.Op == ir.OpValue) {
+					env[i] = r.Value
+				} else {
+					env[i] = Value{}
+				}
+			case i.Op == ir.OpApply:
+				c := get(i.Args[0]).Fn
+				if c == nil {
+					return fail(i, "call of a null fn value")
+				}
+				args := append([]Value{}, c.Captures...)
+				for _, arg := range i.Args[1:] {
+					args = append(args, get(arg))
+				}
+				v, err := vm.Call(c.Fn, args...)
+				if err != nil {
+					return nil, Value{}, addFrame(err, Frame{Fn: f.Name, Loc: i.Loc})
+				}
+				env[i] = v
+			case i.Op == ir.OpJump:
+				prev, b = b, b.Succs[0]
+			case i.Op == ir.OpBranch:
+				if get(i.Args[0]).Int != 0 {
+					prev, b = b, b.Succs[0]
+				} else {
+					prev, b = b, b.Succs[1]
+				}
+			case i.Op == ir.OpRet && len(i.Args) > 0:
+				return nil, get(i.Args[0]), nil
+			case i.Op == ir.OpRet:
+				return nil, Value{}, nil
+			case i.Op == ir.OpUnreachable:
+				return fail(i, "unreachable code reached")
+			}
+		}
+	}
+}
+
+// Writes the args of a call to print separated by spaces and followed by a
+// newline
+func (vm *VM) print(i *ir.Instr, args []Value) error {
+	s := []string{}
+	for j, arg := range args {
+		s = append(s, format(i.Args[j].Type(), arg))
+	}
+	_, err := fmt.Fprintln(vm.Out, strings.Join(s, " "))
+	return err
+}
+
+// Formats v as print does: chars as the byte they hold, floats in the
+// shortest form that reads back the same, pointers as null or ptr, fn
+// values as null or fn, channels as null or chan and results as the variant
+// they are followed by what it holds in parentheses
+func format(t ir.Type, v Value) string {
+	switch {
+	case t.IsResult():
+		value, err := t.Outcomes()
+		if v.Res != nil && v.Res.Ok {
+			return "Ok(" + format(value, v.Res.Value) + ")"
+		}
+		held := Value{}
+		if v.Res != nil {
+			held = v.Res.Value
+		}
+		return "Err(" + format(err, held) + ")"
+	case t == ir.Uint:
+		return strconv.FormatUint(uint64(v.Int), 10)
+	case t == ir.Char:
+		return string([]byte{byte(v.Int)})
+	case t == ir.Bool:
+		return strconv.FormatBool(v.Int != 0)
+	case t == ir.Float:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case t == ir.String:
+		return v.Str
+	case t.IsPointer() && v.Ptr == nil:
+		return "null"
+	case t.IsPointer():
+		return "ptr"
+	case t.IsFn() && v.Fn == nil:
+		return "null"
+	case t.IsFn():
+		return "fn"
+	case t.IsChan() && v.Ch == nil:
+		return "null"
+	case t.IsChan():
+		return "chan"
+	}
+	return strconv.FormatInt(v.Int, 10)
+}
+
+// Integer operations wrap around, on 64 bits for int and uint and on 8 bits
+// for char. Shifts by the width of the type or more give 0, or -1 for right
+// shifts of negative ints.
+func binary(op ir.Op, t ir.Type, a Value, b Value) (Value, error) {
+	if t == ir.Float {
+		switch op {
+		case ir.OpAdd:
+			return Value{Float: a.Float + b.Float}, nil
+		case ir.OpSub:
+			return Value{Float: a.Float - b.Float}, nil
+		case ir.OpMul:
+			return Value{Float: a.Float * b.Float}, nil
+		}
+		return Value{Float: a.Float / b.Float}, nil
+	}
+
+	x, y := uint64(a.Int), uint64(b.Int)
+	r := uint64(0)
+	switch op {
+	case ir.OpAdd:
+		r = x + y
+	case ir.OpSub:
+		r = x - y
+	case ir.OpMul:
+		r = x * y
+	case ir.OpDiv, ir.OpRem:
+		if y == 0 {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		switch {
+		case t.IsSigned() && a.Int == math.MinInt64 && b.Int == -1:
+			// The quotient overflows back to the dividend
+			r = x
+			if op == ir.OpRem {
+				r = 0
+			}
+		case t.IsSigned() && op == ir.OpDiv:
+			r = uint64(a.Int / b.Int)
+		case t.IsSigned():
+			r = uint64(a.Int % b.Int)
+		case op == ir.OpDiv:
+			r = x / y
+		default:
+			r = x % y
+		}
+	case ir.OpAnd:
+		r = x & y
+	case ir.OpOr:
+		r = x | y
+	case ir.OpXor:
+		r = x ^ y
+	case ir.OpShl:
+		r = x << y
+	case ir.OpShr:
+		if t.IsSigned() {
+			r = uint64(a.Int >> y)
+		} else {
+			r = x >> y
+		}
+	}
+	if t == ir.Char {
+		r = uint64(uint8(r))
+	}
+	return Value{Int: int64(r)}, nil
+}
+
+func unary(op ir.Op, t ir.Type, a Value) Value {
+	switch {
+	case op == ir.OpNot:
+		return Value{Int: 1 - a.Int}
+	case t == ir.Float:
+		return Value{Float: -a.Float}
+	case t == ir.Char:
+		return Value{Int: int64(uint8(-a.Int))}
+	}
+	return Value{Int: -a.Int}
+}
+
+func compare(op ir.Op, t ir.Type, a Value, b Value) Value {
+	lt, eq, gt := false, false, false
+	switch {
+	case t == ir.Float:
+		lt, eq, gt = a.Float < b.Float, a.Float == b.Float, a.Float > b.Float
+	case t.IsSigned():
+		lt, eq, gt = a.Int < b.Int, a.Int == b.Int, a.Int > b.Int
+	case t.IsInteger():
+		x, y := uint64(a.Int), uint64(b.Int)
+		lt, eq, gt = x < y, x == y, x > y
+	default:
+		eq = a == b
+	}
+
+	r := false
+	switch op {
+	case ir.OpEq:
+		r = eq
+	case ir.OpNe:
+		r = !eq
+	case ir.OpLt:
+		r = lt
+	case ir.OpLe:
+		r = lt || eq
+	case ir.OpGt:
+		r = gt
+	default:
+		r = gt || eq
+	}
+	if r {
+		return Value{Int: 1}
+	}
+	return Value{}
+}
@@ -0,0 +1,392 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"yal/internal/backendtest"
+	"yal/ir"
+	"yal/lexer"
+	"yal/opt"
+	"yal/parser"
+	"yal/vm"
+)
+
+// Runs src optimized at level, returning what it prints and its exit code
+func run(t *testing.T, src string, level int) (string, int, error) {
+	ctx := context.Background()
+
+	tokens, err := lexer.NewLexer(ctx, src).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ir.Build(parser.NewParser(ctx, tokens).Run())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &opt.Manager{Passes: opt.Pipeline(level), Verify: true}
+	if err := pm.Run(m); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	code, err := vm.New(m, &out).Run()
+	return out.String(), code, err
+}
+
+// Checks that src prints want and exits with code at every level
+func expectRun(t *testing.T, src string, want string, code int) {
+	for level := 0; level <= 2; level++ {
+		out, got, err := run(t, src, level)
+		if err != nil {
+			t.Fatalf("unexpected error at -O%d: %v", level, err)
+		}
+		if out != want || got != code {
+			t.Errorf("expected %q and exit code %d at -O%d, got %q and %d\n", want, code, level, out, got)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Test loops and calls", func(t *testing.T) {
+		expectRun(t, `fn fib(n: int) : int {
+  let a = 0;
+  let b = 1;
+  for (let i = 0; i < n; ++i) {
+    let t = a + b;
+    a = b;
+    b = t;
+  }
+  return a;
+}
+
+fn main() : int {
+  let k = 3;
+  let s = 0;
+  while (s < 100) {
+    s += fib(10) * k + k * k;
+  }
+  print(s, fib(20));
+  return s % 7;
+}`, "174 6765\n", 6)
+	})
+
+	t.Run("Test pointers", func(t *testing.T) {
+		expectRun(t, `fn swap(a: *int, b: *int) : void {
+  let t = *a;
+  *a = *b;
+  *b = t;
+}
+
+fn main() : int {
+  let x = 1;
+  let y = 2;
+  swap(&x, &y);
+  print(x, y);
+  return x;
+}`, "2 1\n", 2)
+	})
+
+	t.Run("Test values", func(t *testing.T) {
+		expectRun(t, `fn main() : void {
+  let u: uint = 0;
+  let f = 1.5;
+  print(u - 1, f * 2.0, -7 / 2, -7 % 2, 1 << 3, true && !false, "hi");
+}`, "18446744073709551615 3 -3 -1 8 true hi\n", 0)
+	})
+
+	t.Run("Test short circuits", func(t *testing.T) {
+		expectRun(t, `fn loud(b: bool) : bool {
+  print(b);
+  return b;
+}
+
+fn main() : void {
+  print(loud(false) && loud(true), loud(true) || loud(false));
+}`, "false\ntrue\nfalse true\n", 0)
+	})
+
+	t.Run("Test multiple return values", func(t *testing.T) {
+		expectRun(t, `fn divmod(a: int, b: int) : (int, int) {
+  return a / b, a % b;
+}
+
+fn forward(a: int) : (int, int) {
+  if (a > 10) {
+    return divmod(a, 10);
+  }
+  (a, 0)
+}
+
+fn main() : int {
+  let (q, r) = divmod(7, 2);
+  let (t, _) = forward(25);
+  let (ok, n) = (true, 4);
+  print(q, r, t, ok, n);
+  q + r
+}`, "3 1 2 true 4\n", 4)
+	})
+
+	t.Run("Test defer", func(t *testing.T) {
+		expectRun(t, `fn cleanup(n: int) : int {
+  defer print("closed", n);
+  print("working");
+  for (let i = 0; i < 3; ++i) {
+    let j = i;
+    defer print("loop", j);
+  }
+  if (n > 1) {
+    return n;
+  }
+  n = 42;
+  n + 1
+}
+
+fn main() : int {
+  print(cleanup(2));
+  print(cleanup(1));
+  0
+}`, "working\nloop 2\nloop 1\nloop 0\nclosed 2\n2\nworking\nloop 2\nloop 1\nloop 0\nclosed 42\n43\n", 0)
+	})
+
+	t.Run("Test results", func(t *testing.T) {
+		expectRun(t, backendtest.Results, backendtest.ResultsOutput, backendtest.ResultsExit)
+	})
+
+	t.Run("Test recover", func(t *testing.T) {
+		expectRun(t, `fn report() : void {
+  let (msg, ok) = recover();
+  if (ok) {
+    print("recovered:", msg);
+  }
+}
+
+fn safe(n: int) : int {
+  defer report();
+  if (n > 2) { panic("too big"); }
+  n * 10
+}
+
+fn main() : int {
+  print(safe(1), safe(5));
+  let (msg, ok) = recover();
+  print(ok, msg);
+  0
+}`, "recovered: too big\n10 0\nfalse \n", 0)
+	})
+
+	t.Run("Test channels", func(t *testing.T) {
+		expectRun(t, `fn producer(ch: chan<int>, n: int) : void {
+  for (let i = 0; i < n; ++i) {
+    ch <- i;
+  }
+}
+
+fn consume() : int {
+  let ch = chan<int>(4);
+  spawn producer(ch, 3);
+  <- ch + <- ch
+}
+
+fn main() : int {
+  print(consume());
+  let ch = chan<int>();
+  spawn producer(ch, 1);
+  print(<- ch);
+  let never = chan<int>();
+  spawn producer(never, 1);
+  7
+}`, "1\n0\n", 7)
+	})
+
+	t.Run("Test unbuffered channels", func(t *testing.T) {
+		expectRun(t, `fn pinger(ch: chan<int>, n: int) : void {
+  for (let i = 1; i <= n; ++i) {
+    ch <- i;
+    print("sent", i);
+  }
+}
+
+fn main() : int {
+  let ch = chan<int>();
+  spawn pinger(ch, 2);
+  let a = <- ch;
+  print("received", a);
+  let b = <- ch;
+  print("received", b);
+  a + b
+}`, "received 1\nsent 1\nreceived 2\n", 3)
+	})
+
+	t.Run("Test closures", func(t *testing.T) {
+		expectRun(t, `fn adder(n: int) : fn(int): int {
+  (x: int) : int => x + n
+}
+
+fn apply(f: fn(int): int, v: int) : int {
+  f(v)
+}
+
+fn double(x: int) : int {
+  x * 2
+}
+
+fn counter() : int {
+  let count = 0;
+  let inc = () : int => {
+    count += 1;
+    count
+  };
+  inc();
+  inc();
+  print(count);
+  count = 10;
+  inc()
+}
+
+fn nested(a: int) : int {
+  let outer = (b: int) : fn(int): int => (c: int) : int => a + b + c;
+  let inner = outer(2);
+  a = 100;
+  inner(3)
+}
+
+fn main() : int {
+  let fs: fn(int): int;
+  let total = 0;
+  for (let i = 0; i < 3; ++i) {
+    let j = i;
+    let f = (x: int) : int => x + j;
+    if (i == 1) { fs = f; }
+  }
+  print(apply(adder(1), 2), apply(double, 5), counter(), nested(1), fs(10), fs);
+  0
+}`, "2\n3 10 11 105 11 fn\n", 0)
+	})
+
+	t.Run("Test interfaces", func(t *testing.T) {
+		expectRun(t, backendtest.Interfaces, backendtest.InterfacesOutput, backendtest.InterfacesExit)
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	src := `fn even(n: int) : bool {
+  if (n == 0) { return true; }
+  return odd(n - 1);
+}
+
+fn odd(n: int) : bool {
+  if (n == 0) { return false; }
+  return even(n - 1);
+}
+
+fn sum(n: int, acc: int) : int {
+  if (n == 0) { return acc; }
+  return sum(n - 1, acc + n);
+}
+
+fn main() : void {
+  print(even(100001), sum(100000, 0));
+}`
+
+	t.Run("Test deep recursion overflows without them", func(t *testing.T) {
+		_, _, err := run(t, src, 0)
+		var re *vm.RuntimeError
+		if !errors.As(err, &re) || re.Msg != "stack overflow" {
+			t.Errorf("expected a stack overflow, got %v\n", err)
+		}
+	})
+
+	t.Run("Test same output with them", func(t *testing.T) {
+		for level := 1; level <= 2; level++ {
+			out, _, err := run(t, src, level)
+			if err != nil || out != "false 5000050000\n" {
+				t.Errorf("expected %q at -O%d, got %q and %v\n", "false 5000050000\n", level, out, err)
+			}
+		}
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":             `fn main() : void { panic("oops"); }`,
+		"Test division by zero":  `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test null pointer":      `fn get(p: *int) : int { *p } fn main() : int { let p: *int = NULL; get(p) }`,
+		"Test null fn value":     `fn main() : int { let f: fn(): int; f() }`,
+		"Test null interface":    `definetype Shape = interface { fn area(self) : int; }; fn main() : int { let s: Shape; s.area() }`,
+		"Test deadlock":          `fn main() : int { let ch = chan<int>(); ch <- 1; 0 }`,
+		"Test blocked tasks":     `fn wait(ch: chan<int>) : void { <- ch; } fn main() : int { let ch = chan<int>(); spawn wait(ch); <- ch }`,
+		"Test null channel":      `fn main() : int { let ch: chan<int>; <- ch }`,
+		"Test failing task":      `fn fail(ch: chan<int>) : void { panic("in task"); } fn main() : int { let ch = chan<int>(); spawn fail(ch); <- ch }`,
+		"Test unrecovered error": `fn report() : void { recover(); } fn main() : int { defer report(); let n = 0; 1 / n }`,
+	}
+	msgs := map[string]string{
+		"Test panic":             "panic: oops",
+		"Test division by zero":  "division by zero",
+		"Test null pointer":      "line 1 column 25: null pointer dereference",
+		"Test null fn value":     "line 1 column 38: call of a null fn value",
+		"Test null interface":    "line 1 column 89: method area of a null interface value",
+		"Test deadlock":          "fn main: line 1 column 45: all tasks are blocked",
+		"Test blocked tasks":     "fn main: line 1 column 99: all tasks are blocked",
+		"Test null channel":      "line 1 column 39: receive from a null channel",
+		"Test failing task":      "fn fail: line 1 column 38: panic: in task",
+		"Test unrecovered error": "division by zero",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			for level := 0; level <= 2; level++ {
+				_, _, err := run(t, src, level)
+				if err == nil || !strings.Contains(err.Error(), msgs[name]) {
+					t.Errorf("expected an error containing %q at -O%d, got %v\n", msgs[name], level, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeferOnErrors(t *testing.T) {
+	src := `fn div(a: int, b: int) : int {
+  defer print("div");
+  a / b
+}
+
+fn main() : int {
+  defer print("main");
+  print(div(4, 2));
+  div(1, 0)
+}`
+	for level := 0; level <= 2; level++ {
+		out, _, err := run(t, src, level)
+		if out != "div\n2\ndiv\nmain\n" || err == nil || !strings.Contains(err.Error(), "division by zero") {
+			t.Errorf("expected %q and a division by zero at -O%d, got %q and %v\n", "div\n2\ndiv\nmain\n", level, out, err)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	src := `fn inner(n: int) : int {
+  if (n > 2) { panic("too big"); }
+  n
+}
+
+fn outer(n: int) : int {
+  let m = inner(n) + 1;
+  m
+}
+
+fn main() : int {
+  print(outer(1));
+  outer(3)
+}`
+	_, _, err := run(t, src, 0)
+	var re *vm.RuntimeError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected a runtime error, got %v\n", err)
+	}
+	want := "\tin inner at line 2 column 22\n\tin outer at line 7 column 17\n\tin main at line 13 column 9\n"
+	if re.Msg != "panic: too big" || re.Stack() != want {
+		t.Errorf("expected %q with the trace\n%s\ngot %q with\n%s\n", "panic: too big", want, re.Msg, re.Stack())
+	}
+}
@@ -0,0 +1,469 @@
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type valType byte
+
+const (
+	i32 valType = 0x7f
+	i64 valType = 0x7e
+	f64 valType = 0x7c
+)
+
+func (t valType) String() string {
+	switch t {
+	case i32:
+		return "i32"
+	case i64:
+		return "i64"
+	}
+	return "f64"
+}
+
+// Fn of a module, imported from the host when imports is set. Names are
+// given without the $ of the text format, the params coming first.
+type function struct {
+	name    string
+	params  []valType
+	results []valType
+	locals  []valType
+	names   []string
+	body    []instr
+	imports string
+	export  string
+}
+
+func (f *function) signature() string {
+	return fmt.Sprint(f.params, f.results)
+}
+
+// Instruction in the text format, made of its mnemonic and its immediate
+// operand: a label, a local index, a fn name, a constant or a memory
+// offset depending on the instruction
+type instr struct {
+	op  string
+	arg any
+}
+
+type immediate int
+
+const (
+	noImm    immediate = iota
+	blockImm           // label of the block, loop or if opened, which may be empty
+	labelImm           // label branched to
+	tableImm           // labels branched to by br_table, the last one by default
+	localImm
+	globalImm
+	callImm
+	i32Imm
+	i64Imm
+	f64Imm
+	memImm // offset, the alignment being the natural one
+)
+
+type opcode struct {
+	code  byte
+	imm   immediate
+	align int
+}
+
+var opcodes = map[string]opcode{
+	"unreachable":  {0x00, noImm, 0},
+	"block":        {0x02, blockImm, 0},
+	"loop":         {0x03, blockImm, 0},
+	"if":           {0x04, blockImm, 0},
+	"else":         {0x05, noImm, 0},
+	"end":          {0x0b, noImm, 0},
+	"br":           {0x0c, labelImm, 0},
+	"br_if":        {0x0d, labelImm, 0},
+	"br_table":     {0x0e, tableImm, 0},
+	"return":       {0x0f, noImm, 0},
+	"call":         {0x10, callImm, 0},
+	"drop":         {0x1a, noImm, 0},
+	"select":       {0x1b, noImm, 0},
+	"local.get":    {0x20, localImm, 0},
+	"local.set":    {0x21, localImm, 0},
+	"local.tee":    {0x22, localImm, 0},
+	"global.get":   {0x23, globalImm, 0},
+	"global.set":   {0x24, globalImm, 0},
+	"i32.load":     {0x28, memImm, 2},
+	"i64.load":     {0x29, memImm, 3},
+	"f64.load":     {0x2b, memImm, 3},
+	"i32.store":    {0x36, memImm, 2},
+	"i64.store":    {0x37, memImm, 3},
+	"f64.store":    {0x39, memImm, 3},
+	"i32.const":    {0x41, i32Imm, 0},
+	"i64.const":    {0x42, i64Imm, 0},
+	"f64.const":    {0x44, f64Imm, 0},
+	"i32.eqz":      {0x45, noImm, 0},
+	"i32.eq":       {0x46, noImm, 0},
+	"i32.ne":       {0x47, noImm, 0},
+	"i32.lt_s":     {0x48, noImm, 0},
+	"i32.lt_u":     {0x49, noImm, 0},
+	"i64.eqz":      {0x50, noImm, 0},
+	"i64.eq":       {0x51, noImm, 0},
+	"i64.ne":       {0x52, noImm, 0},
+	"i64.lt_s":     {0x53, noImm, 0},
+	"i64.lt_u":     {0x54, noImm, 0},
+	"i64.gt_s":     {0x55, noImm, 0},
+	"i64.gt_u":     {0x56, noImm, 0},
+	"i64.le_s":     {0x57, noImm, 0},
+	"i64.le_u":     {0x58, noImm, 0},
+	"i64.ge_s":     {0x59, noImm, 0},
+	"i64.ge_u":     {0x5a, noImm, 0},
+	"f64.eq":       {0x61, noImm, 0},
+	"f64.ne":       {0x62, noImm, 0},
+	"f64.lt":       {0x63, noImm, 0},
+	"f64.gt":       {0x64, noImm, 0},
+	"f64.le":       {0x65, noImm, 0},
+	"f64.ge":       {0x66, noImm, 0},
+	"i32.add":      {0x6a, noImm, 0},
+	"i32.sub":      {0x6b, noImm, 0},
+	"i32.and":      {0x71, noImm, 0},
+	"i32.or":       {0x72, noImm, 0},
+	"i32.xor":      {0x73, noImm, 0},
+	"i64.add":      {0x7c, noImm, 0},
+	"i64.sub":      {0x7d, noImm, 0},
+	"i64.mul":      {0x7e, noImm, 0},
+	"i64.div_s":    {0x7f, noImm, 0},
+	"i64.div_u":    {0x80, noImm, 0},
+	"i64.rem_s":    {0x81, noImm, 0},
+	"i64.rem_u":    {0x82, noImm, 0},
+	"i64.and":      {0x83, noImm, 0},
+	"i64.or":       {0x84, noImm, 0},
+	"i64.xor":      {0x85, noImm, 0},
+	"i64.shl":      {0x86, noImm, 0},
+	"i64.shr_s":    {0x87, noImm, 0},
+	"i64.shr_u":    {0x88, noImm, 0},
+	"f64.neg":      {0x9a, noImm, 0},
+	"f64.add":      {0xa0, noImm, 0},
+	"f64.sub":      {0xa1, noImm, 0},
+	"f64.mul":      {0xa2, noImm, 0},
+	"f64.div":      {0xa3, noImm, 0},
+	"i32.wrap_i64": {0xa7, noImm, 0},
+}
+
+// Module of fns with one exported memory, holding the stack of the slots of
+// variables followed by data. The top of the stack is held by the only
+// global, starting at stack.
+type module struct {
+	funcs []*function
+	data  []byte
+	pages int
+	stack int32
+}
+
+const spGlobal = "sp"
+
+// Writes the module in the WebAssembly text format
+func (m *module) writeText(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("(module\n")
+	for _, f := range m.funcs {
+		if f.imports != "" {
+			fmt.Fprintf(&b, "  (import %q %q (func $%s%s))\n", "yal", f.imports, f.name, f.textSignature(false))
+		}
+	}
+	fmt.Fprintf(&b, "  (memory (export \"memory\") %d)\n", m.pages)
+	fmt.Fprintf(&b, "  (global $%s (mut i32) (i32.const %d))\n", spGlobal, m.stack)
+	if len(m.data) > 0 {
+		fmt.Fprintf(&b, "  (data (i32.const %d) \"%s\")\n", dataStart, escape(m.data))
+	}
+
+	for _, f := range m.funcs {
+		if f.imports != "" {
+			continue
+		}
+		b.WriteString("\n  (func $" + f.name)
+		if f.export != "" {
+			fmt.Fprintf(&b, " (export %q)", f.export)
+		}
+		b.WriteString(f.textSignature(true) + "\n")
+		if len(f.locals) > 0 {
+			b.WriteString("   ")
+			for i, t := range f.locals {
+				fmt.Fprintf(&b, " (local $%s %s)", f.names[len(f.params)+i], t)
+			}
+			b.WriteString("\n")
+		}
+
+		depth := 2
+		for _, in := range f.body {
+			if in.op == "end" || in.op == "else" {
+				depth--
+			}
+			b.WriteString(strings.Repeat("  ", depth) + f.textInstr(in) + "\n")
+			if opcodes[in.op].imm == blockImm || in.op == "else" {
+				depth++
+			}
+		}
+		b.WriteString("  )\n")
+	}
+	b.WriteString(")\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (f *function) textSignature(named bool) string {
+	s := ""
+	for i, t := range f.params {
+		if named {
+			s += fmt.Sprintf(" (param $%s %s)", f.names[i], t)
+		} else {
+			s += fmt.Sprintf(" (param %s)", t)
+		}
+	}
+	for _, t := range f.results {
+		s += fmt.Sprintf(" (result %s)", t)
+	}
+	return s
+}
+
+func (f *function) textInstr(in instr) string {
+	switch opcodes[in.op].imm {
+	case blockImm, labelImm:
+		if label := in.arg.(string); label != "" {
+			return in.op + " $" + label
+		}
+	case tableImm:
+		s := in.op
+		for _, label := range in.arg.([]string) {
+			s += " $" + label
+		}
+		return s
+	case localImm:
+		return in.op + " $" + f.names[in.arg.(int)]
+	case globalImm, callImm:
+		return in.op + " $" + in.arg.(string)
+	case i32Imm, i64Imm:
+		return in.op + " " + strconv.FormatInt(in.arg.(int64), 10)
+	case f64Imm:
+		v := in.arg.(float64)
+		switch {
+		case math.IsNaN(v):
+			return in.op + " nan"
+		case math.IsInf(v, 1):
+			return in.op + " inf"
+		case math.IsInf(v, -1):
+			return in.op + " -inf"
+		}
+		return in.op + " " + strconv.FormatFloat(v, 'g', -1, 64)
+	case memImm:
+		if offset := in.arg.(int); offset != 0 {
+			return in.op + " offset=" + strconv.Itoa(offset)
+		}
+	}
+	return in.op
+}
+
+// Escapes the bytes of a string of the text format that aren't printable
+// ASCII as hexadecimal
+func escape(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\%02x", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Writes the module in the WebAssembly binary format
+func (m *module) writeBinary(w io.Writer) error {
+	var out bytes.Buffer
+	out.Write([]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00})
+
+	types := map[string]int{}
+	var typeSec, importSec, funcSec, codeSec []byte
+	indices := map[string]int{}
+	ntypes, nimports, nfuncs := 0, 0, 0
+	for i, f := range m.funcs {
+		indices[f.name] = i
+		sig := f.signature()
+		if _, ok := types[sig]; !ok {
+			types[sig] = ntypes
+			ntypes++
+			typeSec = append(typeSec, 0x60)
+			typeSec = appendTypes(typeSec, f.params)
+			typeSec = appendTypes(typeSec, f.results)
+		}
+		if f.imports != "" {
+			importSec = appendName(importSec, "yal")
+			importSec = appendName(importSec, f.imports)
+			importSec = append(importSec, 0x00)
+			importSec = appendUint(importSec, uint64(types[sig]))
+			nimports++
+		} else {
+			funcSec = appendUint(funcSec, uint64(types[sig]))
+			nfuncs++
+		}
+	}
+	for _, f := range m.funcs {
+		if f.imports == "" {
+			codeSec = appendBytes(codeSec, f.encode(indices))
+		}
+	}
+
+	section(&out, 1, ntypes, typeSec)
+	section(&out, 2, nimports, importSec)
+	section(&out, 3, nfuncs, funcSec)
+	section(&out, 5, 1, appendUint([]byte{0x00}, uint64(m.pages)))
+	global := []byte{byte(i32), 0x01, opcodes["i32.const"].code}
+	global = appendInt(global, int64(m.stack))
+	section(&out, 6, 1, append(global, opcodes["end"].code))
+
+	var exportSec []byte
+	nexports := 1
+	exportSec = appendName(exportSec, "memory")
+	exportSec = append(exportSec, 0x02, 0x00)
+	for i, f := range m.funcs {
+		if f.export != "" {
+			exportSec = appendName(exportSec, f.export)
+			exportSec = append(exportSec, 0x00)
+			exportSec = appendUint(exportSec, uint64(i))
+			nexports++
+		}
+	}
+	section(&out, 7, nexports, exportSec)
+	section(&out, 10, nfuncs, codeSec)
+
+	if len(m.data) > 0 {
+		seg := []byte{0x00, opcodes["i32.const"].code}
+		seg = appendInt(seg, dataStart)
+		seg = append(seg, opcodes["end"].code)
+		section(&out, 11, 1, appendBytes(seg, m.data))
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// Writes a section holding n entries, left out when empty
+func section(out *bytes.Buffer, id byte, n int, entries []byte) {
+	if n == 0 {
+		return
+	}
+	contents := appendUint(nil, uint64(n))
+	out.WriteByte(id)
+	out.Write(appendBytes(nil, append(contents, entries...)))
+}
+
+// Returns the code of a fn: its locals, grouped by type, and its body
+func (f *function) encode(indices map[string]int) []byte {
+	var groups []byte
+	n := 0
+	for i := 0; i < len(f.locals); {
+		j := i
+		for j < len(f.locals) && f.locals[j] == f.locals[i] {
+			j++
+		}
+		groups = appendUint(groups, uint64(j-i))
+		groups = append(groups, byte(f.locals[i]))
+		n++
+		i = j
+	}
+	code := appendUint(nil, uint64(n))
+	code = append(code, groups...)
+
+	// Branches refer to the blocks they leave by their depth
+	labels := []string{}
+	depth := func(label string) uint64 {
+		for i := len(labels) - 1; i >= 0; i-- {
+			if labels[i] == label {
+				return uint64(len(labels) - 1 - i)
+			}
+		}
+		panic(fmt.Sprintf("fn %s: unknown label %s", f.name, label))
+	}
+
+	for _, in := range f.body {
+		op, ok := opcodes[in.op]
+		if !ok {
+			panic(fmt.Sprintf("fn %s: unknown instruction %s", f.name, in.op))
+		}
+		code = append(code, op.code)
+		switch op.imm {
+		case blockImm:
+			labels = append(labels, in.arg.(string))
+			code = append(code, 0x40)
+		case labelImm:
+			code = appendUint(code, depth(in.arg.(string)))
+		case tableImm:
+			targets := in.arg.([]string)
+			code = appendUint(code, uint64(len(targets)-1))
+			for _, label := range targets {
+				code = appendUint(code, depth(label))
+			}
+		case localImm:
+			code = appendUint(code, uint64(in.arg.(int)))
+		case globalImm:
+			code = appendUint(code, 0)
+		case callImm:
+			code = appendUint(code, uint64(indices[in.arg.(string)]))
+		case i32Imm, i64Imm:
+			code = appendInt(code, in.arg.(int64))
+		case f64Imm:
+			bits := math.Float64bits(in.arg.(float64))
+			for i := 0; i < 8; i++ {
+				code = append(code, byte(bits>>(8*i)))
+			}
+		case memImm:
+			code = appendUint(code, uint64(op.align))
+			code = appendUint(code, uint64(in.arg.(int)))
+		}
+		if in.op == "end" {
+			labels = labels[:len(labels)-1]
+		}
+	}
+	return append(code, opcodes["end"].code)
+}
+
+func appendTypes(b []byte, types []valType) []byte {
+	b = appendUint(b, uint64(len(types)))
+	for _, t := range types {
+		b = append(b, byte(t))
+	}
+	return b
+}
+
+func appendName(b []byte, name string) []byte {
+	return appendBytes(b, []byte(name))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	return append(appendUint(b, uint64(len(data))), data...)
+}
+
+// Appends v in the unsigned LEB128 encoding
+func appendUint(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// Appends v in the signed LEB128 encoding
+func appendInt(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,96 @@
+package wasm
+
+// Fns the host module yal provides. The print ones write their arg as the
+// vm's print does, strings being given by the address of their record,
+// print_space a space and print_newline a newline. panic makes them write
+// to stderr from then on, after writing "panic: ". exit ends the program
+// with an exit code, and fail writes the string it is given and a newline
+// to stderr before exiting with 1.
+var imports = []struct {
+	name   string
+	params []valType
+}{
+	{"print_int", []valType{i64}},
+	{"print_uint", []valType{i64}},
+	{"print_char", []valType{i64}},
+	{"print_bool", []valType{i32}},
+	{"print_float", []valType{f64}},
+	{"print_string", []valType{i32}},
+	{"print_ptr", []valType{i32}},
+	{"print_space", nil},
+	{"print_newline", nil},
+	{"panic", nil},
+	{"exit", []valType{i32}},
+	{"fail", []valType{i32}},
+}
+
+// Fns of the runtime defined in the module, in the order they are added to
+// it when called
+var helpers = []string{"div_s", "rem_s", "div_u", "rem_u", "shl", "shr_s", "shr_u", "nonnull"}
+
+// Names fns of the runtime so that they can't clash with the fns of the
+// module, whose names have no dot
+func runtimeName(name string) string {
+	return "yal." + name
+}
+
+// Returns the fn of the runtime name
+func (g *generator) helper(name string) *function {
+	f := &function{name: runtimeName(name), params: []valType{i64, i64}, results: []valType{i64}, names: []string{"a", "b"}}
+	g.fn = f
+
+	switch name {
+	case "div_s", "rem_s", "div_u", "rem_u":
+		g.emit("local.get", 1)
+		g.emit("i64.eqz", nil)
+		g.emit("if", "")
+		g.abort("division by zero")
+		g.emit("end", nil)
+		// Dividing the smallest int by -1 overflows back to it, which is
+		// what negating it does
+		if name == "div_s" {
+			g.emit("local.get", 1)
+			g.emit("i64.const", int64(-1))
+			g.emit("i64.eq", nil)
+			g.emit("if", "")
+			g.emit("i64.const", int64(0))
+			g.emit("local.get", 0)
+			g.emit("i64.sub", nil)
+			g.emit("return", nil)
+			g.emit("end", nil)
+		}
+		g.emit("local.get", 0)
+		g.emit("local.get", 1)
+		g.emit("i64."+name, nil)
+	case "shl", "shr_s", "shr_u":
+		// Shifts only use the low 6 bits of their count, shifting by 64
+		// or more gives what shifting by 63 twice would
+		g.emit("local.get", 0)
+		g.emit("local.get", 1)
+		g.emit("i64."+name, nil)
+		if name == "shr_s" {
+			g.emit("local.get", 0)
+			g.emit("i64.const", int64(63))
+			g.emit("i64.shr_s", nil)
+		} else {
+			g.emit("i64.const", int64(0))
+		}
+		g.emit("local.get", 1)
+		g.emit("i64.const", int64(64))
+		g.emit("i64.lt_u", nil)
+		g.emit("select", nil)
+	case "nonnull":
+		// Returns the pointer it is given once checked, failing with the
+		// message it is given along with it
+		f.params, f.results, f.names = []valType{i32, i32}, []valType{i32}, []string{"p", "msg"}
+		g.emit("local.get", 0)
+		g.emit("i32.eqz", nil)
+		g.emit("if", "")
+		g.emit("local.get", 1)
+		g.call("fail")
+		g.emit("unreachable", nil)
+		g.emit("end", nil)
+		g.emit("local.get", 0)
+	}
+	return f
+}
@@ -0,0 +1,551 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"yal/ir"
+)
+
+const (
+	// Addresses below stackLimit never hold slots. 0 is NULL as well as the
+	// address of the empty string, memory being zeroed.
+	stackLimit = 8
+	stackSize  = 64 << 10
+	dataStart  = stackLimit + stackSize
+	pageSize   = 64 << 10
+)
+
+type genError struct {
+	error
+}
+
+type generator struct {
+	m    *ir.Module
+	data []byte
+	strs map[string]int64
+	used map[string]bool
+
+	// State of the fn being generated
+	f      *ir.Func
+	fn     *function
+	locals map[ir.Value]int
+	pos    map[*ir.Block]int
+	slots  map[*ir.Instr]int64
+	frame  int64
+	pc, fp int
+}
+
+// Writes a valid module in the WebAssembly binary format to w. It exports
+// its memory and main, which returns an i64 or nothing, and imports the fns
+// of the runtime it calls from the host module yal.
+func GenerateBinary(w io.Writer, m *ir.Module) error {
+	mod, err := compile(m)
+	if err != nil {
+		return err
+	}
+	return mod.writeBinary(w)
+}
+
+// Writes a valid module in the WebAssembly text format to w, the same one
+// GenerateBinary writes
+func GenerateText(w io.Writer, m *ir.Module) error {
+	mod, err := compile(m)
+	if err != nil {
+		return err
+	}
+	return mod.writeText(w)
+}
+
+// Values are held in one local each, ints, uints and chars as i64, floats
+// as f64, and bools, pointers and strings as i32. Slots are taken from a
+// stack in memory on entry to the fns allocating them.
+func compile(m *ir.Module) (mod *module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(genError)
+			if !ok {
+				panic(r)
+			}
+			err = e.error
+		}
+	}()
+
+	main := m.Func("main")
+	if main == nil {
+		return nil, fmt.Errorf("no main fn")
+	}
+	if len(main.Params) > 0 {
+		return nil, fmt.Errorf("main takes no params")
+	}
+
+	g := &generator{m: m, strs: map[string]int64{}, used: map[string]bool{}}
+	funcs := []*function{}
+	for _, f := range m.Funcs {
+		funcs = append(funcs, g.genFunc(f))
+	}
+	for _, name := range helpers {
+		if g.used[name] {
+			funcs = append(funcs, g.helper(name))
+		}
+	}
+
+	// Imports come first in the index space of fns
+	mod = &module{stack: dataStart, data: g.data}
+	for _, imp := range imports {
+		if g.used[imp.name] {
+			mod.funcs = append(mod.funcs, &function{name: runtimeName(imp.name), params: imp.params, imports: imp.name})
+		}
+	}
+	mod.funcs = append(mod.funcs, funcs...)
+	mod.pages = (dataStart + len(g.data) + pageSize - 1) / pageSize
+	return mod, nil
+}
+
+func (g *generator) fail(format string, args ...any) {
+	panic(genError{fmt.Errorf("fn %s: "+format, append([]any{g.f.Name}, args...)...)})
+}
+
+func valTypeOf(t ir.Type) valType {
+	switch {
+	case t.IsInteger():
+		return i64
+	case t == ir.Float:
+		return f64
+	}
+	return i32
+}
+
+// Returns the address of the record of string s in memory, its length as a
+// little endian u32 followed by its bytes. Strings are only ever made from
+// constants and are stored once each, equal strings having equal addresses.
+func (g *generator) str(s string) int64 {
+	if s == "" {
+		return 0
+	}
+	addr, ok := g.strs[s]
+	if !ok {
+		for len(g.data)%4 != 0 {
+			g.data = append(g.data, 0)
+		}
+		addr = int64(dataStart + len(g.data))
+		g.strs[s] = addr
+		g.data = binary.LittleEndian.AppendUint32(g.data, uint32(len(s)))
+		g.data = append(g.data, s...)
+	}
+	return addr
+}
+
+func (g *generator) emit(op string, arg any) {
+	g.fn.body = append(g.fn.body, instr{op, arg})
+}
+
+// Adds a local of type t to the fn being generated, returning its index
+func (g *generator) local(name string, t valType) int {
+	g.fn.locals = append(g.fn.locals, t)
+	g.fn.names = append(g.fn.names, name)
+	return len(g.fn.names) - 1
+}
+
+// Calls a fn of the runtime
+func (g *generator) call(name string) {
+	g.used[name] = true
+	g.emit("call", runtimeName(name))
+}
+
+// Fails with msg, which the host writes to stderr before exiting with 1
+func (g *generator) abort(msg string) {
+	g.emit("i32.const", g.str(msg))
+	g.call("fail")
+	g.emit("unreachable", nil)
+}
+
+// Checks the pointer on the stack that the load or store i goes through,
+// which fails with the position of i when it is null
+func (g *generator) nonNull(i *ir.Instr) {
+	msg := "null pointer dereference"
+	if i.Loc.Line > 0 {
+		msg = fmt.Sprintf("line %d column %d: %s", i.Loc.Line, i.Loc.Column, msg)
+	}
+	g.emit("i32.const", g.str(msg))
+	g.call("nonnull")
+}
+
+// Returns whether i defines a value
+func defines(i *ir.Instr) bool {
+	return !i.Op.IsTerminator() && i.Op != ir.OpStore && i.Typ != ir.Void
+}
+
+// Blocks are laid out in order, each one following the end of a block
+// nesting the blocks before it, so that branching to that block jumps
+// forward to it. Jumps backward set the pc local and branch to a loop
+// around all blocks, which starts with a br_table to the block of the pc.
+func (g *generator) genFunc(f *ir.Func) *function {
+	g.f = f
+	if f.HasDefers() {
+		g.fail("defer is not supported on wasm")
+	}
+	if f.HasInterfaces() {
+		g.fail("interfaces are not supported on wasm")
+	}
+	if f.HasResults() {
+		g.fail("results and recover are not supported on wasm")
+	}
+	if f.HasClosures() {
+		g.fail("closures are not supported on wasm")
+	}
+	if f.HasTasks() {
+		g.fail("tasks and channels are not supported on wasm")
+	}
+	g.fn = &function{name: f.Name}
+	g.locals, g.pos, g.slots = map[ir.Value]int{}, map[*ir.Block]int{}, map[*ir.Instr]int64{}
+	g.frame = 0
+	if f.Name == "main" {
+		g.fn.export = "main"
+	}
+
+	for _, p := range f.Params {
+		g.locals[p] = len(g.fn.names)
+		g.fn.params = append(g.fn.params, valTypeOf(p.Typ))
+		g.fn.names = append(g.fn.names, p.String())
+	}
+	if f.Ret != ir.Void {
+		g.fn.results = []valType{valTypeOf(f.Ret)}
+	}
+
+	for k, b := range f.Blocks {
+		g.pos[b] = k
+	}
+	loop := false
+	for _, b := range f.Blocks {
+		for _, i := range b.Instrs {
+			if defines(i) {
+				g.locals[i] = g.local(i.String(), valTypeOf(i.Typ))
+			}
+			if i.Op == ir.OpAlloca {
+				g.slots[i] = g.frame
+				g.frame += 8
+			}
+		}
+		for _, s := range b.Succs {
+			loop = loop || g.pos[s] <= g.pos[b]
+		}
+	}
+	if loop {
+		g.pc = g.local("pc", i32)
+	}
+	if g.frame > 0 {
+		g.fp = g.local("fp", i32)
+		g.prologue()
+	}
+
+	first := 1
+	if loop {
+		g.emit("loop", "dispatch")
+		first = 0
+	}
+	for k := len(f.Blocks) - 1; k >= first; k-- {
+		g.emit("block", f.Blocks[k].String())
+	}
+	if loop {
+		targets := []string{}
+		for _, b := range f.Blocks {
+			targets = append(targets, b.String())
+		}
+		g.emit("local.get", g.pc)
+		g.emit("br_table", append(targets, targets[0]))
+		g.emit("end", nil)
+	}
+
+	for k, b := range f.Blocks {
+		if k > 0 {
+			g.emit("end", nil)
+		}
+		for _, i := range b.Instrs {
+			if i.Op != ir.OpPhi {
+				g.genInstr(i)
+			}
+		}
+	}
+	if loop {
+		g.emit("end", nil)
+		g.emit("unreachable", nil)
+	}
+	return g.fn
+}
+
+// Takes the slots of the fn from the stack, failing when it overflows
+func (g *generator) prologue() {
+	g.emit("global.get", spGlobal)
+	g.emit("i32.const", g.frame)
+	g.emit("i32.sub", nil)
+	g.emit("local.tee", g.fp)
+	g.emit("global.set", spGlobal)
+	g.emit("local.get", g.fp)
+	g.emit("i32.const", int64(stackLimit))
+	g.emit("i32.lt_s", nil)
+	g.emit("if", "")
+	g.abort("stack overflow")
+	g.emit("end", nil)
+}
+
+func (g *generator) epilogue() {
+	if g.frame > 0 {
+		g.emit("local.get", g.fp)
+		g.emit("i32.const", g.frame)
+		g.emit("i32.add", nil)
+		g.emit("global.set", spGlobal)
+	}
+}
+
+// Pushes v on the operand stack
+func (g *generator) push(v ir.Value) {
+	c, ok := v.(*ir.Const)
+	switch {
+	case !ok:
+		g.emit("local.get", g.locals[v])
+	case c.Typ == ir.Float:
+		g.emit("f64.const", c.Float)
+	case c.Typ == ir.String:
+		g.emit("i32.const", g.str(c.Str))
+	case valTypeOf(c.Typ) == i32:
+		g.emit("i32.const", c.Int)
+	default:
+		g.emit("i64.const", c.Int)
+	}
+}
+
+// Copies the values of the phis of b coming from pred at once, pushing all
+// of them before setting the phis so that phis that are args of other ones
+// keep their value
+func (g *generator) copyPhis(pred *ir.Block, b *ir.Block) {
+	at := b.PredIndex(pred)
+	phis := b.Phis()
+	for _, phi := range phis {
+		g.push(phi.Args[at])
+	}
+	for j := len(phis) - 1; j >= 0; j-- {
+		g.emit("local.set", g.locals[phis[j]])
+	}
+}
+
+// Jumps from b to its successor s, falling through to s when it is next and
+// the jump is the last instruction of b
+func (g *generator) jump(b *ir.Block, s *ir.Block, last bool) {
+	g.copyPhis(b, s)
+	switch {
+	case g.pos[s] <= g.pos[b]:
+		g.emit("i32.const", int64(g.pos[s]))
+		g.emit("local.set", g.pc)
+		g.emit("br", "dispatch")
+	case !last || g.pos[s] != g.pos[b]+1:
+		g.emit("br", s.String())
+	}
+}
+
+var (
+	intOps = map[ir.Op]string{
+		ir.OpAdd: "i64.add", ir.OpSub: "i64.sub", ir.OpMul: "i64.mul",
+		ir.OpAnd: "i64.and", ir.OpOr: "i64.or", ir.OpXor: "i64.xor",
+	}
+	boolOps = map[ir.Op]string{
+		ir.OpAnd: "i32.and", ir.OpOr: "i32.or", ir.OpXor: "i32.xor",
+		ir.OpEq: "i32.eq", ir.OpNe: "i32.ne",
+	}
+	floatOps = map[ir.Op]string{
+		ir.OpAdd: "f64.add", ir.OpSub: "f64.sub", ir.OpMul: "f64.mul", ir.OpDiv: "f64.div",
+		ir.OpEq: "f64.eq", ir.OpNe: "f64.ne", ir.OpLt: "f64.lt", ir.OpLe: "f64.le", ir.OpGt: "f64.gt", ir.OpGe: "f64.ge",
+	}
+	signedOps = map[ir.Op]string{
+		ir.OpDiv: "i64.div_s", ir.OpRem: "i64.rem_s", ir.OpShl: "i64.shl", ir.OpShr: "i64.shr_s",
+		ir.OpEq: "i64.eq", ir.OpNe: "i64.ne", ir.OpLt: "i64.lt_s", ir.OpLe: "i64.le_s", ir.OpGt: "i64.gt_s", ir.OpGe: "i64.ge_s",
+	}
+	unsignedOps = map[ir.Op]string{
+		ir.OpDiv: "i64.div_u", ir.OpRem: "i64.rem_u", ir.OpShl: "i64.shl", ir.OpShr: "i64.shr_u",
+		ir.OpEq: "i64.eq", ir.OpNe: "i64.ne", ir.OpLt: "i64.lt_u", ir.OpLe: "i64.le_u", ir.OpGt: "i64.gt_u", ir.OpGe: "i64.ge_u",
+	}
+	loads  = map[valType]string{i32: "i32.load", i64: "i64.load", f64: "f64.load"}
+	stores = map[valType]string{i32: "i32.store", i64: "i64.store", f64: "f64.store"}
+)
+
+func (g *generator) genInstr(i *ir.Instr) {
+	switch {
+	case i.Op.IsBinary():
+		g.push(i.Args[0])
+		g.push(i.Args[1])
+		g.genBinary(i)
+		g.emit("local.set", g.locals[i])
+	case i.Op == ir.OpNot:
+		g.push(i.Args[0])
+		g.emit("i32.eqz", nil)
+		g.emit("local.set", g.locals[i])
+	case i.Op == ir.OpNeg && i.Typ == ir.Float:
+		g.push(i.Args[0])
+		g.emit("f64.neg", nil)
+		g.emit("local.set", g.locals[i])
+	case i.Op == ir.OpNeg:
+		g.emit("i64.const", int64(0))
+		g.push(i.Args[0])
+		g.emit("i64.sub", nil)
+		g.truncate(i.Typ)
+		g.emit("local.set", g.locals[i])
+	case i.Op.IsCompare():
+		g.push(i.Args[0])
+		g.push(i.Args[1])
+		g.emit(g.compareOp(i), nil)
+		g.emit("local.set", g.locals[i])
+	case i.Op == ir.OpAlloca:
+		g.emit("local.get", g.fp)
+		g.emit("i32.const", g.slots[i])
+		g.emit("i32.add", nil)
+		g.emit("local.tee", g.locals[i])
+		g.emit("i64.const", int64(0))
+		g.emit("i64.store", 0)
+	case i.Op == ir.OpLoad:
+		g.push(i.Args[0])
+		g.nonNull(i)
+		g.emit(loads[valTypeOf(i.Typ)], 0)
+		g.emit("local.set", g.locals[i])
+	case i.Op == ir.OpStore:
+		g.push(i.Args[0])
+		g.nonNull(i)
+		g.push(i.Args[1])
+		g.emit(stores[valTypeOf(i.Args[1].Type())], 0)
+	case i.Op == ir.OpCall:
+		g.genCall(i)
+	case i.Op == ir.OpJump:
+		g.jump(i.Block, i.Block.Succs[0], true)
+	case i.Op == ir.OpBranch:
+		then, els := i.Block.Succs[0], i.Block.Succs[1]
+		g.push(i.Args[0])
+		if len(then.Phis()) == 0 && g.pos[then] > g.pos[i.Block] {
+			g.emit("br_if", then.String())
+		} else {
+			g.emit("if", "")
+			g.jump(i.Block, then, false)
+			g.emit("end", nil)
+		}
+		g.jump(i.Block, els, true)
+	case i.Op == ir.OpRet:
+		if len(i.Args) > 0 {
+			g.push(i.Args[0])
+		}
+		g.epilogue()
+		g.emit("return", nil)
+	case i.Op == ir.OpUnreachable:
+		g.abort("unreachable code reached")
+	}
+}
+
+// Computes binary i of the two values on top of the operand stack
+func (g *generator) genBinary(i *ir.Instr) {
+	switch {
+	case i.Typ == ir.Float:
+		g.emit(floatOps[i.Op], nil)
+		return
+	case i.Typ == ir.Bool:
+		g.emit(boolOps[i.Op], nil)
+		return
+	}
+
+	// Divisions check their divisor and shifts their count in the runtime
+	// unless it is a constant needing no check
+	n, constant := int64(0), false
+	if c, ok := i.Args[1].(*ir.Const); ok {
+		n, constant = c.Int, true
+	}
+	ops := unsignedOps
+	if i.Typ.IsSigned() {
+		ops = signedOps
+	}
+	switch i.Op {
+	case ir.OpDiv, ir.OpRem:
+		if constant && n != 0 && n != -1 {
+			g.emit(ops[i.Op], nil)
+		} else {
+			g.call(ops[i.Op][len("i64."):])
+		}
+	case ir.OpShl, ir.OpShr:
+		if constant && uint64(n) < 64 {
+			g.emit(ops[i.Op], nil)
+		} else {
+			g.call(ops[i.Op][len("i64."):])
+		}
+	default:
+		g.emit(intOps[i.Op], nil)
+	}
+	g.truncate(i.Typ)
+}
+
+// Wraps the value on top of the operand stack around to the width of t
+func (g *generator) truncate(t ir.Type) {
+	if t == ir.Char {
+		g.emit("i64.const", int64(0xff))
+		g.emit("i64.and", nil)
+	}
+}
+
+func (g *generator) compareOp(i *ir.Instr) string {
+	t := i.Args[0].Type()
+	switch {
+	case t == ir.Float:
+		return floatOps[i.Op]
+	case t.IsSigned():
+		return signedOps[i.Op]
+	case t.IsInteger():
+		return unsignedOps[i.Op]
+	}
+	if op, ok := boolOps[i.Op]; ok && i.Op.IsCompare() {
+		return op
+	}
+	g.fail("comparing %s values with %s is not supported on wasm", t, i.Op)
+	return ""
+}
+
+func (g *generator) genCall(i *ir.Instr) {
+	callee := g.m.Func(i.Callee)
+	if callee == nil {
+		g.genBuiltin(i)
+		return
+	}
+
+	// Tail calls are plain calls, the tail call proposal not being
+	// supported by every runtime
+	for _, arg := range i.Args {
+		g.push(arg)
+	}
+	g.emit("call", callee.Name)
+	if defines(i) {
+		g.emit("local.set", g.locals[i])
+	}
+}
+
+// Prints the args of a call to print or panic with the fns of the host
+func (g *generator) genBuiltin(i *ir.Instr) {
+	if i.Callee == "panic" {
+		g.call("panic")
+	}
+	for j, arg := range i.Args {
+		if j > 0 {
+			g.call("print_space")
+		}
+		g.push(arg)
+
+		t := arg.Type()
+		switch {
+		case t.IsPointer():
+			g.call("print_ptr")
+		case t == ir.Int:
+			g.call("print_int")
+		default:
+			g.call("print_" + string(t))
+		}
+	}
+	g.call("print_newline")
+
+	if i.Callee == "panic" {
+		g.emit("i32.const", int64(1))
+		g.call("exit")
+		g.emit("unreachable", nil)
+	}
+}
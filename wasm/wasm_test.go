@@ -0,0 +1,216 @@
+package wasm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"yal/ir"
+	"yal/wasm"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/sys"
+	"yal/internal/backendtest"
+)
+
+// Builds src optimized at level and runs it, returning what it writes to
+// stdout and stderr and its exit code
+func run(t *testing.T, src string, level int) (string, string, int) {
+	return runModule(t, backendtest.Lower(t, src, level))
+}
+
+// Runs the binary module of m with a host module printing as the vm does
+func runModule(t *testing.T, m *ir.Module) (string, string, int) {
+	var bin bytes.Buffer
+	if err := wasm.GenerateBinary(&bin, m); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	var stdout, stderr strings.Builder
+	var w io.Writer = &stdout
+	print := func(s string) { io.WriteString(w, s) }
+	exit := func(code uint32) { panic(sys.NewExitError(code)) }
+	_, err := r.NewHostModuleBuilder("yal").
+		NewFunctionBuilder().WithFunc(func(v int64) { print(strconv.FormatInt(v, 10)) }).Export("print_int").
+		NewFunctionBuilder().WithFunc(func(v uint64) { print(strconv.FormatUint(v, 10)) }).Export("print_uint").
+		NewFunctionBuilder().WithFunc(func(v uint64) { print(string([]byte{byte(v)})) }).Export("print_char").
+		NewFunctionBuilder().WithFunc(func(v uint32) { print(strconv.FormatBool(v != 0)) }).Export("print_bool").
+		NewFunctionBuilder().WithFunc(func(v float64) { print(strconv.FormatFloat(v, 'g', -1, 64)) }).Export("print_float").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, addr uint32) {
+		print(str(m, addr))
+	}).Export("print_string").
+		NewFunctionBuilder().WithFunc(func(p uint32) {
+		if p == 0 {
+			print("null")
+		} else {
+			print("ptr")
+		}
+	}).Export("print_ptr").
+		NewFunctionBuilder().WithFunc(func() { print(" ") }).Export("print_space").
+		NewFunctionBuilder().WithFunc(func() { print("\n") }).Export("print_newline").
+		NewFunctionBuilder().WithFunc(func() { w = &stderr; print("panic: ") }).Export("panic").
+		NewFunctionBuilder().WithFunc(exit).Export("exit").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, msg uint32) {
+		stderr.WriteString(str(m, msg) + "\n")
+		exit(1)
+	}).Export("fail").
+		Instantiate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mod, err := r.Instantiate(ctx, bin.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := mod.ExportedFunction("main").Call(ctx)
+	var exitErr *sys.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return stdout.String(), stderr.String(), int(exitErr.ExitCode())
+	case err != nil:
+		t.Fatal(err)
+	}
+	code := 0
+	if len(results) > 0 {
+		code = int(results[0] & 0xff)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+// Reads the string whose record is at addr
+func str(m api.Module, addr uint32) string {
+	n, _ := m.Memory().ReadUint32Le(addr)
+	s, _ := m.Memory().Read(addr+4, n)
+	return string(s)
+}
+
+func TestRun(t *testing.T) {
+	backendtest.RunPrograms(t, 2, run)
+
+	t.Run("Test floats", func(t *testing.T) {
+		backendtest.ExpectSameAsVM(t, backendtest.Floats, 2, run)
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := map[string]string{
+		"Test panic":            `fn main() : void { print(1); panic("oops", 2); }`,
+		"Test division by zero": `fn div(a: int, b: int) : int { a / b } fn main() : int { return div(1, 0); }`,
+		"Test null pointer":     `fn main() : int { let p: *int = NULL; return *p; }`,
+		"Test stack overflow":   `fn f(n: int) : int { let x = n; let p = &x; return *p + f(n + 1); } fn main() : int { f(0) }`,
+	}
+	msgs := map[string]string{
+		"Test panic":            "panic: oops 2\n",
+		"Test division by zero": "division by zero\n",
+		"Test null pointer":     "line 1 column 46: null pointer dereference\n",
+		"Test stack overflow":   "stack overflow\n",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, stderr, code := run(t, src, 0)
+			if stderr != msgs[name] || code != 1 {
+				t.Errorf("expected %q and exit code 1, got %q and %d\n", msgs[name], stderr, code)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Test text", func(t *testing.T) {
+		var text strings.Builder
+		src := `fn main() : int { let n = 0; while (n < 3) { n++; } print(n); n }`
+		if err := wasm.GenerateText(&text, backendtest.Lower(t, src, 1)); err != nil {
+			t.Fatal(err)
+		}
+		want := `(module
+  (import "yal" "print_int" (func $yal.print_int (param i64)))
+  (import "yal" "print_newline" (func $yal.print_newline))
+  (memory (export "memory") 2)
+  (global $sp (mut i32) (i32.const 65544))
+
+  (func $main (export "main") (result i64)
+    (local $%0 i64) (local $%1 i32) (local $%2 i64) (local $pc i32)
+    loop $dispatch
+      block $b3
+        block $b2
+          block $b1
+            block $b0
+              local.get $pc
+              br_table $b0 $b1 $b2 $b3 $b0
+            end
+            i64.const 0
+            local.set $%0
+          end
+          local.get $%0
+          i64.const 3
+          i64.lt_s
+          local.set $%1
+          local.get $%1
+          br_if $b2
+          br $b3
+        end
+        local.get $%0
+        i64.const 1
+        i64.add
+        local.set $%2
+        local.get $%2
+        local.set $%0
+        i32.const 1
+        local.set $pc
+        br $dispatch
+      end
+      local.get $%0
+      call $yal.print_int
+      call $yal.print_newline
+      local.get $%0
+      return
+    end
+    unreachable
+  )
+)
+`
+		if text.String() != want {
+			t.Errorf("expected\n%s\ngot\n%s\n", want, text.String())
+		}
+	})
+
+	t.Run("Test swapping phis", func(t *testing.T) {
+		m, err := ir.Parse(`fn main(): int {
+b0:
+  jmp b1
+b1:
+  %0 = phi int [1, b0], [%1, b1]
+  %1 = phi int [2, b0], [%0, b1]
+  %2 = phi int [1, b0], [%3, b1]
+  %3 = add int %2, 1
+  %4 = lt int %3, 5
+  br %4, b1, b2
+b2:
+  %5 = sub int %0, %1
+  ret int %5
+}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, code := runModule(t, m); code != 1 {
+			t.Errorf("expected exit code 1, got %d\n", code)
+		}
+	})
+
+	t.Run("Test no main", func(t *testing.T) {
+		err := wasm.GenerateBinary(&bytes.Buffer{}, backendtest.Lower(t, `fn f() : void {}`, 0))
+		if err == nil || err.Error() != "no main fn" {
+			t.Errorf("expected an error, got %v\n", err)
+		}
+	})
+}